@@ -0,0 +1,194 @@
+package timedb
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// MaxBuckets is the largest number of buckets of an aggregation, so a
+// small bucket in a long range can't use all the memory.
+const MaxBuckets = 100000
+
+// ErrTooManyBuckets is returned when a range has more than MaxBuckets buckets.
+var ErrTooManyBuckets = errors.New("timeDB: too many buckets")
+
+// bucketCount returns the number of buckets of the range [start, end) or
+// ErrTooManyBuckets if there are more than MaxBuckets.
+func bucketCount(start, end time.Time, bucket time.Duration) (int, error) {
+	d := end.Sub(start)
+	if d <= 0 {
+		return 0, nil
+	}
+
+	n := d / bucket
+	if d%bucket != 0 {
+		n++
+	}
+	if n > MaxBuckets {
+		return 0, fmt.Errorf("%w: %d buckets of %v, the maximum is %d", ErrTooManyBuckets, n, bucket, MaxBuckets)
+	}
+	return int(n), nil
+}
+
+// AggregateFunc is how the points of a bucket are combined.
+type AggregateFunc int
+
+const (
+	AggAvg AggregateFunc = iota
+	AggSum
+	AggMin
+	AggMax
+	AggCount
+	AggLast
+)
+
+// FillPolicy is the value given to the buckets without points.
+type FillPolicy int
+
+const (
+	// FillNone omits the empty buckets.
+	FillNone FillPolicy = iota
+
+	// FillNull sets the empty buckets to NaN.
+	FillNull
+
+	// FillZero sets the empty buckets to zero.
+	FillZero
+
+	// FillPrevious repeats the value of the previous bucket.
+	FillPrevious
+
+	// FillLinear interpolates between the previous and the next bucket.
+	FillLinear
+)
+
+// Aggregate combines the points of each series of a numeric table in
+// buckets of the range [start, end). The empty buckets are filled
+// according to the policy so charts can receive a regular series, up
+// to MaxBuckets (see ErrTooManyBuckets).
+// If the table has a rollup built for the range with a resolution that
+// fits the buckets, the points are read from it (see AddRollup).
+func (db *DB) Aggregate(table string, start, end time.Time, bucket time.Duration, fn AggregateFunc, fill FillPolicy) ([]Series, error) {
+	return db.aggregate(table, start, end, bucket, fn, fill, "")
+}
+
+func (db *DB) aggregate(table string, start, end time.Time, bucket time.Duration, fn AggregateFunc, fill FillPolicy, filter string) ([]Series, error) {
+	if bucket <= 0 {
+		return nil, fmt.Errorf("timeDB: invalid bucket %v", bucket)
+	}
+	if fill != FillNone {
+		if _, err := bucketCount(start, end, bucket); err != nil {
+			return nil, err
+		}
+	}
+
+	// long ranges are read from the rollups if possible
+	if filter == "" {
+		if r, f, ok := db.routeAggregate(table, start, end, bucket, fn); ok {
+			table, fn = r.Table, f
+		}
+	}
+
+	series, err := db.series(table, start, end, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, s := range series {
+		series[i].Points = Fill(aggregate(s.Points, start, bucket, fn), start, end, bucket, fill)
+	}
+	return series, nil
+}
+
+// aggregate combines the points, that must be sorted by time, by bucket.
+func aggregate(points []Point, start time.Time, bucket time.Duration, fn AggregateFunc) []Point {
+	var result []Point
+	var count int
+
+	for _, p := range points {
+		t := start.Add(p.Time.Sub(start) / bucket * bucket)
+
+		n := len(result)
+		if n == 0 || !result[n-1].Time.Equal(t) {
+			if n > 0 && fn == AggAvg {
+				result[n-1].Value /= float64(count)
+			}
+			v := p.Value
+			if fn == AggCount {
+				v = 1
+			}
+			result = append(result, Point{Time: t, Value: v})
+			count = 1
+			continue
+		}
+
+		count++
+		last := &result[n-1]
+		switch fn {
+		case AggAvg, AggSum:
+			last.Value += p.Value
+		case AggMin:
+			last.Value = math.Min(last.Value, p.Value)
+		case AggMax:
+			last.Value = math.Max(last.Value, p.Value)
+		case AggCount:
+			last.Value++
+		case AggLast:
+			last.Value = p.Value
+		}
+	}
+
+	if n := len(result); n > 0 && fn == AggAvg {
+		result[n-1].Value /= float64(count)
+	}
+	return result
+}
+
+// Fill returns a point for each bucket of the range [start, end) taking
+// the value from points, that must be aligned to the buckets and sorted,
+// or from the fill policy if there is no point. With FillPrevious and
+// FillLinear the buckets before the first point and after the last one
+// are NaN. Only the first MaxBuckets buckets are returned.
+func Fill(points []Point, start, end time.Time, bucket time.Duration, fill FillPolicy) []Point {
+	if fill == FillNone {
+		return points
+	}
+
+	n := min((end.Sub(start)+bucket-1)/bucket, MaxBuckets)
+	result := make([]Point, 0, max(n, 0))
+
+	j := 0
+	for i := time.Duration(0); i < n; i++ {
+		t := start.Add(i * bucket)
+
+		for j < len(points) && points[j].Time.Before(t) {
+			j++
+		}
+
+		if j < len(points) && points[j].Time.Equal(t) {
+			result = append(result, points[j])
+			continue
+		}
+
+		v := math.NaN()
+		switch fill {
+		case FillZero:
+			v = 0
+		case FillPrevious:
+			if j > 0 {
+				v = points[j-1].Value
+			}
+		case FillLinear:
+			if j > 0 && j < len(points) {
+				prev, next := points[j-1], points[j]
+				f := float64(t.Sub(prev.Time)) / float64(next.Time.Sub(prev.Time))
+				v = prev.Value + (next.Value-prev.Value)*f
+			}
+		}
+		result = append(result, Point{Time: t, Value: v})
+	}
+
+	return result
+}
@@ -0,0 +1,55 @@
+package timedb
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAggregate(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for _, m := range []int{0, 1, 3} {
+		if err := db.InsertValue(start.Add(time.Duration(m)*time.Minute), "cpu", float64(m+1), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.InsertValue(start.Add(3*time.Minute), "cpu", 8, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		fn       AggregateFunc
+		fill     FillPolicy
+		expected []float64
+	}{
+		{AggAvg, FillNone, []float64{1, 2, 6}},
+		{AggSum, FillZero, []float64{1, 2, 0, 12, 0}},
+		{AggMax, FillPrevious, []float64{1, 2, 2, 8, 8}},
+		{AggCount, FillLinear, []float64{1, 1, 1.5, 2, math.NaN()}},
+		{AggMin, FillNull, []float64{1, 2, math.NaN(), 4, math.NaN()}},
+	}
+
+	for _, test := range tests {
+		series, err := db.Aggregate("cpu", start, start.Add(5*time.Minute), time.Minute, test.fn, test.fill)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(series) != 1 {
+			t.Fatalf("expected 1 series, got %d", len(series))
+		}
+
+		p := series[0].Points
+		if len(p) != len(test.expected) {
+			t.Fatalf("%d %d: expected %v, got %v", test.fn, test.fill, test.expected, p)
+		}
+
+		for i, v := range test.expected {
+			if p[i].Value != v && !(math.IsNaN(v) && math.IsNaN(p[i].Value)) {
+				t.Fatalf("%d %d: expected %v, got %v", test.fn, test.fill, test.expected, p)
+			}
+		}
+	}
+}
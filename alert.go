@@ -0,0 +1,119 @@
+package timedb
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AlertRule fires when more than Threshold records of the table containing
+// Filter are written within Window. For example, more than 10 lines
+// containing "panic" in 1 minute.
+type AlertRule struct {
+	Name string
+
+	// Table can be a pattern like "app-*" or "logs/**".
+	Table string
+
+	// Filter is the text that the records must contain. If it
+	// is empty all the records match.
+	Filter    string
+	Threshold int
+	Window    time.Duration
+
+	// Callback is called when the rule fires.
+	Callback func(Alert)
+
+	// Webhook is an url where the alert is posted as JSON.
+	Webhook string
+}
+
+// Alert is the notification of a rule that fired.
+type Alert struct {
+	Rule  string
+	Table string
+	Count int
+	Time  time.Time
+	Last  string
+}
+
+type alerter struct {
+	db    *DB
+	rule  AlertRule
+	mutex sync.Mutex
+	times []time.Time
+}
+
+// AddAlert registers an alert rule that is evaluated on every write.
+// After a rule fires it is reset and needs a new full window of
+// matches to fire again.
+func (db *DB) AddAlert(rule AlertRule) {
+	a := &alerter{rule: rule, db: db}
+	db.OnWrite(a.check)
+}
+
+func (a *alerter) check(table string, d DataPoint) {
+	rule := a.rule
+
+	if !matchTable(rule.Table, table) {
+		return
+	}
+
+	if rule.Filter != "" && !strings.Contains(d.Text, rule.Filter) {
+		return
+	}
+
+	a.mutex.Lock()
+
+	// discard the matches outside of the window
+	limit := d.Time.Add(-rule.Window)
+	i := 0
+	for i < len(a.times) && !a.times[i].After(limit) {
+		i++
+	}
+	a.times = append(a.times[i:], d.Time)
+
+	count := len(a.times)
+	fire := count > rule.Threshold
+	if fire {
+		a.times = nil
+	}
+
+	a.mutex.Unlock()
+
+	if !fire {
+		return
+	}
+
+	alert := Alert{Rule: rule.Name, Table: table, Count: count, Time: d.Time, Last: d.Text}
+
+	if rule.Callback != nil {
+		rule.Callback(alert)
+	}
+
+	if rule.Webhook != "" {
+		go a.post(alert)
+	}
+}
+
+func (a *alerter) post(alert Alert) {
+	b, err := json.Marshal(alert)
+	if err != nil {
+		return
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	res, err := client.Post(a.rule.Webhook, "application/json", bytes.NewReader(b))
+	if err != nil {
+		a.db.log().Warn("timedb: error posting alert", "rule", alert.Rule, "error", err)
+		return
+	}
+	res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		a.db.log().Warn("timedb: error posting alert", "rule", alert.Rule, "status", res.Status)
+	}
+}
@@ -0,0 +1,47 @@
+package timedb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAlert(t *testing.T) {
+	db := NewMemory()
+
+	var alerts []Alert
+	db.AddAlert(AlertRule{
+		Name:      "panics",
+		Table:     "app-*",
+		Filter:    "panic",
+		Threshold: 2,
+		Window:    time.Minute,
+		Callback:  func(a Alert) { alerts = append(alerts, a) },
+	})
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	writes := []struct {
+		sec  int
+		text string
+	}{
+		{0, "panic 1"},
+		{10, "ok"},
+		{70, "panic 2"}, // the first one is out of the window
+		{80, "panic 3"},
+		{90, "panic 4"}, // fires
+		{100, "panic 5"},
+	}
+
+	for _, w := range writes {
+		if err := db.Insert(start.Add(time.Duration(w.sec)*time.Second), "app-1", w.text); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(alerts) != 1 {
+		t.Fatalf("expected 1 alert, got %d", len(alerts))
+	}
+
+	if a := alerts[0]; a.Count != 3 || a.Last != "panic 4" || a.Rule != "panics" {
+		t.Fatalf("unexpected alert %+v", a)
+	}
+}
@@ -0,0 +1,85 @@
+package timedb
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// AnnotationsTable is the table where the annotations are stored.
+const AnnotationsTable = "_annotations"
+
+// Annotation marks a point in time or a time span, like a deploy, so
+// it can be shown over the charts.
+type Annotation struct {
+	Time time.Time
+
+	// End is the end of a time span. It is zero for points in time.
+	End time.Time `json:",omitempty"`
+
+	Title string
+	Text  string   `json:",omitempty"`
+	Tags  []string `json:",omitempty"`
+}
+
+// annotationRecord is how the annotations are stored in the table.
+type annotationRecord struct {
+	End   int64    `json:"end,omitempty"`
+	Title string   `json:"title"`
+	Text  string   `json:"text,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+// CreateAnnotation saves an annotation. The time is now if it is zero.
+func (db *DB) CreateAnnotation(a Annotation) error {
+	if a.Title == "" {
+		return fmt.Errorf("timeDB.CreateAnnotation: the title is required")
+	}
+
+	t := a.Time
+	if t.IsZero() {
+		t = db.now(AnnotationsTable)
+	}
+	if !a.End.IsZero() && a.End.Before(t) {
+		return fmt.Errorf("timeDB.CreateAnnotation: the end is before the time")
+	}
+
+	rec := annotationRecord{Title: a.Title, Text: a.Text, Tags: a.Tags}
+	if !a.End.IsZero() {
+		rec.End = a.End.Unix()
+	}
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return db.save(t, AnnotationsTable, string(b))
+}
+
+// ListAnnotations returns the annotations that start in the range
+// [start, end) and have all the tags.
+func (db *DB) ListAnnotations(start, end time.Time, tags ...string) ([]Annotation, error) {
+	var result []Annotation
+
+	err := db.scanRange(AnnotationsTable, start, end, "", func(d DataPoint) {
+		var rec annotationRecord
+		if err := json.Unmarshal([]byte(trimText(d.Text)), &rec); err != nil {
+			return
+		}
+
+		for _, tag := range tags {
+			if !slices.Contains(rec.Tags, tag) {
+				return
+			}
+		}
+
+		a := Annotation{Time: d.Time, Title: rec.Title, Text: rec.Text, Tags: rec.Tags}
+		if rec.End != 0 {
+			a.End = time.Unix(rec.End, 0)
+		}
+		result = append(result, a)
+	})
+
+	return result, err
+}
@@ -0,0 +1,40 @@
+package timedb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnnotations(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	if err := db.CreateAnnotation(Annotation{Time: start, Title: "deploy v1.2.3", Tags: []string{"deploy", "web"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateAnnotation(Annotation{Time: start.Add(time.Minute), End: start.Add(time.Hour), Title: "maintenance", Tags: []string{"web"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateAnnotation(Annotation{Time: start}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if err := db.CreateAnnotation(Annotation{Time: start, End: start.Add(-time.Hour), Title: "x"}); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	a, err := db.ListAnnotations(start, start.Add(time.Hour), "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 2 || a[0].Title != "deploy v1.2.3" || !a[0].End.IsZero() || !a[1].End.Equal(start.Add(time.Hour)) {
+		t.Fatalf("invalid annotations %v", a)
+	}
+
+	a, err = db.ListAnnotations(start, start.Add(time.Hour), "web", "deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 1 || a[0].Tags[0] != "deploy" {
+		t.Fatalf("invalid annotations %v", a)
+	}
+}
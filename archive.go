@@ -0,0 +1,463 @@
+package timedb
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrArchived is returned when writing to a month that has been archived.
+var ErrArchived = errors.New("timeDB: month archived")
+
+// the first entry of an archive lists the files that it contains
+// so they can be listed without decompressing the whole archive.
+const archiveIndex = "index"
+
+// Archive packs all the files of the month in a single tar.zst file
+// so historical data doesn't use millions of small files. Archived
+// data is queried as usual but can't be written. The current month
+// can't be archived.
+func (db *DB) Archive(month time.Time) error {
+	month = month.Local()
+	name := month.Format("2006-01")
+	if name == time.Now().Format("2006-01") {
+		return fmt.Errorf("timeDB.Archive: can't archive the current month")
+	}
+
+	if db.customLayout() {
+		return fmt.Errorf("timeDB.Archive: archives require the default layout")
+	}
+
+	unlock, err := db.lockMaintenance()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	dayList, err := db.days()
+	if err != nil {
+		return err
+	}
+
+	var files []string
+	for _, day := range dayList {
+		dir := db.getDir(day)
+		if !strings.HasPrefix(dir, name) {
+			continue
+		}
+
+		dirFiles, err := dayFiles(db.storage, dir)
+		if err != nil {
+			return err
+		}
+		files = append(files, dirFiles...)
+	}
+
+	if len(files) == 0 {
+		return nil
+	}
+
+	archive := archiveName(name)
+	if err := db.checkShadowed(archive); err != nil {
+		return fmt.Errorf("timeDB.Archive: %w", err)
+	}
+
+	db.closeFiles(func(p string) bool { return strings.HasPrefix(p, name) })
+
+	tmp := archive + ".tmp"
+	if err := db.writeArchive(tmp, files); err != nil {
+		db.storage.Remove(tmp)
+		return fmt.Errorf("timeDB.Archive: %v", err)
+	}
+
+	if err := db.storage.Rename(tmp, archive); err != nil {
+		return fmt.Errorf("timeDB.Archive: %v", err)
+	}
+
+	// now the archive has all the data. Ignore the errors of files
+	// that were already archived.
+	for _, f := range files {
+		if err := db.storage.Remove(f); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			db.log().Warn("timedb: error removing archived file", "file", f, "error", err)
+		}
+	}
+	for _, day := range dayList {
+		if dir := db.getDir(day); strings.HasPrefix(dir, name) {
+			removeDirs(db.storage, dir)
+		}
+	}
+
+	db.resetUsage()
+	db.log().Info("timedb: month archived", "archive", archive, "files", len(files))
+	return nil
+}
+
+// checkArchived returns ErrArchived if the file belongs to an archived
+// month. The local files would hide the archived ones.
+func (db *DB) checkArchived(name string) error {
+	if len(name) < 7 {
+		return nil
+	}
+	if _, err := fs.Stat(localStorage(db.storage), archiveName(name[:7])); err == nil {
+		return fmt.Errorf("%w: %s", ErrArchived, name)
+	}
+	return nil
+}
+
+// checkShadowed returns an error if the archive exists and a local data
+// file hides one of its entries, so archiving again would lose it.
+func (db *DB) checkShadowed(archive string) error {
+	local := localStorage(db.storage)
+	files, err := archiveStorage{storage: local}.index(archive)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	for _, f := range files {
+		if _, ok := tableFileName(partBase(path.Base(f))); !ok {
+			continue
+		}
+		if _, err := fs.Stat(local, f); err == nil {
+			return fmt.Errorf("%s is both local and in %s", f, archive)
+		}
+	}
+	return nil
+}
+
+func (db *DB) writeArchive(name string, files []string) error {
+	out, err := db.storage.Create(name)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	zw, err := zstd.NewWriter(out)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(zw)
+
+	index := strings.Join(files, "\n")
+	hdr := &tar.Header{Name: archiveIndex, Mode: 0644, Size: int64(len(index)), ModTime: time.Now()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(tw, index); err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := addToArchive(db.storage, tw, file); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+func addToArchive(s storage, tw *tar.Writer, name string) error {
+	f, err := s.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = f
+	size := info.Size()
+	if size == 0 {
+		// the size is unknown for some storages
+		b, err := io.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+		size = int64(len(b))
+	}
+
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: size, ModTime: info.ModTime()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tw, r)
+	return err
+}
+
+func archiveName(month string) string {
+	return month + ".tar.zst"
+}
+
+// archiveStorage reads the files that don't exist from the archive of the month.
+type archiveStorage struct {
+	storage
+	dicts   *dictionaries
+	entries *archiveEntries
+}
+
+// archiveEntries caches the files of the archives, so the files that are
+// not archived are not searched in them.
+type archiveEntries struct {
+	mutex    sync.Mutex
+	archives map[string]*archiveEntryList
+}
+
+type archiveEntryList struct {
+	// the size and the time of the archive, to read the index again
+	// if it is archived again
+	size    int64
+	modTime time.Time
+	files   map[string]bool
+}
+
+func (s archiveStorage) Open(name string) (fs.File, error) {
+	f, err := s.open(name)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) || !strings.HasSuffix(partBase(name), ".log") {
+		return f, err
+	}
+
+	// the day could be compressed
+	cf, cerr := openCompressed(fsFunc(s.open), name, s.dicts)
+	if cerr != nil {
+		if errors.Is(cerr, fs.ErrNotExist) {
+			return nil, err
+		}
+		return nil, cerr
+	}
+	return cf, nil
+}
+
+func (s archiveStorage) open(name string) (fs.File, error) {
+	f, err := s.storage.Open(name)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) || len(name) < 7 {
+		return f, err
+	}
+
+	archive := archiveName(name[:7])
+
+	// the entries can only be found reading the archive from the start
+	files, err := s.archiveFiles(archive)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		return nil, err
+	}
+	if !files[name] {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	a, err := s.openArchive(archive)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		return nil, err
+	}
+
+	for {
+		hdr, err := a.tar.Next()
+		if err == io.EOF {
+			a.Close()
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		if err != nil {
+			a.Close()
+			return nil, err
+		}
+
+		if hdr.Name == name {
+			a.info = hdr.FileInfo()
+			return a, nil
+		}
+	}
+}
+
+func (s archiveStorage) openArchive(name string) (*archiveFile, error) {
+	f, err := s.storage.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	zr, err := zstd.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &archiveFile{file: f, zstd: zr, tar: tar.NewReader(zr)}, nil
+}
+
+// archiveFiles returns the files contained in the archive.
+func (s archiveStorage) archiveFiles(name string) (map[string]bool, error) {
+	info, err := fs.Stat(s.storage, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.entries != nil {
+		s.entries.mutex.Lock()
+		e := s.entries.archives[name]
+		s.entries.mutex.Unlock()
+
+		if e != nil && e.size == info.Size() && e.modTime.Equal(info.ModTime()) {
+			return e.files, nil
+		}
+	}
+
+	index, err := s.index(name)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]bool, len(index))
+	for _, f := range index {
+		files[f] = true
+	}
+
+	if s.entries != nil {
+		s.entries.mutex.Lock()
+		if s.entries.archives == nil {
+			s.entries.archives = make(map[string]*archiveEntryList)
+		}
+		s.entries.archives[name] = &archiveEntryList{size: info.Size(), modTime: info.ModTime(), files: files}
+		s.entries.mutex.Unlock()
+	}
+	return files, nil
+}
+
+// index returns the files contained in the archive.
+func (s archiveStorage) index(name string) ([]string, error) {
+	a, err := s.openArchive(name)
+	if err != nil {
+		return nil, err
+	}
+	defer a.Close()
+
+	hdr, err := a.tar.Next()
+	if err != nil {
+		return nil, err
+	}
+	if hdr.Name != archiveIndex {
+		return nil, fmt.Errorf("timeDB: invalid archive %s", name)
+	}
+
+	var files []string
+	sc := bufio.NewScanner(a.tar)
+	for sc.Scan() {
+		files = append(files, sc.Text())
+	}
+	return files, sc.Err()
+}
+
+func (s archiveStorage) ReadDir(name string) ([]fs.DirEntry, error) {
+	local, err := s.storage.ReadDir(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	entries := make(map[string]fs.DirEntry)
+	for _, e := range local {
+		entries[e.Name()] = e
+	}
+
+	var archives []string
+	if name == "." {
+		for _, e := range local {
+			if !e.IsDir() && strings.HasSuffix(e.Name(), ".tar.zst") {
+				archives = append(archives, e.Name())
+			}
+		}
+	} else if len(name) >= 7 {
+		archives = append(archives, archiveName(name[:7]))
+	}
+
+	for _, a := range archives {
+		files, err := s.archiveFiles(a)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+
+		for f := range files {
+			rel := f
+			if name != "." {
+				if !strings.HasPrefix(f, name+"/") {
+					continue
+				}
+				rel = f[len(name)+1:]
+			}
+
+			child, isDir := rel, false
+			if i := strings.IndexByte(rel, '/'); i != -1 {
+				child, isDir = rel[:i], true
+			}
+
+			if _, ok := entries[child]; !ok {
+				entries[child] = fs.FileInfoToDirEntry(memInfo{name: child, dir: isDir})
+			}
+		}
+	}
+
+	if len(entries) == 0 && err != nil {
+		return nil, err
+	}
+
+	result := make([]fs.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, e)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name() < result[j].Name() })
+	return result, nil
+}
+
+// archiveFile is an entry being read from an archive.
+type archiveFile struct {
+	file fs.File
+	zstd *zstd.Decoder
+	tar  *tar.Reader
+	info fs.FileInfo
+}
+
+func (a *archiveFile) Read(p []byte) (int, error) {
+	return a.tar.Read(p)
+}
+
+func (a *archiveFile) Stat() (fs.FileInfo, error) {
+	return a.info, nil
+}
+
+func (a *archiveFile) Close() error {
+	a.zstd.Close()
+	return a.file.Close()
+}
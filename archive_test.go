@@ -0,0 +1,139 @@
+package timedb
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArchive(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2020, 1, 30, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 4; i++ {
+		if err := db.Insert(start.AddDate(0, 0, i), "logs", "v%d", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.Archive(start); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.storage.Open("2020-01-30/logs.log"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.storage.Open("2020-01.tar.zst"); err != nil {
+		t.Fatal(err)
+	}
+
+	scanner := db.Query("lo*", start, start.AddDate(0, 0, 3), 0, 0)
+	defer scanner.Close()
+
+	var got string
+	for scanner.Scan() {
+		got += scanner.Data().Text
+	}
+
+	if scanner.Error != nil {
+		t.Fatal(scanner.Error)
+	}
+
+	if got != " v0 v1 v2 v3" {
+		t.Fatalf("unexpected result %q", got)
+	}
+
+	dayList, err := db.days()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dayList) != 4 {
+		t.Fatalf("unexpected days %v", dayList)
+	}
+}
+
+func TestArchiveWrite(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2020, 1, 30, 10, 0, 0, 0, time.Local)
+	if err := db.Insert(start, "logs", "old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Archive(start); err != nil {
+		t.Fatal(err)
+	}
+
+	// writing would hide the archived file and archiving again lose it
+	if err := db.Insert(start.Add(time.Hour), "logs", "new"); !errors.Is(err, ErrArchived) {
+		t.Fatalf("expected ErrArchived, got %v", err)
+	}
+	if err := db.Archive(start); err != nil {
+		t.Fatal(err)
+	}
+
+	scanner := db.Query("logs", start, start.Add(2*time.Hour), 0, 0)
+	defer scanner.Close()
+
+	var got string
+	for scanner.Scan() {
+		got += scanner.Data().Text
+	}
+	if got != " old" {
+		t.Fatalf("unexpected result %q", got)
+	}
+}
+
+// countingStorage counts the times that the archives are opened.
+type countingStorage struct {
+	storage
+	opens *int
+}
+
+func (s countingStorage) Open(name string) (fs.File, error) {
+	if strings.HasSuffix(name, ".tar.zst") {
+		*s.opens++
+	}
+	return s.storage.Open(name)
+}
+
+func (s countingStorage) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(s.storage, name)
+}
+
+func TestArchiveMissing(t *testing.T) {
+	var opens int
+	db := newDB("", countingStorage{storage: newMemStorage(), opens: &opens})
+
+	start := time.Date(2020, 1, 30, 10, 0, 0, 0, time.Local)
+	if err := db.Insert(start, "logs", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Archive(start); err != nil {
+		t.Fatal(err)
+	}
+
+	// the index is read at most once and the files that are not in it
+	// are not searched in the archive
+	opens = 0
+	for i := 0; i < 3; i++ {
+		for _, name := range []string{"2020-01-30/logs.log.1", "2020-01-30/logs.stats", "2020-01-31/logs.log"} {
+			if _, err := db.storage.Open(name); !errors.Is(err, fs.ErrNotExist) {
+				t.Fatalf("%s: expected ErrNotExist, got %v", name, err)
+			}
+		}
+	}
+	if opens > 1 {
+		t.Fatalf("the archive was opened %d times", opens)
+	}
+
+	opens = 0
+	if _, err := db.storage.Open("2020-01-30/logs.log"); err != nil {
+		t.Fatal(err)
+	}
+	if opens != 1 {
+		t.Fatalf("the archive was opened %d times", opens)
+	}
+}
@@ -0,0 +1,358 @@
+package timedb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+const (
+	// arrowBatchSize is the default number of records of the record batches.
+	arrowBatchSize = 64 << 10
+
+	// arrowMaxBatchBytes is the size of the text after which a record batch
+	// is written, so the offsets of the text column don't overflow.
+	arrowMaxBatchBytes = 64 << 20
+)
+
+// ArrowContentType is the media type of Arrow IPC streams.
+const ArrowContentType = "application/vnd.apache.arrow.stream"
+
+// WriteArrow writes the records of the scanner as an Arrow IPC stream, so
+// analytics tools like pyarrow, polars or the arrow R package read them
+// without parsing text. The stream has a column "time", a timestamp in
+// seconds, and a column "text" and is written in record batches of up to
+// batchSize records, 65536 if it is zero.
+func (s *Scanner) WriteArrow(w io.Writer, batchSize int) error {
+	if batchSize <= 0 {
+		batchSize = arrowBatchSize
+	}
+
+	aw := &arrowWriter{w: w}
+	if err := aw.schema(); err != nil {
+		return err
+	}
+
+	var b arrowBatch
+	for s.Scan() {
+		d := s.Data()
+		b.add(d.Time.Unix(), strings.ToValidUTF8(trimText(d.Text), "�"))
+
+		if b.rows() == batchSize || len(b.text) >= arrowMaxBatchBytes {
+			if err := aw.batch(&b); err != nil {
+				return err
+			}
+			b.reset()
+		}
+	}
+	if s.Error != nil {
+		return s.Error
+	}
+
+	if b.rows() > 0 {
+		if err := aw.batch(&b); err != nil {
+			return err
+		}
+	}
+	return aw.end()
+}
+
+// arrowBatch are the columns of a record batch.
+type arrowBatch struct {
+	times   []int64
+	offsets []int32
+	text    []byte
+}
+
+func (b *arrowBatch) rows() int {
+	return len(b.times)
+}
+
+func (b *arrowBatch) add(t int64, text string) {
+	if len(b.offsets) == 0 {
+		b.offsets = append(b.offsets, 0)
+	}
+	b.times = append(b.times, t)
+	b.text = append(b.text, text...)
+	b.offsets = append(b.offsets, int32(len(b.text)))
+}
+
+func (b *arrowBatch) reset() {
+	b.times = b.times[:0]
+	b.offsets = b.offsets[:0]
+	b.text = b.text[:0]
+}
+
+// The values of the Arrow flatbuffers used.
+const (
+	arrowMetadataV5 = 4
+
+	arrowHeaderSchema      = 1
+	arrowHeaderRecordBatch = 3
+
+	arrowTypeUtf8      = 5
+	arrowTypeTimestamp = 10
+
+	arrowSecond = 0
+)
+
+// arrowWriter writes the messages of an Arrow IPC stream.
+type arrowWriter struct {
+	w io.Writer
+}
+
+func (a *arrowWriter) schema() error {
+	field := func(name string, typ int, t *fbTable) *fbTable {
+		return &fbTable{fields: []fbField{
+			{slot: 0, ref: name},
+			{slot: 1, size: 1, value: 0},
+			{slot: 2, size: 1, value: uint64(typ)},
+			{slot: 3, ref: t},
+			{slot: 5, ref: fbVector{}},
+		}}
+	}
+
+	timestamp := &fbTable{fields: []fbField{
+		{slot: 0, size: 2, value: arrowSecond},
+		{slot: 1, ref: "UTC"},
+	}}
+
+	schema := &fbTable{fields: []fbField{
+		{slot: 1, ref: fbVector{
+			field("time", arrowTypeTimestamp, timestamp),
+			field("text", arrowTypeUtf8, &fbTable{}),
+		}},
+	}}
+
+	return a.message(arrowHeaderSchema, schema, nil)
+}
+
+func (a *arrowWriter) batch(b *arrowBatch) error {
+	var body []byte
+	var buffers []byte
+
+	// the validity bitmaps are empty because there are no nulls
+	addBuffer := func(data []byte) {
+		buffers = binary.LittleEndian.AppendUint64(buffers, uint64(len(body)))
+		buffers = binary.LittleEndian.AppendUint64(buffers, uint64(len(data)))
+		body = append(body, data...)
+		body = append(body, make([]byte, pad8(len(body)))...)
+	}
+
+	times := make([]byte, 0, len(b.times)*8)
+	for _, t := range b.times {
+		times = binary.LittleEndian.AppendUint64(times, uint64(t))
+	}
+	offsets := make([]byte, 0, len(b.offsets)*4)
+	for _, o := range b.offsets {
+		offsets = binary.LittleEndian.AppendUint32(offsets, uint32(o))
+	}
+
+	addBuffer(nil)
+	addBuffer(times)
+	addBuffer(nil)
+	addBuffer(offsets)
+	addBuffer(b.text)
+
+	// a field node with the length and the null count of each column
+	var nodes []byte
+	for i := 0; i < 2; i++ {
+		nodes = binary.LittleEndian.AppendUint64(nodes, uint64(b.rows()))
+		nodes = binary.LittleEndian.AppendUint64(nodes, 0)
+	}
+
+	batch := &fbTable{fields: []fbField{
+		{slot: 0, size: 8, value: uint64(b.rows())},
+		{slot: 1, ref: fbStructs(nodes)},
+		{slot: 2, ref: fbStructs(buffers)},
+	}}
+
+	return a.message(arrowHeaderRecordBatch, batch, body)
+}
+
+// message writes an encapsulated message: a continuation marker, the
+// size of the metadata, the Message flatbuffer padded to 8 bytes and
+// the body.
+func (a *arrowWriter) message(headerType int, header *fbTable, body []byte) error {
+	msg := &fbTable{fields: []fbField{
+		{slot: 0, size: 2, value: arrowMetadataV5},
+		{slot: 1, size: 1, value: uint64(headerType)},
+		{slot: 2, ref: header},
+		{slot: 3, size: 8, value: uint64(len(body))},
+	}}
+
+	meta := fbEncode(msg)
+	meta = append(meta, make([]byte, pad8(len(meta)))...)
+
+	buf := make([]byte, 0, 8+len(meta)+len(body))
+	buf = binary.LittleEndian.AppendUint32(buf, 0xFFFFFFFF)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(meta)))
+	buf = append(buf, meta...)
+	buf = append(buf, body...)
+
+	if _, err := a.w.Write(buf); err != nil {
+		return fmt.Errorf("timeDB: error writing the arrow stream: %w", err)
+	}
+	return nil
+}
+
+// end writes the end of stream marker.
+func (a *arrowWriter) end() error {
+	if _, err := a.w.Write([]byte{0xFF, 0xFF, 0xFF, 0xFF, 0, 0, 0, 0}); err != nil {
+		return fmt.Errorf("timeDB: error writing the arrow stream: %w", err)
+	}
+	return nil
+}
+
+func pad8(n int) int {
+	return (8 - n%8) % 8
+}
+
+// The metadata of the Arrow messages are flatbuffers. The few tables
+// needed are written by hand front to back: each table is preceded by
+// its vtable and followed by the objects it references, so all the
+// offsets are positive as the format requires.
+
+// fbTable is a flatbuffers table.
+type fbTable struct {
+	fields []fbField
+}
+
+// fbField is a field of a table: a scalar of size bytes or, if ref is
+// not nil, an offset to a string (string), a table (*fbTable), a vector
+// of tables (fbVector) or a vector of structs (fbStructs).
+type fbField struct {
+	slot  int
+	size  int
+	value uint64
+	ref   interface{}
+}
+
+type fbVector []*fbTable
+
+// fbStructs is a vector of 16 byte structs, like the field nodes
+// and the buffers of a record batch.
+type fbStructs []byte
+
+// fbEncode returns the flatbuffer with the table as root.
+func fbEncode(root *fbTable) []byte {
+	var w fbWriter
+	w.buf = make([]byte, 4)
+	pos := w.object(root)
+	binary.LittleEndian.PutUint32(w.buf, uint32(pos))
+	return w.buf
+}
+
+type fbWriter struct {
+	buf []byte
+}
+
+// align pads the buffer until its length plus extra is a multiple of n.
+func (w *fbWriter) align(n, extra int) {
+	for (len(w.buf)+extra)%n != 0 {
+		w.buf = append(w.buf, 0)
+	}
+}
+
+// object writes the object and returns its position.
+func (w *fbWriter) object(o interface{}) int {
+	switch o := o.(type) {
+	case string:
+		w.align(4, 0)
+		pos := len(w.buf)
+		w.buf = binary.LittleEndian.AppendUint32(w.buf, uint32(len(o)))
+		w.buf = append(w.buf, o...)
+		w.buf = append(w.buf, 0)
+		return pos
+
+	case fbStructs:
+		// the structs have 8 byte fields
+		w.align(8, 4)
+		pos := len(w.buf)
+		w.buf = binary.LittleEndian.AppendUint32(w.buf, uint32(len(o)/16))
+		w.buf = append(w.buf, o...)
+		return pos
+
+	case fbVector:
+		w.align(4, 0)
+		pos := len(w.buf)
+		w.buf = binary.LittleEndian.AppendUint32(w.buf, uint32(len(o)))
+		w.buf = append(w.buf, make([]byte, 4*len(o))...)
+		for i, t := range o {
+			w.patch(pos+4+4*i, w.object(t))
+		}
+		return pos
+
+	case *fbTable:
+		return w.table(o)
+
+	default:
+		panic(fmt.Sprintf("invalid flatbuffer object %T", o))
+	}
+}
+
+func (w *fbWriter) table(t *fbTable) int {
+	// the fields are sorted by size after the offset to the vtable
+	// and the table starts at 4 modulo 8, so they are aligned
+	fields := slices.Clone(t.fields)
+	for i := range fields {
+		if fields[i].ref != nil {
+			fields[i].size = 4
+		}
+	}
+	slices.SortStableFunc(fields, func(a, b fbField) int {
+		return b.size - a.size
+	})
+
+	slots := 0
+	offsets := make([]int, len(fields))
+	size := 4
+	for i, f := range fields {
+		slots = max(slots, f.slot+1)
+		offsets[i] = size
+		size += f.size
+	}
+
+	w.align(2, 0)
+	vtable := len(w.buf)
+	vt := make([]uint16, 2+slots)
+	vt[0] = uint16(2 * len(vt))
+	vt[1] = uint16(size)
+	for i, f := range fields {
+		vt[2+f.slot] = uint16(offsets[i])
+	}
+	for _, v := range vt {
+		w.buf = binary.LittleEndian.AppendUint16(w.buf, v)
+	}
+
+	w.align(8, 4)
+	pos := len(w.buf)
+	w.buf = binary.LittleEndian.AppendUint32(w.buf, uint32(pos-vtable))
+
+	for _, f := range fields {
+		switch f.size {
+		case 1:
+			w.buf = append(w.buf, byte(f.value))
+		case 2:
+			w.buf = binary.LittleEndian.AppendUint16(w.buf, uint16(f.value))
+		case 4:
+			w.buf = binary.LittleEndian.AppendUint32(w.buf, uint32(f.value))
+		case 8:
+			w.buf = binary.LittleEndian.AppendUint64(w.buf, f.value)
+		}
+	}
+
+	for i, f := range fields {
+		if f.ref != nil {
+			w.patch(pos+offsets[i], w.object(f.ref))
+		}
+	}
+	return pos
+}
+
+// patch sets the offset at pos to the object at target.
+func (w *fbWriter) patch(pos, target int) {
+	binary.LittleEndian.PutUint32(w.buf[pos:], uint32(target-pos))
+}
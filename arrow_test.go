@@ -0,0 +1,136 @@
+package timedb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// fbRead reads the flatbuffers of the test following the offsets.
+type fbRead struct {
+	buf []byte
+}
+
+func (r fbRead) u32(pos int) int { return int(binary.LittleEndian.Uint32(r.buf[pos:])) }
+
+// field returns the position of the field of the table or -1.
+func (r fbRead) field(table, slot int) int {
+	vtable := table - int(int32(binary.LittleEndian.Uint32(r.buf[table:])))
+	if vtable%2 != 0 || table%4 != 0 {
+		panic("unaligned table")
+	}
+	size := int(binary.LittleEndian.Uint16(r.buf[vtable:]))
+	if 4+2*slot >= size {
+		return -1
+	}
+	off := int(binary.LittleEndian.Uint16(r.buf[vtable+4+2*slot:]))
+	if off == 0 {
+		return -1
+	}
+	return table + off
+}
+
+func (r fbRead) ref(table, slot int) int {
+	p := r.field(table, slot)
+	return p + r.u32(p)
+}
+
+func (r fbRead) str(pos int) string {
+	n := r.u32(pos)
+	return string(r.buf[pos+4 : pos+4+n])
+}
+
+func readArrow(t *testing.T, data []byte) ([]string, []int64, []string) {
+	var names []string
+	var times []int64
+	var texts []string
+
+	for {
+		if binary.LittleEndian.Uint32(data) != 0xFFFFFFFF {
+			t.Fatal("missing continuation")
+		}
+		size := int(binary.LittleEndian.Uint32(data[4:]))
+		if size == 0 {
+			return names, times, texts
+		}
+		if size%8 != 0 {
+			t.Fatalf("unaligned metadata %d", size)
+		}
+
+		r := fbRead{buf: data[8 : 8+size]}
+		msg := r.u32(0)
+		if v := binary.LittleEndian.Uint16(r.buf[r.field(msg, 0):]); v != 4 {
+			t.Fatalf("unexpected version %d", v)
+		}
+		header := r.ref(msg, 2)
+		bodyLen := int(binary.LittleEndian.Uint64(r.buf[r.field(msg, 3):]))
+		body := data[8+size : 8+size+bodyLen]
+
+		switch typ := r.buf[r.field(msg, 1)]; typ {
+		case 1:
+			fields := r.ref(header, 1)
+			for i := 0; i < r.u32(fields); i++ {
+				p := fields + 4 + 4*i
+				f := p + r.u32(p)
+				names = append(names, r.str(r.ref(f, 0)))
+				if r.field(f, 5) == -1 {
+					t.Fatal("missing children")
+				}
+			}
+
+		case 3:
+			rows := int(binary.LittleEndian.Uint64(r.buf[r.field(header, 0):]))
+			buffers := r.ref(header, 2)
+			if r.u32(buffers) != 5 || (buffers+4)%8 != 0 {
+				t.Fatalf("unexpected buffers")
+			}
+			buffer := func(i int) []byte {
+				p := buffers + 4 + 16*i
+				off := binary.LittleEndian.Uint64(r.buf[p:])
+				n := binary.LittleEndian.Uint64(r.buf[p+8:])
+				if off%8 != 0 {
+					t.Fatalf("unaligned buffer %d", i)
+				}
+				return body[off : off+n]
+			}
+
+			tb, ob, text := buffer(1), buffer(3), buffer(4)
+			for i := 0; i < rows; i++ {
+				times = append(times, int64(binary.LittleEndian.Uint64(tb[i*8:])))
+				start, end := binary.LittleEndian.Uint32(ob[i*4:]), binary.LittleEndian.Uint32(ob[i*4+4:])
+				texts = append(texts, string(text[start:end]))
+			}
+
+		default:
+			t.Fatalf("unexpected message %d", typ)
+		}
+
+		data = data[8+size+bodyLen:]
+	}
+}
+
+func TestWriteArrow(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 5; i++ {
+		db.Insert(start.Add(time.Duration(i)*time.Second), "nginx", "GET /%d", i)
+	}
+
+	s := db.Query("nginx", start, start.Add(time.Hour), 0, 0)
+	defer s.Close()
+
+	var buf bytes.Buffer
+	if err := s.WriteArrow(&buf, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	names, times, texts := readArrow(t, buf.Bytes())
+	if len(names) != 2 || names[0] != "time" || names[1] != "text" {
+		t.Fatalf("unexpected fields %v", names)
+	}
+	if len(texts) != 5 || texts[4] != "GET /4" || times[4] != start.Unix()+4 {
+		t.Fatalf("unexpected records %v %v", times, texts)
+	}
+}
@@ -0,0 +1,209 @@
+package timedb
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrQueueFull is returned by Save and Insert in async mode when the
+// queue is full and AsyncOptions.DropWhenFull is set.
+var ErrQueueFull = errors.New("timeDB: write queue full")
+
+const (
+	defaultQueueSize = 10000
+	defaultMaxBatch  = 1000
+)
+
+// AsyncOptions configure the async write mode.
+type AsyncOptions struct {
+	// QueueSize is the maximum number of records waiting to be written.
+	QueueSize int
+
+	// MaxBatch is the maximum number of records written at once.
+	MaxBatch int
+
+	// DropWhenFull makes Save return ErrQueueFull instead of waiting
+	// when the queue is full.
+	DropWhenFull bool
+}
+
+type asyncWriter struct {
+	db     *DB
+	opts   AsyncOptions
+	queue  chan asyncItem
+	errors chan error
+	done   chan struct{}
+}
+
+// asyncItem is a record or a flush request.
+type asyncItem struct {
+	record batchRecord
+	flush  chan error
+
+	// written, if not nil, receives the error of the write of the record.
+	written chan error
+}
+
+// StartAsync enables the async write mode: Save and Insert validate the
+// record and add it to a queue, and a goroutine writes the queued records
+// in batches. The errors of the writes are sent to the Errors channel.
+// Flush waits until the queued records are written and Close drains
+// the queue and returns to the synchronous mode.
+func (db *DB) StartAsync(o AsyncOptions) error {
+	if o.QueueSize <= 0 {
+		o.QueueSize = defaultQueueSize
+	}
+	if o.MaxBatch <= 0 {
+		o.MaxBatch = defaultMaxBatch
+	}
+
+	db.asyncMutex.Lock()
+	defer db.asyncMutex.Unlock()
+
+	if db.async != nil {
+		return fmt.Errorf("timeDB.StartAsync: already started")
+	}
+
+	a := &asyncWriter{
+		db:     db,
+		opts:   o,
+		queue:  make(chan asyncItem, o.QueueSize),
+		errors: make(chan error, 100),
+		done:   make(chan struct{}),
+	}
+	db.async = a
+
+	go a.run()
+	return nil
+}
+
+// Errors returns the channel where the errors of the async writes are sent.
+// If they are not received they are discarded. It returns nil if the
+// async mode is not enabled.
+func (db *DB) Errors() <-chan error {
+	db.asyncMutex.RLock()
+	defer db.asyncMutex.RUnlock()
+
+	if db.async == nil {
+		return nil
+	}
+	return db.async.errors
+}
+
+// Flush waits until the records queued in async mode are written. It returns
+// the error of the last write, if any. In synchronous mode the records are
+// already written and it does nothing.
+func (db *DB) Flush() error {
+	db.asyncMutex.RLock()
+	a := db.async
+	if a == nil {
+		db.asyncMutex.RUnlock()
+		return nil
+	}
+
+	c := make(chan error, 1)
+	a.queue <- asyncItem{flush: c}
+	db.asyncMutex.RUnlock()
+
+	return <-c
+}
+
+// SetFlushOnQuery makes the queries flush the async queue before reading,
+// so the records saved by the same process are always visible.
+func (db *DB) SetFlushOnQuery(v bool) {
+	db.flushOnQuery.Store(v)
+}
+
+// stopAsync writes the queued records and stops the async mode.
+func (db *DB) stopAsync() {
+	db.asyncMutex.Lock()
+	a := db.async
+	db.async = nil
+	db.asyncMutex.Unlock()
+
+	if a != nil {
+		close(a.queue)
+		<-a.done
+	}
+}
+
+// enqueue adds the record to the queue if the async mode is enabled.
+// If written is not nil it receives the error of the write.
+func (db *DB) enqueue(r batchRecord, written chan error) (bool, error) {
+	db.asyncMutex.RLock()
+	defer db.asyncMutex.RUnlock()
+
+	a := db.async
+	if a == nil {
+		return false, nil
+	}
+
+	item := asyncItem{record: r, written: written}
+
+	if a.opts.DropWhenFull {
+		select {
+		case a.queue <- item:
+			return true, nil
+		default:
+			db.metrics.writeErrors.Add(1)
+			return true, ErrQueueFull
+		}
+	}
+
+	a.queue <- item
+	return true, nil
+}
+
+func (a *asyncWriter) run() {
+	defer close(a.done)
+
+	for item := range a.queue {
+		var records []batchRecord
+		var flushes, written []chan error
+
+		add := func(item asyncItem) {
+			if item.flush != nil {
+				flushes = append(flushes, item.flush)
+			} else {
+				records = append(records, item.record)
+				if item.written != nil {
+					written = append(written, item.written)
+				}
+			}
+		}
+
+		add(item)
+
+		// take what is already queued
+	drain:
+		for len(records) < a.opts.MaxBatch {
+			select {
+			case item, ok := <-a.queue:
+				if !ok {
+					break drain
+				}
+				add(item)
+			default:
+				break drain
+			}
+		}
+
+		var err error
+		if len(records) > 0 {
+			if err = a.db.writeRecords(records); err != nil {
+				select {
+				case a.errors <- err:
+				default:
+				}
+				a.db.log().Warn("timedb: async write error", "records", len(records), "error", err)
+			}
+		}
+
+		for _, c := range written {
+			c <- err
+		}
+		for _, c := range flushes {
+			c <- err
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package timedb
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAsync(t *testing.T) {
+	db := NewMemory()
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+
+	if err := db.StartAsync(AsyncOptions{MaxBatch: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.StartAsync(AsyncOptions{}); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	for i := 0; i < 100; i++ {
+		if err := db.Insert(start.Add(time.Duration(i)*time.Second), "log", "v%d", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// invalid records are rejected before being queued
+	if err := db.Insert(start, "../log", "x"); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	count := func() int {
+		s := db.Query("log", start, start.Add(time.Hour), 0, 0)
+		defer s.Close()
+
+		n := 0
+		for s.Scan() {
+			n++
+		}
+		return n
+	}
+
+	if n := count(); n != 100 {
+		t.Fatalf("expected 100 records, got %d", n)
+	}
+
+	// the errors of the writes are sent to the channel
+	db.SetQuota(Quota{MaxBytes: 1})
+	db.Insert(start, "log", "over quota")
+
+	select {
+	case err := <-db.Errors():
+		if !errors.Is(err, ErrQuotaExceeded) {
+			t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected an error")
+	}
+
+	db.SetQuota(Quota{})
+	db.Insert(start.Add(time.Hour), "log", "last")
+
+	// close drains the queue
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if db.Errors() != nil {
+		t.Fatal("the async mode should be stopped")
+	}
+
+	s := db.Query("log", start.Add(time.Hour), start.Add(time.Hour), 0, 0)
+	defer s.Close()
+	if !s.Scan() || s.Data().Text != " last" {
+		t.Fatal("expected the last record")
+	}
+}
+
+func TestAsyncQueueFull(t *testing.T) {
+	db := NewMemory()
+
+	// block the writer so the queue is not emptied
+	release := make(chan struct{})
+	db.OnWrite(func(table string, d DataPoint) {
+		<-release
+	})
+
+	db.StartAsync(AsyncOptions{QueueSize: 1, DropWhenFull: true})
+	defer db.Close()
+
+	var err error
+	for i := 0; i < 10 && err == nil; i++ {
+		err = db.Save("log", "a")
+	}
+
+	close(release)
+
+	if !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+}
+
+func TestFlushOnQuery(t *testing.T) {
+	db := NewMemory()
+	db.StartAsync(AsyncOptions{})
+	defer db.Close()
+
+	db.SetFlushOnQuery(true)
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 100; i++ {
+		db.Insert(start, "log", "v%d", i)
+
+		s := db.Query("log", start, start, 0, 0)
+		n := 0
+		for s.Scan() {
+			n++
+		}
+		s.Close()
+
+		if n != i+1 {
+			t.Fatalf("expected %d records, got %d", i+1, n)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package timedb
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// Backfill inserts large historical ranges of a table. The records are
+// appended directly to the files of their days through a buffer, without
+// the locking and the checks of each Save, and the stats and indexes of
+// the days are built at the end. A backfill must not be used concurrently
+// and the days that it writes should not be written at the same time.
+type Backfill struct {
+	db    *DB
+	table string
+	opts  TableOptions
+	name  string
+	part  int
+	size  int64
+	file  io.WriteCloser
+	w     *bufio.Writer
+	last  time.Time
+	days  []time.Time
+	err   error
+}
+
+// Backfill starts a backfill of the table. The records must be inserted
+// sorted by time and are not visible until they are flushed, at the latest
+// when the backfill is closed. The write hooks and the quotas are applied
+// but not the clock checks and the observers.
+func (db *DB) Backfill(table string) (*Backfill, error) {
+	if err := validTable(table); err != nil {
+		return nil, err
+	}
+
+	o := db.TableOptions(table)
+	if o.Sequence {
+		return nil, fmt.Errorf("timeDB.Backfill: tables with sequence numbers are not supported")
+	}
+
+	return &Backfill{db: db, table: table, opts: o}, nil
+}
+
+// Insert adds a record to the backfill.
+func (b *Backfill) Insert(t time.Time, data string, v ...interface{}) error {
+	if b.err != nil {
+		return b.err
+	}
+
+	if t.Before(b.last) {
+		return fmt.Errorf("timeDB.Backfill: the records must be sorted: %s is before %s", t.Format(time.RFC3339), b.last.Format(time.RFC3339))
+	}
+
+	db := b.db
+	data, stored, ok, err := db.prepare(t, b.table, data, v...)
+	if err != nil || !ok {
+		return err
+	}
+
+	line := timeField(t, 0) + " " + stored + "\n"
+
+	if err := db.checkQuota(b.table, int64(len(line))); err != nil {
+		db.metrics.writeErrors.Add(1)
+		return err
+	}
+
+	if name := db.getTablePath(t, b.table); name != b.name {
+		if err := b.openDay(t, name); err != nil {
+			return b.fail(err)
+		}
+	} else if b.opts.MaxFileSize > 0 && b.size > db.headerSize() && b.size+int64(len(line)) > b.opts.MaxFileSize {
+		if err := b.openPart(b.part + 1); err != nil {
+			return b.fail(err)
+		}
+	}
+
+	// the buffer is only written at the end of a line, so the queries
+	// running meanwhile don't read a partial record. A line larger than
+	// the buffer is written at once.
+	if b.w.Buffered() > 0 && b.w.Available() < len(line) {
+		err = b.w.Flush()
+	}
+
+	var n int
+	if err == nil {
+		n, err = b.w.Write([]byte(line))
+	}
+	if err != nil {
+		db.metrics.writeErrors.Add(1)
+		return b.fail(diskFullError(fmt.Errorf("timeDB: error writing data %w", err)))
+	}
+
+	b.last = t
+	b.size += int64(n)
+
+	db.metrics.writes.Add(1)
+	db.metrics.bytesWritten.Add(int64(n))
+	db.addUsage(b.table, b.name, int64(n))
+	if c := db.recent.Load(); c != nil {
+		c.add(b.table, []byte(line))
+	}
+	return nil
+}
+
+// fail stops the backfill after an error writing.
+func (b *Backfill) fail(err error) error {
+	b.err = err
+	b.db.notifyDiskFull(err)
+	return err
+}
+
+// Flush writes the buffered records.
+func (b *Backfill) Flush() error {
+	if b.w == nil {
+		return b.err
+	}
+	if err := b.w.Flush(); err != nil {
+		return b.fail(diskFullError(fmt.Errorf("timeDB: error writing data %w", err)))
+	}
+	return b.err
+}
+
+// openDay starts writing the file of a new day.
+func (b *Backfill) openDay(t time.Time, name string) error {
+	if err := b.closeFile(); err != nil {
+		return err
+	}
+
+	b.name = name
+	b.days = append(b.days, t)
+
+	part := 0
+	if b.opts.MaxFileSize > 0 {
+		part = lastPart(b.db.storage, name)
+	}
+	return b.openPart(part)
+}
+
+func (b *Backfill) openPart(part int) error {
+	if err := b.closeFile(); err != nil {
+		return err
+	}
+
+	db := b.db
+	p := partName(b.name, part)
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	// the file can't be written by the DB at the same time
+	db.closeFile(b.name)
+
+	if err := db.checkArchived(p); err != nil {
+		db.metrics.writeErrors.Add(1)
+		return err
+	}
+
+	if err := db.decompressFile(p); err != nil {
+		db.metrics.writeErrors.Add(1)
+		return diskFullError(fmt.Errorf("timeDB: error openning file %s: %w", p, err))
+	}
+
+	// a crash could have left a partial record at the end
+	if err := db.repairTail(p); err != nil {
+		db.metrics.writeErrors.Add(1)
+		return diskFullError(fmt.Errorf("timeDB: error openning file %s: %w", p, err))
+	}
+
+	f, err := db.storage.Append(p)
+	if err != nil {
+		db.metrics.writeErrors.Add(1)
+		return diskFullError(fmt.Errorf("timeDB: error openning file %s: %w", p, err))
+	}
+
+	b.size = 0
+	if info, err := fs.Stat(localStorage(db.storage), p); err == nil {
+		b.size = info.Size()
+	}
+
+	n, err := db.writeHeader(f, b.size)
+	if err != nil {
+		f.Close()
+		db.metrics.writeErrors.Add(1)
+		return diskFullError(fmt.Errorf("timeDB: error writing file %s: %w", p, err))
+	}
+	b.size += int64(n)
+	db.addFileUsage(b.name, int64(n))
+
+	b.part = part
+	b.file = f
+	b.w = bufio.NewWriterSize(f, 1<<20)
+	return nil
+}
+
+func (b *Backfill) closeFile() error {
+	if b.file == nil {
+		return nil
+	}
+
+	err := b.w.Flush()
+	if e := b.file.Close(); err == nil {
+		err = e
+	}
+	b.file = nil
+	b.w = nil
+
+	if err != nil {
+		return diskFullError(fmt.Errorf("timeDB: error writing data %w", err))
+	}
+	return nil
+}
+
+// Close writes the buffered records and builds the stats of the days
+// written, and their full text indexes and bloom filters if they have.
+func (b *Backfill) Close() error {
+	if err := b.closeFile(); err != nil {
+		return b.fail(err)
+	}
+	if b.err != nil {
+		return b.err
+	}
+
+	db := b.db
+	encrypted := db.encrypted()
+	for _, day := range b.days {
+		if _, err := db.DayStats(day, b.table); err != nil {
+			return err
+		}
+
+		if b.opts.FullText && !encrypted {
+			if err := db.BuildIndex(day, b.table); err != nil {
+				return err
+			}
+		}
+
+		name := db.getTablePath(day, b.table)
+		if _, err := fs.Stat(db.storage, bloomFile(name)); err == nil && !encrypted {
+			if err := db.BuildBloom(day, b.table); err != nil {
+				return err
+			}
+		}
+	}
+
+	b.days = nil
+	return nil
+}
@@ -0,0 +1,119 @@
+package timedb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackfill(t *testing.T) {
+	dir := t.TempDir()
+	db := New(dir)
+
+	if err := db.SetTableOptions("old", TableOptions{FullText: true, MaxFileSize: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+
+	b, err := db.Backfill("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3*24; i++ {
+		if err := b.Insert(start.Add(time.Duration(i)*time.Hour), "request %d ok", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := b.Insert(start, "late"); err == nil {
+		t.Fatal("expected an error inserting unsorted records")
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first two days
+	if n := countRecords(t, db, "old", start); n != 14+24 {
+		t.Fatalf("expected 38 records, got %d", n)
+	}
+
+	st, err := db.DayStats(start.AddDate(0, 0, 1), "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Count != 24 || !st.Sorted {
+		t.Fatalf("invalid stats %+v", st)
+	}
+
+	day := filepath.Join(dir, "2020-01-02")
+	for _, f := range []string{"old.stats", "old.idx", "old.log.1"} {
+		if _, err := os.Stat(filepath.Join(day, f)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := db.Search("old", "request 20", start, start.AddDate(0, 0, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 1 {
+		t.Fatalf("expected 1 record, got %v", r)
+	}
+}
+
+func TestBackfillWholeLines(t *testing.T) {
+	dir := t.TempDir()
+	db := New(dir)
+
+	b, err := db.Backfill("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	name := filepath.Join(dir, "2020-01-01", "old.log")
+	text := strings.Repeat("x", 999)
+
+	// the lines written while the backfill runs are complete
+	var flushes int
+	var size int64
+	for i := 0; i < 3000; i++ {
+		if err := b.Insert(start, "%d %s", i, text); err != nil {
+			t.Fatal(err)
+		}
+
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() == size {
+			continue
+		}
+		size = info.Size()
+		flushes++
+
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		last := make([]byte, 1)
+		_, err = f.ReadAt(last, size-1)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if last[0] != '\n' {
+			t.Fatalf("partial line at %d", size)
+		}
+	}
+
+	if flushes < 2 {
+		t.Fatalf("expected several flushes, got %d", flushes)
+	}
+}
@@ -0,0 +1,67 @@
+package timedb
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// backup freezes the files of the database between BeginBackup and EndBackup.
+type backup struct {
+	active atomic.Bool
+
+	// gate is held by the maintenance tasks while they run and by the
+	// backup while it lasts.
+	gate sync.RWMutex
+}
+
+// BeginBackup prepares the files of the database to be copied by an external
+// tool, like rsync, restic or a ZFS snapshot. It writes the records queued in
+// async mode, syncs the files being written to disk and, until EndBackup is
+// called, waits for the maintenance tasks that would replace or delete files
+// (retention, compression, archiving, merges...) and doesn't start new parts
+// of the tables with MaxFileSize. Records can still be written, but they are
+// only appended so the copy is consistent up to some point in time. Writes
+// that need to delete old days because of a quota wait too.
+func (db *DB) BeginBackup() error {
+	if !db.backup.active.CompareAndSwap(false, true) {
+		return fmt.Errorf("timeDB.BeginBackup: a backup is already running")
+	}
+
+	if err := db.Flush(); err != nil {
+		db.backup.active.Store(false)
+		return err
+	}
+
+	// wait for the running tasks
+	db.backup.gate.Lock()
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	for _, w := range db.allWriters() {
+		if w.file == nil {
+			continue
+		}
+		if err := syncFile(w.file); err != nil {
+			db.backup.gate.Unlock()
+			db.backup.active.Store(false)
+			return fmt.Errorf("timeDB.BeginBackup: error syncing %s: %v", w.path, err)
+		}
+	}
+
+	db.log().Info("timedb: backup started")
+	return nil
+}
+
+// EndBackup resumes the tasks stopped by BeginBackup.
+func (db *DB) EndBackup() error {
+	if !db.backup.active.Load() {
+		return fmt.Errorf("timeDB.EndBackup: no backup running")
+	}
+
+	db.backup.active.Store(false)
+	db.backup.gate.Unlock()
+	db.log().Info("timedb: backup ended")
+	return nil
+}
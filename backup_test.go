@@ -0,0 +1,67 @@
+package timedb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackup(t *testing.T) {
+	dir := t.TempDir()
+	db := New(dir)
+
+	if err := db.SetTableOptions("log", TableOptions{MaxFileSize: db.headerSize() + 50}); err != nil {
+		t.Fatal(err)
+	}
+
+	day1 := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	day2 := day1.AddDate(0, 0, 1)
+	if err := db.Insert(day1, "log", "old"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.BeginBackup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.BeginBackup(); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// the parts don't rotate during the backup
+	for i := 0; i < 10; i++ {
+		if err := db.Insert(day2, "log", "%d", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "2020-01-02", "log.log.1")); !os.IsNotExist(err) {
+		t.Fatalf("unexpected part: %v", err)
+	}
+
+	// the maintenance tasks wait
+	done := make(chan error)
+	go func() { done <- db.Prune(day2) }()
+
+	select {
+	case err := <-done:
+		t.Fatalf("prune didn't wait: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if _, err := os.Stat(filepath.Join(dir, "2020-01-01", "log.log")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.EndBackup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "2020-01-01")); !os.IsNotExist(err) {
+		t.Fatalf("expected the day to be pruned: %v", err)
+	}
+
+	if err := db.EndBackup(); err == nil {
+		t.Fatal("expected an error")
+	}
+}
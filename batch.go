@@ -0,0 +1,189 @@
+package timedb
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Batch groups records that become visible to queries at the same time,
+// when the batch is committed, so readers never see part of a logical event.
+// The records of each table and day are appended with a single write.
+// A batch must not be used concurrently.
+type Batch struct {
+	db      *DB
+	records []batchRecord
+}
+
+type batchRecord struct {
+	time   time.Time
+	table  string
+	data   string
+	stored string
+}
+
+// NewBatch returns an empty batch.
+func (db *DB) NewBatch() *Batch {
+	return &Batch{db: db}
+}
+
+// Save adds a record with the current time to the batch.
+func (b *Batch) Save(table, data string, v ...interface{}) error {
+	return b.Insert(b.db.now(table), table, data, v...)
+}
+
+// Insert adds a record to the batch. It is not visible until Commit is called.
+func (b *Batch) Insert(t time.Time, table, data string, v ...interface{}) error {
+	t, err := b.db.checkClock(t, table)
+	if err != nil {
+		b.db.metrics.writeErrors.Add(1)
+		return err
+	}
+
+	data, stored, ok, err := b.db.prepare(t, table, data, v...)
+	if err != nil || !ok {
+		return err
+	}
+
+	b.records = append(b.records, batchRecord{time: t, table: table, data: data, stored: stored})
+	return nil
+}
+
+// Len returns the number of records in the batch.
+func (b *Batch) Len() int {
+	return len(b.records)
+}
+
+// Discard removes all the records of the batch.
+func (b *Batch) Discard() {
+	b.db.forgetDedup(b.records...)
+	b.records = nil
+}
+
+// Commit writes the records of the batch. Queries see all the records of
+// a table and day or none. If the batch spans several files and a write
+// fails, the files written before remain.
+func (b *Batch) Commit() error {
+	if len(b.records) == 0 {
+		return nil
+	}
+
+	if err := b.db.writeRecords(b.records); err != nil {
+		return err
+	}
+
+	b.records = nil
+	return nil
+}
+
+// writeRecords checks the quotas and writes the records grouped by file.
+func (db *DB) writeRecords(records []batchRecord) error {
+	sizes := make(map[string]int64)
+	for _, r := range records {
+		sizes[r.table] += int64(len(r.stored) + 12)
+	}
+	for table, n := range sizes {
+		if err := db.checkQuota(table, n); err != nil {
+			db.metrics.writeErrors.Add(1)
+			db.forgetDedup(records...)
+			return err
+		}
+	}
+
+	if err := db.writeGroups(groupLines(records)); err != nil {
+		db.notifyDiskFull(err)
+		db.forgetDedup(records...)
+		return err
+	}
+
+	for _, r := range records {
+		db.notifyWrite(r.table, DataPoint{Time: r.time, Text: r.data})
+	}
+	return nil
+}
+
+// writeGroup are the lines of a table and day written at once.
+type writeGroup struct {
+	time    time.Time
+	table   string
+	buf     bytes.Buffer
+	lines   int
+	records []batchRecord
+}
+
+// groupLines groups the records by file keeping their order.
+func groupLines(records []batchRecord) []*writeGroup {
+	var groups []*writeGroup
+	byFile := make(map[string]*writeGroup)
+
+	for _, r := range records {
+		key := r.time.Format("2006-01-02") + "/" + r.table
+		g, ok := byFile[key]
+		if !ok {
+			g = &writeGroup{time: r.time, table: r.table}
+			byFile[key] = g
+			groups = append(groups, g)
+		}
+
+		g.buf.WriteString(strconv.FormatInt(r.time.Unix(), 10))
+		g.buf.WriteByte(' ')
+		g.buf.WriteString(r.stored)
+		g.buf.WriteByte('\n')
+		g.lines++
+		g.records = append(g.records, r)
+	}
+
+	return groups
+}
+
+// writeGroups appends the groups, each one with the lock of its table.
+func (db *DB) writeGroups(groups []*writeGroup) error {
+	for _, g := range groups {
+		if err := db.writeGroup(g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *DB) writeGroup(g *writeGroup) error {
+	w, unlock := db.lockWriter(g.table)
+	defer unlock()
+
+	first, err := db.numberLines(g)
+	if err != nil {
+		return err
+	}
+
+	if err := db.openWrite(w, g.time, g.table, g.buf.Len()); err != nil {
+		db.releaseSeq(g.table, first)
+		return err
+	}
+
+	written, err := w.file.Write(g.buf.Bytes())
+	if err != nil {
+		db.releaseSeq(g.table, first)
+		db.metrics.writeErrors.Add(1)
+		return diskFullError(fmt.Errorf("timeDB: error writing data %w", err))
+	}
+
+	db.metrics.fileWrites.Add(1)
+
+	if w.fsync == FsyncAlways {
+		if err := db.syncWriteFile(w); err != nil {
+			db.metrics.writeErrors.Add(1)
+			return diskFullError(fmt.Errorf("timeDB: error syncing data %w", err))
+		}
+	}
+
+	w.size += int64(written)
+	if c := db.recent.Load(); c != nil {
+		c.add(g.table, g.buf.Bytes())
+	}
+
+	db.metrics.writes.Add(int64(g.lines))
+	db.metrics.bytesWritten.Add(int64(written))
+	db.addUsage(g.table, w.path, int64(written))
+	return nil
+}
@@ -0,0 +1,67 @@
+package timedb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBatch(t *testing.T) {
+	db := NewMemory()
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+
+	var observed int
+	db.OnWrite(func(table string, d DataPoint) {
+		observed++
+	})
+
+	count := func(table string) int {
+		s := db.Query(table, start, start.AddDate(0, 0, 2), 0, 0)
+		defer s.Close()
+
+		n := 0
+		for s.Scan() {
+			n++
+		}
+		return n
+	}
+
+	b := db.NewBatch()
+	b.Insert(start, "orders", "created")
+	b.Insert(start, "payments", "charged")
+	b.Insert(start.Add(time.Second), "orders", "paid")
+	b.Insert(start.AddDate(0, 0, 1), "orders", "shipped")
+
+	if err := b.Insert(start, "../x", "a"); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if n := count("*"); n != 0 {
+		t.Fatalf("the batch should not be visible yet, got %d", n)
+	}
+
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := count("orders"); n != 3 {
+		t.Fatalf("expected 3 records, got %d", n)
+	}
+	if n := count("*"); n != 4 {
+		t.Fatalf("expected 4 records, got %d", n)
+	}
+	if observed != 4 {
+		t.Fatalf("expected 4 notifications, got %d", observed)
+	}
+	if b.Len() != 0 {
+		t.Fatal("the batch should be empty after commit")
+	}
+
+	b.Insert(start, "orders", "discarded")
+	b.Discard()
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if n := count("orders"); n != 3 {
+		t.Fatalf("expected 3 records, got %d", n)
+	}
+}
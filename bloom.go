@@ -0,0 +1,261 @@
+package timedb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"math"
+	"strings"
+	"time"
+)
+
+// Bloom filters are saved next to the data ("table.bloom") with the
+// trigrams of the lines so queries with a filter can skip the days
+// that can't contain it.
+
+// bloomFalsePositives is the target rate of false positives.
+const bloomFalsePositives = 0.01
+
+type bloomFilter struct {
+	// size is the size of the data when the filter was built.
+	size       int64
+	compressed bool
+	k          uint32
+	bits       []uint64
+}
+
+func newBloomFilter(n int) *bloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	m := int(math.Ceil(-float64(n) * math.Log(bloomFalsePositives) / (math.Ln2 * math.Ln2)))
+	k := uint32(math.Max(1, math.Round(float64(m)/float64(n)*math.Ln2)))
+	return &bloomFilter{k: k, bits: make([]uint64, (m+63)/64)}
+}
+
+// bloomHashes returns the two hashes used to derive the k positions.
+func bloomHashes(s string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := mix64(h.Sum64())
+	return x, mix64(x) | 1
+}
+
+func (b *bloomFilter) add(s string) {
+	h1, h2 := bloomHashes(s)
+	m := uint64(len(b.bits) * 64)
+	for i := uint32(0); i < b.k; i++ {
+		p := (h1 + uint64(i)*h2) % m
+		b.bits[p/64] |= 1 << (p % 64)
+	}
+}
+
+func (b *bloomFilter) has(s string) bool {
+	h1, h2 := bloomHashes(s)
+	m := uint64(len(b.bits) * 64)
+	for i := uint32(0); i < b.k; i++ {
+		p := (h1 + uint64(i)*h2) % m
+		if b.bits[p/64]&(1<<(p%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// mayContain reports whether a line can contain the text. Texts shorter
+// than a trigram can't be checked.
+func (b *bloomFilter) mayContain(text string) bool {
+	for i := 0; i+3 <= len(text); i++ {
+		if !b.has(text[i : i+3]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *bloomFilter) marshal() []byte {
+	buf := make([]byte, 0, 21+8*len(b.bits))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(b.size))
+	if b.compressed {
+		buf = append(buf, 1)
+	} else {
+		buf = append(buf, 0)
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, b.k)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(len(b.bits)))
+	for _, w := range b.bits {
+		buf = binary.LittleEndian.AppendUint64(buf, w)
+	}
+	return buf
+}
+
+func unmarshalBloom(data []byte) (*bloomFilter, error) {
+	if len(data) < 21 {
+		return nil, fmt.Errorf("timeDB: invalid bloom filter")
+	}
+
+	b := &bloomFilter{
+		size:       int64(binary.LittleEndian.Uint64(data)),
+		compressed: data[8] == 1,
+		k:          binary.LittleEndian.Uint32(data[9:]),
+	}
+
+	n := binary.LittleEndian.Uint64(data[13:])
+	data = data[21:]
+	if uint64(len(data)) != n*8 || n == 0 {
+		return nil, fmt.Errorf("timeDB: invalid bloom filter")
+	}
+
+	b.bits = make([]uint64, n)
+	for i := range b.bits {
+		b.bits[i] = binary.LittleEndian.Uint64(data[i*8:])
+	}
+	return b, nil
+}
+
+func bloomFile(name string) string {
+	return strings.TrimSuffix(statsFile(name), ".stats") + ".bloom"
+}
+
+// BuildBloom saves a bloom filter of the table for the day so queries
+// with a filter skip the day if it can't contain the text. The filter
+// is ignored if the data changes after it is built.
+func (db *DB) BuildBloom(day time.Time, table string) error {
+	if err := validTable(table); err != nil {
+		return err
+	}
+	if db.encrypted() {
+		return ErrEncrypted
+	}
+
+	name := db.getTablePath(day, table)
+
+	size, compressed, err := db.dataSize(name)
+	if err != nil {
+		return err
+	}
+
+	trigrams, err := db.trigrams(day, name)
+	if err != nil {
+		return err
+	}
+
+	b := newBloomFilter(len(trigrams))
+	b.size = size
+	b.compressed = compressed
+	for t := range trigrams {
+		b.add(t)
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return writeFile(db.storage, bloomFile(name), b.marshal())
+}
+
+// trigrams returns the trigrams of the lines, that is the text that
+// filters compare in databases without encryption.
+func (db *DB) trigrams(day time.Time, name string) (map[string]struct{}, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	f, err := db.openParts(day, name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	trigrams := make(map[string]struct{})
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadString('\n')
+		line = strings.TrimSuffix(line, "\n")
+
+		for i := 0; i+3 <= len(line); i++ {
+			trigrams[line[i:i+3]] = struct{}{}
+		}
+
+		if err == io.EOF {
+			return trigrams, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// savedBloom returns the bloom filter of the file if it exists and
+// the data didn't change since it was built.
+func (db *DB) savedBloom(name string) (*bloomFilter, bool) {
+	data, err := fs.ReadFile(db.storage, bloomFile(name))
+	if err != nil {
+		return nil, false
+	}
+
+	b, err := unmarshalBloom(data)
+	if err != nil {
+		db.log().Warn("timedb: invalid bloom filter", "file", name, "error", err)
+		return nil, false
+	}
+
+	size, compressed, err := db.dataSize(name)
+	if err != nil || size != b.size || compressed != b.compressed {
+		return nil, false
+	}
+	return b, true
+}
+
+// skipBloom reports whether the bloom filter of the file says that
+// it doesn't contain the filter.
+func (db *DB) skipBloom(name, filter string) bool {
+	if len(filter) < 3 {
+		return false
+	}
+
+	b, ok := db.savedBloom(name)
+	if !ok {
+		return false
+	}
+	return !b.mayContain(filter)
+}
+
+// buildBlooms builds the bloom filters of the days before today that
+// don't have one or that changed.
+func (db *DB) buildBlooms() error {
+	if db.encrypted() {
+		return nil
+	}
+
+	dayList, err := db.days()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+
+	for _, day := range dayList {
+		if !day.Before(today) {
+			break
+		}
+
+		tables, err := db.matchTables(day, "**")
+		if err != nil {
+			return err
+		}
+
+		for _, table := range tables {
+			if _, ok := db.savedBloom(db.getTablePath(day, table)); ok {
+				continue
+			}
+
+			if err := db.BuildBloom(day, table); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package timedb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBloom(t *testing.T) {
+	db := New(t.TempDir())
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	next := start.AddDate(0, 0, 1)
+
+	for i := 0; i < 100; i++ {
+		if err := db.Insert(start.Add(time.Duration(i)*time.Second), "app", "request ok"); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Insert(next.Add(time.Duration(i)*time.Second), "app", "request ok"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Insert(start.Add(time.Hour), "app", "error disk full"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	for _, day := range []time.Time{start, next} {
+		if err := db.BuildBloom(day, "app"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	count := func() int {
+		s := db.Query("app", start, next.Add(time.Hour), 0, 0)
+		defer s.Close()
+		s.SetFilter("disk full")
+
+		plan, err := s.Explain()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(plan.Files) != 2 || plan.Files[0].Skipped {
+			t.Fatalf("invalid plan %+v", plan)
+		}
+
+		n := 0
+		for s.Scan() {
+			n++
+		}
+		if s.Error != nil {
+			t.Fatal(s.Error)
+		}
+		return n
+	}
+
+	s := db.Query("app", start, next.Add(time.Hour), 0, 0)
+	s.SetFilter("disk full")
+	plan, err := s.Explain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if !plan.Files[1].Skipped {
+		t.Fatalf("expected the second day to be skipped: %+v", plan.Files)
+	}
+
+	if n := count(); n != 1 {
+		t.Fatalf("expected 1 record, got %d", n)
+	}
+
+	// the filter is ignored if the data changes
+	if err := db.Insert(next.Add(time.Hour), "app", "error disk full"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	if n := count(); n != 2 {
+		t.Fatalf("expected 2 records, got %d", n)
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+	b := newBloomFilter(1000)
+	for i := 0; i < 1000; i++ {
+		b.add(string(rune('a'+i%26)) + string(rune('a'+i/26%26)) + "x")
+	}
+
+	if !b.mayContain("abx") || !b.mayContain("ab") {
+		t.Fatal("expected a match")
+	}
+
+	c, err := unmarshalBloom(b.marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.mayContain("abx") || c.mayContain("zzzz") {
+		t.Fatal("invalid filter after unmarshal")
+	}
+}
@@ -0,0 +1,99 @@
+package timedb
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrClockSkew is returned when the time of a record is too far from
+// the clock of the server.
+var ErrClockSkew = errors.New("timeDB: time out of the allowed range")
+
+// ClockPolicy is what happens to the records out of the allowed range.
+type ClockPolicy int
+
+const (
+	// ClockReject refuses the record with ErrClockSkew.
+	ClockReject ClockPolicy = iota
+
+	// ClockClamp saves the record with the closest allowed time.
+	ClockClamp
+)
+
+// ClockOptions protect the data from records with wrong times.
+type ClockOptions struct {
+	// MaxFuture and MaxPast are how far the time of a record can be from
+	// the clock of the server. Zero doesn't limit it.
+	MaxFuture time.Duration
+	MaxPast   time.Duration
+	Policy    ClockPolicy
+
+	// Monotonic saves the records of Save with the time of the last
+	// one of the table if the clock goes backwards, so the lines of
+	// the file stay sorted.
+	Monotonic bool
+}
+
+type clockGuard struct {
+	opts  ClockOptions
+	mutex sync.Mutex
+	last  map[string]time.Time
+}
+
+// SetClock sets the range of times allowed for new records. The zero
+// value disables the checks.
+func (db *DB) SetClock(o ClockOptions) {
+	var c *clockGuard
+	if o != (ClockOptions{}) {
+		c = &clockGuard{opts: o, last: make(map[string]time.Time)}
+	}
+	db.clock.Store(c)
+}
+
+// checkClock returns the time of a record after the clock checks.
+func (db *DB) checkClock(t time.Time, table string) (time.Time, error) {
+	c := db.clock.Load()
+	if c == nil {
+		return t, nil
+	}
+
+	now := time.Now()
+	o := c.opts
+
+	if o.MaxFuture > 0 && t.After(now.Add(o.MaxFuture)) {
+		if o.Policy != ClockClamp {
+			return t, fmt.Errorf("%w: %s is more than %v in the future in table %s", ErrClockSkew, t.Format(time.RFC3339), o.MaxFuture, table)
+		}
+		t = now.Add(o.MaxFuture)
+	}
+
+	if o.MaxPast > 0 && t.Before(now.Add(-o.MaxPast)) {
+		if o.Policy != ClockClamp {
+			return t, fmt.Errorf("%w: %s is more than %v in the past in table %s", ErrClockSkew, t.Format(time.RFC3339), o.MaxPast, table)
+		}
+		t = now.Add(-o.MaxPast)
+	}
+
+	return t, nil
+}
+
+// now returns the time for a record of Save.
+func (db *DB) now(table string) time.Time {
+	t := time.Now()
+
+	c := db.clock.Load()
+	if c == nil || !c.opts.Monotonic {
+		return t
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if last, ok := c.last[table]; ok && t.Before(last) {
+		return last
+	}
+	c.last[table] = t
+	return t
+}
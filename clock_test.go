@@ -0,0 +1,57 @@
+package timedb
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	db := NewMemory()
+	db.SetClock(ClockOptions{MaxFuture: time.Hour, MaxPast: 24 * time.Hour})
+
+	now := time.Now()
+
+	if err := db.Insert(now.Add(2*time.Hour), "log", "a"); !errors.Is(err, ErrClockSkew) {
+		t.Fatalf("expected ErrClockSkew, got %v", err)
+	}
+	if err := db.NewBatch().Insert(now.Add(-48*time.Hour), "log", "a"); !errors.Is(err, ErrClockSkew) {
+		t.Fatalf("expected ErrClockSkew, got %v", err)
+	}
+	if err := db.Insert(now.Add(30*time.Minute), "log", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	db.SetClock(ClockOptions{MaxFuture: time.Hour, Policy: ClockClamp})
+	if err := db.Insert(now.Add(5*time.Hour), "log", "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	s := db.Query("log", now, now.Add(10*time.Hour), 0, 0)
+	defer s.Close()
+
+	var last DataPoint
+	for s.Scan() {
+		last = s.Data()
+	}
+	if trimText(last.Text) != "b" || last.Time.After(now.Add(time.Hour+time.Second)) {
+		t.Fatalf("expected the time to be clamped, got %v", last)
+	}
+}
+
+func TestClockMonotonic(t *testing.T) {
+	db := NewMemory()
+	db.SetClock(ClockOptions{Monotonic: true})
+
+	c := db.clock.Load()
+	future := time.Now().Add(time.Hour)
+	c.last["log"] = future
+
+	// the clock is behind the last record
+	if got := db.now("log"); !got.Equal(future) {
+		t.Fatalf("expected %v, got %v", future, got)
+	}
+	if got := db.now("other"); got.After(time.Now()) {
+		t.Fatalf("unexpected time %v", got)
+	}
+}
@@ -0,0 +1,213 @@
+/*
+Command timedb-bench generates write load to compare the write paths of
+timedb on real hardware:
+
+	timedb-bench -mode sync -tables 10 -concurrency 8 -line 200 -fsync close -duration 10s
+	timedb-bench -mode batch -batch 500 -fsync always
+	timedb-bench -mode async -queue 10000 -max-batch 1000
+
+The modes are the synchronous writes of Insert, batches committed by each
+writer and the async mode, where a goroutine writes the queued records of
+all the writers at once (group commit).
+
+It prints the throughput, the latency of the calls (in async mode only
+until the record is queued) and the internal counters of the database:
+the writes to the files, the records written by each one, the syncs and
+the time waiting for the lock. With -cpuprofile it saves a profile of
+the load for go tool pprof.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime/pprof"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/scorredoira/timedb"
+)
+
+type config struct {
+	dir         string
+	mode        string
+	tables      int
+	concurrency int
+	line        int
+	fsync       timedb.FsyncPolicy
+	duration    time.Duration
+	records     int64
+	batch       int
+	queue       int
+	maxBatch    int
+	cpuProfile  string
+}
+
+func main() {
+	var c config
+	var fsync string
+	flag.StringVar(&c.dir, "dir", "", "the data directory. By default a temporary one that is deleted at the end")
+	flag.StringVar(&c.mode, "mode", "sync", "the write path: sync, batch or async")
+	flag.IntVar(&c.tables, "tables", 1, "the number of tables written")
+	flag.IntVar(&c.concurrency, "concurrency", 1, "the number of goroutines writing")
+	flag.IntVar(&c.line, "line", 100, "the size of the records in bytes")
+	flag.StringVar(&fsync, "fsync", "never", "the fsync policy of the tables: never, always or close")
+	flag.DurationVar(&c.duration, "duration", 10*time.Second, "how long to write")
+	flag.Int64Var(&c.records, "records", 0, "stop after writing this number of records")
+	flag.IntVar(&c.batch, "batch", 100, "the records of each batch in batch mode")
+	flag.IntVar(&c.queue, "queue", 0, "the queue size in async mode")
+	flag.IntVar(&c.maxBatch, "max-batch", 0, "the maximum records written at once in async mode")
+	flag.StringVar(&c.cpuProfile, "cpuprofile", "", "write a CPU profile of the load to this file")
+	flag.Parse()
+
+	switch fsync {
+	case "never":
+		c.fsync = timedb.FsyncNever
+	case "always":
+		c.fsync = timedb.FsyncAlways
+	case "close":
+		c.fsync = timedb.FsyncOnClose
+	default:
+		fmt.Fprintf(os.Stderr, "invalid fsync policy %q\n", fsync)
+		os.Exit(2)
+	}
+
+	if err := run(c); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(c config) error {
+	if c.dir == "" {
+		dir, err := os.MkdirTemp("", "timedb-bench")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		c.dir = dir
+	}
+
+	db := timedb.New(c.dir)
+
+	tables := make([]string, c.tables)
+	for i := range tables {
+		tables[i] = fmt.Sprintf("bench%d", i)
+		if err := db.SetTableOptions(tables[i], timedb.TableOptions{Fsync: c.fsync}); err != nil {
+			return err
+		}
+	}
+
+	switch c.mode {
+	case "sync", "batch":
+	case "async":
+		if err := db.StartAsync(timedb.AsyncOptions{QueueSize: c.queue, MaxBatch: c.maxBatch}); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid mode %q", c.mode)
+	}
+
+	line := strings.Repeat("x", c.line)
+
+	if c.cpuProfile != "" {
+		f, err := os.Create(c.cpuProfile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if err := pprof.StartCPUProfile(f); err != nil {
+			return err
+		}
+		defer pprof.StopCPUProfile()
+	}
+
+	var written atomic.Int64
+	var errors atomic.Int64
+	latencies := make([][]time.Duration, c.concurrency)
+
+	deadline := time.Now().Add(c.duration)
+	done := func() bool {
+		return time.Now().After(deadline) || c.records > 0 && written.Load() >= c.records
+	}
+
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for w := 0; w < c.concurrency; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			for i := w; !done(); i++ {
+				table := tables[i%len(tables)]
+				n := 1
+
+				t := time.Now()
+				var err error
+				if c.mode == "batch" {
+					b := db.NewBatch()
+					for j := 0; j < c.batch; j++ {
+						b.Save(table, line)
+					}
+					n = b.Len()
+					err = b.Commit()
+				} else {
+					err = db.Save(table, line)
+				}
+				latencies[w] = append(latencies[w], time.Since(t))
+
+				if err != nil {
+					errors.Add(1)
+					continue
+				}
+				written.Add(int64(n))
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// the async queue is written before measuring
+	if err := db.Close(); err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+
+	st := db.Stats()
+	report(c, elapsed, written.Load(), errors.Load(), slices.Concat(latencies...), st)
+	return nil
+}
+
+func report(c config, elapsed time.Duration, written, errors int64, latencies []time.Duration, st timedb.Stats) {
+	slices.Sort(latencies)
+	percentile := func(p float64) time.Duration {
+		if len(latencies) == 0 {
+			return 0
+		}
+		return latencies[int(float64(len(latencies)-1)*p)]
+	}
+
+	seconds := elapsed.Seconds()
+	fmt.Printf("mode %s, %d tables, %d writers, %d bytes per record\n", c.mode, c.tables, c.concurrency, c.line)
+	fmt.Printf("records      %d in %v (%d errors)\n", written, elapsed.Round(time.Millisecond), errors)
+	fmt.Printf("throughput   %.0f records/s, %.2f MB/s\n", float64(written)/seconds, float64(st.BytesWritten)/seconds/1e6)
+	fmt.Printf("latency      p50 %v, p99 %v, max %v\n", percentile(0.5), percentile(0.99), percentile(1))
+
+	perWrite := 0.0
+	if st.FileWrites > 0 {
+		perWrite = float64(st.Writes) / float64(st.FileWrites)
+	}
+	fmt.Printf("file writes  %d, %.1f records each\n", st.FileWrites, perWrite)
+
+	var avgSync time.Duration
+	if st.Fsyncs > 0 {
+		avgSync = st.FsyncTime / time.Duration(st.Fsyncs)
+	}
+	fmt.Printf("fsyncs       %d, %v average\n", st.Fsyncs, avgSync)
+	fmt.Printf("lock wait    %v\n", st.LockWait.Round(time.Millisecond))
+}
@@ -0,0 +1,90 @@
+/*
+Command timedb manages timedb databases.
+
+	timedb migrate -dir path/to/data -table "**" -from legacy -to compressed
+	timedb sql -dir path/to/data "SELECT count(*) FROM nginx WHERE time >= '2020-01-01' GROUP BY time(1h)"
+*/
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/scorredoira/timedb"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "migrate":
+		err = migrate(os.Args[2:])
+	case "sql":
+		err = runSQL(os.Args[2:])
+	default:
+		usage()
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: timedb migrate -dir path -table table -from format -to format")
+	fmt.Fprintln(os.Stderr, "       timedb sql -dir path query")
+	os.Exit(2)
+}
+
+// migrate rewrites the files of a table in another format.
+func migrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dir := fs.String("dir", ".", "the data directory")
+	table := fs.String("table", "**", "the table, it can be a pattern")
+	from := fs.String("from", "legacy", "the format of the files to migrate: legacy, text or compressed")
+	to := fs.String("to", "text", "the new format: legacy, text or compressed")
+	fs.Parse(args)
+
+	f, err := timedb.ParseFormat(*from)
+	if err != nil {
+		return err
+	}
+	t, err := timedb.ParseFormat(*to)
+	if err != nil {
+		return err
+	}
+
+	db := timedb.New(*dir)
+	defer db.Close()
+
+	return db.Migrate(*table, f, t)
+}
+
+// runSQL runs a query of the SQL subset and prints the result as JSON.
+func runSQL(args []string) error {
+	fs := flag.NewFlagSet("sql", flag.ExitOnError)
+	dir := fs.String("dir", ".", "the data directory")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		usage()
+	}
+
+	db := timedb.New(*dir)
+	defer db.Close()
+
+	res, err := db.RunSQL(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	e := json.NewEncoder(os.Stdout)
+	e.SetIndent("", "  ")
+	return e.Encode(res)
+}
@@ -0,0 +1,682 @@
+package timedb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// columnBlockRows is the number of records of the columnar blocks.
+const columnBlockRows = 8192
+
+// columnsVersion is the version of the columnar files. The files of other
+// versions are built again.
+const columnsVersion = 1
+
+// The columnar file of a data file has a header with its size followed
+// by the index, gob encoded, and the chunks of the blocks. Each block has
+// a chunk with the times and one for each column, so reading some fields
+// of the records only reads their chunks. The chunks have a checksum and
+// the blocks the position of their first record in the data file, where
+// the records are parsed from if a chunk is corrupt.
+
+type columnType int
+
+const (
+	columnTime columnType = iota
+	columnNumber
+	columnString
+)
+
+type columnIndex struct {
+	Version int
+
+	// Size is the size of the data files when the columns were built.
+	Size    int64
+	Columns []string
+	Blocks  []columnBlock
+}
+
+// columnBlock are the chunks of a block. The first one is the time and
+// the rest the columns in the order of the index.
+type columnBlock struct {
+	Start, End int64
+	Rows       int
+	Chunks     []columnChunk
+
+	// Offset is the position of the first record in the data files.
+	Offset int64
+}
+
+type columnChunk struct {
+	Offset, Length int64
+	Type           columnType
+
+	// Compressed is set if zstd makes the chunk smaller.
+	Compressed bool
+
+	// CRC is the checksum of the bytes stored.
+	CRC uint32
+}
+
+var errCorruptChunk = errors.New("timeDB: corrupt chunk")
+
+func columnsFile(name string) string {
+	return strings.TrimSuffix(statsFile(name), ".stats") + ".cols"
+}
+
+// ColumnBatch is a block of records of a table with the values of some of
+// their fields.
+type ColumnBatch struct {
+	Table string
+	Time  []time.Time
+
+	// Columns are in the order they were requested.
+	Columns []Column
+}
+
+// Column are the values of a field of the records of a batch. If all of them
+// are numbers they are in Numbers, with NaN for the records without the field,
+// and otherwise in Strings, with the JSON of the values that are not strings
+// and empty strings for the records without the field.
+type Column struct {
+	Name    string
+	Numbers []float64 `json:",omitempty"`
+	Strings []string  `json:",omitempty"`
+}
+
+// IsNumber reports whether the values of the column are numbers.
+func (c Column) IsNumber() bool {
+	return c.Strings == nil
+}
+
+// Float returns the value of the column for the record i as a number.
+func (c Column) Float(i int) (float64, bool) {
+	if c.IsNumber() {
+		v := c.Numbers[i]
+		return v, !math.IsNaN(v)
+	}
+	v, err := strconv.ParseFloat(c.Strings[i], 64)
+	return v, err == nil
+}
+
+// ScanColumns calls fn with the records of the JSON tables in [start, end)
+// in batches with the values of the columns, that can be nested fields
+// separated with dots. The days that have the fields in columnar blocks
+// (see TableOptions.Columns) only read them and the rest are parsed from
+// the records. The table can be a pattern.
+func (db *DB) ScanColumns(table string, start, end time.Time, columns []string, fn func(b ColumnBatch) error) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("timeDB.ScanColumns: no columns")
+	}
+
+	start, end = start.Local(), end.Local()
+
+	for _, day := range days(start, end) {
+		tables := []string{table}
+		if isPattern(table) {
+			var err error
+			if tables, err = db.matchTables(day, table); err != nil {
+				continue
+			}
+		}
+
+		from, to := day, day.AddDate(0, 0, 1)
+		if start.After(from) {
+			from = start
+		}
+		if end.Before(to) {
+			to = end
+		}
+		if !from.Before(to) {
+			continue
+		}
+
+		for _, t := range tables {
+			name := db.getTablePath(day, t)
+			if idx, ok := db.savedColumns(name, columns); ok {
+				if err := db.readColumns(day, t, name, idx, from, to, columns, fn); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := db.scanColumns(t, from, to, columns, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// AggregateColumn combines the numeric values of a column of the JSON
+// records of the table in buckets of [start, end), like Aggregate does
+// with the numeric tables. The values that are not numbers are ignored.
+func (db *DB) AggregateColumn(table, column string, start, end time.Time, bucket time.Duration, fn AggregateFunc, fill FillPolicy) ([]Point, error) {
+	if bucket <= 0 {
+		return nil, fmt.Errorf("timeDB: invalid bucket %v", bucket)
+	}
+	if fill != FillNone {
+		if _, err := bucketCount(start, end, bucket); err != nil {
+			return nil, err
+		}
+	}
+
+	var points []Point
+	err := db.ScanColumns(table, start, end, []string{column}, func(b ColumnBatch) error {
+		c := b.Columns[0]
+		for i, t := range b.Time {
+			if v, ok := c.Float(i); ok {
+				points = append(points, Point{Time: t, Value: v})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].Time.Before(points[j].Time)
+	})
+	return Fill(aggregate(points, start, bucket, fn), start, end, bucket, fill), nil
+}
+
+// scanColumns parses the records of the range in batches.
+func (db *DB) scanColumns(table string, start, end time.Time, columns []string, fn func(b ColumnBatch) error) error {
+	b := newColumnBuilder(columns)
+
+	var err error
+	flush := func() {
+		if err == nil && b.rows() > 0 {
+			err = fn(b.batch(table))
+		}
+		b = newColumnBuilder(columns)
+	}
+
+	e := db.scanRange(table, start, end, "", func(d DataPoint) {
+		b.add(d.Time.Unix(), d.Text)
+		if b.rows() == columnBlockRows {
+			flush()
+		}
+	})
+	flush()
+
+	if e != nil {
+		return e
+	}
+	return err
+}
+
+// readColumns reads the blocks of the columnar file in the range. If a
+// block can't be read the records from it are parsed from the data.
+func (db *DB) readColumns(day time.Time, table, name string, idx *columnIndex, start, end time.Time, columns []string, fn func(b ColumnBatch) error) error {
+	f, err := db.storage.Open(columnsFile(name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ra, ok := f.(io.ReaderAt)
+	if !ok {
+		b, err := io.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		ra = bytes.NewReader(b)
+	}
+
+	// the position of the requested columns in the blocks
+	chunks := make([]int, len(columns))
+	for i, c := range columns {
+		chunks[i] = slices.Index(idx.Columns, c) + 1
+	}
+
+	// the chunks start after the index
+	var size [4]byte
+	if _, err := ra.ReadAt(size[:], 0); err != nil {
+		return fmt.Errorf("timeDB: error reading %s: %v", columnsFile(name), err)
+	}
+	base := 4 + int64(binary.LittleEndian.Uint32(size[:]))
+
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		return err
+	}
+	defer dec.Close()
+
+	from, to := start.Unix(), end.Unix()
+	for _, block := range idx.Blocks {
+		if block.End < from || block.Start >= to {
+			continue
+		}
+
+		b, err := readBlock(ra, dec, base, block, table, columns, chunks)
+		if err != nil {
+			db.log().Warn("timedb: invalid columns, reading the records", "file", columnsFile(name), "offset", block.Offset, "error", err)
+			return db.scanColumnsFrom(day, table, name, block.Offset, start, end, columns, fn)
+		}
+
+		if block.Start < from || block.End >= to {
+			b = b.filter(start, end)
+		}
+		if len(b.Time) == 0 {
+			continue
+		}
+
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// filter returns the records of the batch in [start, end).
+func (b ColumnBatch) filter(start, end time.Time) ColumnBatch {
+	r := ColumnBatch{Table: b.Table, Columns: make([]Column, len(b.Columns))}
+	for i, c := range b.Columns {
+		r.Columns[i].Name = c.Name
+	}
+
+	for i, t := range b.Time {
+		if t.Before(start) || !t.Before(end) {
+			continue
+		}
+		r.Time = append(r.Time, t)
+		for j, c := range b.Columns {
+			if c.IsNumber() {
+				r.Columns[j].Numbers = append(r.Columns[j].Numbers, c.Numbers[i])
+			} else {
+				r.Columns[j].Strings = append(r.Columns[j].Strings, c.Strings[i])
+			}
+		}
+	}
+	return r
+}
+
+// readBlock returns the batch of the columns of a block. chunks are the
+// positions of the columns in the chunks of the block.
+func readBlock(ra io.ReaderAt, dec *zstd.Decoder, base int64, block columnBlock, table string, columns []string, chunks []int) (ColumnBatch, error) {
+	b := ColumnBatch{Table: table, Columns: make([]Column, len(columns))}
+
+	times, err := readChunk(ra, dec, base, block.Chunks[0])
+	if err != nil {
+		return b, err
+	}
+	if b.Time, err = decodeTimes(times, block.Rows); err != nil {
+		return b, err
+	}
+
+	for i, c := range columns {
+		chunk := block.Chunks[chunks[i]]
+		data, err := readChunk(ra, dec, base, chunk)
+		if err != nil {
+			return b, err
+		}
+		if b.Columns[i], err = decodeColumn(c, chunk.Type, data, block.Rows); err != nil {
+			return b, err
+		}
+	}
+	return b, nil
+}
+
+// scanColumnsFrom parses the records of the data file from the offset,
+// where a block that can't be read starts, to the end.
+func (db *DB) scanColumnsFrom(day time.Time, table, name string, offset int64, start, end time.Time, columns []string, fn func(b ColumnBatch) error) error {
+	db.mutex.RLock()
+	f, err := db.openParts(day, name)
+	db.mutex.RUnlock()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.CopyN(io.Discard, f, offset); err != nil {
+		return fmt.Errorf("timeDB: error reading %s: %v", name, err)
+	}
+
+	b := newColumnBuilder(columns)
+	flush := func() error {
+		var err error
+		if b.rows() > 0 {
+			err = fn(b.batch(table))
+		}
+		b = newColumnBuilder(columns)
+		return err
+	}
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("timeDB: error reading %s: %v", name, err)
+		}
+
+		d, ok := db.decodeLine(line[:len(line)-1])
+		if !ok || d.Time.Before(start) || !d.Time.Before(end) {
+			continue
+		}
+
+		b.add(d.Time.Unix(), d.Text)
+		if b.rows() == columnBlockRows {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+func readChunk(ra io.ReaderAt, dec *zstd.Decoder, base int64, c columnChunk) ([]byte, error) {
+	b := make([]byte, c.Length)
+	if _, err := ra.ReadAt(b, base+c.Offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(b) != c.CRC {
+		return nil, errCorruptChunk
+	}
+	if !c.Compressed {
+		return b, nil
+	}
+	return dec.DecodeAll(b, nil)
+}
+
+// buildColumns saves the columnar file of a data file.
+func (db *DB) buildColumns(day time.Time, name string, columns []string) error {
+	if db.keys != nil {
+		return ErrEncrypted
+	}
+
+	f, err := db.openParts(day, name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		return err
+	}
+	defer enc.Close()
+
+	idx := columnIndex{Version: columnsVersion, Columns: columns}
+	var data bytes.Buffer
+
+	b := newColumnBuilder(columns)
+	flush := func() {
+		if b.rows() > 0 {
+			idx.Blocks = append(idx.Blocks, b.encode(enc, &data))
+		}
+		b = newColumnBuilder(columns)
+	}
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			// a line without the new line is not complete yet
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("timeDB: error reading %s: %v", name, err)
+		}
+		offset := idx.Size
+		idx.Size += int64(len(line))
+
+		d, ok := db.decodeLine(line[:len(line)-1])
+		if !ok {
+			continue
+		}
+
+		if b.rows() == 0 {
+			b.offset = offset
+		}
+		b.add(d.Time.Unix(), d.Text)
+		if b.rows() == columnBlockRows {
+			flush()
+		}
+	}
+	flush()
+
+	var buf bytes.Buffer
+	buf.Write(make([]byte, 4))
+	if err := gob.NewEncoder(&buf).Encode(idx); err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(buf.Bytes(), uint32(buf.Len()-4))
+	buf.Write(data.Bytes())
+
+	return writeFile(db.storage, columnsFile(name), buf.Bytes())
+}
+
+// savedColumns returns the index of the columnar file of a data file if
+// it exists, is up to date and has the columns.
+func (db *DB) savedColumns(name string, columns []string) (*columnIndex, bool) {
+	f, err := db.storage.Open(columnsFile(name))
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, false
+	}
+
+	var idx columnIndex
+	if err := gob.NewDecoder(io.LimitReader(r, int64(binary.LittleEndian.Uint32(size[:])))).Decode(&idx); err != nil {
+		db.log().Warn("timedb: invalid columns", "file", name, "error", err)
+		return nil, false
+	}
+	if idx.Version != columnsVersion {
+		return nil, false
+	}
+
+	for _, c := range columns {
+		if !slices.Contains(idx.Columns, c) {
+			return nil, false
+		}
+	}
+
+	n, compressed, err := db.dataSize(name)
+	if err != nil || (!compressed && n != idx.Size) {
+		return nil, false
+	}
+	return &idx, true
+}
+
+// columnBuilder accumulates the values of the fields of the records.
+type columnBuilder struct {
+	columns [][]string
+	times   []int64
+	values  [][]interface{}
+
+	// offset is the position of the first record in the data files.
+	offset int64
+}
+
+func newColumnBuilder(columns []string) *columnBuilder {
+	b := &columnBuilder{values: make([][]interface{}, len(columns))}
+	for _, c := range columns {
+		b.columns = append(b.columns, strings.Split(c, "."))
+	}
+	return b
+}
+
+func (b *columnBuilder) rows() int {
+	return len(b.times)
+}
+
+// add adds a record. The fields of the records that are not JSON objects
+// are missing.
+func (b *columnBuilder) add(epoch int64, text string) {
+	var v map[string]interface{}
+	json.Unmarshal([]byte(text), &v)
+
+	b.times = append(b.times, epoch)
+	for i, path := range b.columns {
+		b.values[i] = append(b.values[i], jsonField(v, path))
+	}
+}
+
+// batch returns the values accumulated.
+func (b *columnBuilder) batch(table string) ColumnBatch {
+	r := ColumnBatch{Table: table, Time: make([]time.Time, len(b.times))}
+	for i, t := range b.times {
+		r.Time[i] = time.Unix(t, 0)
+	}
+	for i, path := range b.columns {
+		r.Columns = append(r.Columns, makeColumn(strings.Join(path, "."), b.values[i]))
+	}
+	return r
+}
+
+// encode writes the chunks of the block to data.
+func (b *columnBuilder) encode(enc *zstd.Encoder, data *bytes.Buffer) columnBlock {
+	block := columnBlock{Start: b.times[0], End: b.times[0], Rows: len(b.times), Offset: b.offset}
+
+	add := func(t columnType, raw []byte) {
+		c := columnChunk{Offset: int64(data.Len()), Type: t}
+		if z := enc.EncodeAll(raw, nil); len(z) < len(raw) {
+			raw = z
+			c.Compressed = true
+		}
+		c.Length = int64(len(raw))
+		c.CRC = crc32.ChecksumIEEE(raw)
+		data.Write(raw)
+		block.Chunks = append(block.Chunks, c)
+	}
+
+	// the times are stored as the difference with the previous one
+	var raw []byte
+	var prev int64
+	for _, t := range b.times {
+		block.Start = min(block.Start, t)
+		block.End = max(block.End, t)
+		raw = binary.AppendVarint(raw, t-prev)
+		prev = t
+	}
+	add(columnTime, raw)
+
+	for i, path := range b.columns {
+		c := makeColumn(strings.Join(path, "."), b.values[i])
+		raw = nil
+		if c.IsNumber() {
+			for _, v := range c.Numbers {
+				raw = binary.LittleEndian.AppendUint64(raw, math.Float64bits(v))
+			}
+			add(columnNumber, raw)
+		} else {
+			for _, v := range c.Strings {
+				raw = binary.AppendUvarint(raw, uint64(len(v)))
+				raw = append(raw, v...)
+			}
+			add(columnString, raw)
+		}
+	}
+
+	return block
+}
+
+// makeColumn returns the column of the values, numeric if all are numbers.
+func makeColumn(name string, values []interface{}) Column {
+	c := Column{Name: name}
+
+	numeric := true
+	for _, v := range values {
+		if _, ok := v.(float64); !ok && v != nil {
+			numeric = false
+			break
+		}
+	}
+
+	if numeric {
+		c.Numbers = make([]float64, len(values))
+		for i, v := range values {
+			if f, ok := v.(float64); ok {
+				c.Numbers[i] = f
+			} else {
+				c.Numbers[i] = math.NaN()
+			}
+		}
+		return c
+	}
+
+	c.Strings = make([]string, len(values))
+	for i, v := range values {
+		switch v := v.(type) {
+		case nil:
+		case string:
+			c.Strings[i] = v
+		default:
+			b, _ := json.Marshal(v)
+			c.Strings[i] = string(b)
+		}
+	}
+	return c
+}
+
+func decodeTimes(data []byte, rows int) ([]time.Time, error) {
+	times := make([]time.Time, rows)
+
+	var t int64
+	for i := range times {
+		d, n := binary.Varint(data)
+		if n <= 0 {
+			return nil, errors.New("invalid time")
+		}
+		data = data[n:]
+		t += d
+		times[i] = time.Unix(t, 0)
+	}
+	return times, nil
+}
+
+func decodeColumn(name string, t columnType, data []byte, rows int) (Column, error) {
+	c := Column{Name: name}
+
+	switch t {
+	case columnNumber:
+		if len(data) != rows*8 {
+			return c, errors.New("invalid numbers")
+		}
+		c.Numbers = make([]float64, rows)
+		for i := range c.Numbers {
+			c.Numbers[i] = math.Float64frombits(binary.LittleEndian.Uint64(data[i*8:]))
+		}
+
+	case columnString:
+		c.Strings = make([]string, rows)
+		for i := range c.Strings {
+			l, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < l {
+				return c, errors.New("invalid strings")
+			}
+			c.Strings[i] = string(data[n : n+int(l)])
+			data = data[n+int(l):]
+		}
+
+	default:
+		return c, fmt.Errorf("invalid column type %d", t)
+	}
+
+	return c, nil
+}
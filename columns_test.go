@@ -0,0 +1,143 @@
+package timedb
+
+import (
+	"encoding/binary"
+	"io/fs"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestColumns(t *testing.T) {
+	db := NewMemory()
+	db.SetTableOptions("http", TableOptions{Columns: []string{"status", "duration", "req.path"}})
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	db.Insert(start, "http", "not json")
+	for i := 0; i < 10000; i++ {
+		ts := start.Add(time.Duration(i) * time.Second)
+		if err := db.Insert(ts, "http", `{"status":%d,"duration":%d,"req":{"path":"/%d"}}`, 200+i%2, i%10, i%3); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scan := func(columns ...string) (int, []ColumnBatch) {
+		var n int
+		var batches []ColumnBatch
+		err := db.ScanColumns("http", start, start.Add(time.Hour), columns, func(b ColumnBatch) error {
+			n += len(b.Time)
+			batches = append(batches, b)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n, batches
+	}
+
+	check := func() {
+		// the first hour and the record without fields
+		n, batches := scan("duration", "req.path")
+		if n != 3601 {
+			t.Fatalf("expected 3601 records, got %d", n)
+		}
+
+		c := batches[0].Columns
+		if !c[0].IsNumber() || !math.IsNaN(c[0].Numbers[0]) || c[0].Numbers[4] != 3 || c[1].IsNumber() || c[1].Strings[5] != "/1" {
+			t.Fatalf("unexpected columns %+v", c)
+		}
+
+		points, err := db.AggregateColumn("http", "duration", start, start.Add(time.Minute), 10*time.Second, AggSum, FillNone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(points) != 6 || points[0].Value != 45 {
+			t.Fatalf("unexpected points %+v", points)
+		}
+	}
+
+	check()
+
+	if err := db.ApplyTableOptions(); err != nil {
+		t.Fatal(err)
+	}
+
+	name := columnsFile(db.getTablePath(start, "http"))
+	if _, err := fs.Stat(db.storage, name); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.savedColumns(db.getTablePath(start, "http"), []string{"status"}); !ok {
+		t.Fatal("expected the columns")
+	}
+	if _, ok := db.savedColumns(db.getTablePath(start, "http"), []string{"other"}); ok {
+		t.Fatal("unexpected column")
+	}
+
+	check()
+
+	// appending invalidates the columns
+	db.Insert(start.Add(3*time.Hour), "http", `{"duration":1000}`)
+	if _, ok := db.savedColumns(db.getTablePath(start, "http"), []string{"status"}); ok {
+		t.Fatal("expected the columns to be out of date")
+	}
+
+	points, err := db.AggregateColumn("http", "duration", start, start.Add(4*time.Hour), 4*time.Hour, AggMax, FillNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 1 || points[0].Value != 1000 {
+		t.Fatalf("unexpected points %+v", points)
+	}
+}
+
+func TestColumnsCorrupt(t *testing.T) {
+	db := NewMemory()
+	db.SetTableOptions("http", TableOptions{Columns: []string{"status"}})
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 3*columnBlockRows; i++ {
+		if err := db.Insert(start.Add(time.Duration(i)*time.Second), "http", `{"status":%d}`, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.ApplyTableOptions(); err != nil {
+		t.Fatal(err)
+	}
+
+	// corrupt the chunk of the second block
+	data := db.getTablePath(start, "http")
+	idx, ok := db.savedColumns(data, []string{"status"})
+	if !ok || len(idx.Blocks) != 3 {
+		t.Fatal("expected the columns")
+	}
+
+	name := columnsFile(data)
+	b, err := fs.ReadFile(db.storage, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := 4 + int64(binary.LittleEndian.Uint32(b))
+	b[base+idx.Blocks[1].Chunks[1].Offset] ^= 0xff
+	if err := writeFile(db.storage, name, b); err != nil {
+		t.Fatal(err)
+	}
+
+	// the records of the blocks from it are parsed from the data
+	var status []float64
+	err = db.ScanColumns("http", start, start.AddDate(0, 0, 1), []string{"status"}, func(b ColumnBatch) error {
+		status = append(status, b.Columns[0].Numbers...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(status) != 3*columnBlockRows {
+		t.Fatalf("expected %d records, got %d", 3*columnBlockRows, len(status))
+	}
+	for i, v := range status {
+		if v != float64(i) {
+			t.Fatalf("unexpected status %d: %v", i, v)
+		}
+	}
+}
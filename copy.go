@@ -0,0 +1,117 @@
+package timedb
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// CopyRange copies the data of a table between start and end from src to dst.
+// The records are read line by line and appended to the files of dst, so
+// the copy is not idempotent: copying a range twice duplicates its records,
+// and the records of a day that already has data in dst are appended after
+// it even if they are older. The table can be a pattern to copy all the
+// matching tables.
+func CopyRange(src, dst *DB, table string, start, end time.Time) error {
+	if src == dst {
+		return fmt.Errorf("timeDB.CopyRange: source and destination are the same")
+	}
+
+	start = start.Local()
+	end = end.Local()
+
+	for _, day := range days(start, end) {
+		tables := []string{table}
+		if isPattern(table) {
+			var err error
+			tables, err = src.matchTables(day, table)
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return err
+			}
+		}
+
+		full := !start.After(day) && !end.Before(day.AddDate(0, 0, 1).Add(-time.Second))
+
+		for _, t := range tables {
+			if err := copyDay(src, dst, t, day, start, end, full); err != nil {
+				dst.resetUsage()
+				return err
+			}
+		}
+	}
+
+	dst.resetUsage()
+	return nil
+}
+
+// copyDay appends the records of the table in the day to dst. If full is
+// true the day is inside the range and the time of the lines is not checked.
+func copyDay(src, dst *DB, table string, day, start, end time.Time, full bool) error {
+	// the source is opened with its lock and read with only the lock of
+	// the destination, so two databases can copy into each other at the
+	// same time without a deadlock
+	path := src.getTablePath(day, table)
+	src.mutex.RLock()
+	in, err := src.openParts(day, path)
+	src.mutex.RUnlock()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("timeDB.CopyRange: error openning file %s: %v", path, err)
+	}
+	defer in.Close()
+
+	dst.mutex.Lock()
+	defer dst.mutex.Unlock()
+
+	out, err := dst.openAppend(day, table)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	// each part has its own header
+	w := bufio.NewWriter(out)
+	r := bufio.NewReader(in)
+	from, to := start.Unix(), end.Unix()
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 && !isHeader(line) {
+			if epoch := lineEpoch(line); full || epoch >= from && epoch <= to {
+				if line[len(line)-1] != '\n' {
+					line = append(line, '\n')
+				}
+				if _, err := w.Write(line); err != nil {
+					return fmt.Errorf("timeDB.CopyRange: error writing data %v", err)
+				}
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("timeDB.CopyRange: error reading %s: %v", path, err)
+		}
+	}
+
+	return w.Flush()
+}
+
+// days returns the start of each day between start and end.
+func days(start, end time.Time) []time.Time {
+	var result []time.Time
+	d := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
+	for !d.After(end) {
+		result = append(result, d)
+		d = d.AddDate(0, 0, 1)
+	}
+	return result
+}
@@ -0,0 +1,128 @@
+package timedb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCopyRange(t *testing.T) {
+	src := New(t.TempDir())
+	dst := New(t.TempDir())
+
+	day1 := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	day2 := day1.AddDate(0, 0, 1)
+
+	for i := 0; i < 4; i++ {
+		if err := src.Insert(day1.Add(time.Duration(i)*time.Hour), "logs", "a%d", i); err != nil {
+			t.Fatal(err)
+		}
+		if err := src.Insert(day2.Add(time.Duration(i)*time.Hour), "logs", "b%d", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// all day1 and the first two hours of day2
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local)
+	end := day2.Add(time.Hour)
+	if err := CopyRange(src, dst, "logs", start, end); err != nil {
+		t.Fatal(err)
+	}
+
+	scanner := dst.Query("logs", start, day2, 0, 0)
+	defer scanner.Close()
+
+	var got string
+	for scanner.Scan() {
+		got += scanner.Data().Text
+	}
+
+	if got != " a0 a1 a2 a3 b0 b1" {
+		t.Fatalf("unexpected result %q", got)
+	}
+}
+
+func TestCopyRangeParts(t *testing.T) {
+	src := New(t.TempDir())
+	dst := New(t.TempDir())
+
+	for _, db := range []*DB{src, dst} {
+		if err := db.SetTableOptions("logs", TableOptions{MaxFileSize: db.headerSize() + 30}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 4; i++ {
+		if err := src.Insert(start.Add(time.Duration(i)*time.Second), "logs", "a%d", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dst.Insert(start, "logs", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.Insert(start, "logs", "y"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the whole day and a range, both from all the parts
+	day := time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local)
+	if err := CopyRange(src, dst, "logs", day, day.AddDate(0, 0, 1).Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := CopyRange(src, dst, "logs", start.Add(2*time.Second), start.Add(3*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	scanner := dst.Query("logs", start, start, 0, 0)
+	defer scanner.Close()
+
+	var got string
+	for scanner.Scan() {
+		got += scanner.Data().Text
+	}
+	if got != " x y a0 a1 a2 a3 a2 a3" {
+		t.Fatalf("unexpected result %q", got)
+	}
+}
+
+func TestCopyRangeBothWays(t *testing.T) {
+	a := New(t.TempDir())
+	b := New(t.TempDir())
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	a.Insert(start, "logs", "a")
+	b.Insert(start, "logs", "b")
+
+	copies := []func() error{
+		func() error { return CopyRange(a, b, "logs", start, start) },
+		func() error { return Merge(b, a) },
+	}
+
+	for _, fn := range copies {
+		// b is being read by a copy to a, which waits for the lock of a
+		b.mutex.RLock()
+
+		done := make(chan error, 1)
+		go func() { done <- fn() }()
+		time.Sleep(50 * time.Millisecond)
+
+		// the copy from a waits for the lock of b without holding the one of a
+		locked := make(chan struct{})
+		go func() {
+			a.mutex.Lock()
+			a.mutex.Unlock()
+			close(locked)
+		}()
+
+		select {
+		case <-locked:
+		case <-time.After(5 * time.Second):
+			t.Fatal("deadlock")
+		}
+
+		b.mutex.RUnlock()
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
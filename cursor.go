@@ -0,0 +1,234 @@
+package timedb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// cursor is the position after the last record returned by a query.
+type cursor struct {
+	// Day and Offset are the file and the position of the next line.
+	// Offset is -1 if it is not known, for example in patterns.
+	Day    string `json:"d"`
+	Offset int64  `json:"o"`
+
+	// Time is the time of the last record and Skip the number of
+	// records returned with that time, to continue after them if
+	// the offset can't be used.
+	Time int64 `json:"t"`
+	Skip int   `json:"n"`
+
+	// Seq is the sequence number of the last record, if the table has them.
+	Seq uint64 `json:"s,omitempty"`
+}
+
+func (c cursor) token() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func parseCursor(token string) (*cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("timeDB: invalid cursor")
+	}
+
+	c := &cursor{}
+	if err := json.Unmarshal(b, c); err != nil || c.Skip < 0 {
+		return nil, fmt.Errorf("timeDB: invalid cursor")
+	}
+	return c, nil
+}
+
+// fileBoundary is where the data of a file starts in the stream read
+// by the scanner.
+type fileBoundary struct {
+	stream int64
+	day    time.Time
+
+	// offset is the position where the file was opened or -1 if
+	// it is not known.
+	offset int64
+
+	// merge is the reader of the tables of a pattern, that knows
+	// the table of each line.
+	merge *mergeReader
+}
+
+// Cursor returns an opaque token with the position after the last record
+// returned. Passed to SetCursor in a new query it continues after it,
+// without scanning again the records before and without missing or
+// repeating records if new ones are written. Without records it returns
+// the cursor of SetCursor or "".
+func (s *Scanner) Cursor() string {
+	if !s.hasLast {
+		return ""
+	}
+	return s.last.token()
+}
+
+// SetCursor continues the scan after the position of a cursor returned
+// by a previous query of the same table and filters. It replaces the
+// start of the query. It must be called before the first Scan.
+func (s *Scanner) SetCursor(token string) error {
+	r := s.reader
+	if !r.current.IsZero() || r.prefetch != nil || s.rows > 0 {
+		return fmt.Errorf("timeDB: the cursor must be set before scanning")
+	}
+
+	c, err := parseCursor(token)
+	if err != nil {
+		return err
+	}
+
+	r.start = time.Unix(c.Time, 0).Local()
+	r.resume = c
+
+	s.last = *c
+	s.hasLast = true
+
+	if c.Seq > 0 {
+		s.afterSeq = max(s.afterSeq, c.Seq)
+	} else {
+		s.resumeSkip = c.Skip
+	}
+	return nil
+}
+
+// skipResumed reports whether the record was returned before the cursor.
+func (s *Scanner) skipResumed(d DataPoint) bool {
+	if s.resumeSkip == 0 || s.reader.resumed {
+		return false
+	}
+	if d.Time.Unix() != s.reader.resume.Time {
+		s.resumeSkip = 0
+		return false
+	}
+	s.resumeSkip--
+	return true
+}
+
+// advanceCursor moves the cursor after the record just returned.
+func (s *Scanner) advanceCursor(d DataPoint) {
+	day, off := s.position(s.consumed)
+
+	t := d.Time.Unix()
+	if s.hasLast && s.last.Time == t {
+		s.last.Skip++
+	} else {
+		s.last.Time = t
+		s.last.Skip = 1
+	}
+
+	s.last.Seq = d.Seq
+	s.last.Day = s.reader.db.getDir(d.Time)
+	s.last.Offset = -1
+	if off >= 0 && s.reader.db.getDir(day) == s.last.Day {
+		s.last.Offset = off
+	}
+	s.hasLast = true
+}
+
+// boundary returns the boundaries from the one of the file of the stream
+// position end, that is the end of a line.
+func (s *Scanner) boundary(end int64) []fileBoundary {
+	r := s.reader
+
+	// the line is in the last file that starts before its end
+	b := r.boundaries
+	for len(b) > 1 && b[1].stream < end {
+		b = b[1:]
+	}
+	r.boundaries = b
+	return b
+}
+
+// position returns the day and the offset in its file of the stream
+// position end, that is the end of a line.
+func (s *Scanner) position(end int64) (time.Time, int64) {
+	b := s.boundary(end)
+	if len(b) == 0 || b[0].offset < 0 || b[0].stream >= end {
+		return time.Time{}, -1
+	}
+	return b[0].day, b[0].offset + end - b[0].stream
+}
+
+// tableAt returns the table of the line that ends at the stream
+// position end.
+func (s *Scanner) tableAt(end int64) string {
+	b := s.boundary(end)
+	if len(b) > 0 && b[0].merge != nil {
+		if table := b[0].merge.tableAt(end - b[0].stream); table != "" {
+			return table
+		}
+	}
+	return s.reader.table
+}
+
+// fileOffset returns the position of the file or -1 if it is not
+// known or it is not a position in a data file.
+func fileOffset(f io.Reader) int64 {
+	if _, ok := f.(*recentFile); ok {
+		return -1
+	}
+
+	sk, ok := f.(io.Seeker)
+	if !ok {
+		return -1
+	}
+
+	off, err := sk.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return -1
+	}
+	return off
+}
+
+// seekCursor moves the file of the day of the cursor to its offset if the
+// line before it is still the last record returned.
+func (r *reader) seekCursor(t time.Time, f io.Reader) {
+	c := r.resume
+	if c == nil || c.Offset <= 0 || r.db.getDir(t) != c.Day || fileOffset(f) < 0 {
+		return
+	}
+
+	ra, ok := f.(io.ReaderAt)
+	if !ok {
+		return
+	}
+
+	n := min(c.Offset, 4096)
+	buf := make([]byte, n)
+	if _, err := ra.ReadAt(buf, c.Offset-n); err != nil || buf[n-1] != '\n' {
+		return
+	}
+
+	// the start of the previous line
+	i := int64(len(buf)) - 2
+	for i >= 0 && buf[i] != '\n' {
+		i--
+	}
+	if i < 0 && n < c.Offset {
+		return
+	}
+
+	line := buf[i+1:]
+	if lineEpoch(line) != c.Time {
+		return
+	}
+	if c.Seq > 0 {
+		if j := bytes.IndexByte(line, ' '); j == -1 {
+			return
+		} else if _, seq, err := parseTimeField(string(line[:j])); err != nil || seq != c.Seq {
+			return
+		}
+	}
+
+	if _, err := f.(io.Seeker).Seek(c.Offset, io.SeekStart); err == nil {
+		r.resumed = true
+	}
+}
@@ -0,0 +1,118 @@
+package timedb
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCursor(t *testing.T) {
+	for _, table := range []string{"app", "app*"} {
+		t.Run(table, func(t *testing.T) {
+			testCursor(t, table)
+		})
+	}
+}
+
+func testCursor(t *testing.T, table string) {
+	db := New(t.TempDir())
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	next := start.AddDate(0, 0, 1)
+
+	// many records share the same second
+	var want []string
+	for i := 0; i < 10; i++ {
+		ts := start
+		if i >= 7 {
+			ts = next
+		}
+		text := fmt.Sprint("r", i)
+		if err := db.Insert(ts, "app", text); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, text)
+	}
+	db.Close()
+
+	var got []string
+	token := ""
+	for page := 0; page < 10; page++ {
+		s := db.Query(table, start, next.Add(time.Hour), 0, 3)
+		if token != "" {
+			if err := s.SetCursor(token); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		n := 0
+		for s.Scan() {
+			got = append(got, trimText(s.Data().Text))
+			n++
+		}
+		if s.Error != nil {
+			t.Fatal(s.Error)
+		}
+
+		if page == 1 && table == "app" && !s.reader.resumed {
+			t.Fatal("expected to seek to the offset of the cursor")
+		}
+
+		token = s.Cursor()
+		s.Close()
+
+		if page == 0 {
+			c, err := parseCursor(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if table == "app" && c.Offset != db.headerSize()+3*int64(len("1577869200 r0\n")) {
+				t.Fatalf("invalid offset %+v", c)
+			}
+			if table != "app" && c.Offset != -1 {
+				t.Fatalf("invalid offset %+v", c)
+			}
+
+			// new records in the same second are not skipped
+			if err := db.Insert(start, "app", "late"); err != nil {
+				t.Fatal(err)
+			}
+			db.Close()
+			want = append(want[:7], append([]string{"late"}, want[7:]...)...)
+		}
+
+		if n == 0 {
+			break
+		}
+	}
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestCursorErrors(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	if err := db.Insert(start, "app", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	s := db.Query("app", start, start.Add(time.Hour), 0, 0)
+	defer s.Close()
+
+	if err := s.SetCursor("x"); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if s.Cursor() != "" {
+		t.Fatal("expected no cursor")
+	}
+
+	s.Scan()
+	token := s.Cursor()
+	if err := s.SetCursor(token); err == nil {
+		t.Fatal("expected an error after scanning")
+	}
+}
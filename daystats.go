@@ -0,0 +1,301 @@
+package timedb
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// DayStats summarizes the records of a table in a day. They are saved
+// in a small file next to the data ("table.stats") so they can be used
+// without reading the data again.
+type DayStats struct {
+	Count int64
+	First time.Time
+	Last  time.Time
+
+	// Hours are the records of each hour of the day.
+	Hours [24]int64
+
+	// Sorted is true if the records are sorted by time.
+	Sorted bool
+
+	// Numeric is true if all the records have a numeric value.
+	Numeric bool
+	Min     float64
+	Max     float64
+
+	// Size is the size of the data that the stats include. If the
+	// file grows only the new lines are read.
+	Size int64
+
+	nonNumeric bool
+}
+
+type dayStatsFile struct {
+	DayStats
+	NonNumeric bool
+}
+
+// DayStats returns the stats of a table in a day.
+func (db *DB) DayStats(day time.Time, table string) (DayStats, error) {
+	if err := validTable(table); err != nil {
+		return DayStats{}, err
+	}
+
+	name := db.getTablePath(day, table)
+	statsName := statsFile(name)
+
+	st, _ := db.savedStats(name)
+
+	size, compressed, err := db.dataSize(name)
+	if err != nil {
+		return DayStats{}, err
+	}
+
+	if compressed && st.Count > 0 {
+		// compressed files don't change
+		return st, nil
+	}
+
+	if !compressed && size == st.Size {
+		return st, nil
+	}
+
+	if size < st.Size {
+		// the file was rewritten
+		st = DayStats{}
+	}
+
+	if err := db.readStats(&st, day, name); err != nil {
+		return DayStats{}, err
+	}
+
+	b, err := json.Marshal(dayStatsFile{DayStats: st, NonNumeric: st.nonNumeric})
+	if err != nil {
+		return DayStats{}, err
+	}
+
+	if db.lock != nil && db.lock.mode == LockRead {
+		return st, nil
+	}
+
+	db.mutex.Lock()
+	err = writeFile(db.storage, statsName, b)
+	db.mutex.Unlock()
+
+	if err != nil && !errors.Is(err, ErrReadOnly) {
+		db.log().Warn("timedb: error saving stats", "file", statsName, "error", err)
+	}
+
+	return st, nil
+}
+
+// savedStats returns the stats of a data file saved in its sidecar
+// without updating them.
+func (db *DB) savedStats(name string) (DayStats, bool) {
+	b, err := fs.ReadFile(db.storage, statsFile(name))
+	if err != nil {
+		return DayStats{}, false
+	}
+
+	var f dayStatsFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return DayStats{}, false
+	}
+
+	st := f.DayStats
+	st.nonNumeric = f.NonNumeric
+	return st, true
+}
+
+// tableStats returns the stats of the tables of the day that match
+// the table, which can be a pattern.
+func (db *DB) tableStats(day time.Time, table string) ([]DayStats, error) {
+	tables := []string{table}
+	if isPattern(table) {
+		var err error
+		if tables, err = db.matchTables(day, table); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, nil
+			}
+			return nil, err
+		}
+	}
+
+	var result []DayStats
+	for _, t := range tables {
+		st, err := db.DayStats(day, t)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		result = append(result, st)
+	}
+	return result, nil
+}
+
+// statsFile returns the name of the stats of a data file.
+func statsFile(name string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(name, ".zst"), ".log") + ".stats"
+}
+
+// sidecarFiles returns the files saved next to a data file.
+func sidecarFiles(name string) []string {
+	return []string{statsFile(name), bloomFile(name), indexFile(name), idsFile(name), columnsFile(name)}
+}
+
+// dataSize returns the size of a data file and its parts. It returns true
+// if some of them are compressed or archived, where the size is not known.
+func (db *DB) dataSize(name string) (int64, bool, error) {
+	var size int64
+	for part := 0; ; part++ {
+		p := partName(name, part)
+
+		info, err := fs.Stat(localStorage(db.storage), p)
+		if err == nil {
+			size += info.Size()
+			continue
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return 0, false, err
+		}
+
+		// it can be compressed, archived or in a remote store
+		f, err := db.storage.Open(p)
+		if err != nil {
+			if part > 0 && errors.Is(err, fs.ErrNotExist) {
+				return size, false, nil
+			}
+			return 0, false, err
+		}
+		f.Close()
+		return 0, true, nil
+	}
+}
+
+// readStats adds to the stats the lines of the file after st.Size.
+func (db *DB) readStats(st *DayStats, day time.Time, name string) error {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	f, err := db.openParts(day, name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if s, ok := f.(io.Seeker); ok {
+		if _, err := s.Seek(st.Size, io.SeekStart); err != nil {
+			return err
+		}
+	} else if _, err := io.CopyN(io.Discard, f, st.Size); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			// a line without the new line is not complete yet
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("timeDB: error reading %s: %v", name, err)
+		}
+
+		st.Size += int64(len(line))
+		db.addStats(st, line[:len(line)-1])
+	}
+}
+
+func (db *DB) addStats(st *DayStats, line string) {
+	epoch := lineEpoch([]byte(line))
+	if epoch == 0 {
+		return
+	}
+
+	t := time.Unix(epoch, 0)
+	if st.Count == 0 {
+		st.Sorted = true
+	} else if t.Before(st.Last) {
+		st.Sorted = false
+	}
+	if st.Count == 0 || t.Before(st.First) {
+		st.First = t
+	}
+	if st.Count == 0 || t.After(st.Last) {
+		st.Last = t
+	}
+	st.Count++
+	st.Hours[t.Hour()]++
+
+	if st.nonNumeric {
+		return
+	}
+
+	text := line[strings.IndexByte(line, ' ')+1:]
+	if strings.HasPrefix(text, encryptedPrefix) && db.keys != nil {
+		var err error
+		if text, err = db.decrypt(epoch, text); err != nil {
+			st.nonNumeric = true
+			st.Numeric = false
+			return
+		}
+	}
+
+	v, _, err := ParseValue(text)
+	if err != nil {
+		st.nonNumeric = true
+		st.Numeric = false
+		return
+	}
+
+	if !st.Numeric {
+		st.Numeric = true
+		st.Min, st.Max = v, v
+		return
+	}
+	if v < st.Min {
+		st.Min = v
+	}
+	if v > st.Max {
+		st.Max = v
+	}
+}
+
+// buildStats updates the stats of all the tables of the days before today.
+func (db *DB) buildStats() error {
+	dayList, err := db.days()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+
+	for _, day := range dayList {
+		if !day.Before(today) {
+			break
+		}
+
+		tables, err := db.matchTables(day, "**")
+		if err != nil {
+			return err
+		}
+
+		for _, table := range tables {
+			if _, err := db.DayStats(day, table); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package timedb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDayStats(t *testing.T) {
+	dir := t.TempDir()
+	db := New(dir)
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i, v := range []float64{3, -1, 7} {
+		if err := db.InsertValue(start.Add(time.Duration(i)*time.Hour), "cpu", v, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	st, err := db.DayStats(start, "cpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if st.Count != 3 || !st.First.Equal(start) || !st.Last.Equal(start.Add(2*time.Hour)) {
+		t.Fatalf("invalid stats %+v", st)
+	}
+	if st.Hours[10] != 1 || st.Hours[12] != 1 {
+		t.Fatalf("invalid hours %v", st.Hours)
+	}
+	if !st.Numeric || st.Min != -1 || st.Max != 7 {
+		t.Fatalf("invalid values %+v", st)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "2020-01-01", "cpu.stats")); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the new lines are read
+	if err := db.Insert(start.Add(3*time.Hour), "cpu", "x"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	st, err = New(dir).DayStats(start, "cpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Count != 4 || st.Numeric || st.Hours[13] != 1 {
+		t.Fatalf("invalid stats %+v", st)
+	}
+
+	// the stats are not a table
+	tables, err := db.matchTables(start, "**")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 1 {
+		t.Fatalf("expected 1 table, got %v", tables)
+	}
+}
@@ -0,0 +1,100 @@
+package timedb
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DedupOptions configure the deduplication of records on ingest.
+type DedupOptions struct {
+	// Window is how long a record is remembered. Zero disables
+	// the deduplication.
+	Window time.Duration
+
+	// Key returns the idempotency key of a record, for example an id
+	// field of the payload. If it is nil or returns an empty key the
+	// records are identical if they have the same time and data.
+	Key func(table, data string) string
+}
+
+// SetDedup drops the records identical to one saved within the window,
+// protecting against shippers that deliver the same record twice. The
+// records are remembered in memory so it only applies to this DB.
+func (db *DB) SetDedup(o DedupOptions) {
+	var d *deduper
+	if o.Window > 0 {
+		d = &deduper{opts: o, seen: make(map[string]time.Time)}
+	}
+	db.dedup.Store(d)
+}
+
+type deduper struct {
+	opts  DedupOptions
+	mutex sync.Mutex
+	seen  map[string]time.Time
+	queue []dedupEntry
+}
+
+type dedupEntry struct {
+	key  string
+	time time.Time
+}
+
+func (d *deduper) key(t time.Time, table, data string) string {
+	if d.opts.Key != nil {
+		if k := d.opts.Key(table, data); k != "" {
+			return table + "\x00" + k
+		}
+	}
+	return table + "\x00" + strconv.FormatInt(t.Unix(), 10) + "\x00" + data
+}
+
+// duplicate reports whether the record was seen within the window
+// and if not it remembers it.
+func (d *deduper) duplicate(t time.Time, table, data string) bool {
+	key := d.key(t, table, data)
+	now := time.Now()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	// forget the records outside of the window
+	limit := now.Add(-d.opts.Window)
+	i := 0
+	for ; i < len(d.queue); i++ {
+		e := d.queue[i]
+		if e.time.After(limit) {
+			break
+		}
+		if d.seen[e.key].Equal(e.time) {
+			delete(d.seen, e.key)
+		}
+	}
+	d.queue = d.queue[i:]
+
+	if _, ok := d.seen[key]; ok {
+		return true
+	}
+
+	d.seen[key] = now
+	d.queue = append(d.queue, dedupEntry{key: key, time: now})
+	return false
+}
+
+// forget removes records that were not written so they can be retried.
+func (d *deduper) forget(records []batchRecord) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, r := range records {
+		delete(d.seen, d.key(r.time, r.table, r.data))
+	}
+}
+
+// forgetDedup removes the records from the deduplication if it is enabled.
+func (db *DB) forgetDedup(records ...batchRecord) {
+	if d := db.dedup.Load(); d != nil {
+		d.forget(records)
+	}
+}
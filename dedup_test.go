@@ -0,0 +1,96 @@
+package timedb
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDedup(t *testing.T) {
+	db := NewMemory()
+	db.SetDedup(DedupOptions{Window: time.Minute})
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for _, r := range []struct {
+		t    time.Time
+		data string
+	}{
+		{start, "a"},
+		{start, "a"},
+		{start, "b"},
+		{start.Add(time.Second), "a"},
+	} {
+		if err := db.Insert(r.t, "log", r.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// other tables are independent
+	if err := db.Insert(start, "other", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := countRecords(t, db, "log", start); n != 3 {
+		t.Fatalf("expected 3 records, got %d", n)
+	}
+
+	// with an idempotency key
+	db.SetDedup(DedupOptions{Window: time.Minute, Key: func(table, data string) string {
+		id, _, _ := strings.Cut(data, " ")
+		return id
+	}})
+
+	b := db.NewBatch()
+	for _, data := range []string{"1 first", "2 second", "1 retry"} {
+		if err := b.Insert(start.Add(time.Hour), "keyed", data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if b.Len() != 2 {
+		t.Fatalf("expected 2 records, got %d", b.Len())
+	}
+
+	// discarded records can be saved again
+	b.Discard()
+	if err := db.Insert(start.Add(time.Hour), "keyed", "1 again"); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRecords(t, db, "keyed", start); n != 1 {
+		t.Fatalf("expected 1 record, got %d", n)
+	}
+}
+
+func TestDedupWindow(t *testing.T) {
+	db := NewMemory()
+	db.SetDedup(DedupOptions{Window: 50 * time.Millisecond})
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	if err := db.Insert(start, "log", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if err := db.Insert(start, "log", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRecords(t, db, "log", start); n != 2 {
+		t.Fatalf("expected 2 records, got %d", n)
+	}
+}
+
+func countRecords(t *testing.T, db *DB, table string, day time.Time) int {
+	t.Helper()
+
+	s := db.Query(table, day, day.AddDate(0, 0, 1), 0, 0)
+	defer s.Close()
+
+	n := 0
+	for s.Scan() {
+		n++
+	}
+	if s.Error != nil {
+		t.Fatal(s.Error)
+	}
+	return n
+}
@@ -0,0 +1,300 @@
+package timedb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	zdict "github.com/klauspost/compress/dict"
+	"github.com/klauspost/compress/zstd"
+)
+
+// dictDir is the metadata directory with the zstd dictionaries, one file
+// per dictionary named by its id, and dictTables the file with the
+// dictionary of each table.
+const (
+	dictDir    = "dicts"
+	dictTables = "dicts/tables.json"
+)
+
+const (
+	// maxDictSize is the size of the dictionaries. It is the
+	// default of the zstd command.
+	maxDictSize = 112 << 10
+
+	// maxDictSamples is the amount of data read to train a dictionary,
+	// divided between all the files of the period.
+	maxDictSamples = 8 << 20
+
+	// minDictSamples is the minimum amount of data to train a dictionary.
+	minDictSamples = 64 << 10
+)
+
+// dictionaries are the zstd dictionaries of the tables. They are loaded
+// from the metadata the first time they are needed. The dictionaries
+// replaced by a new one are kept to read the files compressed with them.
+type dictionaries struct {
+	mutex  sync.Mutex
+	byID   map[uint32][]byte
+	tables map[string]uint32
+}
+
+// get returns the dictionary with the id.
+func (d *dictionaries) get(s fs.FS, id uint32) ([]byte, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if b, ok := d.byID[id]; ok {
+		return b, nil
+	}
+
+	b, err := fs.ReadFile(s, dictFile(id))
+	if err != nil {
+		return nil, fmt.Errorf("timeDB: error reading the dictionary %d: %w", id, err)
+	}
+
+	if d.byID == nil {
+		d.byID = make(map[uint32][]byte)
+	}
+	d.byID[id] = b
+	return b, nil
+}
+
+// table returns the dictionary of the table or nil if it doesn't have one.
+func (d *dictionaries) table(s fs.FS, table string) ([]byte, error) {
+	d.mutex.Lock()
+	tables, err := d.loadTables(s)
+	d.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	id, ok := tables[table]
+	if !ok {
+		return nil, nil
+	}
+	return d.get(s, id)
+}
+
+// loadTables returns the dictionary of each table. The caller must hold the lock.
+func (d *dictionaries) loadTables(s fs.FS) (map[string]uint32, error) {
+	if d.tables != nil {
+		return d.tables, nil
+	}
+
+	tables := make(map[string]uint32)
+
+	b, err := fs.ReadFile(s, path.Join(metaDir, dictTables))
+	if err == nil {
+		if err := json.Unmarshal(b, &tables); err != nil {
+			return nil, fmt.Errorf("timeDB: invalid dictionaries: %v", err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	d.tables = tables
+	return tables, nil
+}
+
+// set saves the dictionary and makes it the one of the table.
+func (d *dictionaries) set(s storage, table string, id uint32, dict []byte) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	tables, err := d.loadTables(s)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFile(s, dictFile(id), dict); err != nil {
+		return err
+	}
+
+	m := make(map[string]uint32, len(tables)+1)
+	for k, v := range tables {
+		m[k] = v
+	}
+	m[table] = id
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(s, path.Join(metaDir, dictTables), b); err != nil {
+		return err
+	}
+
+	if d.byID == nil {
+		d.byID = make(map[uint32][]byte)
+	}
+	d.byID[id] = dict
+	d.tables = m
+	return nil
+}
+
+func dictFile(id uint32) string {
+	return path.Join(metaDir, dictDir, strconv.FormatUint(uint64(id), 10)+".dict")
+}
+
+// TrainDictionary builds a zstd dictionary from the records of the table
+// between start and end and uses it to compress the next days of the table.
+// Dictionaries improve the ratio and the speed of the short repetitive lines
+// of the logs, where a file alone has little history to compress them.
+func (db *DB) TrainDictionary(table string, start, end time.Time) error {
+	if _, err := db.trainDictionary(table, start, end); err != nil {
+		return fmt.Errorf("timeDB.TrainDictionary: %w", err)
+	}
+	return nil
+}
+
+// Dictionary returns the id of the dictionary of the table or
+// zero if it doesn't have one.
+func (db *DB) Dictionary(table string) (uint32, error) {
+	d := db.dicts
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	tables, err := d.loadTables(localStorage(db.storage))
+	if err != nil {
+		return 0, err
+	}
+	return tables[table], nil
+}
+
+func (db *DB) trainDictionary(table string, start, end time.Time) ([]byte, error) {
+	samples, size, err := db.dictSamples(table, start, end)
+	if err != nil {
+		return nil, err
+	}
+	if size < minDictSamples {
+		return nil, fmt.Errorf("not enough data to train a dictionary for %s: %d bytes", table, size)
+	}
+
+	dict, err := zdict.BuildZstdDict(samples, zdict.Options{
+		MaxDictSize: maxDictSize,
+		HashBytes:   6,
+		ZstdLevel:   zstd.SpeedDefault,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := zstd.InspectDictionary(dict)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.dicts.set(localStorage(db.storage), table, info.ID(), dict); err != nil {
+		return nil, err
+	}
+
+	db.log().Info("timedb: dictionary trained", "table", table, "id", info.ID(), "samples", size)
+	return dict, nil
+}
+
+// dictSamples returns the lines of the table between start and end to
+// train a dictionary, taking the same amount of data from each file.
+func (db *DB) dictSamples(table string, start, end time.Time) ([][]byte, int, error) {
+	var files []string
+	err := db.eachDataFile(table, start, end, func(day time.Time, table, name string) error {
+		files = append(files, name)
+		return nil
+	})
+	if err != nil || len(files) == 0 {
+		return nil, 0, err
+	}
+
+	var samples [][]byte
+	var size int
+	budget := maxDictSamples / len(files)
+
+	for _, name := range files {
+		f, err := db.storage.Open(name)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		r := bufio.NewReader(f)
+		for n := 0; n < budget; {
+			line, err := r.ReadBytes('\n')
+			if err != nil {
+				// the last line could be being written
+				if err != io.EOF {
+					f.Close()
+					return nil, 0, fmt.Errorf("error reading %s: %v", name, err)
+				}
+				break
+			}
+			if isHeader(line) {
+				continue
+			}
+			samples = append(samples, bytes.Clone(line))
+			n += len(line)
+			size += len(line)
+		}
+		f.Close()
+	}
+
+	return samples, size, nil
+}
+
+// compressor returns the options to compress the files of the table. If
+// the table has TableOptions.Dictionary and no dictionary yet, it is
+// trained with the data of the day. The caller must hold the lock.
+func (db *DB) compressor(day time.Time, table string, o TableOptions) ([]zstd.EOption, error) {
+	dict, err := db.dicts.table(localStorage(db.storage), table)
+	if err != nil {
+		return nil, err
+	}
+
+	if dict == nil && o.Dictionary {
+		if dict, err = db.trainDictionary(table, day, day); err != nil {
+			// small tables are compressed without dictionary
+			db.log().Warn("timedb: error training a dictionary", "table", table, "error", err)
+			return nil, nil
+		}
+	}
+
+	if dict == nil {
+		return nil, nil
+	}
+	return []zstd.EOption{zstd.WithEncoderDict(dict)}, nil
+}
+
+// decompressor returns the options to decompress a file reading the
+// dictionary it was compressed with from the header of the first frame,
+// after the sync marker if it has one.
+func (d *dictionaries) decompressor(s fs.FS, r *bufio.Reader) ([]zstd.DOption, error) {
+	if d == nil {
+		return nil, nil
+	}
+
+	b, err := r.Peek(syncMarkerSize + zstd.HeaderMaxSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if _, ok := parseSyncMarker(b); ok {
+		b = b[syncMarkerSize:]
+	}
+
+	var h zstd.Header
+	if err := h.Decode(b); err != nil || h.DictionaryID == 0 {
+		// invalid headers are reported by the decoder
+		return nil, nil
+	}
+
+	dict, err := d.get(s, h.DictionaryID)
+	if err != nil {
+		return nil, err
+	}
+	return []zstd.DOption{zstd.WithDecoderDicts(dict)}, nil
+}
@@ -0,0 +1,79 @@
+package timedb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestDictionary(t *testing.T) {
+	dir := t.TempDir()
+	db := New(dir)
+
+	db.SetTableOptions("nginx", TableOptions{Compress: true, Dictionary: true})
+	db.SetTableOptions("small", TableOptions{Compress: true, Dictionary: true})
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 5000; i++ {
+		if err := db.Insert(start, "nginx", "GET /api/v1/users/%d 200 %dms", i, i%100); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Insert(start, "small", "GET /")
+
+	if err := db.ApplyTableOptions(); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := db.Dictionary("nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id == 0 {
+		t.Fatal("expected a dictionary")
+	}
+
+	if id, _ := db.Dictionary("small"); id != 0 {
+		t.Fatal("not enough data to train a dictionary")
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "2020-01-01", "nginx.log.zst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first frame is after the sync marker
+	var h zstd.Header
+	if err := h.Decode(b[syncMarkerSize:]); err != nil {
+		t.Fatal(err)
+	}
+	if h.DictionaryID != id {
+		t.Fatalf("expected dictionary %d, got %d", id, h.DictionaryID)
+	}
+	db.Close()
+
+	// the dictionary is loaded from the metadata
+	db = New(dir)
+	defer db.Close()
+
+	if n := countRecords(t, db, "nginx", start); n != 5000 {
+		t.Fatalf("expected 5000 records, got %d", n)
+	}
+	if n := countRecords(t, db, "small", start); n != 1 {
+		t.Fatalf("expected 1 record, got %d", n)
+	}
+
+	// appending decompresses the file
+	if err := db.Insert(start, "nginx", "GET /"); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRecords(t, db, "nginx", start); n != 5001 {
+		t.Fatalf("expected 5001 records, got %d", n)
+	}
+
+	if err := db.TrainDictionary("small", start, start); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,43 @@
+package timedb
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrDiskFull is returned when a write fails because there is no space
+// left on the device or the user exceeded its disk quota.
+var ErrDiskFull = errors.New("timeDB: disk full")
+
+// OnDiskFull sets a function that is called when a write fails with
+// ErrDiskFull, so the application can stop logging or send an alert.
+// It is called after the lock of the database is released, so it can
+// use the database.
+func (db *DB) OnDiskFull(fn func(err error)) {
+	db.mutex.Lock()
+	db.diskFull = fn
+	db.mutex.Unlock()
+}
+
+// diskFullError wraps the error with ErrDiskFull if the disk is full.
+func diskFullError(err error) error {
+	if err != nil && isDiskFull(err) {
+		return fmt.Errorf("%w: %v", ErrDiskFull, err)
+	}
+	return err
+}
+
+// notifyDiskFull calls the disk full callback if the error is ErrDiskFull.
+func (db *DB) notifyDiskFull(err error) {
+	if !errors.Is(err, ErrDiskFull) {
+		return
+	}
+
+	db.mutex.RLock()
+	fn := db.diskFull
+	db.mutex.RUnlock()
+
+	if fn != nil {
+		fn(err)
+	}
+}
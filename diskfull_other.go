@@ -0,0 +1,8 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package timedb
+
+// isDiskFull is not supported in this system.
+func isDiskFull(err error) bool {
+	return false
+}
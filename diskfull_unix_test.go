@@ -0,0 +1,49 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package timedb
+
+import (
+	"errors"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fullStorage fails all the writes with ENOSPC.
+type fullStorage struct {
+	storage
+}
+
+func (s fullStorage) Append(name string) (io.WriteCloser, error) {
+	return fullWriter{}, nil
+}
+
+type fullWriter struct{}
+
+func (fullWriter) Write(p []byte) (int, error) {
+	return 0, syscall.ENOSPC
+}
+
+func (fullWriter) Close() error {
+	return nil
+}
+
+func TestDiskFull(t *testing.T) {
+	db := NewMemory()
+	db.storage = archiveStorage{storage: fullStorage{newMemStorage()}, dicts: db.dicts}
+
+	var notified error
+	db.OnDiskFull(func(err error) {
+		notified = err
+	})
+
+	err := db.Insert(time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local), "log", "a")
+	if !errors.Is(err, ErrDiskFull) {
+		t.Fatalf("expected ErrDiskFull, got %v", err)
+	}
+
+	if !errors.Is(notified, ErrDiskFull) {
+		t.Fatalf("expected a notification, got %v", notified)
+	}
+}
@@ -0,0 +1,151 @@
+package timedb
+
+import (
+	"errors"
+	"io/fs"
+	"time"
+)
+
+// DayUsage is the disk space used by a table in a day.
+type DayUsage struct {
+	Day   time.Time
+	Bytes int64
+}
+
+// DiskUsage returns the bytes used by the local data files of the table,
+// including its parts and the compressed files.
+func (db *DB) DiskUsage(table string) (int64, error) {
+	days, err := db.DiskUsageByDay(table)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, d := range days {
+		total += d.Bytes
+	}
+	return total, nil
+}
+
+// DiskUsageByDay returns the bytes used by the local data files of the
+// table in each day, sorted by date. The days without data are omitted.
+// The sizes are cached and updated with the writes, so only the files
+// that changed in other ways are read again.
+func (db *DB) DiskUsageByDay(table string) ([]DayUsage, error) {
+	if err := validTable(table); err != nil {
+		return nil, err
+	}
+
+	dayList, err := db.storageDays(localStorage(db.storage))
+	if err != nil {
+		return nil, err
+	}
+
+	var result []DayUsage
+	for _, day := range dayList {
+		size, err := db.fileUsage(db.getTablePath(day, table))
+		if err != nil {
+			return nil, err
+		}
+		if size > 0 {
+			result = append(result, DayUsage{Day: day, Bytes: size})
+		}
+	}
+	return result, nil
+}
+
+// ScanSize returns the bytes of the local data files that a query of the
+// table in the range [start, end] reads at most. The table can be a pattern.
+func (db *DB) ScanSize(table string, start, end time.Time) (int64, error) {
+	if !isPattern(table) {
+		if err := validTable(table); err != nil {
+			return 0, err
+		}
+	}
+
+	dayList, err := db.storageDays(localStorage(db.storage))
+	if err != nil {
+		return 0, err
+	}
+
+	start = start.Local()
+	first := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.Local)
+
+	var total int64
+	for _, day := range dayList {
+		if day.Before(first) || day.After(end) {
+			continue
+		}
+
+		tables := []string{table}
+		if isPattern(table) {
+			var err error
+			tables, err = db.matchTables(day, table)
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					continue
+				}
+				return 0, err
+			}
+		}
+
+		for _, t := range tables {
+			size, err := db.fileUsage(db.getTablePath(day, t))
+			if err != nil {
+				return 0, err
+			}
+			total += size
+		}
+	}
+	return total, nil
+}
+
+// fileUsage returns the size of a data file with its parts.
+func (db *DB) fileUsage(name string) (int64, error) {
+	u := &db.usage
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if size, ok := u.files[name]; ok {
+		return size, nil
+	}
+
+	local := localStorage(db.storage)
+
+	var size int64
+	for _, f := range append([]string{name, name + ".zst"}, partFiles(local, name)...) {
+		info, err := fs.Stat(local, f)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return 0, err
+		}
+		size += info.Size()
+	}
+
+	if u.files == nil {
+		u.files = make(map[string]int64)
+	}
+	u.files[name] = size
+	return size, nil
+}
+
+// addFileUsage counts the bytes written to a data file that are
+// not records, like the header.
+func (db *DB) addFileUsage(name string, n int64) {
+	u := &db.usage
+	u.mutex.Lock()
+	if _, ok := u.files[name]; ok {
+		u.files[name] += n
+	}
+	u.mutex.Unlock()
+}
+
+// forgetFileUsage forgets the size of a data file that was rewritten.
+func (db *DB) forgetFileUsage(name string) {
+	u := &db.usage
+	u.mutex.Lock()
+	delete(u.files, name)
+	u.mutex.Unlock()
+}
@@ -0,0 +1,102 @@
+package timedb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDiskUsage(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 3; i++ {
+		if err := db.Insert(start.AddDate(0, 0, i), "nginx", "GET /"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Insert(start, "app", "started"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the header and a line of 17 bytes
+	line := db.headerSize() + 17
+
+	days, err := db.DiskUsageByDay("nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 3 || !days[1].Day.Equal(time.Date(2020, 1, 2, 0, 0, 0, 0, time.Local)) || days[1].Bytes != line {
+		t.Fatalf("invalid usage %v", days)
+	}
+
+	// the cached sizes are updated with the writes, also in new files
+	if err := db.Insert(start.AddDate(0, 0, 2), "nginx", "GET /"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Insert(start.AddDate(0, 0, 3), "nginx", "GET /"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Insert(start.AddDate(0, 0, 1), "app", "GET /"); err != nil {
+		t.Fatal(err)
+	}
+
+	days, err = db.DiskUsageByDay("nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 4 || days[2].Bytes != line+17 || days[3].Bytes != line {
+		t.Fatalf("invalid usage %v", days)
+	}
+
+	total, err := db.DiskUsage("nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 4*line+17 {
+		t.Fatalf("invalid total %d", total)
+	}
+
+	if err := db.Prune(start.AddDate(0, 0, 2)); err != nil {
+		t.Fatal(err)
+	}
+
+	days, err = db.DiskUsageByDay("nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 2 {
+		t.Fatalf("invalid usage %v", days)
+	}
+}
+
+func TestScanSize(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 3; i++ {
+		if err := db.Insert(start.AddDate(0, 0, i), "prod/nginx", "GET /"); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Insert(start.AddDate(0, 0, i), "prod/app", "GET /"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	file := db.headerSize() + 17
+
+	size, err := db.ScanSize("prod/nginx", start.Add(time.Hour), start.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 2*file {
+		t.Fatalf("invalid size %d", size)
+	}
+
+	size, err = db.ScanSize("prod/*", start, start.AddDate(0, 0, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 6*file {
+		t.Fatalf("invalid size %d", size)
+	}
+}
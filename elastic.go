@@ -0,0 +1,235 @@
+package timedb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultElasticBulkSize is the default size of the _bulk requests.
+const defaultElasticBulkSize = 5 << 20
+
+// ElasticOptions configure an export to Elasticsearch.
+type ElasticOptions struct {
+	// URL is the address of the cluster, like "http://localhost:9200".
+	URL string
+
+	// Index is the index of the documents, by default the name of the
+	// table. A date layout between braces is replaced by the day of the
+	// record, like "nginx-{2006.01.02}". The names are lowercased and
+	// the characters not allowed in indexes replaced by "-".
+	Index string
+
+	// Labels are added to the labels of every document, which have the
+	// table and the labels of the records of numeric tables.
+	Labels Labels
+
+	// BulkSize is the maximum size of each _bulk request, 5MB if zero.
+	BulkSize int
+
+	// Token is sent as a bearer token if it is not empty.
+	Token string
+
+	// Header are other headers of the requests.
+	Header http.Header
+
+	// Client is http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// elasticDoc is a document of the export with the fields of the
+// Elastic Common Schema.
+type elasticDoc struct {
+	Timestamp time.Time `json:"@timestamp"`
+	Message   string    `json:"message"`
+	Labels    Labels    `json:"labels"`
+}
+
+// ExportElastic sends the records of the table in [start, end) to
+// Elasticsearch with _bulk requests, to search selected ranges in an
+// existing ELK stack. The table can be a pattern. It returns the number
+// of documents indexed.
+func (db *DB) ExportElastic(table string, start, end time.Time, o ElasticOptions) (int64, error) {
+	var n int64
+	err := db.elasticBulk(table, start, end, o, func(payload []byte, docs int) error {
+		if err := o.post(payload); err != nil {
+			return err
+		}
+		n += int64(docs)
+		return nil
+	})
+	if err != nil {
+		return n, fmt.Errorf("timeDB.ExportElastic: %w", err)
+	}
+	return n, nil
+}
+
+// WriteElasticBulk writes the records of the table in [start, end) as
+// the body of _bulk requests, to send them later with:
+//
+//	curl -H "Content-Type: application/x-ndjson" --data-binary @file http://localhost:9200/_bulk
+//
+// A new body starts every BulkSize bytes, so each one fits in a request.
+func (db *DB) WriteElasticBulk(w io.Writer, table string, start, end time.Time, o ElasticOptions) error {
+	return db.elasticBulk(table, start, end, o, func(payload []byte, docs int) error {
+		_, err := w.Write(payload)
+		return err
+	})
+}
+
+// elasticBulk calls fn with the payloads of the _bulk requests.
+func (db *DB) elasticBulk(table string, start, end time.Time, o ElasticOptions, fn func(payload []byte, docs int) error) error {
+	size := o.BulkSize
+	if size <= 0 {
+		size = defaultElasticBulkSize
+	}
+
+	var buf bytes.Buffer
+	var docs int
+	e := json.NewEncoder(&buf)
+	e.SetEscapeHTML(false)
+
+	err := db.eachTableDay(table, start, end, func(table string, day, from, to time.Time) error {
+		action := map[string]map[string]string{"index": {"_index": o.index(table, day)}}
+
+		s := db.Query(table, from, to, 0, 0)
+		defer s.Close()
+
+		for s.Scan() {
+			d := s.Data()
+			if !d.Time.Before(to) {
+				break
+			}
+
+			doc := elasticDoc{
+				Timestamp: d.Time.UTC(),
+				Message:   strings.ToValidUTF8(trimText(d.Text), "�"),
+				Labels:    Labels{"table": table},
+			}
+			if _, labels, err := ParseValue(d.Text); err == nil {
+				for k, v := range labels {
+					doc.Labels[k] = v
+				}
+			}
+			for k, v := range o.Labels {
+				doc.Labels[k] = v
+			}
+
+			mark := buf.Len()
+			if err := e.Encode(action); err != nil {
+				return err
+			}
+			if err := e.Encode(doc); err != nil {
+				return err
+			}
+
+			if buf.Len() > size && docs > 0 {
+				// send the previous documents and start with this one
+				if err := fn(buf.Bytes()[:mark], docs); err != nil {
+					return err
+				}
+				rest := append([]byte(nil), buf.Bytes()[mark:]...)
+				buf.Reset()
+				buf.Write(rest)
+				docs = 0
+			}
+			docs++
+		}
+		return s.Error
+	})
+	if err != nil {
+		return err
+	}
+
+	if docs > 0 {
+		return fn(buf.Bytes(), docs)
+	}
+	return nil
+}
+
+// index returns the index of the records of the table of the day.
+func (o ElasticOptions) index(table string, day time.Time) string {
+	index := o.Index
+	if index == "" {
+		index = table
+	}
+
+	if i := strings.IndexByte(index, '{'); i != -1 {
+		if j := strings.IndexByte(index[i:], '}'); j != -1 {
+			index = index[:i] + day.Format(index[i+1:i+j]) + index[i+j+1:]
+		}
+	}
+
+	index = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\*?"<>|, #:`, r) {
+			return '-'
+		}
+		return r
+	}, strings.ToLower(index))
+
+	return strings.TrimLeft(index, "-_+")
+}
+
+// elasticResponse is the response of a _bulk request.
+type elasticResponse struct {
+	Errors bool
+	Items  []map[string]struct {
+		Status int
+		Error  struct {
+			Type   string
+			Reason string
+		}
+	}
+}
+
+// post sends a _bulk request. Elasticsearch answers 200 even if some
+// documents fail, so the error of the first one is returned.
+func (o ElasticOptions) post(payload []byte) error {
+	url := strings.TrimSuffix(o.URL, "/") + "/_bulk"
+	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	for k, v := range o.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if o.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+o.Token)
+	}
+
+	client := o.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		io.Copy(io.Discard, resp.Body)
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	var r elasticResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return fmt.Errorf("%s: invalid response: %w", url, err)
+	}
+	if r.Errors {
+		for _, item := range r.Items {
+			for _, v := range item {
+				if v.Status >= 300 {
+					return fmt.Errorf("%s: %s: %s", url, v.Error.Type, v.Error.Reason)
+				}
+			}
+		}
+	}
+	return nil
+}
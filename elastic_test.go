@@ -0,0 +1,89 @@
+package timedb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportElastic(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 10; i++ {
+		db.Insert(start.Add(time.Duration(i)*time.Second), "prod/nginx", "GET /%d", i)
+	}
+	db.InsertValue(start, "cpu", 0.5, Labels{"host": "a"})
+
+	var requests int
+	var docs []elasticDoc
+	var indexes []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		requests++
+
+		s := bufio.NewScanner(r.Body)
+		for s.Scan() {
+			var action map[string]map[string]string
+			json.Unmarshal(s.Bytes(), &action)
+			indexes = append(indexes, action["index"]["_index"])
+
+			s.Scan()
+			var doc elasticDoc
+			json.Unmarshal(s.Bytes(), &doc)
+			docs = append(docs, doc)
+		}
+		w.Write([]byte(`{"errors":false,"items":[]}`))
+	}))
+	defer ts.Close()
+
+	o := ElasticOptions{URL: ts.URL, Index: "logs-{2006.01.02}", Labels: Labels{"env": "prod"}, BulkSize: 500}
+	n, err := db.ExportElastic("**", start, start.Add(time.Hour), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 11 || len(docs) != 11 || requests < 2 {
+		t.Fatalf("unexpected export of %d documents in %d requests", len(docs), requests)
+	}
+	if indexes[0] != "logs-2020.01.01" {
+		t.Fatalf("unexpected index %s", indexes[0])
+	}
+	if d := docs[0]; d.Labels["host"] != "a" || d.Labels["env"] != "prod" || d.Labels["table"] != "cpu" {
+		t.Fatalf("unexpected document %+v", d)
+	}
+	if d := docs[10]; d.Message != "GET /9" || !d.Timestamp.Equal(start.Add(9*time.Second)) || d.Labels["table"] != "prod/nginx" {
+		t.Fatalf("unexpected document %+v", d)
+	}
+
+	var buf bytes.Buffer
+	if err := db.WriteElasticBulk(&buf, "prod/nginx", start, start.Add(time.Hour), ElasticOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 20 || lines[0] != `{"index":{"_index":"prod-nginx"}}` {
+		t.Fatalf("unexpected bulk %s", buf.String())
+	}
+}
+
+func TestExportElasticError(t *testing.T) {
+	db := NewMemory()
+	db.Insert(time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local), "nginx", "GET /")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"errors":true,"items":[{"index":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse"}}}]}`))
+	}))
+	defer ts.Close()
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local)
+	_, err := db.ExportElastic("nginx", start, start.AddDate(0, 0, 1), ElasticOptions{URL: ts.URL})
+	if err == nil || !strings.Contains(err.Error(), "failed to parse") {
+		t.Fatalf("expected the error of the document, got %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package timedb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// encrypted records are stored as "$aes$keyID$base64(nonce + ciphertext)".
+const encryptedPrefix = "$aes$"
+
+// ErrEncrypted is returned building a full text index, a bloom filter or
+// the columns of a database with encryption, because they would save the
+// text of the records in clear.
+var ErrEncrypted = errors.New("timeDB: the indexes are not built with encryption")
+
+// KeyProvider provides the AES keys (16, 24 or 32 bytes) used to encrypt the data.
+// The key id is stored with each record so keys can be rotated.
+type KeyProvider interface {
+	// CurrentKey returns the key used to encrypt new records.
+	CurrentKey() (id string, key []byte, err error)
+
+	// Key returns the key with the given id to decrypt existing records.
+	Key(id string) ([]byte, error)
+}
+
+// StaticKey is a KeyProvider with a single key.
+type StaticKey []byte
+
+func (k StaticKey) CurrentKey() (string, []byte, error) {
+	return "0", k, nil
+}
+
+func (k StaticKey) Key(id string) ([]byte, error) {
+	if id != "0" {
+		return nil, fmt.Errorf("timeDB: invalid key id %s", id)
+	}
+	return k, nil
+}
+
+// SetKeyProvider enables the encryption of new records with AES-GCM.
+// Only the data is encrypted, the time of the records is stored in clear.
+// Records are decrypted transparently when queried. The full text indexes,
+// bloom filters and columns are not built anymore (see ErrEncrypted).
+func (db *DB) SetKeyProvider(keys KeyProvider) {
+	db.mutex.Lock()
+	db.keys = keys
+	db.mutex.Unlock()
+}
+
+// encrypted reports whether the new records are encrypted.
+func (db *DB) encrypted() bool {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	return db.keys != nil
+}
+
+func (db *DB) encrypt(epoch int64, data string) (string, error) {
+	id, key, err := db.keys.CurrentKey()
+	if err != nil {
+		return "", fmt.Errorf("timeDB: error getting the key: %v", err)
+	}
+
+	if strings.Contains(id, "$") {
+		return "", fmt.Errorf("timeDB: invalid key id %s", id)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	// the time is authenticated so records can't be moved
+	b := gcm.Seal(nonce, nonce, []byte(data), []byte(strconv.FormatInt(epoch, 10)))
+	return encryptedPrefix + id + "$" + base64.RawStdEncoding.EncodeToString(b), nil
+}
+
+func (db *DB) decrypt(epoch int64, text string) (string, error) {
+	text = strings.TrimPrefix(text, encryptedPrefix)
+
+	i := strings.IndexByte(text, '$')
+	if i == -1 {
+		return "", fmt.Errorf("timeDB: invalid encrypted record")
+	}
+
+	key, err := db.keys.Key(text[:i])
+	if err != nil {
+		return "", fmt.Errorf("timeDB: error getting the key: %v", err)
+	}
+
+	b, err := base64.RawStdEncoding.DecodeString(text[i+1:])
+	if err != nil {
+		return "", fmt.Errorf("timeDB: invalid encrypted record: %v", err)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	if len(b) < gcm.NonceSize() {
+		return "", fmt.Errorf("timeDB: invalid encrypted record")
+	}
+
+	nonce := b[:gcm.NonceSize()]
+	data, err := gcm.Open(nil, nonce, b[gcm.NonceSize():], []byte(strconv.FormatInt(epoch, 10)))
+	if err != nil {
+		return "", fmt.Errorf("timeDB: error decrypting record: %v", err)
+	}
+
+	return string(data), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("timeDB: invalid key: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
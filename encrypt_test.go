@@ -0,0 +1,42 @@
+package timedb
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestEncryption(t *testing.T) {
+	db := NewMemory()
+	db.SetKeyProvider(StaticKey("0123456789abcdef0123456789abcdef"))
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	if err := db.Insert(start, "logs", "secret %d", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Insert(start, "logs", "other"); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := db.storage.Open(db.getTablePath(start, "logs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(f)
+	if bytes.Contains(b, []byte("secret")) {
+		t.Fatal("the data is not encrypted")
+	}
+
+	scanner := db.Query("logs", start, start, 0, 0)
+	defer scanner.Close()
+	scanner.SetFilter("secret")
+
+	if !scanner.Scan() || scanner.Data().Text != " secret 1" {
+		t.Fatalf("unexpected data %q %v", scanner.Data().Text, scanner.Error)
+	}
+
+	if scanner.Scan() {
+		t.Fatal("expected only one result")
+	}
+}
@@ -0,0 +1,133 @@
+package timedb
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+)
+
+// QueryPlan describes how a query is executed.
+type QueryPlan struct {
+	Table string
+	Start time.Time
+	End   time.Time
+	Files []PlanFile
+
+	// Bytes is the estimated size of the data read. The size of
+	// compressed and archived files is not known.
+	Bytes int64
+
+	// Notes explain the decisions of the plan.
+	Notes []string
+}
+
+// PlanFile is a file that the query opens.
+type PlanFile struct {
+	Name string
+	Size int64
+
+	// Compressed is true if the file is compressed or in an archive.
+	Compressed bool
+
+	// Stats is true if the file has stats (see DayStats).
+	Stats bool
+
+	// Skipped is true if the bloom filter of the file says that it
+	// doesn't contain the filter (see BuildBloom).
+	Skipped bool
+}
+
+// Explain returns the plan of the query without reading the data.
+func (s *Scanner) Explain() (*QueryPlan, error) {
+	r := s.reader
+	db := r.db
+
+	plan := &QueryPlan{Table: r.table, Start: r.start, End: r.end}
+	skipped := 0
+
+	for _, day := range days(r.start, r.end) {
+		tables := []string{r.table}
+		if isPattern(r.table) {
+			var err error
+			if tables, err = db.matchTables(day, r.table); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+			if len(tables) > 1 {
+				plan.note("%s: %d tables merged by time", db.getDir(day), len(tables))
+			}
+		}
+
+		for _, table := range tables {
+			name := db.getTablePath(day, table)
+
+			size, compressed, err := db.dataSize(name)
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					continue
+				}
+				return nil, err
+			}
+
+			_, err = fs.Stat(db.storage, statsFile(name))
+			f := PlanFile{Name: name, Size: size, Compressed: compressed, Stats: err == nil}
+
+			if r.filter != "" && db.skipBloom(name, r.filter) {
+				f.Skipped = true
+				skipped++
+			} else {
+				plan.Bytes += size
+			}
+
+			plan.Files = append(plan.Files, f)
+		}
+	}
+
+	if len(plan.Files) == 0 {
+		plan.note("no files in the range")
+	}
+
+	if r.filter != "" {
+		plan.note("filter %q: every line is read and compared", r.filter)
+		if skipped > 0 {
+			plan.note("bloom filters: %d files skipped", skipped)
+		}
+	}
+
+	if s.json != nil {
+		plan.note("json filter %q: every line is parsed", s.json)
+	}
+
+	if len(s.filters) > 0 {
+		plan.note("%d filter functions: every line is evaluated", len(s.filters))
+	}
+
+	if s.project != nil {
+		plan.note("projection %q: only the matching lines are returned", s.project)
+	}
+
+	if r.offset > 0 {
+		plan.note("offset %d: the records before it are read and skipped", r.offset)
+	}
+
+	if r.limit > 0 {
+		plan.note("limit %d: the scan stops after it", r.limit-r.offset)
+	}
+
+	if p := r.prefetch; p != nil {
+		plan.note("parallel: up to %d days read ahead", cap(p.slots))
+	}
+
+	switch {
+	case s.sample.every > 1:
+		plan.note("sample: every %d records", s.sample.every)
+	case s.sample.rand != nil:
+		plan.note("sample: %.2f%% of the records", s.sample.rate*100)
+	}
+
+	return plan, nil
+}
+
+func (p *QueryPlan) note(format string, v ...interface{}) {
+	p.Notes = append(p.Notes, fmt.Sprintf(format, v...))
+}
@@ -0,0 +1,45 @@
+package timedb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExplain(t *testing.T) {
+	db := New(t.TempDir())
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 3; i++ {
+		if err := db.Insert(start.AddDate(0, 0, i), "app-1", "a"); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Insert(start.AddDate(0, 0, i), "app-2", "b"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := db.DayStats(start, "app-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	s := db.Query("app-*", start, start.AddDate(0, 0, 1), 0, 0)
+	defer s.Close()
+	s.SetFilter("x")
+
+	plan, err := s.Explain()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plan.Files) != 4 || plan.Files[0].Name != "2020-01-01/app-1.log" || !plan.Files[0].Stats || plan.Files[1].Stats {
+		t.Fatalf("invalid files %v", plan.Files)
+	}
+
+	if size := 4 * (13 + db.headerSize()); plan.Bytes != size {
+		t.Fatalf("expected %d bytes, got %d", size, plan.Bytes)
+	}
+
+	if len(plan.Notes) != 3 {
+		t.Fatalf("invalid notes %v", plan.Notes)
+	}
+}
@@ -0,0 +1,141 @@
+package timedb
+
+import (
+	"container/list"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// fileCache keeps open the files read recently so queries that are repeated,
+// like dashboards that poll today's data, don't open them every time.
+type fileCache struct {
+	mutex sync.Mutex
+	size  int
+	files map[string]*cachedFile
+	lru   *list.List
+}
+
+type cachedFile struct {
+	path    string
+	file    *os.File
+	refs    int
+	evicted bool
+	elem    *list.Element
+}
+
+// SetFileCache keeps up to n files open for reading. Each query reads
+// the file as it was when the query opened it. Zero disables the cache.
+// It is only used with local files.
+func (db *DB) SetFileCache(n int) {
+	var c *fileCache
+	if n > 0 {
+		c = &fileCache{size: n, files: make(map[string]*cachedFile), lru: list.New()}
+	}
+
+	if old := db.fileCache.Swap(c); old != nil {
+		old.close()
+	}
+}
+
+// open returns a handle of the file. The file is checked to be the same
+// that is cached because it could have been replaced, for example when
+// the day is compressed.
+func (c *fileCache) open(path string) (fs.File, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	cf, ok := c.files[path]
+	if ok {
+		if cached, err := cf.file.Stat(); err != nil || !os.SameFile(cached, info) {
+			c.evict(cf)
+			ok = false
+		}
+	}
+
+	if !ok {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+
+		cf = &cachedFile{path: path, file: f}
+		cf.elem = c.lru.PushFront(cf)
+		c.files[path] = cf
+
+		for c.lru.Len() > c.size {
+			c.evict(c.lru.Back().Value.(*cachedFile))
+		}
+	}
+
+	c.lru.MoveToFront(cf.elem)
+	cf.refs++
+
+	return &cachedHandle{
+		SectionReader: io.NewSectionReader(cf.file, 0, info.Size()),
+		cache:         c,
+		file:          cf,
+		info:          info,
+	}, nil
+}
+
+// evict removes the file from the cache. It is closed when it is not used.
+// The caller must hold the lock.
+func (c *fileCache) evict(cf *cachedFile) {
+	if cf.evicted {
+		return
+	}
+	cf.evicted = true
+	c.lru.Remove(cf.elem)
+	delete(c.files, cf.path)
+
+	if cf.refs == 0 {
+		cf.file.Close()
+	}
+}
+
+func (c *fileCache) release(cf *cachedFile) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	cf.refs--
+	if cf.refs == 0 && cf.evicted {
+		cf.file.Close()
+	}
+}
+
+func (c *fileCache) close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, cf := range c.files {
+		c.evict(cf)
+	}
+}
+
+// cachedHandle reads a cached file until the size it had when it was opened.
+type cachedHandle struct {
+	*io.SectionReader
+	cache  *fileCache
+	file   *cachedFile
+	info   fs.FileInfo
+	closed bool
+}
+
+func (h *cachedHandle) Stat() (fs.FileInfo, error) {
+	return h.info, nil
+}
+
+func (h *cachedHandle) Close() error {
+	if !h.closed {
+		h.closed = true
+		h.cache.release(h.file)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package timedb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFileCache(t *testing.T) {
+	db := New(t.TempDir())
+	db.SetFileCache(1)
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+
+	count := func(table string) int {
+		s := db.Query(table, start, start, 0, 0)
+		defer s.Close()
+
+		n := 0
+		for s.Scan() {
+			n++
+		}
+		if s.Error != nil {
+			t.Fatal(s.Error)
+		}
+		return n
+	}
+
+	for i := 1; i <= 3; i++ {
+		if err := db.Insert(start, "log", "a"); err != nil {
+			t.Fatal(err)
+		}
+
+		// the new records are read with the cached file
+		if n := count("log"); n != i {
+			t.Fatalf("expected %d lines, got %d", i, n)
+		}
+	}
+
+	c := db.fileCache.Load()
+	cf := c.files[db.storage.(archiveStorage).storage.(diskStorage).path("2020-01-01/log.log")]
+	if cf == nil || cf.refs != 0 {
+		t.Fatalf("expected a cached file, got %+v", cf)
+	}
+
+	// the file is replaced when the day is compressed
+	if err := db.SetTableOptions("log", TableOptions{Compress: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.ApplyTableOptions(); err != nil {
+		t.Fatal(err)
+	}
+	if n := count("log"); n != 3 {
+		t.Fatalf("expected 3 lines, got %d", n)
+	}
+	if err := db.Insert(start, "log", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if n := count("log"); n != 4 {
+		t.Fatalf("expected 4 lines, got %d", n)
+	}
+
+	// other files evict it
+	if err := db.Insert(start, "other", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if n := count("other"); n != 1 {
+		t.Fatalf("expected 1 line, got %d", n)
+	}
+	if len(c.files) != 1 || !cf.evicted {
+		t.Fatal("expected the file to be evicted")
+	}
+}
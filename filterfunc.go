@@ -0,0 +1,38 @@
+package timedb
+
+import (
+	"bytes"
+	"time"
+)
+
+// FilterFunc decides if a record is returned by a query. The line is the
+// text of the record without the time. It is only valid during the call
+// and must not be modified, so it can be evaluated without copies by
+// predicates like compiled CEL or expr programs.
+type FilterFunc func(line []byte, t time.Time) bool
+
+// SetFilterFunc adds a predicate that the records must match. It is
+// evaluated after the text and JSON filters.
+func (s *Scanner) SetFilterFunc(fn FilterFunc) {
+	s.filters = append(s.filters, fn)
+}
+
+func (s *Scanner) filterFuncs(d DataPoint) bool {
+	var line []byte
+	if s.reader.db.keys != nil {
+		// the line in the buffer is encrypted
+		line = []byte(trimText(d.Text))
+	} else {
+		line = s.scanner.Bytes()
+		if i := bytes.IndexByte(line, ' '); i != -1 {
+			line = line[i+1:]
+		}
+	}
+
+	for _, fn := range s.filters {
+		if !fn(line, d.Time) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,37 @@
+package timedb
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestFilterFunc(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i, line := range []string{"GET 200", "GET 500", "POST 500", "GET 502"} {
+		if err := db.Insert(start.Add(time.Duration(i)*time.Minute), "nginx", line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := db.Query("nginx", start, start.Add(time.Hour), 0, 0)
+	defer s.Close()
+
+	s.SetFilterFunc(func(line []byte, _ time.Time) bool {
+		return bytes.HasPrefix(line, []byte("GET "))
+	})
+	s.SetFilterFunc(func(line []byte, t time.Time) bool {
+		return line[len(line)-3] == '5' && t.After(start)
+	})
+
+	var result []string
+	for s.Scan() {
+		result = append(result, trimText(s.Data().Text))
+	}
+
+	if len(result) != 2 || result[0] != "GET 500" || result[1] != "GET 502" {
+		t.Fatalf("invalid result %v", result)
+	}
+}
@@ -0,0 +1,320 @@
+/*
+Package fluent receives logs from Fluent Bit and Fluentd with the forward
+protocol over TCP and saves them in a timedb database.
+
+	l := &fluent.Listener{DB: db}
+	go l.ListenTCP(":24224")
+
+All the modes of the protocol are accepted: Message, Forward, PackedForward
+and CompressedPackedForward, acknowledging the chunks if the client asks for
+it. The authentication with a shared key is not supported.
+*/
+package fluent
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/scorredoira/timedb"
+)
+
+// maxEntries is the maximum number of entries of a message.
+const maxEntries = 100000
+
+// DefaultReadTimeout is the default time that a connection can take to
+// send a message.
+const DefaultReadTimeout = 5 * time.Minute
+
+// Entry is a record received with a tag.
+type Entry struct {
+	Tag    string
+	Time   time.Time
+	Record map[string]interface{}
+}
+
+// String returns the record as JSON, the format it is stored.
+func (e *Entry) String() string {
+	b, err := json.Marshal(jsonValue(e.Record))
+	if err != nil {
+		return fmt.Sprint(e.Record)
+	}
+	return string(b)
+}
+
+// jsonValue converts the binary values, which are strings in most
+// clients, to strings.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []byte:
+		return string(v)
+	case []interface{}:
+		for i, item := range v {
+			v[i] = jsonValue(item)
+		}
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = jsonValue(item)
+		}
+	}
+	return v
+}
+
+type Listener struct {
+	DB *timedb.DB
+
+	// Table returns the table of an entry. By default it is the tag.
+	Table func(e *Entry) string
+
+	// Error is called with the messages that can't be parsed or saved.
+	Error func(err error)
+
+	// ReadTimeout is the time that a connection can take to send each
+	// message, including the time idle before it. Zero is
+	// DefaultReadTimeout.
+	ReadTimeout time.Duration
+
+	mutex     sync.Mutex
+	listeners []net.Listener
+}
+
+func (l *Listener) table(e *Entry) string {
+	if l.Table != nil {
+		return l.Table(e)
+	}
+	return e.Tag
+}
+
+func (l *Listener) error(err error) {
+	if l.Error != nil {
+		l.Error(err)
+	}
+}
+
+// ListenTCP receives messages in addr until the listener is closed.
+func (l *Listener) ListenTCP(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	l.listeners = append(l.listeners, ln)
+	l.mutex.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go l.serveTCP(conn)
+	}
+}
+
+func (l *Listener) serveTCP(conn net.Conn) {
+	defer conn.Close()
+
+	timeout := l.ReadTimeout
+	if timeout <= 0 {
+		timeout = DefaultReadTimeout
+	}
+
+	d := &decoder{r: bufio.NewReader(conn)}
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+			// the connection is closed
+			return
+		}
+
+		msg, err := d.value()
+		if err != nil {
+			if err != io.EOF {
+				l.error(err)
+			}
+			return
+		}
+
+		entries, chunk, err := parseMessage(msg)
+		if err != nil {
+			// the stream can't be followed after an invalid message
+			l.error(err)
+			return
+		}
+
+		if err := l.save(entries); err != nil {
+			// without the ack the client sends the chunk again
+			l.error(err)
+			continue
+		}
+
+		if chunk != "" {
+			ack := appendString([]byte{0x81}, "ack")
+			ack = appendString(ack, chunk)
+			if _, err := conn.Write(ack); err != nil {
+				l.error(err)
+				return
+			}
+		}
+	}
+}
+
+func (l *Listener) save(entries []*Entry) error {
+	var errs []error
+	for _, e := range entries {
+		if err := l.DB.Insert(e.Time, l.table(e), e.String()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var errTooManyEntries = fmt.Errorf("fluent: more than %d entries in a message", maxEntries)
+
+// parseMessage returns the entries of a message and the chunk id that
+// must be acknowledged, if any.
+func parseMessage(msg interface{}) ([]*Entry, string, error) {
+	a, ok := msg.([]interface{})
+	if !ok || len(a) < 2 {
+		return nil, "", fmt.Errorf("fluent: invalid message %v", msg)
+	}
+
+	tag, ok := a[0].(string)
+	if !ok {
+		return nil, "", fmt.Errorf("fluent: invalid tag %v", a[0])
+	}
+
+	var entries []*Entry
+	var options map[string]interface{}
+
+	switch v := a[1].(type) {
+	case []interface{}:
+		// Forward: [tag, [[time, record], ...], options]
+		if len(v) > maxEntries {
+			return nil, "", errTooManyEntries
+		}
+		for _, item := range v {
+			e, err := parseEntry(tag, item)
+			if err != nil {
+				return nil, "", err
+			}
+			entries = append(entries, e)
+		}
+		options = optionsAt(a, 2)
+
+	case string, []byte:
+		// PackedForward: [tag, entries as a msgpack stream, options]
+		options = optionsAt(a, 2)
+
+		var r io.Reader = bytes.NewReader([]byte(text(v)))
+		var decompressed *io.LimitedReader
+		if c, _ := options["compressed"].(string); c == "gzip" {
+			gz, err := gzip.NewReader(r)
+			if err != nil {
+				return nil, "", fmt.Errorf("fluent: invalid gzip data: %w", err)
+			}
+			defer gz.Close()
+			decompressed = &io.LimitedReader{R: gz, N: maxSize + 1}
+			r = decompressed
+		}
+
+		d := &decoder{r: bufio.NewReader(r)}
+		for {
+			item, err := d.value()
+			if decompressed != nil && decompressed.N == 0 {
+				return nil, "", fmt.Errorf("fluent: decompressed data larger than %d bytes", maxSize)
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, "", err
+			}
+			if len(entries) == maxEntries {
+				return nil, "", errTooManyEntries
+			}
+			e, err := parseEntry(tag, item)
+			if err != nil {
+				return nil, "", err
+			}
+			entries = append(entries, e)
+		}
+
+	default:
+		// Message: [tag, time, record, options]
+		if len(a) < 3 {
+			return nil, "", fmt.Errorf("fluent: invalid message %v", msg)
+		}
+		e, err := parseEntry(tag, a[1:3])
+		if err != nil {
+			return nil, "", err
+		}
+		entries = append(entries, e)
+		options = optionsAt(a, 3)
+	}
+
+	chunk, _ := options["chunk"].(string)
+	return entries, chunk, nil
+}
+
+func optionsAt(a []interface{}, i int) map[string]interface{} {
+	if i < len(a) {
+		m, _ := a[i].(map[string]interface{})
+		return m
+	}
+	return nil
+}
+
+// parseEntry parses a [time, record] pair.
+func parseEntry(tag string, v interface{}) (*Entry, error) {
+	a, ok := v.([]interface{})
+	if !ok || len(a) < 2 {
+		return nil, fmt.Errorf("fluent: invalid entry %v", v)
+	}
+
+	record, ok := a[1].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("fluent: invalid record %v", a[1])
+	}
+
+	e := &Entry{Tag: tag, Record: record}
+	switch t := a[0].(type) {
+	case time.Time:
+		e.Time = t
+	case int64:
+		e.Time = time.Unix(t, 0)
+	case uint64:
+		e.Time = time.Unix(int64(t), 0)
+	case float64:
+		e.Time = time.Unix(0, int64(t*1e9))
+	default:
+		return nil, fmt.Errorf("fluent: invalid time %v", a[0])
+	}
+
+	if e.Time.Unix() == 0 {
+		e.Time = time.Now()
+	}
+	return e, nil
+}
+
+// Close stops all the listeners.
+func (l *Listener) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for _, ln := range l.listeners {
+		ln.Close()
+	}
+
+	l.listeners = nil
+	return nil
+}
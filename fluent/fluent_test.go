@@ -0,0 +1,204 @@
+package fluent
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/scorredoira/timedb"
+)
+
+func appendEventTime(b []byte, t time.Time) []byte {
+	b = append(b, 0xd7, 0)
+	b = binary.BigEndian.AppendUint32(b, uint32(t.Unix()))
+	return binary.BigEndian.AppendUint32(b, uint32(t.Nanosecond()))
+}
+
+// appendEntry encodes [time, {"log": line}].
+func appendEntry(b []byte, t time.Time, line string) []byte {
+	b = append(b, 0x92)
+	b = appendEventTime(b, t)
+	b = append(b, 0x81)
+	b = appendString(b, "log")
+	return appendString(b, line)
+}
+
+func appendBin(b []byte, data []byte) []byte {
+	b = append(b, 0xc6)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+	return append(b, data...)
+}
+
+func TestParseMessage(t *testing.T) {
+	start := time.Date(2020, 1, 1, 10, 0, 0, 5, time.Local)
+
+	var entries []byte
+	entries = appendEntry(entries, start, "a")
+	entries = appendEntry(entries, start.Add(time.Second), "b")
+
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(entries)
+	w.Close()
+
+	// Message with an integer time, Forward, PackedForward and
+	// CompressedPackedForward
+	var message, forward, packed, compressed []byte
+	message = append(message, 0x93)
+	message = appendString(message, "app")
+	message = append(message, 0xce)
+	message = binary.BigEndian.AppendUint32(message, uint32(start.Unix()))
+	message = append(message, 0x81)
+	message = appendString(message, "log")
+	message = appendString(message, "a")
+
+	forward = append(forward, 0x92)
+	forward = appendString(forward, "app")
+	forward = append(forward, 0x92)
+	forward = appendEntry(forward, start, "a")
+	forward = appendEntry(forward, start.Add(time.Second), "b")
+
+	packed = append(packed, 0x92)
+	packed = appendString(packed, "app")
+	packed = appendBin(packed, entries)
+
+	compressed = append(compressed, 0x93)
+	compressed = appendString(compressed, "app")
+	compressed = appendBin(compressed, gz.Bytes())
+	compressed = append(compressed, 0x82)
+	compressed = appendString(compressed, "compressed")
+	compressed = appendString(compressed, "gzip")
+	compressed = appendString(compressed, "chunk")
+	compressed = appendString(compressed, "abc")
+
+	for i, b := range [][]byte{message, forward, packed, compressed} {
+		d := &decoder{r: bufio.NewReader(bytes.NewReader(b))}
+		msg, err := d.value()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entries, chunk, err := parseMessage(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if i == 0 {
+			if len(entries) != 1 || !entries[0].Time.Equal(start.Truncate(time.Second)) {
+				t.Fatalf("unexpected entries %+v", entries)
+			}
+			continue
+		}
+
+		if len(entries) != 2 || entries[1].Tag != "app" || !entries[0].Time.Equal(start) || entries[1].String() != `{"log":"b"}` {
+			t.Fatalf("unexpected entries %d: %+v", i, entries)
+		}
+		if i == 3 && chunk != "abc" {
+			t.Fatalf("unexpected chunk %q", chunk)
+		}
+	}
+}
+
+func TestListener(t *testing.T) {
+	db := timedb.NewMemory()
+	l := &Listener{DB: db, Error: func(err error) { t.Error(err) }}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go l.serveTCP(server)
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+
+	var b []byte
+	b = append(b, 0x93)
+	b = appendString(b, "kube.app")
+	b = append(b, 0x91)
+	b = appendEntry(b, start, "GET /")
+	b = append(b, 0x81)
+	b = appendString(b, "chunk")
+	b = appendString(b, "c1")
+
+	go client.Write(b)
+
+	d := &decoder{r: bufio.NewReader(client)}
+	ack, err := d.value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, ok := ack.(map[string]interface{}); !ok || m["ack"] != "c1" {
+		t.Fatalf("unexpected ack %v", ack)
+	}
+
+	s := db.Query("kube.app", start, start, 0, 0)
+	defer s.Close()
+	if !s.Scan() {
+		t.Fatal("expected a record")
+	}
+
+	var record map[string]string
+	if err := json.Unmarshal([]byte(s.Data().Text), &record); err != nil || record["log"] != "GET /" {
+		t.Fatalf("unexpected record %q", s.Data().Text)
+	}
+}
+
+func TestDecoderDepth(t *testing.T) {
+	b := bytes.Repeat([]byte{0x91}, 1<<20)
+	d := &decoder{r: bufio.NewReader(bytes.NewReader(b))}
+	if _, err := d.value(); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	b = append(bytes.Repeat([]byte{0x91}, maxDepth), 0xc0)
+	d = &decoder{r: bufio.NewReader(bytes.NewReader(b))}
+	if _, err := d.value(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseMessageDecompressedSize(t *testing.T) {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(bytes.Repeat([]byte{0xc0}, maxSize+1))
+	w.Close()
+
+	var b []byte
+	b = append(b, 0x93)
+	b = appendString(b, "app")
+	b = appendBin(b, gz.Bytes())
+	b = append(b, 0x81)
+	b = appendString(b, "compressed")
+	b = appendString(b, "gzip")
+
+	d := &decoder{r: bufio.NewReader(bytes.NewReader(b))}
+	msg, err := d.value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := parseMessage(msg); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestListenerReadTimeout(t *testing.T) {
+	l := &Listener{DB: timedb.NewMemory(), ReadTimeout: 10 * time.Millisecond}
+
+	client, server := net.Pipe()
+	defer client.Close()
+
+	done := make(chan struct{})
+	go func() {
+		l.serveTCP(server)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the idle connection was not closed")
+	}
+}
@@ -0,0 +1,272 @@
+package fluent
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// maxSize is the maximum size of a string, a binary or a collection, so
+// a corrupt length doesn't allocate all the memory.
+const maxSize = 64 << 20
+
+// maxDepth is the maximum nesting of arrays and maps, so a deep value
+// doesn't overflow the stack.
+const maxDepth = 64
+
+// decoder decodes the msgpack values of the forward protocol: nil, bool,
+// int64, uint64, float64, string, []byte, []interface{}, maps with the keys
+// as strings and the EventTime extension as a time.Time.
+type decoder struct {
+	r     *bufio.Reader
+	depth int
+}
+
+func (d *decoder) byte() (byte, error) {
+	return d.r.ReadByte()
+}
+
+func (d *decoder) bytes(n int) ([]byte, error) {
+	if n > maxSize {
+		return nil, fmt.Errorf("fluent: size %d too large", n)
+	}
+	b := make([]byte, n)
+	_, err := io.ReadFull(d.r, b)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return b, err
+}
+
+func (d *decoder) uint(n int) (uint64, error) {
+	b, err := d.bytes(n)
+	if err != nil {
+		return 0, err
+	}
+
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+// value decodes the next value. It returns io.EOF if there are no
+// more values.
+func (d *decoder) value() (interface{}, error) {
+	c, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return d.mapValue(int(c & 0x0f))
+	case c&0xf0 == 0x90:
+		return d.array(int(c & 0x0f))
+	case c&0xe0 == 0xa0:
+		return d.str(int(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return d.bytes(int(n))
+
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.uint(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.ext(int(n))
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.ext(1 << (c - 0xd4))
+
+	case 0xca:
+		v, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(v))), err
+	case 0xcb:
+		v, err := d.uint(8)
+		return math.Float64frombits(v), err
+
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		v, err := d.uint(1 << (c - 0xcc))
+		if v <= math.MaxInt64 {
+			return int64(v), err
+		}
+		return v, err
+
+	case 0xd0:
+		v, err := d.uint(1)
+		return int64(int8(v)), err
+	case 0xd1:
+		v, err := d.uint(2)
+		return int64(int16(v)), err
+	case 0xd2:
+		v, err := d.uint(4)
+		return int64(int32(v)), err
+	case 0xd3:
+		v, err := d.uint(8)
+		return int64(v), err
+
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(int(n))
+
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.array(int(n))
+
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapValue(int(n))
+	}
+
+	return nil, fmt.Errorf("fluent: invalid msgpack type 0x%x", c)
+}
+
+func (d *decoder) str(n int) (interface{}, error) {
+	b, err := d.bytes(n)
+	return string(b), err
+}
+
+// nest returns an error if a collection is nested too deep. The caller
+// must call unnest when it is decoded.
+func (d *decoder) nest() error {
+	if d.depth >= maxDepth {
+		return fmt.Errorf("fluent: values nested more than %d levels", maxDepth)
+	}
+	d.depth++
+	return nil
+}
+
+func (d *decoder) unnest() {
+	d.depth--
+}
+
+func (d *decoder) array(n int) (interface{}, error) {
+	if n > maxSize {
+		return nil, fmt.Errorf("fluent: size %d too large", n)
+	}
+	if err := d.nest(); err != nil {
+		return nil, err
+	}
+	defer d.unnest()
+
+	a := make([]interface{}, 0, min(n, 1024))
+	for i := 0; i < n; i++ {
+		v, err := d.value()
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		a = append(a, v)
+	}
+	return a, nil
+}
+
+func (d *decoder) mapValue(n int) (interface{}, error) {
+	if n > maxSize {
+		return nil, fmt.Errorf("fluent: size %d too large", n)
+	}
+	if err := d.nest(); err != nil {
+		return nil, err
+	}
+	defer d.unnest()
+
+	m := make(map[string]interface{}, min(n, 1024))
+	for i := 0; i < n; i++ {
+		k, err := d.value()
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		v, err := d.value()
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		m[text(k)] = v
+	}
+	return m, nil
+}
+
+// ext decodes an extension. The EventTime, the type 0, has the seconds
+// and the nanoseconds as big endian 32 bit integers.
+func (d *decoder) ext(n int) (interface{}, error) {
+	typ, err := d.byte()
+	if err != nil {
+		return nil, noEOF(err)
+	}
+
+	b, err := d.bytes(n)
+	if err != nil {
+		return nil, err
+	}
+
+	if typ == 0 && n == 8 {
+		sec := binary.BigEndian.Uint32(b)
+		nsec := binary.BigEndian.Uint32(b[4:])
+		return time.Unix(int64(sec), int64(nsec)), nil
+	}
+	return b, nil
+}
+
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// text returns a string or binary value as a string.
+func text(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// appendString encodes a string.
+func appendString(b []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n < 256:
+		b = append(b, 0xd9, byte(n))
+	case n < 65536:
+		b = append(b, 0xda)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, 0xdb)
+		b = binary.BigEndian.AppendUint32(b, uint32(n))
+	}
+	return append(b, s...)
+}
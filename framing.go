@@ -0,0 +1,182 @@
+package timedb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// The compressed files are written as independent zstd frames of whole
+// lines, each one preceded by a sync marker: a zstd skippable frame, that
+// the decoders ignore, with the offset of the frame in the decompressed
+// data. Verify and Repair resume at the next marker after a frame that
+// can't be decompressed instead of losing the rest of the file. The files
+// compressed before have a single frame and no markers.
+
+// frameSize is the size of the lines compressed in each frame.
+const frameSize = 256 << 10
+
+// syncMarkerSize is the size of a sync marker: the magic number and the
+// size of a skippable frame, the magic of the markers and the offset.
+const syncMarkerSize = 20
+
+// syncMarker are the first bytes of the sync markers.
+var syncMarker = []byte{0x5e, 0x2a, 0x4d, 0x18, 12, 0, 0, 0, 'T', 'D', 'B', 'S'}
+
+func appendSyncMarker(b []byte, offset int64) []byte {
+	b = append(b, syncMarker...)
+	return binary.LittleEndian.AppendUint64(b, uint64(offset))
+}
+
+// parseSyncMarker returns the offset of a sync marker.
+func parseSyncMarker(b []byte) (int64, bool) {
+	if len(b) < syncMarkerSize || !bytes.HasPrefix(b, syncMarker) {
+		return 0, false
+	}
+	return int64(binary.LittleEndian.Uint64(b[len(syncMarker):])), true
+}
+
+// frameWriter compresses the lines written in frames with sync markers.
+type frameWriter struct {
+	w      io.Writer
+	enc    *zstd.Encoder
+	buf    []byte
+	offset int64
+	frames int
+}
+
+func newFrameWriter(w io.Writer, opts ...zstd.EOption) (*frameWriter, error) {
+	enc, err := zstd.NewWriter(nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &frameWriter{w: w, enc: enc}, nil
+}
+
+func (f *frameWriter) Write(p []byte) (int, error) {
+	f.buf = append(f.buf, p...)
+
+	for len(f.buf) >= frameSize {
+		// the frames end after a line
+		n := bytes.LastIndexByte(f.buf[:frameSize], '\n') + 1
+		if n == 0 {
+			if n = bytes.IndexByte(f.buf, '\n') + 1; n == 0 {
+				break
+			}
+		}
+
+		if err := f.frame(f.buf[:n]); err != nil {
+			return 0, err
+		}
+		f.buf = append(f.buf[:0], f.buf[n:]...)
+	}
+
+	return len(p), nil
+}
+
+// frame writes the data compressed in a frame.
+func (f *frameWriter) frame(data []byte) error {
+	b := appendSyncMarker(nil, f.offset)
+	b = f.enc.EncodeAll(data, b)
+	if _, err := f.w.Write(b); err != nil {
+		return err
+	}
+
+	f.offset += int64(len(data))
+	f.frames++
+	return nil
+}
+
+// Close writes the rest of the data. It doesn't close the writer.
+func (f *frameWriter) Close() error {
+	var err error
+	if len(f.buf) > 0 || f.frames == 0 {
+		err = f.frame(f.buf)
+		f.buf = nil
+	}
+	if e := f.enc.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// frameReader decompresses the frames of a file with sync markers one by
+// one. The frames that can't be decompressed are skipped.
+type frameReader struct {
+	r   *bufio.Reader
+	dec *zstd.Decoder
+	buf []byte
+	err error
+
+	// corrupt is called with the offset and the compressed data of the
+	// frames skipped.
+	corrupt func(offset int64, frame []byte)
+}
+
+func (f *frameReader) Read(p []byte) (int, error) {
+	for len(f.buf) == 0 {
+		if f.err != nil {
+			return 0, f.err
+		}
+		f.next()
+	}
+
+	n := copy(p, f.buf)
+	f.buf = f.buf[n:]
+	return n, nil
+}
+
+// next decompresses the next frame.
+func (f *frameReader) next() {
+	offset, frame, err := f.readFrame()
+	if err != nil {
+		f.err = err
+		return
+	}
+
+	data, err := f.dec.DecodeAll(frame, nil)
+	if err != nil {
+		f.corrupt(offset, frame)
+		return
+	}
+	f.buf = data
+}
+
+// readFrame returns the offset of the next marker and the data until the
+// following one or the end of the file.
+func (f *frameReader) readFrame() (int64, []byte, error) {
+	b, err := f.r.Peek(syncMarkerSize)
+	if len(b) == 0 && err != nil {
+		return 0, nil, err
+	}
+
+	// a corrupt marker is part of the previous frame, so
+	// the frames only start with one or at the beginning
+	offset, _ := parseSyncMarker(b)
+	if _, err := f.r.Discard(len(b)); err != nil {
+		return 0, nil, err
+	}
+
+	var frame []byte
+	for {
+		b, err := f.r.Peek(1)
+		if err == io.EOF {
+			return offset, frame, nil
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if b[0] == syncMarker[0] {
+			if b, _ := f.r.Peek(syncMarkerSize); bytes.HasPrefix(b, syncMarker) && len(b) == syncMarkerSize {
+				return offset, frame, nil
+			}
+		}
+
+		c, _ := f.r.ReadByte()
+		frame = append(frame, c)
+	}
+}
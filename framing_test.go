@@ -0,0 +1,135 @@
+package timedb
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestFrameWriter(t *testing.T) {
+	var data bytes.Buffer
+	for i := 0; data.Len() < 3*frameSize; i++ {
+		fmt.Fprintf(&data, "1577872800 record %d\n", i)
+	}
+
+	var out bytes.Buffer
+	w, err := newFrameWriter(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.frames < 3 || bytes.Count(out.Bytes(), syncMarker) != w.frames {
+		t.Fatalf("unexpected frames %d", w.frames)
+	}
+
+	// the markers are skipped by the decoders
+	zr, err := zstd.NewReader(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(zr)
+	zr.Close()
+	if err != nil || !bytes.Equal(b, data.Bytes()) {
+		t.Fatalf("unexpected data %d %v", len(b), err)
+	}
+
+	// corrupt the second frame
+	compressed := out.Bytes()
+	second := bytes.Index(compressed[syncMarkerSize:], syncMarker) + syncMarkerSize
+	compressed[second+syncMarkerSize+100] ^= 0xff
+
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dec.Close()
+
+	var corrupt []int64
+	r := &frameReader{r: bufio.NewReader(bytes.NewReader(compressed)), dec: dec, corrupt: func(offset int64, frame []byte) {
+		corrupt = append(corrupt, offset)
+	}}
+	b, err = io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offset, _ := parseSyncMarker(compressed[second:])
+	if len(corrupt) != 1 || corrupt[0] != offset || offset == 0 {
+		t.Fatalf("unexpected corrupt frames %v", corrupt)
+	}
+
+	// the lines of the other frames are read
+	if !bytes.HasPrefix(data.Bytes(), b[:offset]) || !bytes.HasSuffix(data.Bytes(), b[offset:]) || len(b) >= data.Len() {
+		t.Fatalf("unexpected data %d", len(b))
+	}
+}
+
+func TestRepairCompressed(t *testing.T) {
+	dir := t.TempDir()
+	db := New(dir)
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	const total = 30000
+	for i := 0; i < total; i++ {
+		if err := db.Insert(start, "nginx", "GET /%d", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.SetTableOptions("nginx", TableOptions{Compress: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.ApplyTableOptions(); err != nil {
+		t.Fatal(err)
+	}
+
+	// corrupt the second frame
+	name := filepath.Join(dir, "2020-01-01", "nginx.log.zst")
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := bytes.Index(b[syncMarkerSize:], syncMarker) + syncMarkerSize
+	if second < syncMarkerSize {
+		t.Fatal("expected several frames")
+	}
+	b[second+syncMarkerSize+100] ^= 0xff
+	if err := os.WriteFile(name, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := db.Verify("nginx", start, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Invalid) != 1 || report.Invalid[0].Reason != "corrupt compressed frame" || report.Records == 0 || report.Records >= total {
+		t.Fatalf("unexpected report %d %+v", report.Records, report.Invalid)
+	}
+
+	if _, err := db.Repair("nginx", start, start); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRecords(t, db, "nginx", start); n != int(report.Records) {
+		t.Fatalf("expected %d records, got %d", report.Records, n)
+	}
+
+	q, err := db.Quarantined(start, "nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(q) != 1 || q[0].Offset == 0 {
+		t.Fatalf("unexpected quarantine %+v", q)
+	}
+}
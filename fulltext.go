@@ -0,0 +1,311 @@
+package timedb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// The full text index of a day is saved next to the data ("table.idx")
+// with the offsets of the lines that contain each token. It is built
+// for the tables with TableOptions.FullText by ApplyTableOptions.
+
+type fullTextIndex struct {
+	// Size is the size of the data when the index was built.
+	Size   int64
+	Tokens map[string][]int64
+}
+
+func indexFile(name string) string {
+	return strings.TrimSuffix(statsFile(name), ".stats") + ".idx"
+}
+
+// Tokens splits the text in lower case words. It is how the text
+// of the records and the queries of Search are split.
+func Tokens(text string) []string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, w := range words {
+		words[i] = strings.ToLower(w)
+	}
+	return words
+}
+
+// BuildIndex saves the full text index of the table for the day. It
+// returns ErrEncrypted if the database has encryption.
+func (db *DB) BuildIndex(day time.Time, table string) error {
+	if err := validTable(table); err != nil {
+		return err
+	}
+
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	return db.buildIndex(day, db.getTablePath(day, table))
+}
+
+func (db *DB) buildIndex(day time.Time, name string) error {
+	if db.keys != nil {
+		return ErrEncrypted
+	}
+
+	f, err := db.openParts(day, name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	idx := fullTextIndex{Tokens: make(map[string][]int64)}
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			// a line without the new line is not complete yet
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("timeDB: error reading %s: %v", name, err)
+		}
+
+		d, ok := db.decodeLine(line[:len(line)-1])
+		if ok {
+			seen := make(map[string]bool)
+			for _, t := range Tokens(d.Text) {
+				if !seen[t] {
+					seen[t] = true
+					idx.Tokens[t] = append(idx.Tokens[t], idx.Size)
+				}
+			}
+		}
+		idx.Size += int64(len(line))
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(idx); err != nil {
+		return err
+	}
+	return writeFile(db.storage, indexFile(name), buf.Bytes())
+}
+
+// savedIndex returns the index of the file if it exists and is up
+// to date. Compressed files don't change so their index is valid.
+func (db *DB) savedIndex(name string) (*fullTextIndex, bool) {
+	b, err := fs.ReadFile(db.storage, indexFile(name))
+	if err != nil {
+		return nil, false
+	}
+
+	var idx fullTextIndex
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&idx); err != nil {
+		db.log().Warn("timedb: invalid index", "file", name, "error", err)
+		return nil, false
+	}
+
+	size, compressed, err := db.dataSize(name)
+	if err != nil || (!compressed && size != idx.Size) {
+		return nil, false
+	}
+	return &idx, true
+}
+
+// decodeLine parses a stored line and decrypts it if needed.
+func (db *DB) decodeLine(line string) (DataPoint, bool) {
+	i := strings.IndexByte(line, ' ')
+	if i == -1 {
+		return DataPoint{}, false
+	}
+
+	epoch, seq, err := parseTimeField(line[:i])
+	if err != nil {
+		return DataPoint{}, false
+	}
+
+	text := line[i:]
+	if db.keys != nil && strings.HasPrefix(text, " "+encryptedPrefix) {
+		if text, err = db.decrypt(epoch, text[1:]); err != nil {
+			return DataPoint{}, false
+		}
+		text = " " + text
+	}
+
+	return DataPoint{Time: time.Unix(epoch, 0), Text: text, Seq: seq}, true
+}
+
+// Search returns the records in [start, end) that contain all the words
+// of the query, in any order and case. The days with a full text index
+// only read the matching lines and the rest are scanned.
+func (db *DB) Search(table, query string, start, end time.Time) ([]DataPoint, error) {
+	words := Tokens(query)
+	if len(words) == 0 {
+		return nil, fmt.Errorf("timeDB.Search: empty query")
+	}
+
+	match := func(d DataPoint) bool {
+		tokens := Tokens(d.Text)
+		for _, w := range words {
+			found := false
+			for _, t := range tokens {
+				if t == w {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	}
+
+	start, end = start.Local(), end.Local()
+
+	var result []DataPoint
+	for _, day := range days(start, end) {
+		tables := []string{table}
+		if isPattern(table) {
+			var err error
+			if tables, err = db.matchTables(day, table); err != nil {
+				continue
+			}
+		}
+
+		from, to := day, day.AddDate(0, 0, 1)
+		if start.After(from) {
+			from = start
+		}
+		if end.Before(to) {
+			to = end
+		}
+		if !from.Before(to) {
+			continue
+		}
+
+		for _, t := range tables {
+			add := func(d DataPoint) {
+				if !d.Time.Before(from) && d.Time.Before(to) && match(d) {
+					result = append(result, d)
+				}
+			}
+
+			idx, ok := db.savedIndex(db.getTablePath(day, t))
+			if !ok {
+				if err := db.scanRange(t, from, to, "", add); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			if err := db.searchIndex(day, t, idx, words, add); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Time.Before(result[j].Time)
+	})
+	return result, nil
+}
+
+// searchIndex reads the lines of the day that contain all the words.
+func (db *DB) searchIndex(day time.Time, table string, idx *fullTextIndex, words []string, fn func(d DataPoint)) error {
+	offsets := idx.Tokens[words[0]]
+	for _, w := range words[1:] {
+		offsets = intersect(offsets, idx.Tokens[w])
+	}
+	if len(offsets) == 0 {
+		return nil
+	}
+
+	name := db.getTablePath(day, table)
+
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	f, err := db.openParts(day, name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if ra, ok := f.(io.ReaderAt); ok {
+		for _, off := range offsets {
+			line, err := readLineAt(ra, off)
+			if err != nil {
+				return fmt.Errorf("timeDB: error reading %s: %v", name, err)
+			}
+			if d, ok := db.decodeLine(line); ok {
+				fn(d)
+			}
+		}
+		return nil
+	}
+
+	// compressed files and parts are read until the last match
+	r := bufio.NewReader(f)
+	var pos int64
+	for len(offsets) > 0 {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("timeDB: error reading %s: %v", name, err)
+		}
+
+		if pos == offsets[0] {
+			offsets = offsets[1:]
+			if d, ok := db.decodeLine(line[:len(line)-1]); ok {
+				fn(d)
+			}
+		}
+		pos += int64(len(line))
+	}
+	return nil
+}
+
+// readLineAt returns the line that starts at off without the new line.
+func readLineAt(ra io.ReaderAt, off int64) (string, error) {
+	var line []byte
+	buf := make([]byte, 512)
+	for {
+		n, err := ra.ReadAt(buf, off)
+		if i := bytes.IndexByte(buf[:n], '\n'); i != -1 {
+			return string(append(line, buf[:i]...)), nil
+		}
+		line = append(line, buf[:n]...)
+		off += int64(n)
+		if err != nil {
+			if err == io.EOF {
+				return string(line), nil
+			}
+			return "", err
+		}
+	}
+}
+
+// intersect returns the values of both sorted lists.
+func intersect(a, b []int64) []int64 {
+	var result []int64
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
@@ -0,0 +1,151 @@
+package timedb
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"time"
+)
+
+func TestSearch(t *testing.T) {
+	db := New(t.TempDir())
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	next := start.AddDate(0, 0, 1)
+
+	lines := []string{"GET /index 200", "Error: disk full", "POST /login 500", "disk ok"}
+	for i, line := range lines {
+		if err := db.Insert(start.Add(time.Duration(i)*time.Minute), "app", line); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Insert(next.Add(time.Duration(i)*time.Minute), "app", line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	if err := db.SetTableOptions("app", TableOptions{FullText: true, Compress: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(query string) []DataPoint {
+		result, err := db.Search("app", query, start, next.Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	// without index
+	if r := search("DISK error"); len(r) != 2 || trimText(r[0].Text) != "Error: disk full" {
+		t.Fatalf("invalid result %v", r)
+	}
+
+	if err := db.ApplyTableOptions(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := db.savedIndex(db.getTablePath(start, "app")); !ok {
+		t.Fatal("expected an index")
+	}
+
+	if r := search("DISK error"); len(r) != 2 || trimText(r[0].Text) != "Error: disk full" || !r[1].Time.Equal(next.Add(time.Minute)) {
+		t.Fatalf("invalid result %v", r)
+	}
+
+	if r := search("disk"); len(r) != 4 {
+		t.Fatalf("expected 4 records, got %v", r)
+	}
+
+	if r := search("500 login"); len(r) != 2 {
+		t.Fatalf("expected 2 records, got %v", r)
+	}
+
+	if r := search("dis"); len(r) != 0 {
+		t.Fatalf("expected no records, got %v", r)
+	}
+
+	// the range is respected
+	r, err := db.Search("app", "disk", start.Add(2*time.Minute), next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 1 {
+		t.Fatalf("expected 1 record, got %v", r)
+	}
+}
+
+func TestSearchUncompressed(t *testing.T) {
+	db := New(t.TempDir())
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i, line := range []string{"a b", "b c", "c d"} {
+		if err := db.Insert(start.Add(time.Duration(i)*time.Minute), "app", line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	if err := db.BuildIndex(start, "app"); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := db.Search("app", "c", start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 2 || trimText(r[0].Text) != "b c" || trimText(r[1].Text) != "c d" {
+		t.Fatalf("invalid result %v", r)
+	}
+
+	// the index is ignored after a write
+	if err := db.Insert(start.Add(5*time.Minute), "app", "c"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	if r, _ = db.Search("app", "c", start, start.Add(time.Hour)); len(r) != 3 {
+		t.Fatalf("expected 3 records, got %v", r)
+	}
+}
+
+func TestSearchEncrypted(t *testing.T) {
+	db := New(t.TempDir())
+	db.SetKeyProvider(StaticKey("0123456789abcdef0123456789abcdef"))
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	if err := db.Insert(start, "app", "secret token"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// the indexes would have the text in clear
+	if err := db.BuildIndex(start, "app"); !errors.Is(err, ErrEncrypted) {
+		t.Fatalf("expected ErrEncrypted, got %v", err)
+	}
+	if err := db.BuildBloom(start, "app"); !errors.Is(err, ErrEncrypted) {
+		t.Fatalf("expected ErrEncrypted, got %v", err)
+	}
+
+	if err := db.SetTableOptions("app", TableOptions{FullText: true, Columns: []string{"a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.ApplyTableOptions(); err != nil {
+		t.Fatal(err)
+	}
+
+	name := db.getTablePath(start, "app")
+	for _, file := range []string{indexFile(name), bloomFile(name), columnsFile(name)} {
+		if _, err := fs.Stat(db.storage, file); err == nil {
+			t.Fatalf("unexpected file %s", file)
+		}
+	}
+
+	r, err := db.Search("app", "secret", start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 1 {
+		t.Fatalf("expected 1 record, got %v", r)
+	}
+}
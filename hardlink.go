@@ -0,0 +1,137 @@
+package timedb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SnapshotHardlink creates a point-in-time copy of the database in dest,
+// which must not exist or be empty. The files are hardlinks to the ones
+// of the database and only the files open for writing are copied,
+// so it takes milliseconds and almost no space even for big databases.
+//
+// The files of the database are never modified in place while they are
+// linked: before appending to a file with other links it is copied, so
+// the snapshot keeps the data as it was (see diskStorage.Append).
+// Where hardlinks are not supported all the files are copied.
+func (db *DB) SnapshotHardlink(dest string) error {
+	local, ok := localStorage(db.storage).(diskStorage)
+	if !ok {
+		return fmt.Errorf("timeDB.SnapshotHardlink: the database is not in a directory")
+	}
+
+	if entries, err := os.ReadDir(dest); err == nil && len(entries) > 0 {
+		return fmt.Errorf("timeDB.SnapshotHardlink: %s is not empty", dest)
+	}
+
+	if err := db.Flush(); err != nil {
+		return err
+	}
+
+	// it doesn't modify the files so it can run during a backup
+	unlock, err := db.lockDir()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// writes wait until all the files are linked
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	active := make(map[string]bool)
+	for _, w := range db.allWriters() {
+		if w.file != nil {
+			active[filepath.FromSlash(partName(w.path, w.part))] = true
+		}
+	}
+
+	root, err := filepath.Abs(local.root)
+	if err != nil {
+		return err
+	}
+
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if rel == trashDir {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(filepath.Join(dest, rel), 0777)
+		}
+
+		if rel == lockFile || rel == writeLock || strings.HasSuffix(rel, ".tmp") {
+			return nil
+		}
+
+		target := filepath.Join(dest, rel)
+		if !active[rel] && hardlinks {
+			if err := os.Link(p, target); err == nil {
+				return nil
+			}
+			// other file system
+		}
+		return copyFile(p, target)
+	})
+	if err != nil {
+		return fmt.Errorf("timeDB.SnapshotHardlink: %v", err)
+	}
+
+	db.log().Info("timedb: snapshot created", "dest", dest)
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// unshare replaces a file that has other hardlinks with a copy so that
+// writing it doesn't modify the other links.
+func unshare(p string) error {
+	info, err := os.Stat(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	if linkCount(info) <= 1 {
+		return nil
+	}
+
+	tmp := p + ".tmp"
+	if err := copyFile(p, tmp); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("timeDB: error copying %s: %v", p, err)
+	}
+	return os.Rename(tmp, p)
+}
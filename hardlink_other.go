@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package timedb
+
+import "io/fs"
+
+// hardlinks is false because the links of the files are not known, so
+// they couldn't be unshared before writing them.
+const hardlinks = false
+
+func linkCount(info fs.FileInfo) uint64 {
+	return 1
+}
@@ -0,0 +1,19 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package timedb
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// hardlinks reports whether the database can be snapshotted with hardlinks.
+const hardlinks = true
+
+// linkCount returns the number of hardlinks of a file.
+func linkCount(info fs.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Nlink)
+	}
+	return 1
+}
@@ -0,0 +1,81 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package timedb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshotHardlink(t *testing.T) {
+	dir := t.TempDir()
+	db := New(dir)
+
+	day1 := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	day2 := day1.AddDate(0, 0, 1)
+
+	if err := db.Insert(day1, "nginx", "GET /"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Insert(day2, "nginx", "GET /"); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "snapshot")
+	if err := db.SnapshotHardlink(dest); err != nil {
+		t.Fatal(err)
+	}
+
+	// the closed file is linked and the active one copied
+	old, err := os.Stat(filepath.Join(dest, "2020-01-01", "nginx.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linkCount(old) != 2 {
+		t.Fatalf("expected a hardlink, got %d links", linkCount(old))
+	}
+	active, err := os.Stat(filepath.Join(dest, "2020-01-02", "nginx.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linkCount(active) != 1 {
+		t.Fatalf("expected a copy, got %d links", linkCount(active))
+	}
+
+	// writing after the snapshot doesn't modify it
+	for _, day := range []time.Time{day1, day2} {
+		if err := db.Insert(day, "nginx", "POST /"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	texts := func(db *DB, day time.Time) string {
+		s := db.Query("nginx", day, day.Add(time.Minute), 0, 0)
+		defer s.Close()
+
+		var got string
+		for s.Scan() {
+			got += s.Data().Text
+		}
+		if s.Error != nil {
+			t.Fatal(s.Error)
+		}
+		return got
+	}
+
+	snap := New(dest)
+	for _, day := range []time.Time{day1, day2} {
+		if got := texts(snap, day); got != " GET /" {
+			t.Fatalf("%v: unexpected snapshot %q", day, got)
+		}
+		if got := texts(db, day); got != " GET / POST /" {
+			t.Fatalf("%v: unexpected data %q", day, got)
+		}
+	}
+
+	if err := db.SnapshotHardlink(dest); err == nil {
+		t.Fatal("expected an error with a destination that is not empty")
+	}
+}
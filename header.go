@@ -0,0 +1,151 @@
+package timedb
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// New data files start with a line that describes their format:
+//
+//	#timedb 1 compression=none precision=s codec=text
+//
+// Files written by older versions don't have it and are read as version 0.
+// Readers skip the header lines so the parts of a file and the merged
+// files can contain more than one.
+
+// FormatVersion is the version of the format of the files written.
+const FormatVersion = 1
+
+const headerMagic = "#timedb "
+
+// FileHeader describes the format of a data file.
+type FileHeader struct {
+	// Version is 0 for the files without header.
+	Version int
+
+	// Compression is the compression of the records. Compressed
+	// files have the .zst extension instead.
+	Compression string
+
+	// Precision is the unit of the times: "s".
+	Precision string
+
+	// Codec is the encoding of the records: "text" or "aes" if
+	// they are encrypted.
+	Codec string
+}
+
+// legacyHeader is the format of the files without header.
+var legacyHeader = FileHeader{Compression: "none", Precision: "s", Codec: "text"}
+
+// String returns the header line without the new line.
+func (h FileHeader) String() string {
+	return fmt.Sprintf("%s%d compression=%s precision=%s codec=%s", headerMagic, h.Version, h.Compression, h.Precision, h.Codec)
+}
+
+// isHeader reports whether the line is a header.
+func isHeader(line []byte) bool {
+	return bytes.HasPrefix(line, []byte(headerMagic))
+}
+
+// parseHeader parses a header line. Unknown flags are ignored.
+func parseHeader(line string) (FileHeader, error) {
+	fields := strings.Fields(strings.TrimPrefix(line, headerMagic))
+	if !strings.HasPrefix(line, headerMagic) || len(fields) == 0 {
+		return FileHeader{}, fmt.Errorf("timeDB: invalid header %s", line)
+	}
+
+	v, err := strconv.Atoi(fields[0])
+	if err != nil || v < 1 {
+		return FileHeader{}, fmt.Errorf("timeDB: invalid header %s", line)
+	}
+
+	h := legacyHeader
+	h.Version = v
+	for _, f := range fields[1:] {
+		name, value, _ := strings.Cut(f, "=")
+		switch name {
+		case "compression":
+			h.Compression = value
+		case "precision":
+			h.Precision = value
+		case "codec":
+			h.Codec = value
+		}
+	}
+
+	if h.Version > FormatVersion {
+		return h, fmt.Errorf("timeDB: unsupported format version %d", h.Version)
+	}
+	return h, nil
+}
+
+// newHeader returns the header of the files created now.
+func (db *DB) newHeader() FileHeader {
+	h := legacyHeader
+	h.Version = FormatVersion
+	if db.keys != nil {
+		h.Codec = "aes"
+	}
+	return h
+}
+
+// writeHeader writes the header if the file is empty and returns the
+// number of bytes written.
+func (db *DB) writeHeader(w io.Writer, size int64) (int, error) {
+	if size > 0 {
+		return 0, nil
+	}
+	return io.WriteString(w, db.newHeader().String()+"\n")
+}
+
+// headerSize returns the size of the header of a new file. Files of
+// that size don't have records.
+func (db *DB) headerSize() int64 {
+	return int64(len(db.newHeader().String()) + 1)
+}
+
+// skipHeader discards the header at the start of r if it has one.
+func skipHeader(r *bufio.Reader) error {
+	b, err := r.Peek(len(headerMagic))
+	if err != nil || !isHeader(b) {
+		return nil
+	}
+	_, err = r.ReadBytes('\n')
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// FileHeader returns the format of the data file of the table for the day.
+// Files without header return Version 0.
+func (db *DB) FileHeader(day time.Time, table string) (FileHeader, error) {
+	name := db.getTablePath(day.Local(), table)
+
+	f, err := db.storage.Open(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return FileHeader{}, err
+		}
+		return FileHeader{}, fmt.Errorf("timeDB: error openning file %s: %v", name, err)
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return FileHeader{}, fmt.Errorf("timeDB: error reading %s: %v", name, err)
+	}
+
+	if !isHeader([]byte(line)) {
+		return legacyHeader, nil
+	}
+	return parseHeader(strings.TrimSuffix(line, "\n"))
+}
@@ -0,0 +1,85 @@
+package timedb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileHeader(t *testing.T) {
+	dir := t.TempDir()
+	db := New(dir)
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 3; i++ {
+		if err := db.Insert(start.Add(time.Duration(i)*time.Second), "app", "a%d", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	h, err := db.FileHeader(start, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Version != FormatVersion || h.Codec != "text" || h.Precision != "s" {
+		t.Fatalf("invalid header %+v", h)
+	}
+
+	// a file written by an older version
+	legacy := filepath.Join(dir, "2020-01-01", "legacy.log")
+	data := fmt.Sprintf("%d x\n%d y\n", start.Unix(), start.Unix()+1)
+	if err := os.WriteFile(legacy, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err = db.FileHeader(start, "legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Version != 0 {
+		t.Fatalf("expected version 0, got %+v", h)
+	}
+
+	if n := countRecords(t, db, "app", start); n != 3 {
+		t.Fatalf("expected 3, got %d", n)
+	}
+	if n := countRecords(t, db, "legacy", start); n != 2 {
+		t.Fatalf("expected 2, got %d", n)
+	}
+
+	if _, err := parseHeader("#timedb 99 codec=text"); err == nil {
+		t.Fatal("expected an error for a newer version")
+	}
+}
+
+func TestFileHeaderMerge(t *testing.T) {
+	dir := t.TempDir()
+	dst := New(dir)
+	src := New(t.TempDir())
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	if err := dst.Insert(start, "app", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Insert(start.Add(time.Second), "app", "b"); err != nil {
+		t.Fatal(err)
+	}
+	dst.Close()
+	src.Close()
+
+	if err := Merge(dst, src); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "2020-01-01", "app.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(b), headerMagic); n != 1 || !isHeader(b) {
+		t.Fatalf("expected one header at the start:\n%s", b)
+	}
+}
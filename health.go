@@ -0,0 +1,123 @@
+package timedb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// healthFile is written and removed to check that the database is writable.
+const healthFile = ".health"
+
+// HealthOptions are the thresholds of Health.
+type HealthOptions struct {
+	// MinFreeBytes is the minimum free space in the disk of the
+	// database. Zero doesn't check it.
+	MinFreeBytes uint64
+}
+
+// SetHealthOptions sets the thresholds of Health.
+func (db *DB) SetHealthOptions(o HealthOptions) {
+	db.mutex.Lock()
+	db.health = o
+	db.mutex.Unlock()
+}
+
+// Health returns an error if the database can't work normally: the data
+// directory is not writable, the free space of the disk is below the
+// threshold, the file being written was removed or the last run of the
+// maintenance failed. It is meant for readiness probes.
+func (db *DB) Health() error {
+	var errs []error
+
+	if err := db.checkWritable(); err != nil {
+		errs = append(errs, fmt.Errorf("timeDB: the database is not writable: %w", err))
+	}
+
+	db.mutex.RLock()
+	o := db.health
+	m := db.maintenance
+	db.mutex.RUnlock()
+
+	if o.MinFreeBytes > 0 {
+		if ds, ok := localStorage(db.storage).(diskStorage); ok {
+			free, err := freeSpace(ds.root)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("timeDB: error checking the free space: %w", err))
+			} else if free < o.MinFreeBytes {
+				errs = append(errs, fmt.Errorf("timeDB: %d bytes free, the minimum is %d", free, o.MinFreeBytes))
+			}
+		}
+	}
+
+	if err := db.checkWriteFile(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if m != nil {
+		m.mutex.Lock()
+		err := m.lastErr
+		m.mutex.Unlock()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// checkWritable creates and removes a file.
+func (db *DB) checkWritable() error {
+	local := localStorage(db.storage)
+
+	w, err := local.Create(healthFile)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "ok")
+	if e := w.Close(); err == nil {
+		err = e
+	}
+	if e := local.Remove(healthFile); err == nil {
+		err = e
+	}
+	return err
+}
+
+// checkWriteFile checks that the files being written still exist.
+func (db *DB) checkWriteFile() error {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	for _, w := range db.allWriters() {
+		w.mutex.Lock()
+		err := db.checkWriter(w)
+		w.mutex.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkWriter checks the file of the writer. The caller must hold its lock.
+func (db *DB) checkWriter(w *tableWriter) error {
+	if w.file == nil {
+		return nil
+	}
+
+	if f, ok := w.file.(*os.File); ok {
+		if _, err := f.Stat(); err != nil {
+			return fmt.Errorf("timeDB: invalid file %s: %w", w.path, err)
+		}
+	}
+
+	p := partName(w.path, w.part)
+	if _, err := fs.Stat(localStorage(db.storage), p); err != nil {
+		return fmt.Errorf("timeDB: invalid file %s: %w", p, err)
+	}
+	return nil
+}
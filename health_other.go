@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd)
+
+package timedb
+
+import "errors"
+
+// freeSpace is not supported in this system.
+func freeSpace(dir string) (uint64, error) {
+	return 0, errors.New("not supported")
+}
@@ -0,0 +1,59 @@
+package timedb
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	db := New(t.TempDir())
+	defer db.Close()
+
+	if err := db.Health(); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	if err := db.Insert(start, "nginx", "GET /"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Health(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the file being written is removed
+	if err := os.Remove(localStorage(db.storage).(diskStorage).path(db.Stats().ActiveFile)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Health(); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestHealthMaintenance(t *testing.T) {
+	db := NewMemory()
+
+	failed := errors.New("failed")
+	err := db.StartMaintenance(MaintenanceOptions{
+		Tasks: []func(db *DB) error{
+			func(db *DB) error { return failed },
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.StopMaintenance()
+
+	for i := 0; ; i++ {
+		err := db.Health()
+		if errors.Is(err, failed) {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("expected the error of the maintenance, got %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build linux || darwin || freebsd
+
+package timedb
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHealthFreeSpace(t *testing.T) {
+	db := New(t.TempDir())
+	defer db.Close()
+
+	db.SetHealthOptions(HealthOptions{MinFreeBytes: 1})
+	if err := db.Health(); err != nil {
+		t.Fatal(err)
+	}
+
+	db.SetHealthOptions(HealthOptions{MinFreeBytes: math.MaxUint64})
+	if err := db.Health(); err == nil {
+		t.Fatal("expected an error")
+	}
+}
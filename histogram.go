@@ -0,0 +1,105 @@
+package timedb
+
+import (
+	"fmt"
+	"time"
+)
+
+// Bucket is the number of records in a time interval.
+type Bucket struct {
+	Time  time.Time
+	Count int64
+}
+
+// Histogram returns the number of records of the table in each bucket of
+// the range [start, end). The table can be a pattern and filter is the text
+// that the records must contain. Without a filter and with hour aligned
+// buckets the days are counted from their stats (see DayStats) without
+// reading the data. It returns ErrTooManyBuckets if the range has more
+// than MaxBuckets buckets.
+func (db *DB) Histogram(table string, start, end time.Time, bucket time.Duration, filter string) ([]Bucket, error) {
+	if bucket <= 0 {
+		return nil, fmt.Errorf("timeDB.Histogram: invalid bucket %v", bucket)
+	}
+	if !end.After(start) {
+		return nil, nil
+	}
+
+	start = start.Local()
+	end = end.Local()
+
+	n, err := bucketCount(start, end, bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make([]Bucket, n)
+	for i := range buckets {
+		buckets[i].Time = start.Add(time.Duration(i) * bucket)
+	}
+
+	useStats := filter == "" && bucket%time.Hour == 0 && hourAligned(start) && hourAligned(end)
+	if useStats && db.flushOnQuery.Load() {
+		db.Flush()
+	}
+
+	for _, day := range days(start, end.Add(-time.Nanosecond)) {
+		if useStats {
+			if err := db.statsHistogram(buckets, table, day, start, end, bucket); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if err := db.scanHistogram(buckets, table, day, start, end, bucket, filter); err != nil {
+			return nil, err
+		}
+	}
+
+	return buckets, nil
+}
+
+func hourAligned(t time.Time) bool {
+	return t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0
+}
+
+// statsHistogram counts the records of the day with the hours of the stats.
+func (db *DB) statsHistogram(buckets []Bucket, table string, day, start, end time.Time, bucket time.Duration) error {
+	stats, err := db.tableStats(day, table)
+	if err != nil {
+		return err
+	}
+
+	var hours [24]int64
+	for _, st := range stats {
+		for h, c := range st.Hours {
+			hours[h] += c
+		}
+	}
+
+	for h, c := range hours {
+		t := time.Date(day.Year(), day.Month(), day.Day(), h, 0, 0, 0, time.Local)
+		if c == 0 || t.Before(start) || !t.Before(end) {
+			continue
+		}
+		buckets[t.Sub(start)/bucket].Count += c
+	}
+	return nil
+}
+
+// scanHistogram counts the records of the day reading the data.
+func (db *DB) scanHistogram(buckets []Bucket, table string, day, start, end time.Time, bucket time.Duration, filter string) error {
+	from := day
+	if from.Before(start) {
+		from = start
+	}
+
+	to := day.AddDate(0, 0, 1)
+	if to.After(end) {
+		to = end
+	}
+
+	return db.scanRange(table, from, to, filter, func(d DataPoint) {
+		buckets[d.Time.Sub(start)/bucket].Count++
+	})
+}
@@ -0,0 +1,66 @@
+package timedb
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	db := New(t.TempDir())
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i, m := range []int{0, 10, 70, 24*60 + 5} {
+		text := "info"
+		if i == 1 {
+			text = "error"
+		}
+		if err := db.Insert(start.Add(time.Duration(m)*time.Minute), "log", text); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, filter := range []string{"", "error"} {
+		buckets, err := db.Histogram("log", start, start.Add(48*time.Hour), 24*time.Hour, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []int64{3, 1}
+		if filter != "" {
+			expected = []int64{1, 0}
+		}
+
+		if len(buckets) != 2 || buckets[0].Count != expected[0] || buckets[1].Count != expected[1] {
+			t.Fatalf("filter %q: invalid buckets %v", filter, buckets)
+		}
+	}
+
+	// not aligned to hours
+	buckets, err := db.Histogram("l*", start, start.Add(90*time.Minute), 30*time.Minute, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 3 || buckets[0].Count != 2 || buckets[1].Count != 0 || buckets[2].Count != 1 {
+		t.Fatalf("invalid buckets %v", buckets)
+	}
+}
+
+func TestHistogramTooManyBuckets(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local)
+	_, err := db.Histogram("log", start, start.Add(24*time.Hour), time.Nanosecond, "")
+	if !errors.Is(err, ErrTooManyBuckets) {
+		t.Fatalf("expected ErrTooManyBuckets, got %v", err)
+	}
+
+	_, err = db.Aggregate("log", start, start.Add(24*time.Hour), time.Nanosecond, AggSum, FillZero)
+	if !errors.Is(err, ErrTooManyBuckets) {
+		t.Fatalf("expected ErrTooManyBuckets, got %v", err)
+	}
+
+	if points := Fill(nil, start, start.Add(24*time.Hour), time.Nanosecond, FillZero); len(points) != MaxBuckets {
+		t.Fatalf("unexpected points %d", len(points))
+	}
+}
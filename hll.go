@@ -0,0 +1,94 @@
+package timedb
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// hllPrecision is the number of bits used to select the register. With
+// 2^14 registers the standard error is about 0.8%.
+const hllPrecision = 14
+
+// HyperLogLog estimates the number of distinct values using a fixed
+// amount of memory (16KB).
+type HyperLogLog struct {
+	registers [1 << hllPrecision]uint8
+}
+
+// Add adds a value to the set.
+func (h *HyperLogLog) Add(v string) {
+	f := fnv.New64a()
+	f.Write([]byte(v))
+	x := mix64(f.Sum64())
+
+	i := x >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rank > h.registers[i] {
+		h.registers[i] = rank
+	}
+}
+
+// Merge adds the values of other to the set.
+func (h *HyperLogLog) Merge(other *HyperLogLog) {
+	for i, r := range other.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+}
+
+// Count returns the estimated number of distinct values.
+func (h *HyperLogLog) Count() uint64 {
+	const m = float64(len(h.registers))
+
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+
+	// use linear counting for small sets
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+
+	return uint64(estimate + 0.5)
+}
+
+// mix64 spreads the bits of the FNV hash, that are not random enough
+// in the high bits for short values.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// ApproxDistinct estimates the number of distinct values extracted from
+// the records of the range [start, end) that contain filter. Unlike
+// Distinct the memory used doesn't grow with the number of values.
+func (db *DB) ApproxDistinct(table string, start, end time.Time, filter string, extract Extractor) (uint64, error) {
+	var h HyperLogLog
+
+	err := db.scanRange(table, start, end, filter, func(d DataPoint) {
+		d.Text = trimText(d.Text)
+		if v := extract(d); v != "" {
+			h.Add(v)
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return h.Count(), nil
+}
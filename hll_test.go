@@ -0,0 +1,43 @@
+package timedb
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	for _, n := range []int{10, 1000, 100000} {
+		var h HyperLogLog
+		for i := 0; i < n; i++ {
+			h.Add("client-" + strconv.Itoa(i))
+			h.Add("client-" + strconv.Itoa(i))
+		}
+
+		c := float64(h.Count())
+		if c < float64(n)*0.97 || c > float64(n)*1.03 {
+			t.Fatalf("expected about %d, got %v", n, c)
+		}
+	}
+}
+
+func TestApproxDistinct(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 100; i++ {
+		if err := db.Insert(start, "access", "client %d", i%20); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := db.ApproxDistinct("access", start, start.Add(time.Hour), "", func(d DataPoint) string {
+		return d.Text
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 20 {
+		t.Fatalf("expected 20, got %d", n)
+	}
+}
@@ -0,0 +1,109 @@
+package timedb
+
+// WriteHook transforms the data before it is saved. It can be used to
+// scrub sensitive data, truncate or sample records. If it returns an
+// empty string the record is discarded.
+type WriteHook func(table, data string) string
+
+// AddWriteHook adds a hook that runs on every write. Hooks run in the
+// order they were added.
+func (db *DB) AddWriteHook(h WriteHook) {
+	db.mutex.Lock()
+	db.writeHooks = append(db.writeHooks, h)
+	db.mutex.Unlock()
+}
+
+// runWriteHooks returns the transformed data and false if it must be discarded.
+func (db *DB) runWriteHooks(table, data string) (string, bool) {
+	db.mutex.RLock()
+	hooks := db.writeHooks
+	db.mutex.RUnlock()
+
+	for _, h := range hooks {
+		data = h(table, data)
+		if data == "" {
+			return "", false
+		}
+	}
+	return data, true
+}
+
+// ReadHook transforms the data points returned by a query.
+type ReadHook func(table string, d DataPoint) DataPoint
+
+type readHook struct {
+	table string
+	fn    ReadHook
+}
+
+// AddReadHook adds a hook that transforms the data points of the table
+// before they are returned by Scanner.Data. The table can be a pattern
+// like "app-*" or "logs/**". It is matched against the table of each
+// record, also in the queries of patterns.
+func (db *DB) AddReadHook(table string, h ReadHook) {
+	db.mutex.Lock()
+	db.readHooks = append(db.readHooks, readHook{table: table, fn: h})
+	db.mutex.Unlock()
+}
+
+// getReadHooks returns the read hooks added.
+func (db *DB) getReadHooks() []readHook {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	return db.readHooks
+}
+
+// tableReadHooks returns the read hooks that apply to the table.
+func tableReadHooks(hooks []readHook, table string) []ReadHook {
+	var fns []ReadHook
+	for _, h := range hooks {
+		if matchTable(h.table, table) {
+			fns = append(fns, h.fn)
+		}
+	}
+	return fns
+}
+
+// runReadHooks applies to the current data point the read hooks of the
+// table of its record.
+func (s *Scanner) runReadHooks() {
+	table := s.tableAt(s.consumed)
+
+	fns, ok := s.tableHooks[table]
+	if !ok {
+		fns = tableReadHooks(s.hooks, table)
+		if s.tableHooks == nil {
+			s.tableHooks = make(map[string][]ReadHook)
+		}
+		s.tableHooks[table] = fns
+	}
+
+	for _, h := range fns {
+		s.data = h(table, s.data)
+	}
+}
+
+// WriteObserver is called after a record is saved. The text of
+// the data point is the data as it was saved.
+type WriteObserver func(table string, d DataPoint)
+
+// OnWrite adds an observer that is called after every successful write.
+// It runs synchronously in the goroutine that saves the data so it
+// should return quickly.
+func (db *DB) OnWrite(o WriteObserver) {
+	db.mutex.Lock()
+	db.observers = append(db.observers, o)
+	db.mutex.Unlock()
+}
+
+func (db *DB) notifyWrite(table string, d DataPoint) {
+	db.mutex.RLock()
+	observers := db.observers
+	db.mutex.RUnlock()
+
+	for _, o := range observers {
+		o(table, d)
+	}
+
+	db.mirror(table, d)
+}
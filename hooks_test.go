@@ -0,0 +1,122 @@
+package timedb
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteHooks(t *testing.T) {
+	db := NewMemory()
+
+	db.AddWriteHook(func(table, data string) string {
+		return strings.ReplaceAll(data, "secret", "***")
+	})
+	db.AddWriteHook(func(table, data string) string {
+		if strings.HasPrefix(data, "debug") {
+			return ""
+		}
+		return data
+	})
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for _, v := range []string{"password secret", "debug info", "ok"} {
+		if err := db.Insert(start, "logs", v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scanner := db.Query("logs", start, start, 0, 0)
+	defer scanner.Close()
+
+	var got []string
+	for scanner.Scan() {
+		got = append(got, scanner.Data().Text)
+	}
+
+	if strings.Join(got, ",") != " password ***, ok" {
+		t.Fatalf("unexpected result %q", got)
+	}
+}
+
+func TestReadHooks(t *testing.T) {
+	db := NewMemory()
+
+	db.AddReadHook("app-*", func(table string, d DataPoint) DataPoint {
+		d.Text = strings.ToUpper(d.Text)
+		return d
+	})
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	if err := db.Insert(start, "app-1", "token"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range []string{"app-1", "app-*"} {
+		scanner := db.Query(table, start, start, 0, 0)
+		if !scanner.Scan() || scanner.Data().Text != " TOKEN" {
+			t.Fatalf("unexpected data %q", scanner.Data().Text)
+		}
+		scanner.Close()
+	}
+}
+
+func TestOnWrite(t *testing.T) {
+	db := NewMemory()
+
+	var got []string
+	db.OnWrite(func(table string, d DataPoint) {
+		got = append(got, table+":"+d.Text)
+	})
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	if err := db.Insert(start, "logs", "a %d", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 1 || got[0] != "logs:a 1" {
+		t.Fatalf("unexpected result %q", got)
+	}
+}
+
+func TestReadHooksPattern(t *testing.T) {
+	db := NewMemory()
+
+	db.AddReadHook("secrets", func(table string, d DataPoint) DataPoint {
+		d.Text = " ***"
+		return d
+	})
+	db.AddReadHook("logs/**", func(table string, d DataPoint) DataPoint {
+		d.Text = " " + table + ":" + d.Text[1:]
+		return d
+	})
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i, table := range []string{"secrets", "secret-2", "logs/app/1"} {
+		if err := db.Insert(start.Add(time.Duration(i)*time.Second), table, "token"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, pattern := range []string{"secret*", "*", "**"} {
+		scanner := db.Query(pattern, start, start.Add(time.Minute), 0, 0)
+		if i == 1 {
+			// the days read ahead
+			scanner.SetParallel(2)
+		}
+
+		var got []string
+		for scanner.Scan() {
+			got = append(got, scanner.Data().Text)
+		}
+		scanner.Close()
+
+		want := " ***, token"
+		if pattern == "**" {
+			want += ", logs/app/1:token"
+		}
+		if strings.Join(got, ",") != want {
+			t.Fatalf("%s: unexpected result %q", pattern, got)
+		}
+	}
+}
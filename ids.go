@@ -0,0 +1,162 @@
+package timedb
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The ids of the records inserted with InsertID are saved next to the
+// data of each day ("table.ids"), one per line.
+
+// maxLoadedIDs is the number of files of ids kept in memory.
+const maxLoadedIDs = 16
+
+type recordIDs struct {
+	mutex sync.Mutex
+	files map[string]*idsEntry
+}
+
+type idsEntry struct {
+	// mutex serializes the inserts of the file, so the inserts in other
+	// tables and days don't wait for the record to be written.
+	mutex sync.Mutex
+
+	// users is the number of inserts using the entry. It can't be
+	// removed from memory until they finish.
+	users int
+
+	ids map[string]bool
+
+	// size is the size of the file when it was read, to reload it
+	// if it changes, for example if it is deleted by the retention.
+	size int64
+}
+
+func idsFile(name string) string {
+	return strings.TrimSuffix(statsFile(name), ".stats") + ".ids"
+}
+
+// InsertID saves a record with a unique id. Inserting again a record with
+// the same id in the same table and day does nothing, so clients can retry
+// safely. The id can't contain new lines. In async mode it waits until the
+// record is written, so the id is only saved for records that are.
+func (db *DB) InsertID(t time.Time, table, id, data string, v ...interface{}) error {
+	if id == "" || strings.ContainsAny(id, "\r\n") {
+		return fmt.Errorf("timeDB: invalid record id %q", id)
+	}
+	if err := validTable(table); err != nil {
+		return err
+	}
+
+	name := idsFile(db.getTablePath(t, table))
+
+	ids := &db.ids
+	e := ids.acquire(name)
+	defer ids.release(e)
+
+	if err := e.load(db.storage, name); err != nil {
+		return err
+	}
+	if e.ids[id] {
+		return nil
+	}
+
+	if err := db.saveRecord(t, table, data, true, v...); err != nil {
+		return err
+	}
+
+	w, err := db.storage.Append(name)
+	if err != nil {
+		return fmt.Errorf("timeDB: error saving the id: %v", err)
+	}
+	if _, err := w.Write([]byte(id + "\n")); err != nil {
+		w.Close()
+		return fmt.Errorf("timeDB: error saving the id: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("timeDB: error saving the id: %v", err)
+	}
+
+	e.ids[id] = true
+	e.size += int64(len(id) + 1)
+	return nil
+}
+
+// acquire returns the entry of a file locked.
+func (r *recordIDs) acquire(name string) *idsEntry {
+	r.mutex.Lock()
+	e, ok := r.files[name]
+	if !ok {
+		if r.files == nil {
+			r.files = make(map[string]*idsEntry)
+		}
+		if len(r.files) >= maxLoadedIDs {
+			for k, old := range r.files {
+				if old.users == 0 {
+					delete(r.files, k)
+					break
+				}
+			}
+		}
+		e = &idsEntry{}
+		r.files[name] = e
+	}
+	e.users++
+	r.mutex.Unlock()
+
+	e.mutex.Lock()
+	return e
+}
+
+// release unlocks an entry returned by acquire.
+func (r *recordIDs) release(e *idsEntry) {
+	e.mutex.Unlock()
+
+	r.mutex.Lock()
+	e.users--
+	r.mutex.Unlock()
+}
+
+// load reads the ids of the file if they are not loaded or the file
+// has changed.
+func (e *idsEntry) load(s storage, name string) error {
+	var size int64
+	info, err := fs.Stat(s, name)
+	if err == nil {
+		size = info.Size()
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	if e.ids != nil && e.size == size {
+		return nil
+	}
+
+	e.ids = make(map[string]bool)
+	e.size = 0
+
+	if size > 0 {
+		f, err := s.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			e.ids[sc.Text()] = true
+			e.size += int64(len(sc.Bytes()) + 1)
+		}
+		if err := sc.Err(); err != nil {
+			e.ids = nil
+			return fmt.Errorf("timeDB: error reading %s: %v", name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package timedb
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInsertID(t *testing.T) {
+	dir := t.TempDir()
+	db := New(dir)
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 3; i++ {
+		if err := db.InsertID(start, "log", "id-1", "a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.InsertID(start, "log", "id-2", "b"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// the ids are persisted
+	db = New(dir)
+	if err := db.InsertID(start, "log", "id-1", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := countRecords(t, db, "log", start); n != 2 {
+		t.Fatalf("expected 2 records, got %d", n)
+	}
+
+	// the ids are not tables
+	tables, err := db.matchTables(start, "**")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 1 {
+		t.Fatalf("expected 1 table, got %v", tables)
+	}
+
+	for _, id := range []string{"", "a\nb"} {
+		if err := db.InsertID(start, "log", id, "a"); err == nil {
+			t.Fatalf("%q: expected an error", id)
+		}
+	}
+}
+
+func TestInsertIDConcurrent(t *testing.T) {
+	db := New(t.TempDir())
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+
+	// more tables than files of ids kept in memory, each id inserted
+	// several times at once
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		for j := 0; j < maxLoadedIDs+4; j++ {
+			wg.Add(1)
+			go func(table string) {
+				defer wg.Done()
+				if err := db.InsertID(start, table, "id-1", "a"); err != nil {
+					t.Error(err)
+				}
+			}(fmt.Sprintf("log%d", j))
+		}
+	}
+	wg.Wait()
+
+	for j := 0; j < maxLoadedIDs+4; j++ {
+		if n := countRecords(t, db, fmt.Sprintf("log%d", j), start); n != 1 {
+			t.Fatalf("log%d: expected 1 record, got %d", j, n)
+		}
+	}
+}
+
+func TestInsertIDAsync(t *testing.T) {
+	db := NewMemory()
+	db.StartAsync(AsyncOptions{})
+	defer db.Close()
+
+	// the id is not saved if the write fails
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	db.SetQuota(Quota{MaxBytes: 1})
+	if err := db.InsertID(start, "log", "id-1", "a"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+
+	db.SetQuota(Quota{})
+	if err := db.InsertID(start, "log", "id-1", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := countRecords(t, db, "log", start); n != 1 {
+		t.Fatalf("expected 1 record, got %d", n)
+	}
+}
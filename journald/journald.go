@@ -0,0 +1,170 @@
+/*
+Package journald imports systemd journal entries in a timedb database
+keeping their original time.
+
+	im := &journald.Importer{DB: db}
+	n, err := im.ImportJournal(ctx, "--since", "2020-01-01")
+
+Entries are stored in the same format as the syslog package.
+*/
+package journald
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scorredoira/timedb"
+	"github.com/scorredoira/timedb/syslog"
+)
+
+// Entry are the fields of a journal entry.
+type Entry map[string]string
+
+// Time returns the time when the entry was received by the journal.
+func (e Entry) Time() time.Time {
+	us, err := strconv.ParseInt(e["__REALTIME_TIMESTAMP"], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMicro(us)
+}
+
+// Message converts the entry to a syslog message.
+func (e Entry) Message() *syslog.Message {
+	m := &syslog.Message{
+		Time:     e.Time(),
+		Severity: 6,
+		Hostname: e["_HOSTNAME"],
+		AppName:  e["SYSLOG_IDENTIFIER"],
+		ProcID:   e["_PID"],
+		Text:     e["MESSAGE"],
+	}
+
+	if p, err := strconv.Atoi(e["PRIORITY"]); err == nil {
+		m.Severity = p
+	}
+
+	if f, err := strconv.Atoi(e["SYSLOG_FACILITY"]); err == nil {
+		m.Facility = f
+	}
+
+	if m.AppName == "" {
+		m.AppName = strings.TrimSuffix(e["_SYSTEMD_UNIT"], ".service")
+	}
+
+	// the new line at the end is not part of the message
+	m.Text = strings.TrimRight(m.Text, "\r\n")
+	return m
+}
+
+type Importer struct {
+	DB *timedb.DB
+
+	// Table returns the table of an entry. By default it is the
+	// syslog identifier, the systemd unit or "journal".
+	Table func(e Entry) string
+
+	// Error is called with the entries that can't be saved.
+	Error func(err error)
+}
+
+func (im *Importer) table(e Entry, m *syslog.Message) string {
+	if im.Table != nil {
+		return im.Table(e)
+	}
+	if m.AppName != "" {
+		return m.AppName
+	}
+	return "journal"
+}
+
+// Import reads the output of "journalctl -o json" and saves the entries.
+// It returns the number of entries saved.
+func (im *Importer) Import(r io.Reader) (int, error) {
+	dec := json.NewDecoder(r)
+	n := 0
+
+	for {
+		var fields map[string]json.RawMessage
+		if err := dec.Decode(&fields); err != nil {
+			if err == io.EOF {
+				return n, nil
+			}
+			return n, fmt.Errorf("journald: invalid entry: %v", err)
+		}
+
+		e := make(Entry, len(fields))
+		for k, v := range fields {
+			e[k] = fieldValue(v)
+		}
+
+		m := e.Message()
+		if m.Time.IsZero() {
+			im.error(fmt.Errorf("journald: entry without time: %s", e["__CURSOR"]))
+			continue
+		}
+
+		if err := im.DB.Insert(m.Time, im.table(e, m), m.String()); err != nil {
+			im.error(err)
+			continue
+		}
+		n++
+	}
+}
+
+// ImportJournal runs journalctl with the given arguments and imports its output.
+func (im *Importer) ImportJournal(ctx context.Context, args ...string) (int, error) {
+	cmd := exec.CommandContext(ctx, "journalctl", append([]string{"-o", "json", "--no-pager"}, args...)...)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("journald: error running journalctl: %v", err)
+	}
+
+	n, err := im.Import(out)
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return n, err
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return n, fmt.Errorf("journald: error running journalctl: %v", err)
+	}
+	return n, nil
+}
+
+func (im *Importer) error(err error) {
+	if im.Error != nil {
+		im.Error(err)
+	}
+}
+
+// fieldValue returns the value of a field. Fields that are not valid UTF-8
+// are encoded by journalctl as an array of bytes.
+func fieldValue(v json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(v, &s); err == nil {
+		return s
+	}
+
+	var b []byte
+	var nums []int
+	if err := json.Unmarshal(v, &nums); err == nil {
+		for _, c := range nums {
+			b = append(b, byte(c))
+		}
+		return string(b)
+	}
+
+	return string(v)
+}
@@ -0,0 +1,43 @@
+package journald
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scorredoira/timedb"
+)
+
+func TestImport(t *testing.T) {
+	db := timedb.NewMemory()
+	im := &Importer{DB: db}
+
+	input := `{"__REALTIME_TIMESTAMP":"1577869200000000","PRIORITY":"3","_HOSTNAME":"web1","SYSLOG_IDENTIFIER":"nginx","_PID":"42","MESSAGE":"upstream timed out"}
+{"__REALTIME_TIMESTAMP":"1577869260000000","_HOSTNAME":"web1","_SYSTEMD_UNIT":"app.service","MESSAGE":[104,105,10]}
+`
+
+	n, err := im.Import(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 entries, got %d", n)
+	}
+
+	start := time.Unix(1577869200, 0)
+
+	s := db.Query("nginx", start, start.Add(time.Hour), 0, 0)
+	if !s.Scan() || s.Data().Text != " err web1 nginx[42]: upstream timed out" {
+		t.Fatalf("unexpected entry %q", s.Data().Text)
+	}
+	if !s.Data().Time.Equal(start) {
+		t.Fatalf("unexpected time %v", s.Data().Time)
+	}
+	s.Close()
+
+	s = db.Query("app", start, start.Add(time.Hour), 0, 0)
+	defer s.Close()
+	if !s.Scan() || s.Data().Text != " info web1 app: hi" {
+		t.Fatalf("unexpected entry %q", s.Data().Text)
+	}
+}
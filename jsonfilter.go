@@ -0,0 +1,362 @@
+package timedb
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// JSONFilter matches the records of NDJSON tables. The expressions
+// compare fields with literals and can be combined with &&, || and !:
+//
+//	.status >= 500 && .request.path startsWith "/api"
+//
+// The operators are ==, !=, <, <=, >, >=, startsWith, endsWith and
+// contains. A field alone matches if it exists and is not false, null,
+// zero or empty. Missing fields are null. Lines that are not JSON
+// objects don't match.
+type JSONFilter struct {
+	src  string
+	expr jsonExpr
+}
+
+// ParseJSONFilter parses a filter expression.
+func ParseJSONFilter(expr string) (*JSONFilter, error) {
+	tokens, err := jsonFilterTokens(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &jsonFilterParser{tokens: tokens}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("timeDB: invalid filter: unexpected %s", p.tokens[p.pos])
+	}
+
+	return &JSONFilter{src: expr, expr: e}, nil
+}
+
+// Match reports whether the JSON object matches the filter.
+func (f *JSONFilter) Match(text string) bool {
+	var v map[string]interface{}
+	if err := json.Unmarshal([]byte(text), &v); err != nil {
+		return false
+	}
+	return f.expr.eval(v)
+}
+
+func (f *JSONFilter) String() string {
+	return f.src
+}
+
+// SetJSONFilter returns only the records that match the filter
+// (see JSONFilter).
+func (s *Scanner) SetJSONFilter(expr string) error {
+	f, err := ParseJSONFilter(expr)
+	if err != nil {
+		return err
+	}
+	s.json = f
+	return nil
+}
+
+type jsonExpr interface {
+	eval(v map[string]interface{}) bool
+}
+
+type jsonAnd struct{ a, b jsonExpr }
+
+func (e jsonAnd) eval(v map[string]interface{}) bool { return e.a.eval(v) && e.b.eval(v) }
+
+type jsonOr struct{ a, b jsonExpr }
+
+func (e jsonOr) eval(v map[string]interface{}) bool { return e.a.eval(v) || e.b.eval(v) }
+
+type jsonNot struct{ e jsonExpr }
+
+func (e jsonNot) eval(v map[string]interface{}) bool { return !e.e.eval(v) }
+
+type jsonCompare struct {
+	path  []string
+	op    string
+	value interface{}
+}
+
+func (e jsonCompare) eval(v map[string]interface{}) bool {
+	field := jsonField(v, e.path)
+
+	switch e.op {
+	case "":
+		return jsonTruthy(field)
+	case "==":
+		return jsonEqual(field, e.value)
+	case "!=":
+		return !jsonEqual(field, e.value)
+	case "startsWith", "endsWith", "contains":
+		s, ok := field.(string)
+		sub, ok2 := e.value.(string)
+		if !ok || !ok2 {
+			return false
+		}
+		switch e.op {
+		case "startsWith":
+			return strings.HasPrefix(s, sub)
+		case "endsWith":
+			return strings.HasSuffix(s, sub)
+		default:
+			return strings.Contains(s, sub)
+		}
+	}
+
+	c, ok := jsonCompareValues(field, e.value)
+	if !ok {
+		return false
+	}
+
+	switch e.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+func jsonField(v map[string]interface{}, path []string) interface{} {
+	var field interface{} = v
+	for _, name := range path {
+		m, ok := field.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		field = m[name]
+	}
+	return field
+}
+
+func jsonTruthy(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	default:
+		return true
+	}
+}
+
+func jsonEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case nil, bool, float64, string:
+		return a == b
+	default:
+		return false
+	}
+}
+
+// jsonCompareValues compares two numbers or two strings.
+func jsonCompareValues(a, b interface{}) (int, bool) {
+	switch a := a.(type) {
+	case float64:
+		b, ok := b.(float64)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case a < b:
+			return -1, true
+		case a > b:
+			return 1, true
+		}
+		return 0, true
+	case string:
+		b, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(a, b), true
+	}
+	return 0, false
+}
+
+type jsonFilterParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *jsonFilterParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *jsonFilterParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *jsonFilterParser) or() (jsonExpr, error) {
+	e, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "||" {
+		p.next()
+		b, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		e = jsonOr{e, b}
+	}
+	return e, nil
+}
+
+func (p *jsonFilterParser) and() (jsonExpr, error) {
+	e, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&&" {
+		p.next()
+		b, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		e = jsonAnd{e, b}
+	}
+	return e, nil
+}
+
+func (p *jsonFilterParser) unary() (jsonExpr, error) {
+	switch t := p.next(); {
+	case t == "!":
+		e, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return jsonNot{e}, nil
+
+	case t == "(":
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("timeDB: invalid filter: missing )")
+		}
+		return e, nil
+
+	case strings.HasPrefix(t, "."):
+		e := jsonCompare{path: strings.Split(t[1:], ".")}
+		for _, name := range e.path {
+			if name == "" {
+				return nil, fmt.Errorf("timeDB: invalid filter: invalid field %s", t)
+			}
+		}
+
+		switch op := p.peek(); op {
+		case "==", "!=", "<", "<=", ">", ">=", "startsWith", "endsWith", "contains":
+			p.next()
+			v, err := jsonLiteral(p.next())
+			if err != nil {
+				return nil, err
+			}
+			e.op = op
+			e.value = v
+		}
+		return e, nil
+
+	case t == "":
+		return nil, fmt.Errorf("timeDB: invalid filter: unexpected end")
+
+	default:
+		return nil, fmt.Errorf("timeDB: invalid filter: unexpected %s", t)
+	}
+}
+
+func jsonLiteral(t string) (interface{}, error) {
+	switch {
+	case t == "null":
+		return nil, nil
+	case t == "true":
+		return true, nil
+	case t == "false":
+		return false, nil
+	case strings.HasPrefix(t, `"`):
+		return strconv.Unquote(t)
+	}
+
+	v, err := strconv.ParseFloat(t, 64)
+	if err != nil {
+		return nil, fmt.Errorf("timeDB: invalid filter: invalid value %s", t)
+	}
+	return v, nil
+}
+
+// jsonFilterTokens splits the expression in fields, literals and operators.
+func jsonFilterTokens(expr string) ([]string, error) {
+	var tokens []string
+
+	for i := 0; i < len(expr); {
+		c := expr[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+
+		case c == '"':
+			j := i + 1
+			for ; j < len(expr) && expr[j] != '"'; j++ {
+				if expr[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(expr) {
+				return nil, fmt.Errorf("timeDB: invalid filter: unterminated string")
+			}
+			tokens = append(tokens, expr[i:j+1])
+			i = j + 1
+
+		case strings.ContainsRune("()", rune(c)):
+			tokens = append(tokens, expr[i:i+1])
+			i++
+
+		case strings.ContainsRune("=!<>&|", rune(c)):
+			j := i + 1
+			if j < len(expr) && strings.ContainsRune("=&|", rune(expr[j])) {
+				j++
+			}
+			op := expr[i:j]
+			switch op {
+			case "==", "!=", "<", "<=", ">", ">=", "&&", "||", "!":
+			default:
+				return nil, fmt.Errorf("timeDB: invalid filter: invalid operator %s", op)
+			}
+			tokens = append(tokens, op)
+			i = j
+
+		default:
+			j := i
+			for j < len(expr) && !strings.ContainsRune(" \t\n\"()=!<>&|", rune(expr[j])) {
+				j++
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+		}
+	}
+
+	return tokens, nil
+}
@@ -0,0 +1,78 @@
+package timedb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJSONFilter(t *testing.T) {
+	line := `{"status": 503, "path": "/api/users", "user": {"name": "bob", "admin": true}, "tags": ["a"]}`
+
+	tests := []struct {
+		expr  string
+		match bool
+	}{
+		{`.status >= 500`, true},
+		{`.status < 500`, false},
+		{`.status == 503 && .path startsWith "/api"`, true},
+		{`.status == 503 && .path startsWith "/web"`, false},
+		{`.status == 200 || .path endsWith "users"`, true},
+		{`!(.status == 503)`, false},
+		{`.user.name == "bob"`, true},
+		{`.user.admin`, true},
+		{`.user.missing`, false},
+		{`.user.missing == null`, true},
+		{`.user.missing != "x"`, true},
+		{`.path contains "users"`, true},
+		{`.path > "/a"`, true},
+		{`.status > "500"`, false},
+		{`.tags == "a"`, false},
+	}
+
+	for _, test := range tests {
+		f, err := ParseJSONFilter(test.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", test.expr, err)
+		}
+		if f.Match(line) != test.match {
+			t.Fatalf("%s: expected %v", test.expr, test.match)
+		}
+	}
+
+	if f, _ := ParseJSONFilter(".a"); f.Match("not json") {
+		t.Fatal("invalid lines should not match")
+	}
+
+	for _, expr := range []string{"", ".a ==", ".a = 1", "(.a", ".a == x", `.a == "x`, ".", ".a .b", "a == 1"} {
+		if _, err := ParseJSONFilter(expr); err == nil {
+			t.Fatalf("%s: expected an error", expr)
+		}
+	}
+}
+
+func TestScanJSONFilter(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i, line := range []string{`{"status":200}`, `{"status":500}`, `text`, `{"status":502}`} {
+		if err := db.Insert(start.Add(time.Duration(i)*time.Second), "nginx", line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := db.Query("nginx", start, start.Add(time.Minute), 0, 0)
+	defer s.Close()
+
+	if err := s.SetJSONFilter(".status >= 500"); err != nil {
+		t.Fatal(err)
+	}
+
+	var result []string
+	for s.Scan() {
+		result = append(result, trimText(s.Data().Text))
+	}
+
+	if len(result) != 2 || result[0] != `{"status":500}` || result[1] != `{"status":502}` {
+		t.Fatalf("invalid result %v", result)
+	}
+}
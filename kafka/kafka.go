@@ -0,0 +1,265 @@
+/*
+Package kafka consumes Kafka topics and saves the messages in a timedb
+database. Each topic is stored in a table with its name and each message
+with the time of the record.
+
+The package doesn't depend on a Kafka library, the client is provided
+by the application. For example, with github.com/segmentio/kafka-go:
+
+	func (c client) Open(topic string, partition int, offset int64) (kafka.PartitionReader, error) {
+		r := kafkago.NewReader(kafkago.ReaderConfig{Brokers: c.brokers, Topic: topic, Partition: partition})
+		if err := r.SetOffset(offset); err != nil {
+			return nil, err
+		}
+		return reader{r}, nil
+	}
+
+	c := &kafka.Consumer{DB: db, Client: client{brokers}, Topics: []string{"logs"}}
+	err := c.Run(ctx)
+
+The offsets are saved in the database, so after a restart it continues
+where it stopped. They are saved periodically, so after a crash the
+messages received since the last checkpoint are saved again.
+*/
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/scorredoira/timedb"
+)
+
+// FirstOffset is the offset of the oldest message of a partition.
+// It has the same value as in the usual Kafka clients.
+const FirstOffset int64 = -2
+
+const defaultCheckpointInterval = time.Second
+
+type Message struct {
+	Topic     string
+	Partition int
+	Offset    int64
+	Value     []byte
+	Time      time.Time
+}
+
+// Client connects to the Kafka cluster.
+type Client interface {
+	// Partitions returns the partitions of a topic.
+	Partitions(ctx context.Context, topic string) ([]int, error)
+
+	// Open returns a reader of a partition that starts at offset.
+	Open(topic string, partition int, offset int64) (PartitionReader, error)
+}
+
+type PartitionReader interface {
+	ReadMessage(ctx context.Context) (Message, error)
+	Close() error
+}
+
+type Consumer struct {
+	DB     *timedb.DB
+	Client Client
+	Topics []string
+
+	// Name identifies the offsets of the consumer in the database.
+	// By default it is "kafka".
+	Name string
+
+	// Table returns the table of a message. By default it is the topic.
+	Table func(m Message) string
+
+	// CheckpointInterval is how often the offsets are saved.
+	CheckpointInterval time.Duration
+
+	// Error is called with the messages that can't be saved.
+	Error func(err error)
+
+	mutex   sync.Mutex
+	offsets map[string]map[int]int64
+	dirty   bool
+}
+
+// Run consumes all the partitions of the topics until the context is canceled.
+func (c *Consumer) Run(ctx context.Context) error {
+	if err := c.loadOffsets(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errc := make(chan error, 1)
+	var wg sync.WaitGroup
+
+	for _, topic := range c.Topics {
+		partitions, err := c.Client.Partitions(ctx, topic)
+		if err != nil {
+			cancel()
+			wg.Wait()
+			return fmt.Errorf("kafka: error reading the partitions of %s: %v", topic, err)
+		}
+
+		for _, p := range partitions {
+			wg.Add(1)
+			go func(topic string, partition int) {
+				defer wg.Done()
+				if err := c.consume(ctx, topic, partition); err != nil {
+					select {
+					case errc <- err:
+					default:
+					}
+					cancel()
+				}
+			}(topic, p)
+		}
+	}
+
+	interval := c.CheckpointInterval
+	if interval == 0 {
+		interval = defaultCheckpointInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.saveOffsets(); err != nil {
+				c.error(err)
+			}
+		case <-done:
+			if err := c.saveOffsets(); err != nil {
+				return err
+			}
+			select {
+			case err := <-errc:
+				return err
+			default:
+				return nil
+			}
+		}
+	}
+}
+
+func (c *Consumer) consume(ctx context.Context, topic string, partition int) error {
+	c.mutex.Lock()
+	offset, ok := c.offsets[topic][partition]
+	c.mutex.Unlock()
+	if !ok {
+		offset = FirstOffset
+	}
+
+	r, err := c.Client.Open(topic, partition, offset)
+	if err != nil {
+		return fmt.Errorf("kafka: error opening %s/%d: %v", topic, partition, err)
+	}
+	defer r.Close()
+
+	for {
+		m, err := r.ReadMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("kafka: error reading %s/%d: %v", topic, partition, err)
+		}
+
+		if err := c.handle(m); err != nil {
+			c.error(err)
+		}
+	}
+}
+
+func (c *Consumer) handle(m Message) error {
+	t := m.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	table := m.Topic
+	if c.Table != nil {
+		table = c.Table(m)
+	}
+
+	// the new line at the end is not part of the message
+	text := strings.TrimRight(string(m.Value), "\r\n")
+
+	err := c.DB.Insert(t, table, text)
+
+	// the offset advances even if the message can't be saved,
+	// otherwise a bad message would be retried forever.
+	c.mutex.Lock()
+	if c.offsets[m.Topic] == nil {
+		c.offsets[m.Topic] = make(map[int]int64)
+	}
+	c.offsets[m.Topic][m.Partition] = m.Offset + 1
+	c.dirty = true
+	c.mutex.Unlock()
+
+	return err
+}
+
+func (c *Consumer) metaName() string {
+	name := c.Name
+	if name == "" {
+		name = "kafka"
+	}
+	return name + ".offsets"
+}
+
+func (c *Consumer) loadOffsets() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.offsets = make(map[string]map[int]int64)
+
+	b, err := c.DB.ReadMeta(c.metaName())
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	if err := json.Unmarshal(b, &c.offsets); err != nil {
+		return fmt.Errorf("kafka: invalid offsets: %v", err)
+	}
+	return nil
+}
+
+func (c *Consumer) saveOffsets() error {
+	c.mutex.Lock()
+	if !c.dirty {
+		c.mutex.Unlock()
+		return nil
+	}
+	b, err := json.Marshal(c.offsets)
+	c.dirty = false
+	c.mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+	return c.DB.WriteMeta(c.metaName(), b)
+}
+
+func (c *Consumer) error(err error) {
+	if c.Error != nil {
+		c.Error(err)
+	}
+}
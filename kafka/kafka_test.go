@@ -0,0 +1,115 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/scorredoira/timedb"
+)
+
+type fakeClient struct {
+	messages []Message
+	done     func()
+}
+
+func (c *fakeClient) Partitions(ctx context.Context, topic string) ([]int, error) {
+	return []int{0}, nil
+}
+
+func (c *fakeClient) Open(topic string, partition int, offset int64) (PartitionReader, error) {
+	if offset == FirstOffset {
+		offset = 0
+	}
+	return &fakeReader{c, offset}, nil
+}
+
+type fakeReader struct {
+	client *fakeClient
+	offset int64
+}
+
+func (r *fakeReader) ReadMessage(ctx context.Context) (Message, error) {
+	if r.offset >= int64(len(r.client.messages)) {
+		r.client.done()
+		<-ctx.Done()
+		return Message{}, ctx.Err()
+	}
+	m := r.client.messages[r.offset]
+	r.offset++
+	return m, nil
+}
+
+func (r *fakeReader) Close() error {
+	return nil
+}
+
+func TestConsumer(t *testing.T) {
+	db := timedb.New(t.TempDir())
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+
+	var messages []Message
+	for i := 0; i < 3; i++ {
+		messages = append(messages, Message{
+			Topic:  "logs",
+			Offset: int64(i),
+			Value:  []byte{'a' + byte(i)},
+			Time:   start.Add(time.Duration(i) * time.Minute),
+		})
+	}
+
+	run := func(messages []Message) {
+		ctx, cancel := context.WithCancel(context.Background())
+		c := &Consumer{DB: db, Client: &fakeClient{messages, cancel}, Topics: []string{"logs"}}
+		if err := c.Run(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run(messages[:2])
+
+	// after a restart it continues from the saved offset
+	run(messages)
+
+	s := db.Query("logs", start, start.Add(time.Hour), 0, 0)
+	defer s.Close()
+
+	var got string
+	for s.Scan() {
+		got += s.Data().Text
+	}
+
+	if got != " a b c" {
+		t.Fatalf("unexpected data %q", got)
+	}
+}
+
+type fakeProducer struct {
+	messages []Message
+}
+
+func (p *fakeProducer) Produce(ctx context.Context, messages []Message) error {
+	p.messages = append(p.messages, messages...)
+	return nil
+}
+
+func TestSink(t *testing.T) {
+	db := timedb.NewMemory()
+	p := &fakeProducer{}
+	m := db.Mirror(Sink{Producer: p, Topic: "alerts"}, timedb.MirrorOptions{Block: true, Filter: "error"})
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for _, text := range []string{"ok", "error: timeout", "ok"} {
+		if err := db.Insert(start, "logs", text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.Close()
+
+	if len(p.messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(p.messages))
+	}
+	if msg := p.messages[0]; msg.Topic != "alerts" || string(msg.Value) != "error: timeout" || !msg.Time.Equal(start) {
+		t.Fatalf("invalid message %+v", msg)
+	}
+}
@@ -0,0 +1,39 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/scorredoira/timedb"
+)
+
+// Producer publishes messages to Kafka. Like the Client, it is provided
+// by the application.
+type Producer interface {
+	Produce(ctx context.Context, messages []Message) error
+}
+
+// Sink publishes the records mirrored by a database to a topic, so the
+// critical events can be routed to other systems:
+//
+//	m := db.Mirror(kafka.Sink{Producer: p, Topic: "alerts"}, timedb.MirrorOptions{Tables: []string{"nginx"}, Filter: "status=500"})
+//
+// The value of the messages is the text of the record.
+type Sink struct {
+	Producer Producer
+
+	// Topic is where the messages are published. By default it is the
+	// table of each record.
+	Topic string
+}
+
+func (s Sink) Write(records []timedb.MirrorRecord) error {
+	messages := make([]Message, len(records))
+	for i, r := range records {
+		topic := s.Topic
+		if topic == "" {
+			topic = r.Table
+		}
+		messages[i] = Message{Topic: topic, Value: []byte(r.Text), Time: r.Time}
+	}
+	return s.Producer.Produce(context.Background(), messages)
+}
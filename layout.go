@@ -0,0 +1,146 @@
+package timedb
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PartitionFunc returns the directory of a day relative to the root of
+// the database, like "2006-01-02" or "2006/01/02". The tables of the day
+// are stored inside it.
+type PartitionFunc func(day time.Time) string
+
+// Layout is the directory structure of the database.
+type Layout struct {
+	Partition PartitionFunc
+
+	// Parse is the inverse of Partition. It returns false if the
+	// directory is not a day.
+	Parse func(dir string) (time.Time, bool)
+}
+
+// DayLayout is the default layout: a directory for each day like "2006-01-02".
+var DayLayout = dateLayout("2006-01-02")
+
+// NestedLayout stores the days in directories for each year and
+// month like "2006/01/02".
+var NestedLayout = dateLayout("2006/01/02")
+
+// dateLayout returns a layout that formats the days with a time layout.
+func dateLayout(layout string) Layout {
+	return Layout{
+		Partition: func(day time.Time) string {
+			return day.Format(layout)
+		},
+		Parse: func(dir string) (time.Time, bool) {
+			t, err := time.ParseInLocation(layout, dir, time.Local)
+			return t, err == nil
+		},
+	}
+}
+
+// SetLayout changes the directory structure of the database. It must be
+// set before the database is used and always be the same for the same
+// data. Archives are only supported with the default layout.
+func (db *DB) SetLayout(l Layout) error {
+	if l.Partition == nil || l.Parse == nil {
+		return fmt.Errorf("timeDB.SetLayout: Partition and Parse are required")
+	}
+
+	now := time.Now()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	dir := l.Partition(day)
+	if t, ok := l.Parse(dir); !ok || !t.Equal(day) {
+		return fmt.Errorf("timeDB.SetLayout: Parse is not the inverse of Partition for %s", dir)
+	}
+	if !fs.ValidPath(dir) || dir == "." {
+		return fmt.Errorf("timeDB.SetLayout: invalid directory %s", dir)
+	}
+
+	db.layout.Store(&l)
+	return nil
+}
+
+// customLayout reports whether the layout is not the default.
+func (db *DB) customLayout() bool {
+	return db.layout.Load() != nil
+}
+
+// getDir returns the directory of the day relative to the root of the database.
+func (db *DB) getDir(t time.Time) string {
+	if l := db.layout.Load(); l != nil {
+		return l.Partition(t)
+	}
+	return t.Format("2006-01-02")
+}
+
+// parseDir returns the day of a directory.
+func (db *DB) parseDir(dir string) (time.Time, bool) {
+	if l := db.layout.Load(); l != nil {
+		return l.Parse(dir)
+	}
+	return DayLayout.Parse(dir)
+}
+
+// storageDays returns the days that have a directory in the storage sorted by date.
+func (db *DB) storageDays(s storage) ([]time.Time, error) {
+	// the directories of the days are at the same depth
+	depth := strings.Count(db.getDir(time.Now()), "/")
+
+	dirs := []string{"."}
+	for i := 0; i <= depth; i++ {
+		var next []string
+		for _, dir := range dirs {
+			entries, err := s.ReadDir(dir)
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					continue
+				}
+				return nil, err
+			}
+			for _, e := range entries {
+				if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+					next = append(next, path.Join(dir, e.Name()))
+				}
+			}
+		}
+		dirs = next
+	}
+
+	var result []time.Time
+	for _, dir := range dirs {
+		if t, ok := db.parseDir(dir); ok {
+			result = append(result, t)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Before(result[j]) })
+	return result, nil
+}
+
+// removeDayDir removes the directory of a day if it is empty and its
+// parents that become empty. It returns the number of directories
+// removed and their size.
+func removeDayDir(s storage, dir string) (int, int64) {
+	count, size := removeDirs(s, dir)
+	if count == 0 {
+		return 0, 0
+	}
+
+	for dir = path.Dir(dir); dir != "."; dir = path.Dir(dir) {
+		info, err := fs.Stat(s, dir)
+		if s.Remove(dir) != nil {
+			break
+		}
+		count++
+		if err == nil {
+			size += info.Size()
+		}
+	}
+	return count, size
+}
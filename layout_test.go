@@ -0,0 +1,79 @@
+package timedb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNestedLayout(t *testing.T) {
+	dir := t.TempDir()
+	db := New(dir)
+	if err := db.SetLayout(NestedLayout); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 3; i++ {
+		if err := db.Insert(start.AddDate(0, 0, i), "app", "a%d", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	if _, err := os.Stat(filepath.Join(dir, "2020", "01", "02", "app.log")); err != nil {
+		t.Fatal(err)
+	}
+
+	dayList, err := db.days()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dayList) != 3 || !dayList[2].Equal(time.Date(2020, 1, 3, 0, 0, 0, 0, time.Local)) {
+		t.Fatalf("unexpected days %v", dayList)
+	}
+
+	if n := countRecords(t, db, "app", start.AddDate(0, 0, 2)); n != 1 {
+		t.Fatalf("expected 1, got %d", n)
+	}
+
+	if err := db.Prune(start.AddDate(0, 0, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the month has other days
+	if _, err := os.Stat(filepath.Join(dir, "2020", "01", "01")); !os.IsNotExist(err) {
+		t.Fatalf("expected the day to be removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "2020", "01")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Prune(start.AddDate(0, 0, 3)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "2020")); !os.IsNotExist(err) {
+		t.Fatalf("expected the year to be removed: %v", err)
+	}
+
+	if err := db.Archive(start); err == nil {
+		t.Fatal("expected an error archiving")
+	}
+}
+
+func TestSetLayout(t *testing.T) {
+	db := NewMemory()
+
+	l := Layout{
+		Partition: func(day time.Time) string { return day.Format("2006-01-02") },
+		Parse:     func(dir string) (time.Time, bool) { return time.Time{}, true },
+	}
+	if err := db.SetLayout(l); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if err := db.SetLayout(Layout{}); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,70 @@
+package timedb
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+)
+
+// DefaultMaxLineSize is the default size of the longest line that
+// queries can read.
+const DefaultMaxLineSize = 512 * 1024
+
+// ErrLineTooLong is returned when a record is larger than the maximum
+// line size of a table when writing or of the scanner when reading.
+var ErrLineTooLong = errors.New("timeDB: line too long")
+
+// ErrNewLine is returned when a record contains new lines, which would
+// split it in several records when it is read.
+var ErrNewLine = errors.New("timeDB: the record contains new lines")
+
+// SetMaxLineSize sets the size of the longest line that queries can read.
+// Longer lines stop the scan with ErrLineTooLong. Zero is the default.
+func (db *DB) SetMaxLineSize(n int) {
+	db.maxLine.Store(int64(n))
+}
+
+// SetMaxLineSize is like DB.SetMaxLineSize for this scanner. It must
+// be called before the first Scan.
+func (s *Scanner) SetMaxLineSize(n int) {
+	if n <= 0 {
+		n = DefaultMaxLineSize
+	}
+	s.maxLine = n
+
+	// set large capacity (some lines ar very long)
+	s.scanner.Buffer(make([]byte, 0, min(n, 64*1024)), n)
+}
+
+// SetTruncate truncates the lines longer than the maximum line size
+// instead of returning ErrLineTooLong. It must be called before the
+// first Scan.
+func (s *Scanner) SetTruncate(v bool) {
+	s.trunc = v
+}
+
+// split splits lines like bufio.ScanLines, truncating the long
+// lines if it is enabled.
+func (s *Scanner) split(data []byte, atEOF bool) (int, []byte, error) {
+	advance, token, err := s.splitLine(data, atEOF)
+	s.consumed += int64(advance)
+	return advance, token, err
+}
+
+func (s *Scanner) splitLine(data []byte, atEOF bool) (int, []byte, error) {
+	if s.skip {
+		// discard the rest of a truncated line
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			s.skip = false
+			return i + 1, nil, nil
+		}
+		return len(data), nil, nil
+	}
+
+	advance, token, err := bufio.ScanLines(data, atEOF)
+	if token == nil && err == nil && s.trunc && len(data) >= s.maxLine {
+		s.skip = true
+		return len(data), data, nil
+	}
+	return advance, token, err
+}
@@ -0,0 +1,78 @@
+package timedb
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaxLineSize(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for _, text := range []string{"a", strings.Repeat("x", 100), "b"} {
+		if err := db.Insert(start, "log", text); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db.SetMaxLineSize(50)
+
+	s := db.Query("log", start, start, 0, 0)
+	n := 0
+	for s.Scan() {
+		n++
+	}
+	s.Close()
+
+	if n != 1 || !errors.Is(s.Error, ErrLineTooLong) {
+		t.Fatalf("expected ErrLineTooLong after 1 line, got %d %v", n, s.Error)
+	}
+
+	s = db.Query("log", start, start, 0, 0)
+	s.SetTruncate(true)
+
+	var lines []string
+	for s.Scan() {
+		lines = append(lines, s.Data().Text)
+	}
+	s.Close()
+
+	if s.Error != nil {
+		t.Fatal(s.Error)
+	}
+	if len(lines) != 3 || len(lines[1]) != 50-10 || lines[2] != " b" {
+		t.Fatalf("unexpected lines %q", lines)
+	}
+
+	// the limit of the table when writing
+	if err := db.SetTableOptions("log", TableOptions{MaxLineSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Insert(start, "log", strings.Repeat("x", 20)); !errors.Is(err, ErrLineTooLong) {
+		t.Fatalf("expected ErrLineTooLong, got %v", err)
+	}
+}
+
+func TestInsertNewLine(t *testing.T) {
+	db := NewMemory()
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+
+	for _, text := range []string{"a\n1577869200 forged", "a\rb"} {
+		if err := db.Insert(start, "log", text); !errors.Is(err, ErrNewLine) {
+			t.Fatalf("expected ErrNewLine, got %v", err)
+		}
+	}
+
+	b := db.NewBatch()
+	if err := b.Insert(start, "log", "a\nb"); !errors.Is(err, ErrNewLine) {
+		t.Fatalf("expected ErrNewLine, got %v", err)
+	}
+
+	s := db.Query("log", start, start, 0, 0)
+	defer s.Close()
+	if s.Scan() {
+		t.Fatalf("unexpected record %q", s.Data().Text)
+	}
+}
@@ -0,0 +1,161 @@
+package timedb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrLocked is returned when the data directory is locked by another process.
+var ErrLocked = errors.New("timeDB: locked by another process")
+
+// LockMode is the kind of advisory lock that a process takes on the data
+// directory with LockDir. All modes are shared with the other processes
+// but exclude the maintenance tasks (Archive, Tier, Merge...) that need
+// the directory for themselves.
+type LockMode int
+
+const (
+	// LockRead is for processes that only query. Writes return ErrReadOnly.
+	LockRead LockMode = iota
+
+	// LockWrite allows a single writer process.
+	LockWrite
+
+	// LockMultiWrite allows several writer processes that cooperate
+	// appending to the same files. Each line is written with a single
+	// write to a file opened with O_APPEND, so lines are never mixed.
+	LockMultiWrite
+)
+
+const (
+	lockFile  = "timedb.lock"
+	writeLock = "write.lock"
+)
+
+type dirLock struct {
+	mode  LockMode
+	main  *os.File
+	write *os.File
+}
+
+// LockDir takes an advisory lock (flock) on the data directory that is held
+// until UnlockDir is called. It returns ErrLocked if it conflicts with the
+// lock of another process.
+func (db *DB) LockDir(mode LockMode) error {
+	if db.Path == "" {
+		return fmt.Errorf("timeDB.LockDir: the database is not in a directory")
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if db.lock != nil {
+		return fmt.Errorf("timeDB.LockDir: already locked")
+	}
+
+	main, err := db.openLockFile(lockFile)
+	if err != nil {
+		return err
+	}
+
+	if err := flock(main, false, false); err != nil {
+		main.Close()
+		return err
+	}
+
+	l := &dirLock{mode: mode, main: main}
+
+	if mode != LockRead {
+		l.write, err = db.openLockFile(writeLock)
+		if err != nil {
+			main.Close()
+			return err
+		}
+
+		if err := flock(l.write, mode == LockWrite, false); err != nil {
+			l.write.Close()
+			main.Close()
+			return err
+		}
+	}
+
+	db.lock = l
+	return nil
+}
+
+// UnlockDir releases the lock taken with LockDir.
+func (db *DB) UnlockDir() error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	l := db.lock
+	if l == nil {
+		return nil
+	}
+	db.lock = nil
+
+	if l.write != nil {
+		l.write.Close()
+	}
+	return l.main.Close()
+}
+
+func (db *DB) openLockFile(name string) (*os.File, error) {
+	if err := os.MkdirAll(db.Path, 0777); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(filepath.Join(db.Path, name), os.O_RDWR|os.O_CREATE, 0644)
+}
+
+// lockMaintenance takes the exclusive lock of the data directory for
+// a maintenance task, waiting for the backup if there is one running
+// (see BeginBackup). The returned function releases it.
+func (db *DB) lockMaintenance() (func(), error) {
+	db.backup.gate.RLock()
+
+	unlock, err := db.lockDir()
+	if err != nil {
+		db.backup.gate.RUnlock()
+		return nil, err
+	}
+
+	return func() {
+		unlock()
+		db.backup.gate.RUnlock()
+	}, nil
+}
+
+// lockDir takes the exclusive lock of the data directory.
+func (db *DB) lockDir() (func(), error) {
+	if db.Path == "" {
+		return func() {}, nil
+	}
+
+	db.mutex.RLock()
+	l := db.lock
+	db.mutex.RUnlock()
+
+	if l != nil {
+		// upgrade the lock of the process
+		if err := flock(l.main, true, false); err != nil {
+			// a failed upgrade can lose the shared lock
+			flock(l.main, false, true)
+			return nil, err
+		}
+		return func() { flock(l.main, false, true) }, nil
+	}
+
+	f, err := db.openLockFile(lockFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := flock(f, true, false); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return func() { f.Close() }, nil
+}
@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package timedb
+
+import "os"
+
+// flock is not supported in this system so directories are not locked.
+func flock(f *os.File, exclusive, block bool) error {
+	return nil
+}
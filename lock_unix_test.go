@@ -0,0 +1,68 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package timedb
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLockDir(t *testing.T) {
+	dir := t.TempDir()
+	month := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+
+	// each DB opens its own lock files so they behave like different processes
+	writer := New(dir)
+	if err := writer.LockDir(LockWrite); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Insert(month, "log", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	other := New(dir)
+	if err := other.LockDir(LockWrite); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+	if err := other.LockDir(LockMultiWrite); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+
+	reader := New(dir)
+	if err := reader.LockDir(LockRead); err != nil {
+		t.Fatal(err)
+	}
+	if err := reader.Insert(month, "log", "b"); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+
+	// maintenance needs the directory for itself
+	if err := writer.Archive(month); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+
+	reader.UnlockDir()
+
+	if err := writer.Archive(month); err != nil {
+		t.Fatal(err)
+	}
+
+	// the writer keeps its shared lock after the maintenance
+	if err := other.Archive(month); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+
+	writer.UnlockDir()
+
+	if err := other.LockDir(LockMultiWrite); err != nil {
+		t.Fatal(err)
+	}
+	defer other.UnlockDir()
+
+	third := New(dir)
+	if err := third.LockDir(LockMultiWrite); err != nil {
+		t.Fatal(err)
+	}
+	third.UnlockDir()
+}
@@ -0,0 +1,21 @@
+package timedb
+
+import "log/slog"
+
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// SetLogger sets the logger for internal warnings, like invalid lines
+// skipped by queries or errors in background tasks. By default
+// nothing is logged.
+func (db *DB) SetLogger(l *slog.Logger) {
+	db.logger.Store(l)
+}
+
+// log returns the logger. It doesn't lock so it can be
+// used while holding the lock of the database.
+func (db *DB) log() *slog.Logger {
+	if l := db.logger.Load(); l != nil {
+		return l
+	}
+	return discardLogger
+}
@@ -0,0 +1,33 @@
+package timedb
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogger(t *testing.T) {
+	db := NewMemory()
+
+	var buf bytes.Buffer
+	db.SetLogger(slog.New(slog.NewTextHandler(&buf, nil)))
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	w, err := db.storage.Append(db.getTablePath(start, "logs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "corrupt\n")
+
+	scanner := db.Query("logs", start, start, 0, 0)
+	for scanner.Scan() {
+	}
+	scanner.Close()
+
+	if !strings.Contains(buf.String(), "invalid line") {
+		t.Fatalf("expected a warning, got %q", buf.String())
+	}
+}
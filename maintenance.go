@@ -0,0 +1,173 @@
+package timedb
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const defaultMaintenanceInterval = time.Hour
+
+// MaintenanceOptions are the tasks run by StartMaintenance.
+type MaintenanceOptions struct {
+	// Interval is the time between runs. By default one hour.
+	Interval time.Duration
+
+	// Retention deletes the days older than it. Zero keeps them.
+	Retention time.Duration
+
+	// Archive packs the months before the current one.
+	Archive bool
+
+	// Stats builds the stats of the days before today (see DayStats).
+	Stats bool
+
+	// Bloom builds the bloom filters of the days before today
+	// (see BuildBloom).
+	Bloom bool
+
+	// Tasks are run after the built in tasks, for example to build
+	// rollups or indexes.
+	Tasks []func(db *DB) error
+
+	// Error is called with the errors of the tasks. They are
+	// logged anyway.
+	Error func(err error)
+}
+
+type maintenance struct {
+	stop    chan struct{}
+	done    chan struct{}
+	mutex   sync.Mutex
+	lastRun time.Time
+	lastErr error
+}
+
+// StartMaintenance runs the maintenance tasks in the background: retention,
+// the table options (see ApplyTableOptions), archiving, the extra tasks
+// and the removal of empty directories. The first run is immediate.
+func (db *DB) StartMaintenance(o MaintenanceOptions) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if db.maintenance != nil {
+		return fmt.Errorf("timeDB.StartMaintenance: already running")
+	}
+
+	if o.Interval == 0 {
+		o.Interval = defaultMaintenanceInterval
+	}
+
+	m := &maintenance{stop: make(chan struct{}), done: make(chan struct{})}
+	db.maintenance = m
+
+	go func() {
+		defer close(m.done)
+
+		ticker := time.NewTicker(o.Interval)
+		defer ticker.Stop()
+
+		for {
+			err := db.runMaintenance(o)
+
+			m.mutex.Lock()
+			m.lastRun = time.Now()
+			m.lastErr = err
+			m.mutex.Unlock()
+
+			select {
+			case <-ticker.C:
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// StopMaintenance stops the maintenance and waits until the current run ends.
+func (db *DB) StopMaintenance() {
+	db.mutex.Lock()
+	m := db.maintenance
+	db.maintenance = nil
+	db.mutex.Unlock()
+
+	if m != nil {
+		close(m.stop)
+		<-m.done
+	}
+}
+
+// runMaintenance runs all the tasks even if some of them fail
+// and returns the first error.
+func (db *DB) runMaintenance(o MaintenanceOptions) error {
+	var first error
+	check := func(task string, err error) {
+		if err == nil {
+			return
+		}
+		err = fmt.Errorf("timeDB: maintenance %s: %w", task, err)
+		db.log().Warn("timedb: maintenance error", "task", task, "error", err)
+		if o.Error != nil {
+			o.Error(err)
+		}
+		if first == nil {
+			first = err
+		}
+	}
+
+	now := time.Now()
+
+	if o.Retention > 0 {
+		check("retention", db.Prune(now.Add(-o.Retention)))
+	}
+
+	check("table options", db.ApplyTableOptions())
+
+	if o.Archive {
+		check("archive", db.archiveOldMonths(now))
+	}
+
+	if o.Stats {
+		check("stats", db.buildStats())
+	}
+
+	if o.Bloom {
+		check("bloom", db.buildBlooms())
+	}
+
+	for i, task := range o.Tasks {
+		check(fmt.Sprintf("task %d", i), task(db))
+	}
+
+	_, err := db.Vacuum()
+	check("vacuum", err)
+
+	return first
+}
+
+// archiveOldMonths archives the months before the current one
+// that have days that are not archived.
+func (db *DB) archiveOldMonths(now time.Time) error {
+	dayList, err := db.storageDays(localStorage(db.storage))
+	if err != nil {
+		return err
+	}
+
+	current := now.Format("2006-01")
+	done := make(map[string]bool)
+
+	for _, day := range dayList {
+		month := day.Format("2006-01")
+		if month >= current || done[month] {
+			continue
+		}
+		done[month] = true
+
+		if err := db.Archive(day); err != nil {
+			return err
+		}
+	}
+	return nil
+}
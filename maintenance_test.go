@@ -0,0 +1,56 @@
+package timedb
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMaintenance(t *testing.T) {
+	db := New(t.TempDir())
+
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		db.Insert(now.AddDate(0, 0, -i), "log", "a")
+	}
+
+	// an empty day
+	w, err := db.storage.Create(db.getDir(now.AddDate(0, 0, -10)) + "/x/y.tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	db.storage.Remove(db.getDir(now.AddDate(0, 0, -10)) + "/x/y.tmp")
+
+	var ran bool
+	o := MaintenanceOptions{
+		Retention: 48 * time.Hour,
+		Tasks: []func(db *DB) error{
+			func(db *DB) error {
+				ran = true
+				return errors.New("failed")
+			},
+		},
+	}
+
+	err = db.runMaintenance(o)
+	if err == nil || !ran {
+		t.Fatalf("expected the error of the task, got %v", err)
+	}
+
+	dayList, err := db.days()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dayList) != 3 {
+		t.Fatalf("expected 3 days, got %d", len(dayList))
+	}
+
+	if err := db.StartMaintenance(MaintenanceOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.StartMaintenance(MaintenanceOptions{}); err == nil {
+		t.Fatal("expected an error")
+	}
+	db.StopMaintenance()
+}
@@ -0,0 +1,213 @@
+package timedb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// tenantMeta is the metadata file with the options of a tenant.
+const tenantMeta = "tenant.json"
+
+// TenantOptions are the limits of the data of a tenant.
+type TenantOptions struct {
+	// Retention is how long the data is kept. Zero keeps it forever.
+	Retention time.Duration
+
+	// MaxBytes is the maximum size of the data. When it is exceeded
+	// the oldest days are deleted. Zero is unlimited.
+	MaxBytes int64
+}
+
+// Manager keeps a separate database for each tenant in a subdirectory
+// of Root, like root/tenantID/2006-01-02/table.log.
+type Manager struct {
+	Root string
+
+	// Defaults are the options of the tenants without their own.
+	Defaults TenantOptions
+
+	mutex sync.Mutex
+	dbs   map[string]*DB
+}
+
+func NewManager(root string) *Manager {
+	return &Manager{Root: root, dbs: make(map[string]*DB)}
+}
+
+// DB returns the database of the tenant, creating it if necessary.
+func (m *Manager) DB(tenant string) (*DB, error) {
+	if err := validTenant(tenant); err != nil {
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	db, ok := m.dbs[tenant]
+	if !ok {
+		db = New(filepath.Join(m.Root, tenant))
+		m.dbs[tenant] = db
+	}
+	return db, nil
+}
+
+func validTenant(tenant string) error {
+	if !fs.ValidPath(tenant) || tenant == "." || filepath.Base(tenant) != tenant {
+		return fmt.Errorf("timeDB: invalid tenant %q", tenant)
+	}
+	return nil
+}
+
+// Tenants returns the tenants that have data.
+func (m *Manager) Tenants() ([]string, error) {
+	entries, err := os.ReadDir(m.Root)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var tenants []string
+	for _, e := range entries {
+		if e.IsDir() {
+			tenants = append(tenants, e.Name())
+		}
+	}
+	sort.Strings(tenants)
+	return tenants, nil
+}
+
+// SetOptions saves the options of the tenant in its data directory.
+func (m *Manager) SetOptions(tenant string, o TenantOptions) error {
+	db, err := m.DB(tenant)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	return db.WriteMeta(tenantMeta, b)
+}
+
+// Options returns the options of the tenant or the defaults if it has none.
+func (m *Manager) Options(tenant string) (TenantOptions, error) {
+	db, err := m.DB(tenant)
+	if err != nil {
+		return TenantOptions{}, err
+	}
+
+	b, err := db.ReadMeta(tenantMeta)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return m.Defaults, nil
+		}
+		return TenantOptions{}, err
+	}
+
+	var o TenantOptions
+	if err := json.Unmarshal(b, &o); err != nil {
+		return TenantOptions{}, fmt.Errorf("timeDB: invalid options of tenant %s: %v", tenant, err)
+	}
+	return o, nil
+}
+
+// Remove deletes all the data of the tenant.
+func (m *Manager) Remove(tenant string) error {
+	if err := validTenant(tenant); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	db, ok := m.dbs[tenant]
+	delete(m.dbs, tenant)
+	m.mutex.Unlock()
+
+	if ok {
+		db.Close()
+		db.UnlockDir()
+	}
+
+	return os.RemoveAll(filepath.Join(m.Root, tenant))
+}
+
+// Enforce applies the retention and the quota of all the tenants.
+func (m *Manager) Enforce() error {
+	tenants, err := m.Tenants()
+	if err != nil {
+		return err
+	}
+
+	for _, tenant := range tenants {
+		if err := m.enforce(tenant); err != nil {
+			return fmt.Errorf("timeDB: tenant %s: %v", tenant, err)
+		}
+	}
+	return nil
+}
+
+func (m *Manager) enforce(tenant string) error {
+	o, err := m.Options(tenant)
+	if err != nil {
+		return err
+	}
+
+	db, err := m.DB(tenant)
+	if err != nil {
+		return err
+	}
+
+	if o.Retention > 0 {
+		if err := db.Prune(time.Now().Add(-o.Retention)); err != nil {
+			return err
+		}
+	}
+
+	if o.MaxBytes <= 0 {
+		return nil
+	}
+
+	for {
+		size, err := db.size()
+		if err != nil {
+			return err
+		}
+		if size <= o.MaxBytes {
+			return nil
+		}
+
+		dayList, err := db.days()
+		if err != nil {
+			return err
+		}
+
+		// the last day is kept even if it exceeds the quota by itself
+		if len(dayList) < 2 {
+			return nil
+		}
+
+		if err := db.Prune(dayList[0].AddDate(0, 0, 1)); err != nil {
+			return err
+		}
+	}
+}
+
+// Close closes the files of all the databases.
+func (m *Manager) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, db := range m.dbs {
+		db.Close()
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package timedb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestManager(t *testing.T) {
+	root := t.TempDir()
+	m := NewManager(root)
+	defer m.Close()
+
+	for _, tenant := range []string{"", ".", "..", "a/b"} {
+		if _, err := m.DB(tenant); err == nil {
+			t.Fatalf("expected an error for %q", tenant)
+		}
+	}
+
+	a, err := m.DB("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := m.DB("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		t := now.AddDate(0, 0, -i)
+		a.Insert(t, "log", "aaaaaaaaaa")
+		b.Insert(t, "log", "bbbbbbbbbb")
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "a", now.Format("2006-01-02"), "log.log")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.SetOptions("a", TenantOptions{Retention: 48 * time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	// each file is 22 bytes plus the header and the options 30
+	if err := m.SetOptions("b", TenantOptions{MaxBytes: 200}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the options are saved in the data directory
+	m2 := NewManager(root)
+	if o, err := m2.Options("b"); err != nil || o.MaxBytes != 200 {
+		t.Fatalf("unexpected options %v %v", o, err)
+	}
+
+	if err := m.Enforce(); err != nil {
+		t.Fatal(err)
+	}
+
+	count := func(db *DB) int {
+		dayList, err := db.days()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(dayList)
+	}
+
+	if n := count(a); n != 3 {
+		t.Fatalf("expected 3 days, got %d", n)
+	}
+	if n := count(b); n != 2 {
+		t.Fatalf("expected 2 days, got %d", n)
+	}
+
+	if err := m.Remove("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	tenants, err := m.Tenants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tenants) != 1 || tenants[0] != "b" {
+		t.Fatalf("unexpected tenants %v", tenants)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2020, 1, 30, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 4; i++ {
+		if err := db.Insert(start.AddDate(0, 0, i), "logs", "v%d", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.Archive(start); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Prune(time.Date(2020, 2, 2, 0, 0, 0, 0, time.Local)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.storage.Open("2020-01.tar.zst"); err == nil {
+		t.Fatal("the archive should be removed")
+	}
+
+	scanner := db.Query("logs", start, start.AddDate(0, 0, 3), 0, 0)
+	defer scanner.Close()
+
+	var got string
+	for scanner.Scan() {
+		got += scanner.Data().Text
+	}
+
+	if got != " v3" {
+		t.Fatalf("unexpected result %q", got)
+	}
+}
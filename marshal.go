@@ -0,0 +1,60 @@
+package timedb
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// dataPointJSON is the JSON form of a DataPoint.
+type dataPointJSON struct {
+	Time string
+	Text string
+	Seq  uint64 `json:",omitempty"`
+}
+
+// MarshalJSON encodes the time in RFC 3339 format and the text without
+// the separator of the stored line: {"Time":"2020-01-01T10:00:00Z","Text":"a"}.
+func (d DataPoint) MarshalJSON() ([]byte, error) {
+	return json.Marshal(dataPointJSON{
+		Time: d.Time.Format(time.RFC3339),
+		Text: trimText(d.Text),
+		Seq:  d.Seq,
+	})
+}
+
+// UnmarshalJSON decodes a data point encoded by MarshalJSON.
+func (d *DataPoint) UnmarshalJSON(b []byte) error {
+	var v dataPointJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	t, err := time.Parse(time.RFC3339, v.Time)
+	if err != nil {
+		return fmt.Errorf("timeDB: invalid time %s", v.Time)
+	}
+
+	*d = DataPoint{Time: t, Text: v.Text, Seq: v.Seq}
+	return nil
+}
+
+// MarshalText encodes the data point as the time in RFC 3339 format
+// followed by a space and the text: "2020-01-01T10:00:00Z a".
+func (d DataPoint) MarshalText() ([]byte, error) {
+	return []byte(d.Time.Format(time.RFC3339) + " " + trimText(d.Text)), nil
+}
+
+// UnmarshalText decodes a data point encoded by MarshalText.
+func (d *DataPoint) UnmarshalText(b []byte) error {
+	s, text, _ := strings.Cut(string(b), " ")
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return fmt.Errorf("timeDB: invalid time %s", s)
+	}
+
+	*d = DataPoint{Time: t, Text: text}
+	return nil
+}
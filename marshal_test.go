@@ -0,0 +1,51 @@
+package timedb
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDataPointJSON(t *testing.T) {
+	d := DataPoint{Time: time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC), Text: " GET / 200"}
+
+	b, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != `{"Time":"2020-01-01T10:00:00Z","Text":"GET / 200"}` {
+		t.Fatalf("unexpected json %s", s)
+	}
+
+	var v DataPoint
+	if err := json.Unmarshal([]byte(`{"Time":"2020-01-01T11:00:00+01:00","Text":"GET / 200","Seq":3}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if !v.Time.Equal(d.Time) || v.Text != "GET / 200" || v.Seq != 3 {
+		t.Fatalf("unexpected data point %+v", v)
+	}
+
+	if err := json.Unmarshal([]byte(`{"Time":"yesterday"}`), &v); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestDataPointText(t *testing.T) {
+	d := DataPoint{Time: time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC), Text: " a b"}
+
+	b, err := d.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != "2020-01-01T10:00:00Z a b" {
+		t.Fatalf("unexpected text %s", s)
+	}
+
+	var v DataPoint
+	if err := v.UnmarshalText(b); err != nil {
+		t.Fatal(err)
+	}
+	if !v.Time.Equal(d.Time) || v.Text != "a b" {
+		t.Fatalf("unexpected data point %+v", v)
+	}
+}
@@ -0,0 +1,395 @@
+package timedb
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// isPattern reports whether the table name is a glob pattern like "app-*".
+func isPattern(table string) bool {
+	return strings.ContainsAny(table, "*?[")
+}
+
+// matchTables returns the tables of the day that match the pattern.
+func (db *DB) matchTables(t time.Time, pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	dir := db.getDir(t)
+	files, err := dayFiles(db.storage, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var tables []string
+	seen := make(map[string]bool)
+	for _, f := range files {
+		table, ok := tableFileName(f[len(dir)+1:])
+		if !ok || seen[table] {
+			continue
+		}
+		seen[table] = true
+
+		if matchTable(pattern, table) {
+			tables = append(tables, table)
+		}
+	}
+
+	return tables, nil
+}
+
+// eachTableDay calls fn for every day in [start, end) with the range of
+// the day and every table of the day that matches the pattern.
+func (db *DB) eachTableDay(pattern string, start, end time.Time, fn func(table string, day, from, to time.Time) error) error {
+	start, end = start.Local(), end.Local()
+
+	for _, day := range days(start, end) {
+		from, to := day, day.AddDate(0, 0, 1)
+		if start.After(from) {
+			from = start
+		}
+		if end.Before(to) {
+			to = end
+		}
+		if !from.Before(to) {
+			continue
+		}
+
+		tables := []string{pattern}
+		if isPattern(pattern) {
+			var err error
+			if tables, err = db.matchTables(day, pattern); err != nil {
+				continue
+			}
+		}
+
+		for _, table := range tables {
+			if err := fn(table, day, from, to); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// mergeReader reads lines from many sources and returns them sorted by time.
+// Each source is expected to be sorted already.
+type mergeReader struct {
+	files []io.ReadCloser
+	heads []*mergeHead
+	buf   []byte
+	err   error
+
+	// tables are the tables of the files, if they are known, to
+	// record in runs the table of the lines read.
+	tables []string
+	runs   []tableRun
+	read   int64
+}
+
+// tableRun is a sequence of lines of the same table that ends at the
+// position end of the data read.
+type tableRun struct {
+	end   int64
+	table string
+}
+
+type mergeHead struct {
+	reader *bufio.Reader
+	source int
+	line   []byte
+	epoch  int64
+}
+
+func newMergeReader(files []io.ReadCloser) *mergeReader {
+	m := &mergeReader{files: files}
+	for i, f := range files {
+		h := &mergeHead{reader: bufio.NewReader(f), source: i}
+		if m.advance(h) {
+			m.heads = append(m.heads, h)
+		}
+	}
+	return m
+}
+
+// advance reads the next line of the source. It returns false when
+// the source is exhausted.
+func (m *mergeReader) advance(h *mergeHead) bool {
+	line, err := h.reader.ReadBytes('\n')
+	if len(line) == 0 {
+		if err != nil && err != io.EOF {
+			m.err = err
+		}
+		return false
+	}
+
+	if line[len(line)-1] != '\n' {
+		line = append(line, '\n')
+	}
+
+	h.line = line
+	h.epoch = lineEpoch(line)
+	return true
+}
+
+// next returns the oldest line of the sources and the index of its
+// source. Ties keep the order of the sources.
+func (m *mergeReader) next() ([]byte, int, bool) {
+	if len(m.heads) == 0 {
+		return nil, 0, false
+	}
+
+	min := 0
+	for i, h := range m.heads[1:] {
+		if h.epoch < m.heads[min].epoch {
+			min = i + 1
+		}
+	}
+
+	h := m.heads[min]
+	line, source := h.line, h.source
+	if !m.advance(h) {
+		m.heads = append(m.heads[:min], m.heads[min+1:]...)
+	}
+	return line, source, true
+}
+
+func (m *mergeReader) Read(p []byte) (int, error) {
+	for len(m.buf) < len(p) {
+		line, source, ok := m.next()
+		if !ok {
+			break
+		}
+		m.buf = append(m.buf, line...)
+		if m.tables != nil {
+			m.addRun(m.tables[source], len(line))
+		}
+	}
+
+	if len(m.buf) == 0 {
+		if m.err != nil {
+			return 0, m.err
+		}
+		return 0, io.EOF
+	}
+
+	n := copy(p, m.buf)
+	m.buf = m.buf[n:]
+	return n, nil
+}
+
+// addRun records that the next n bytes read are of the table.
+func (m *mergeReader) addRun(table string, n int) {
+	m.read += int64(n)
+	if k := len(m.runs); k > 0 && m.runs[k-1].table == table {
+		m.runs[k-1].end = m.read
+		return
+	}
+	m.runs = append(m.runs, tableRun{end: m.read, table: table})
+}
+
+// tableAt returns the table of the line that ends at the position end
+// of the data read. The lines must be looked up in order.
+func (m *mergeReader) tableAt(end int64) string {
+	for len(m.runs) > 1 && m.runs[0].end < end {
+		m.runs = m.runs[1:]
+	}
+	if len(m.runs) == 0 {
+		return ""
+	}
+	return m.runs[0].table
+}
+
+func (m *mergeReader) Close() error {
+	var err error
+	for _, f := range m.files {
+		if e := f.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// lineEpoch returns the unix time at the start of a line or 0 if it is invalid.
+func lineEpoch(line []byte) int64 {
+	i := bytes.IndexByte(line, ' ')
+	if i == -1 {
+		return 0
+	}
+
+	epoch, _, err := parseTimeField(string(line[:i]))
+	if err != nil {
+		return 0
+	}
+	return epoch
+}
+
+// Merge merges the data of src into dst. The files of each day are combined
+// sorted by time and the records that both have are stored only once. Both
+// databases are expected to have their files sorted.
+func Merge(dst, src *DB) error {
+	if src == dst {
+		return fmt.Errorf("timeDB.Merge: source and destination are the same")
+	}
+
+	unlock, err := dst.lockMaintenance()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	dayList, err := src.days()
+	if err != nil {
+		return err
+	}
+
+	for _, day := range dayList {
+		tables, err := src.matchTables(day, "**")
+		if err != nil {
+			return err
+		}
+
+		for _, table := range tables {
+			if err := mergeDay(dst, src, day, table); err != nil {
+				dst.resetUsage()
+				return err
+			}
+		}
+	}
+
+	dst.resetUsage()
+	return nil
+}
+
+func mergeDay(dst, src *DB, day time.Time, table string) error {
+	// the source is opened with its lock and read with only the lock of
+	// the destination, so two databases can be merged into each other at
+	// the same time without a deadlock
+	src.mutex.RLock()
+	in, err := src.openParts(day, src.getTablePath(day, table))
+	src.mutex.RUnlock()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("timeDB.Merge: %v", err)
+	}
+
+	dst.mutex.Lock()
+	defer dst.mutex.Unlock()
+
+	var files []io.ReadCloser
+	f, err := dst.openParts(day, dst.getTablePath(day, table))
+	if err == nil {
+		files = append(files, f)
+	} else if !os.IsNotExist(err) {
+		in.Close()
+		return fmt.Errorf("timeDB.Merge: %v", err)
+	}
+	files = append(files, in)
+
+	m := newMergeReader(files)
+	defer m.Close()
+
+	fileName := dst.getTablePath(day, table)
+	tmpName := fileName + ".tmp"
+	tmp, err := dst.storage.Create(tmpName)
+	if err != nil {
+		return fmt.Errorf("timeDB.Merge: error creating temp file: %v", err)
+	}
+	defer dst.storage.Remove(tmpName)
+
+	if _, err := dst.writeHeader(tmp, 0); err != nil {
+		tmp.Close()
+		return fmt.Errorf("timeDB.Merge: error writing %s: %v", fileName, err)
+	}
+
+	if err := writeUnique(tmp, m, dst.recordKey); err != nil {
+		tmp.Close()
+		return fmt.Errorf("timeDB.Merge: error writing %s: %v", fileName, err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("timeDB.Merge: error writing %s: %v", fileName, err)
+	}
+
+	// the active file is going to be replaced
+	dst.closeFile(fileName)
+
+	// the queries running keep reading the old file. The merged file has
+	// the records of all the parts.
+	retired := append([]string{fileName}, partFiles(localStorage(dst.storage), fileName)...)
+	if err := dst.retire(dst.storage, retired...); err != nil {
+		return fmt.Errorf("timeDB.Merge: error replacing %s: %v", fileName, err)
+	}
+
+	return dst.storage.Rename(tmpName, fileName)
+}
+
+// writeUnique copies the sorted lines of the sources to w skipping the
+// headers and the lines of a source that repeat records of another one.
+// The records are compared by the key of the line (see recordKey). A
+// record repeated in the same second is written as many times as the
+// source that has it most, so the repeated records of a source are kept.
+func writeUnique(w io.Writer, m *mergeReader, key func(line []byte) string) error {
+	bw := bufio.NewWriter(w)
+
+	var epoch int64
+	written := make(map[string]int)
+	counts := make(map[int]map[string]int)
+
+	for {
+		line, source, ok := m.next()
+		if !ok {
+			break
+		}
+		if isHeader(line) {
+			continue
+		}
+
+		if e := lineEpoch(line); e != epoch {
+			epoch = e
+			clear(written)
+			clear(counts)
+		}
+
+		c := counts[source]
+		if c == nil {
+			c = make(map[string]int)
+			counts[source] = c
+		}
+		k := key(line)
+		c[k]++
+
+		if c[k] > written[k] {
+			written[k]++
+			if _, err := bw.Write(line); err != nil {
+				return err
+			}
+		}
+	}
+
+	if m.err != nil {
+		return m.err
+	}
+	return bw.Flush()
+}
+
+// recordKey returns the time and the decrypted payload of a line without
+// the sequence number, so the same record is found in several files even
+// if it was numbered or encrypted again with another nonce.
+func (db *DB) recordKey(line []byte) string {
+	d, ok := db.decodeLine(strings.TrimSuffix(string(line), "\n"))
+	if !ok {
+		return string(line)
+	}
+	return strconv.FormatInt(d.Time.Unix(), 10) + d.Text
+}
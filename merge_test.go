@@ -0,0 +1,189 @@
+package timedb
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryPattern(t *testing.T) {
+	db := New(t.TempDir())
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	writes := []struct {
+		table string
+		sec   int
+		text  string
+	}{
+		{"app-1", 0, "a"},
+		{"app-2", 1, "b"},
+		{"app-1", 2, "c"},
+		{"other", 3, "x"},
+		{"app-2", 4, "d"},
+	}
+
+	for _, w := range writes {
+		if err := db.Insert(start.Add(time.Duration(w.sec)*time.Second), w.table, w.text); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scanner := db.Query("app-*", start, start, 0, 0)
+	defer scanner.Close()
+
+	var got string
+	for scanner.Scan() {
+		got += scanner.Data().Text
+	}
+
+	if scanner.Error != nil {
+		t.Fatal(scanner.Error)
+	}
+
+	if got != " a b c d" {
+		t.Fatalf("unexpected result %q", got)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a := New(t.TempDir())
+	b := New(t.TempDir())
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i, db := range []*DB{a, b} {
+		for j := 0; j < 3; j++ {
+			if err := db.Insert(start.Add(time.Duration(j)*time.Second), "logs", "same %d", j); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Insert(start.Add(time.Duration(j)*time.Second), "logs", "db%d", i); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := Merge(a, b); err != nil {
+		t.Fatal(err)
+	}
+
+	scanner := a.Query("logs", start, start, 0, 0)
+	defer scanner.Close()
+
+	var got string
+	for scanner.Scan() {
+		got += scanner.Data().Text
+	}
+
+	if got != " same 0 db0 db1 same 1 db0 db1 same 2 db0 db1" {
+		t.Fatalf("unexpected result %q", got)
+	}
+
+	// the active file was replaced, new writes must go to the merged one
+	if err := a.Insert(start.Add(3*time.Second), "logs", "new"); err != nil {
+		t.Fatal(err)
+	}
+
+	scanner = a.Query("logs", start, start, 9, 1)
+	defer scanner.Close()
+	if !scanner.Scan() || scanner.Data().Text != " new" {
+		t.Fatal("expected the new record")
+	}
+}
+
+func TestMergeRepeated(t *testing.T) {
+	a := New(t.TempDir())
+	b := New(t.TempDir())
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	a.Insert(start, "logs", "GET /")
+	a.Insert(start, "logs", "GET /")
+	b.Insert(start, "logs", "GET /")
+	b.Insert(start, "logs", "POST /")
+
+	if err := Merge(a, b); err != nil {
+		t.Fatal(err)
+	}
+
+	// the records repeated in a are kept and the one of b too
+	scanner := a.Query("logs", start, start, 0, 0)
+	defer scanner.Close()
+
+	var got string
+	for scanner.Scan() {
+		got += scanner.Data().Text
+	}
+	if got != " GET / GET / POST /" {
+		t.Fatalf("unexpected result %q", got)
+	}
+}
+
+func TestMergeEncrypted(t *testing.T) {
+	a := New(t.TempDir())
+	b := New(t.TempDir())
+
+	for _, db := range []*DB{a, b} {
+		db.SetKeyProvider(StaticKey("0123456789abcdef0123456789abcdef"))
+		if err := db.SetTableOptions("logs", TableOptions{Sequence: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the same record with another nonce and sequence number
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	a.Insert(start, "logs", "GET /")
+	b.Insert(start, "logs", "POST /")
+	b.Insert(start, "logs", "GET /")
+
+	if err := Merge(a, b); err != nil {
+		t.Fatal(err)
+	}
+
+	scanner := a.Query("logs", start, start, 0, 0)
+	defer scanner.Close()
+
+	var got []string
+	for scanner.Scan() {
+		got = append(got, scanner.Data().Text)
+	}
+	sort.Strings(got)
+	if strings.Join(got, ",") != " GET /, POST /" {
+		t.Fatalf("unexpected result %q", got)
+	}
+}
+
+func TestMergeParts(t *testing.T) {
+	a := New(t.TempDir())
+	b := New(t.TempDir())
+
+	for _, db := range []*DB{a, b} {
+		if err := db.SetTableOptions("logs", TableOptions{MaxFileSize: db.headerSize() + 30}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// each file has several parts
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 4; i++ {
+		a.Insert(start.Add(time.Duration(i)*time.Second), "logs", "a%d", i)
+		b.Insert(start.Add(time.Duration(i)*time.Second), "logs", "b%d", i)
+	}
+
+	if err := Merge(a, b); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Insert(start.Add(4*time.Second), "logs", "new"); err != nil {
+		t.Fatal(err)
+	}
+
+	scanner := a.Query("logs", start, start, 0, 0)
+	defer scanner.Close()
+
+	var got string
+	for scanner.Scan() {
+		got += scanner.Data().Text
+	}
+	if got != " a0 b0 a1 b1 a2 b2 a3 b3 new" {
+		t.Fatalf("unexpected result %q", got)
+	}
+}
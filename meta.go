@@ -0,0 +1,43 @@
+package timedb
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+)
+
+// metadata files are kept in a directory that is never taken as a day.
+const metaDir = "meta"
+
+// ReadMeta returns the content of a metadata file of the database, like
+// the offsets of a consumer. If it doesn't exist the error is fs.ErrNotExist.
+func (db *DB) ReadMeta(name string) ([]byte, error) {
+	return fs.ReadFile(db.storage, path.Join(metaDir, name))
+}
+
+// WriteMeta replaces the content of a metadata file of the database.
+// The file is written to a temporary file first so it is never half written.
+func (db *DB) WriteMeta(name string, data []byte) error {
+	return writeFile(db.storage, path.Join(metaDir, name), data)
+}
+
+// writeFile replaces the content of a file writing a temporary file first.
+func writeFile(s storage, name string, data []byte) error {
+	tmp := name + ".tmp"
+
+	w, err := s.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("timeDB: error writing %s: %w", name, err)
+	}
+
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return fmt.Errorf("timeDB: error writing %s: %v", name, err)
+	}
+
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("timeDB: error writing %s: %v", name, err)
+	}
+
+	return s.Rename(tmp, name)
+}
@@ -0,0 +1,44 @@
+package timedb
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"time"
+)
+
+func TestMeta(t *testing.T) {
+	db := New(t.TempDir())
+
+	if _, err := db.ReadMeta("offsets"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected not exist, got %v", err)
+	}
+
+	if err := db.WriteMeta("offsets", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.WriteMeta("offsets", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := db.ReadMeta("offsets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "2" {
+		t.Fatalf("unexpected content %q", b)
+	}
+
+	// the metadata is not taken as a day
+	if err := db.Insert(time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local), "log", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	days, err := db.days()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 1 {
+		t.Fatalf("expected 1 day, got %d", len(days))
+	}
+}
@@ -0,0 +1,112 @@
+package timedb
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// metrics are the internal counters of the database.
+type metrics struct {
+	writes       atomic.Int64
+	bytesWritten atomic.Int64
+	writeErrors  atomic.Int64
+	queries      atomic.Int64
+	queryTime    atomic.Int64
+	scanRows     atomic.Int64
+	parseErrors  atomic.Int64
+	openFiles    atomic.Int64
+
+	// the write path
+	fileWrites atomic.Int64
+	lockWait   atomic.Int64
+	fsyncs     atomic.Int64
+	fsyncTime  atomic.Int64
+}
+
+// Stats is a snapshot of the runtime statistics of a database.
+type Stats struct {
+	Writes       int64
+	BytesWritten int64
+	WriteErrors  int64
+	Queries      int64
+	QueryTime    time.Duration
+	ScanRows     int64
+	ParseErrors  int64
+	OpenFiles    int64
+
+	// FileWrites are the writes to the data files. With batches and the
+	// async mode each one can have many records.
+	FileWrites int64
+
+	// LockWait is the time that the writes waited for the lock.
+	LockWait time.Duration
+
+	// Fsyncs are the syncs of the data files and FsyncTime their duration.
+	Fsyncs    int64
+	FsyncTime time.Duration
+
+	// ActiveFile is the last file opened for writing, if it is still open.
+	ActiveFile string
+}
+
+// Stats returns the cumulative statistics since the database was created.
+func (db *DB) Stats() Stats {
+	m := db.metrics
+
+	db.writers.mutex.Lock()
+	active := db.writers.active
+	db.writers.mutex.Unlock()
+
+	return Stats{
+		Writes:       m.writes.Load(),
+		BytesWritten: m.bytesWritten.Load(),
+		WriteErrors:  m.writeErrors.Load(),
+		Queries:      m.queries.Load(),
+		QueryTime:    time.Duration(m.queryTime.Load()),
+		ScanRows:     m.scanRows.Load(),
+		ParseErrors:  m.parseErrors.Load(),
+		OpenFiles:    m.openFiles.Load(),
+		FileWrites:   m.fileWrites.Load(),
+		LockWait:     time.Duration(m.lockWait.Load()),
+		Fsyncs:       m.fsyncs.Load(),
+		FsyncTime:    time.Duration(m.fsyncTime.Load()),
+		ActiveFile:   active,
+	}
+}
+
+// Publish exports the internal counters of the database with expvar
+// under the given name. It panics if the name is already in use.
+func (db *DB) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return db.Stats()
+	}))
+}
+
+// MetricsHandler returns a handler that serves the internal counters
+// in the Prometheus text format.
+func (db *DB) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st := db.Stats()
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		metric := func(name, typ, help string, value interface{}) {
+			fmt.Fprintf(w, "# HELP timedb_%s %s\n# TYPE timedb_%s %s\ntimedb_%s %v\n", name, help, name, typ, name, value)
+		}
+
+		metric("writes_total", "counter", "Records written.", st.Writes)
+		metric("written_bytes_total", "counter", "Bytes written.", st.BytesWritten)
+		metric("write_errors_total", "counter", "Failed writes.", st.WriteErrors)
+		metric("queries_total", "counter", "Queries closed.", st.Queries)
+		metric("query_duration_seconds_total", "counter", "Total duration of the queries.", st.QueryTime.Seconds())
+		metric("scan_rows_total", "counter", "Rows returned by queries.", st.ScanRows)
+		metric("parse_errors_total", "counter", "Lines that couldn't be parsed.", st.ParseErrors)
+		metric("open_files", "gauge", "Files currently open.", st.OpenFiles)
+		metric("file_writes_total", "counter", "Writes to the data files.", st.FileWrites)
+		metric("write_lock_wait_seconds_total", "counter", "Time that the writes waited for the lock.", st.LockWait.Seconds())
+		metric("fsyncs_total", "counter", "Syncs of the data files.", st.Fsyncs)
+		metric("fsync_duration_seconds_total", "counter", "Total duration of the syncs.", st.FsyncTime.Seconds())
+	})
+}
@@ -0,0 +1,65 @@
+package timedb
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 3; i++ {
+		if err := db.Insert(start, "logs", "v%d", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scanner := db.Query("logs", start, start, 0, 0)
+	for scanner.Scan() {
+	}
+	scanner.Close()
+
+	st := db.Stats()
+	if st.Writes != 3 || st.ScanRows != 3 || st.Queries != 1 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+
+	// only the write file remains open
+	if st.OpenFiles != 1 || st.ActiveFile != "2020-01-01/logs.log" {
+		t.Fatalf("unexpected open files %+v", st)
+	}
+
+	w := httptest.NewRecorder()
+	db.MetricsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(w.Body.String(), "timedb_writes_total 3\n") {
+		t.Fatalf("unexpected output %s", w.Body.String())
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	db := New(t.TempDir())
+	if err := db.SetTableOptions("logs", TableOptions{Fsync: FsyncAlways}); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	if err := db.Insert(start, "logs", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	b := db.NewBatch()
+	for i := 0; i < 10; i++ {
+		b.Insert(start, "logs", "b%d", i)
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	st := db.Stats()
+	if st.Writes != 11 || st.FileWrites != 2 || st.Fsyncs != 2 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
@@ -0,0 +1,231 @@
+package timedb
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// Format is the format of a data file.
+type Format int
+
+const (
+	// FormatLegacy is text without header, written by older versions.
+	FormatLegacy Format = iota
+
+	// FormatText is text with a header.
+	FormatText
+
+	// FormatCompressed is a text file compressed with zstd in frames
+	// with sync markers (see Verify).
+	FormatCompressed
+)
+
+var formatNames = []string{"legacy", "text", "compressed"}
+
+func (f Format) String() string {
+	if f < 0 || int(f) >= len(formatNames) {
+		return fmt.Sprintf("Format(%d)", int(f))
+	}
+	return formatNames[f]
+}
+
+// ParseFormat returns the format with the name returned by Format.String.
+func ParseFormat(s string) (Format, error) {
+	for i, name := range formatNames {
+		if name == s {
+			return Format(i), nil
+		}
+	}
+	return 0, fmt.Errorf("timeDB: invalid format %s", s)
+}
+
+// Migrate rewrites the files of the table that are in the format from to
+// the format to. Table can be a pattern. Each file is written to a temporary
+// file that is renamed over the original so a failure leaves the file as it
+// was. The stats, bloom filters and indexes of the files are deleted because
+// the offsets of the records change, and are built again by the maintenance.
+func (db *DB) Migrate(table string, from, to Format) error {
+	for _, f := range []Format{from, to} {
+		if f < FormatLegacy || f > FormatCompressed {
+			return fmt.Errorf("timeDB.Migrate: invalid format %d", f)
+		}
+	}
+
+	if from == to {
+		return nil
+	}
+
+	unlock, err := db.lockMaintenance()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	dayList, err := db.days()
+	if err != nil {
+		return err
+	}
+
+	local := localStorage(db.storage)
+
+	for _, day := range dayList {
+		tables, err := db.matchTables(day, table)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+
+		for _, t := range tables {
+			name := db.getTablePath(day, t)
+			migrated := false
+
+			for part := 0; part <= lastPart(local, name); part++ {
+				p := partName(name, part)
+
+				f, err := fileFormat(local, p)
+				if err != nil {
+					if errors.Is(err, fs.ErrNotExist) {
+						continue
+					}
+					return fmt.Errorf("timeDB.Migrate: error reading %s: %v", p, err)
+				}
+				if f != from {
+					continue
+				}
+
+				db.closeFile(name)
+
+				if err := db.migrateFile(local, p, from, to); err != nil {
+					return fmt.Errorf("timeDB.Migrate: error migrating %s: %v", p, err)
+				}
+				migrated = true
+			}
+
+			if migrated {
+				for _, f := range []string{statsFile(name), bloomFile(name), indexFile(name), columnsFile(name)} {
+					if err := local.Remove(f); err != nil && !errors.Is(err, fs.ErrNotExist) {
+						return fmt.Errorf("timeDB.Migrate: error removing %s: %v", f, err)
+					}
+				}
+			}
+		}
+	}
+
+	db.resetUsage()
+	return nil
+}
+
+// fileFormat returns the format of a data file stored locally.
+func fileFormat(s storage, name string) (Format, error) {
+	if _, err := fs.Stat(s, name); errors.Is(err, fs.ErrNotExist) {
+		if _, err := fs.Stat(s, name+".zst"); err != nil {
+			return 0, err
+		}
+		return FormatCompressed, nil
+	}
+
+	f, err := s.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	b, err := bufio.NewReader(f).Peek(len(headerMagic))
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	if isHeader(b) {
+		return FormatText, nil
+	}
+	return FormatLegacy, nil
+}
+
+// migrateFile rewrites a data file in the format to.
+func (db *DB) migrateFile(s storage, name string, from, to Format) error {
+	var in fs.File
+	var err error
+	if from == FormatCompressed {
+		in, err = openCompressed(s, name, db.dicts)
+	} else {
+		in, err = s.Open(name)
+	}
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	target := name
+	if to == FormatCompressed {
+		target = name + ".zst"
+	}
+
+	tmp := target + ".tmp"
+	out, err := s.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	err = writeFormat(out, in, to, db.newHeader())
+	if err == nil {
+		err = syncFile(out)
+	}
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		s.Remove(tmp)
+		return err
+	}
+
+	if err := s.Rename(tmp, target); err != nil {
+		s.Remove(tmp)
+		return err
+	}
+	in.Close()
+
+	// the queries running keep reading the old file
+	switch {
+	case from == FormatCompressed:
+		return db.retire(s, name+".zst")
+	case to == FormatCompressed:
+		return db.retire(s, name)
+	}
+	return nil
+}
+
+// writeFormat copies the records of r to w in the format f.
+func writeFormat(w io.Writer, r io.Reader, f Format, h FileHeader) error {
+	br := bufio.NewReader(r)
+	if err := skipHeader(br); err != nil {
+		return err
+	}
+
+	if f == FormatCompressed {
+		zw, err := newFrameWriter(w)
+		if err != nil {
+			return err
+		}
+		if err := writeFormat(zw, br, FormatText, h); err != nil {
+			zw.Close()
+			return err
+		}
+		return zw.Close()
+	}
+
+	if f == FormatText {
+		if _, err := io.WriteString(w, h.String()+"\n"); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.Copy(w, br)
+	return err
+}
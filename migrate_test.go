@@ -0,0 +1,93 @@
+package timedb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMigrate(t *testing.T) {
+	dir := t.TempDir()
+	db := New(dir)
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+
+	// files written by an older version
+	for i, table := range []string{"app", "other"} {
+		name := filepath.Join(dir, "2020-01-01", table+".log")
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		data := fmt.Sprintf("%d a\n%d b\n", start.Unix()+int64(i), start.Unix()+1)
+		if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := db.DayStats(start, "app"); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(f Format) {
+		t.Helper()
+		got, err := fileFormat(localStorage(db.storage), "2020-01-01/app.log")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != f {
+			t.Fatalf("expected %v, got %v", f, got)
+		}
+		if n := countRecords(t, db, "app", start); n != 2 {
+			t.Fatalf("expected 2, got %d", n)
+		}
+	}
+
+	if err := db.Migrate("app", FormatLegacy, FormatText); err != nil {
+		t.Fatal(err)
+	}
+	check(FormatText)
+
+	if h, err := db.FileHeader(start, "app"); err != nil || h.Version != FormatVersion {
+		t.Fatalf("invalid header %+v %v", h, err)
+	}
+
+	// the stats are not valid anymore
+	if _, err := os.Stat(filepath.Join(dir, "2020-01-01", "app.stats")); !os.IsNotExist(err) {
+		t.Fatalf("expected the stats to be deleted: %v", err)
+	}
+
+	// only the files in the format from are migrated
+	if err := db.Migrate("app", FormatLegacy, FormatCompressed); err != nil {
+		t.Fatal(err)
+	}
+	check(FormatText)
+
+	if err := db.Migrate("app", FormatText, FormatCompressed); err != nil {
+		t.Fatal(err)
+	}
+	check(FormatCompressed)
+
+	if err := db.Migrate("app", FormatCompressed, FormatLegacy); err != nil {
+		t.Fatal(err)
+	}
+	check(FormatLegacy)
+
+	b, err := os.ReadFile(filepath.Join(dir, "2020-01-01", "app.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("%d a\n%d b\n", start.Unix(), start.Unix()+1); string(b) != want {
+		t.Fatalf("expected %q, got %q", want, b)
+	}
+
+	// the other table is not touched
+	if f, err := fileFormat(localStorage(db.storage), "2020-01-01/other.log"); err != nil || f != FormatLegacy {
+		t.Fatalf("expected legacy, got %v %v", f, err)
+	}
+
+	if _, err := ParseFormat("binary"); err == nil {
+		t.Fatal("expected an error")
+	}
+}
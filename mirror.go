@@ -0,0 +1,332 @@
+package timedb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultMirrorQueue = 10000
+	defaultMirrorBatch = 1000
+)
+
+// MirrorRecord is a record sent to a mirror.
+type MirrorRecord struct {
+	Table string
+	Time  time.Time
+	Text  string
+}
+
+// Sink receives the records of a mirror.
+type Sink interface {
+	Write(records []MirrorRecord) error
+}
+
+// MirrorOptions configure a mirror.
+type MirrorOptions struct {
+	// QueueSize is the maximum number of records waiting to be sent.
+	QueueSize int
+
+	// MaxBatch is the maximum number of records sent at once.
+	MaxBatch int
+
+	// Retries is the number of times a batch that fails is sent again,
+	// waiting RetryInterval between them. After that it is dropped.
+	Retries       int
+	RetryInterval time.Duration
+
+	// Block makes the writes wait when the queue is full. By default
+	// the records that don't fit are dropped so a slow sink doesn't
+	// slow down the database.
+	Block bool
+
+	// Error is called with the errors of the sink. They are logged anyway.
+	Error func(err error)
+
+	// Tables are the tables mirrored. They can be patterns like "prod/**".
+	// By default all of them.
+	Tables []string
+
+	// Filter mirrors only the records that contain it and Match the
+	// records for which it returns true, so critical events can be
+	// routed to other systems.
+	Filter string
+	Match  func(table, text string) bool
+}
+
+// MirrorStats are the counters of a mirror.
+type MirrorStats struct {
+	Sent    int64
+	Dropped int64
+	Errors  int64
+}
+
+// MirrorWriter duplicates the records saved in the database to a sink.
+type MirrorWriter struct {
+	db    *DB
+	sink  Sink
+	opts  MirrorOptions
+	queue chan MirrorRecord
+	done  chan struct{}
+
+	mutex  sync.RWMutex
+	closed bool
+
+	sent    atomic.Int64
+	dropped atomic.Int64
+	errors  atomic.Int64
+}
+
+// Mirror sends a copy of every record saved from now on to the sink in
+// the background, for example to migrate to another database. The records
+// are sent as they are saved, after the write hooks. Close stops it.
+func (db *DB) Mirror(sink Sink, o MirrorOptions) *MirrorWriter {
+	if o.QueueSize <= 0 {
+		o.QueueSize = defaultMirrorQueue
+	}
+	if o.MaxBatch <= 0 {
+		o.MaxBatch = defaultMirrorBatch
+	}
+
+	m := &MirrorWriter{
+		db:    db,
+		sink:  sink,
+		opts:  o,
+		queue: make(chan MirrorRecord, o.QueueSize),
+		done:  make(chan struct{}),
+	}
+
+	go m.run()
+
+	db.mutex.Lock()
+	db.mirrors = append(db.mirrors, m)
+	db.mutex.Unlock()
+
+	return m
+}
+
+// Stats returns the counters of the mirror.
+func (m *MirrorWriter) Stats() MirrorStats {
+	return MirrorStats{
+		Sent:    m.sent.Load(),
+		Dropped: m.dropped.Load(),
+		Errors:  m.errors.Load(),
+	}
+}
+
+// Close stops mirroring and waits until the queued records are sent.
+func (m *MirrorWriter) Close() {
+	db := m.db
+	db.mutex.Lock()
+	db.mirrors = slices.DeleteFunc(db.mirrors, func(w *MirrorWriter) bool { return w == m })
+	db.mutex.Unlock()
+
+	m.mutex.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.queue)
+	}
+	m.mutex.Unlock()
+
+	<-m.done
+}
+
+// matches reports whether the record must be mirrored.
+func (m *MirrorWriter) matches(r MirrorRecord) bool {
+	if len(m.opts.Tables) > 0 && !slices.ContainsFunc(m.opts.Tables, func(p string) bool {
+		return matchTable(p, r.Table)
+	}) {
+		return false
+	}
+	if m.opts.Filter != "" && !strings.Contains(r.Text, m.opts.Filter) {
+		return false
+	}
+	if m.opts.Match != nil && !m.opts.Match(r.Table, r.Text) {
+		return false
+	}
+	return true
+}
+
+// add queues a record.
+func (m *MirrorWriter) add(r MirrorRecord) {
+	if !m.matches(r) {
+		return
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if m.closed {
+		return
+	}
+
+	if m.opts.Block {
+		m.queue <- r
+		return
+	}
+
+	select {
+	case m.queue <- r:
+	default:
+		m.dropped.Add(1)
+	}
+}
+
+func (m *MirrorWriter) run() {
+	defer close(m.done)
+
+	for r := range m.queue {
+		records := []MirrorRecord{r}
+
+		// take what is already queued
+	drain:
+		for len(records) < m.opts.MaxBatch {
+			select {
+			case r, ok := <-m.queue:
+				if !ok {
+					break drain
+				}
+				records = append(records, r)
+			default:
+				break drain
+			}
+		}
+
+		m.send(records)
+	}
+}
+
+// send writes the records to the sink retrying if it fails.
+func (m *MirrorWriter) send(records []MirrorRecord) {
+	for i := 0; ; i++ {
+		err := m.sink.Write(records)
+		if err == nil {
+			m.sent.Add(int64(len(records)))
+			return
+		}
+
+		m.errors.Add(1)
+		m.db.log().Warn("timedb: mirror error", "records", len(records), "error", err)
+		if m.opts.Error != nil {
+			m.opts.Error(err)
+		}
+
+		if i >= m.opts.Retries {
+			m.dropped.Add(int64(len(records)))
+			return
+		}
+		time.Sleep(m.opts.RetryInterval)
+	}
+}
+
+// mirror sends a record saved to the mirrors.
+func (db *DB) mirror(table string, d DataPoint) {
+	db.mutex.RLock()
+	mirrors := db.mirrors
+	db.mutex.RUnlock()
+
+	for _, m := range mirrors {
+		m.add(MirrorRecord{Table: table, Time: d.Time, Text: d.Text})
+	}
+}
+
+// closeMirrors stops the mirrors sending the queued records.
+func (db *DB) closeMirrors() {
+	db.mutex.RLock()
+	mirrors := slices.Clone(db.mirrors)
+	db.mutex.RUnlock()
+
+	for _, m := range mirrors {
+		m.Close()
+	}
+}
+
+// DBSink saves the records in another database.
+type DBSink struct {
+	DB *DB
+}
+
+func (s DBSink) Write(records []MirrorRecord) error {
+	for _, r := range records {
+		if err := s.DB.Insert(r.Time, r.Table, r.Text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriterSink writes the records as lines of JSON.
+type WriterSink struct {
+	Writer io.Writer
+}
+
+func (s WriterSink) Write(records []MirrorRecord) error {
+	var b bytes.Buffer
+	e := json.NewEncoder(&b)
+	for _, r := range records {
+		if err := e.Encode(r); err != nil {
+			return err
+		}
+	}
+	_, err := s.Writer.Write(b.Bytes())
+	return err
+}
+
+// HTTPSink posts the records as a JSON array to a webhook or the insert
+// API of a timedb server, like "http://host:9000/api/v1/insert".
+type HTTPSink struct {
+	URL string
+
+	// Token is sent as a bearer token if it is not empty.
+	Token string
+
+	// Header are other headers of the requests.
+	Header http.Header
+
+	// Client is http.DefaultClient if nil.
+	Client *http.Client
+}
+
+func (s HTTPSink) Write(records []MirrorRecord) error {
+	body, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range s.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("timeDB: mirror %s: %s", s.URL, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package timedb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMirror(t *testing.T) {
+	db := NewMemory()
+	dst := NewMemory()
+
+	var buf bytes.Buffer
+	m1 := db.Mirror(DBSink{dst}, MirrorOptions{Block: true})
+	m2 := db.Mirror(WriterSink{&buf}, MirrorOptions{})
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 10; i++ {
+		if err := db.Insert(start, "nginx", "GET /%d", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m1.Close()
+	m2.Close()
+
+	// the records saved after closing are not mirrored
+	if err := db.Insert(start, "nginx", "GET /"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := countRecords(t, dst, "nginx", start); n != 10 {
+		t.Fatalf("expected 10 records, got %d", n)
+	}
+	if st := m1.Stats(); st.Sent != 10 || st.Dropped != 0 {
+		t.Fatalf("invalid stats %+v", st)
+	}
+
+	var r MirrorRecord
+	if err := json.NewDecoder(&buf).Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Table != "nginx" || r.Text != "GET /0" || !r.Time.Equal(start) {
+		t.Fatalf("invalid record %+v", r)
+	}
+}
+
+type failingSink struct {
+	calls atomic.Int64
+}
+
+func (s *failingSink) Write(records []MirrorRecord) error {
+	s.calls.Add(1)
+	return errors.New("failed")
+}
+
+func TestMirrorRetries(t *testing.T) {
+	db := NewMemory()
+
+	sink := &failingSink{}
+	var errs atomic.Int64
+	m := db.Mirror(sink, MirrorOptions{
+		Retries: 2,
+		Block:   true,
+		Error:   func(err error) { errs.Add(1) },
+	})
+
+	if err := db.Insert(time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local), "nginx", "GET /"); err != nil {
+		t.Fatal(err)
+	}
+	m.Close()
+
+	if n := sink.calls.Load(); n != 3 || errs.Load() != 3 {
+		t.Fatalf("expected 3 calls, got %d", n)
+	}
+	if st := m.Stats(); st.Dropped != 1 || st.Errors != 3 {
+		t.Fatalf("invalid stats %+v", st)
+	}
+}
+
+func TestMirrorFilter(t *testing.T) {
+	db := NewMemory()
+	dst := NewMemory()
+
+	m := db.Mirror(DBSink{dst}, MirrorOptions{
+		Block:  true,
+		Tables: []string{"prod/**"},
+		Filter: "status=500",
+		Match:  func(table, text string) bool { return !strings.Contains(text, "health") },
+	})
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for _, r := range []struct{ table, text string }{
+		{"prod/nginx", "GET / status=500"},
+		{"prod/nginx", "GET / status=200"},
+		{"prod/nginx", "GET /health status=500"},
+		{"dev/nginx", "GET / status=500"},
+	} {
+		if err := db.Insert(start, r.table, r.text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.Close()
+
+	if n := countRecords(t, dst, "prod/nginx", start); n != 1 {
+		t.Fatalf("expected 1 record, got %d", n)
+	}
+	if n := countRecords(t, dst, "dev/nginx", start); n != 0 {
+		t.Fatalf("expected 0 records, got %d", n)
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	var got []MirrorRecord
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	records := []MirrorRecord{{Table: "nginx", Time: time.Unix(1577869200, 0), Text: "GET /"}}
+
+	if err := (HTTPSink{URL: ts.URL, Token: "secret"}).Write(records); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Text != "GET /" {
+		t.Fatalf("invalid records %v", got)
+	}
+
+	if err := (HTTPSink{URL: ts.URL}).Write(records); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,82 @@
+package timedb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// SetMmap reads the days before today, that don't change anymore, mapping
+// the files in memory instead of reading them. It is only supported
+// with local uncompressed files in unix systems.
+func (db *DB) SetMmap(v bool) {
+	db.mmap.Store(v)
+}
+
+// openFile opens a data file, mapped in memory or from the cache of
+// open files if they are enabled.
+func (db *DB) openFile(day time.Time, name string) (fs.File, error) {
+	// the records written after the day was tiered are merged with
+	// the remote ones
+	if t, ok := db.storage.(*tieredStorage); ok {
+		if remote, err := t.inRemote(name); err != nil || remote {
+			return db.storage.Open(name)
+		}
+	}
+
+	if db.mmap.Load() {
+		now := time.Now()
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+
+		if ds, ok := localStorage(db.storage).(diskStorage); ok && day.Before(today) {
+			if f, ok := mmapOpen(ds.path(name)); ok {
+				return f, nil
+			}
+		}
+	}
+
+	if c := db.fileCache.Load(); c != nil {
+		if ds, ok := localStorage(db.storage).(diskStorage); ok {
+			f, err := c.open(ds.path(name))
+			if err == nil || !errors.Is(err, fs.ErrNotExist) {
+				return f, err
+			}
+		}
+	}
+
+	return db.storage.Open(name)
+}
+
+// mmapFile is a file mapped in memory.
+type mmapFile struct {
+	*bytes.Reader
+	data  []byte
+	info  fs.FileInfo
+	unmap func([]byte) error
+}
+
+// next returns the next n bytes of the file without copying them.
+func (f *mmapFile) next(n int) []byte {
+	off := len(f.data) - f.Len()
+	if n > f.Len() {
+		n = f.Len()
+	}
+	f.Seek(int64(n), io.SeekCurrent)
+	return f.data[off : off+n]
+}
+
+func (f *mmapFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *mmapFile) Close() error {
+	if f.data == nil {
+		return nil
+	}
+	data := f.data
+	f.data = nil
+	f.Reader = bytes.NewReader(nil)
+	return f.unmap(data)
+}
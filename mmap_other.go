@@ -0,0 +1,8 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package timedb
+
+// mmapOpen is not supported in this system so files are read normally.
+func mmapOpen(name string) (*mmapFile, bool) {
+	return nil, false
+}
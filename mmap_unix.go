@@ -0,0 +1,31 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package timedb
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+)
+
+// mmapOpen maps the file in memory. It returns false if it can't be
+// mapped so it is read normally.
+func mmapOpen(name string) (*mmapFile, bool) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 || int64(int(info.Size())) != info.Size() {
+		return nil, false
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, false
+	}
+
+	return &mmapFile{Reader: bytes.NewReader(data), data: data, info: info, unmap: syscall.Munmap}, true
+}
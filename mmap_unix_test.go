@@ -0,0 +1,44 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package timedb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMmap(t *testing.T) {
+	db := New(t.TempDir())
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 1000; i++ {
+		if err := db.Insert(start.Add(time.Duration(i)*time.Minute), "log", "line %d", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db.SetMmap(true)
+
+	f, err := db.openFile(start, db.getTablePath(start, "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.(*mmapFile); !ok {
+		t.Fatalf("expected a mapped file, got %T", f)
+	}
+	f.Close()
+
+	s := db.Query("log", start, start.AddDate(0, 0, 1), 0, 0)
+	defer s.Close()
+
+	n := 0
+	for s.Scan() {
+		if s.Data().Time != start.Add(time.Duration(n)*time.Minute) {
+			t.Fatalf("unexpected %v", s.Data())
+		}
+		n++
+	}
+	if n != 1000 {
+		t.Fatalf("expected 1000 lines, got %d", n)
+	}
+}
@@ -0,0 +1,146 @@
+/*
+Package nats saves the messages published on NATS subjects in a timedb
+database. Each message is stored in a table with the name of its subject.
+
+	nc, err := nats.Connect(nats.DefaultURL)
+	s := &timedbnats.Subscriber{DB: db, Conn: nc, Subjects: []string{"logs.>"}}
+	err = s.Start()
+
+With Durable set, it uses JetStream durable consumers: the messages are
+acknowledged after they are saved, so the ones published while the
+process is down are received when it starts again.
+*/
+package nats
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/scorredoira/timedb"
+)
+
+type Subscriber struct {
+	DB       *timedb.DB
+	Conn     *nats.Conn
+	Subjects []string
+
+	// Durable is the name of the JetStream durable consumer. If it is
+	// empty it uses core NATS subscriptions.
+	Durable string
+
+	// Table returns the table of a message. By default it is the subject.
+	Table func(m *nats.Msg) string
+
+	// Error is called with the messages that can't be saved.
+	Error func(err error)
+
+	mutex sync.Mutex
+	subs  []*nats.Subscription
+}
+
+// Start subscribes to the subjects. The messages are received until Close is called.
+func (s *Subscriber) Start() error {
+	var js nats.JetStreamContext
+	if s.Durable != "" {
+		var err error
+		js, err = s.Conn.JetStream()
+		if err != nil {
+			return err
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, subject := range s.Subjects {
+		var sub *nats.Subscription
+		var err error
+
+		if js != nil {
+			sub, err = js.Subscribe(subject, s.handle, nats.Durable(durableName(s.Durable, subject, len(s.Subjects))), nats.ManualAck(), nats.DeliverAll())
+		} else {
+			sub, err = s.Conn.Subscribe(subject, s.handle)
+		}
+
+		if err != nil {
+			s.unsubscribe()
+			return err
+		}
+		s.subs = append(s.subs, sub)
+	}
+
+	return nil
+}
+
+// durableName returns the name of the consumer of a subject. With
+// several subjects each one needs its own consumer.
+func durableName(durable, subject string, subjects int) string {
+	if subjects == 1 {
+		return durable
+	}
+	r := strings.NewReplacer(".", "_", "*", "any", ">", "all")
+	return durable + "_" + r.Replace(subject)
+}
+
+func (s *Subscriber) handle(m *nats.Msg) {
+	t := time.Now()
+	if md, err := m.Metadata(); err == nil {
+		// the time when it was stored in the stream
+		t = md.Timestamp
+	}
+
+	table := m.Subject
+	if s.Table != nil {
+		table = s.Table(m)
+	}
+
+	// the new line at the end is not part of the message
+	text := strings.TrimRight(string(m.Data), "\r\n")
+
+	if err := s.DB.Insert(t, table, text); err != nil {
+		if s.Error != nil {
+			s.Error(err)
+		}
+		if s.Durable != "" {
+			if errors.Is(err, timedb.ErrNewLine) {
+				// it can't be saved, don't receive it again
+				m.Term()
+			} else {
+				m.Nak()
+			}
+		}
+		return
+	}
+
+	if s.Durable != "" {
+		m.Ack()
+	}
+}
+
+// Close removes the subscriptions. Durable consumers are kept in the server.
+func (s *Subscriber) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.unsubscribe()
+}
+
+func (s *Subscriber) unsubscribe() error {
+	var err error
+	for _, sub := range s.subs {
+		if s.Durable != "" {
+			// Drain keeps the durable consumer, Unsubscribe deletes it
+			if e := sub.Drain(); e != nil && err == nil {
+				err = e
+			}
+			continue
+		}
+		if e := sub.Unsubscribe(); e != nil && err == nil {
+			err = e
+		}
+	}
+	s.subs = nil
+	return err
+}
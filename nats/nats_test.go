@@ -0,0 +1,33 @@
+package nats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/scorredoira/timedb"
+)
+
+func TestHandle(t *testing.T) {
+	db := timedb.NewMemory()
+	s := &Subscriber{DB: db}
+
+	start := time.Now().Add(-time.Second)
+	s.handle(&nats.Msg{Subject: "logs.web", Data: []byte("GET /\n")})
+
+	scanner := db.Query("logs.web", start, time.Now(), 0, 0)
+	defer scanner.Close()
+
+	if !scanner.Scan() || scanner.Data().Text != " GET /" {
+		t.Fatalf("unexpected data %q", scanner.Data().Text)
+	}
+}
+
+func TestDurableName(t *testing.T) {
+	if n := durableName("timedb", "logs.>", 1); n != "timedb" {
+		t.Fatal(n)
+	}
+	if n := durableName("timedb", "logs.*.web", 2); n != "timedb_logs_any_web" {
+		t.Fatal(n)
+	}
+}
@@ -0,0 +1,118 @@
+package timedb
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Numeric tables store a value per record, optionally followed by the
+// labels of the series:
+//
+//	1577869200 0.25 {host="a",job="web"}
+
+// Labels identify a numeric series.
+type Labels map[string]string
+
+// String returns the labels sorted by name like {a="1",b="2"}.
+func (l Labels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(l))
+	for k := range l {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, k := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(l[k]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// ParseLabels parses labels in the format returned by Labels.String.
+func ParseLabels(s string) (Labels, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	if len(s) < 2 || s[0] != '{' || s[len(s)-1] != '}' {
+		return nil, fmt.Errorf("timeDB: invalid labels %s", s)
+	}
+
+	labels := Labels{}
+	rest := s[1 : len(s)-1]
+	for rest != "" {
+		i := strings.IndexByte(rest, '=')
+		if i == -1 {
+			return nil, fmt.Errorf("timeDB: invalid labels %s", s)
+		}
+		name := strings.TrimSpace(rest[:i])
+
+		value, err := strconv.QuotedPrefix(rest[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("timeDB: invalid labels %s", s)
+		}
+		rest = rest[i+1+len(value):]
+
+		labels[name], err = strconv.Unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("timeDB: invalid labels %s", s)
+		}
+
+		rest = strings.TrimPrefix(strings.TrimSpace(rest), ",")
+	}
+
+	return labels, nil
+}
+
+// InsertValue saves a point of a numeric series.
+func (db *DB) InsertValue(t time.Time, table string, v float64, labels Labels) error {
+	return db.save(t, table, FormatValue(v, labels))
+}
+
+// FormatValue returns the text of a numeric record.
+func FormatValue(v float64, labels Labels) string {
+	s := strconv.FormatFloat(v, 'g', -1, 64)
+	if len(labels) > 0 {
+		s += " " + labels.String()
+	}
+	return s
+}
+
+// ParseValue parses the text of a numeric record.
+func ParseValue(text string) (float64, Labels, error) {
+	text = strings.TrimSpace(text)
+
+	value, labels, _ := strings.Cut(text, " ")
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("timeDB: invalid value %s", value)
+	}
+
+	l, err := ParseLabels(labels)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return v, l, nil
+}
+
+// Value returns the value and the labels of the current data point
+// of a numeric table.
+func (d DataPoint) Value() (float64, Labels, error) {
+	return ParseValue(d.Text)
+}
@@ -0,0 +1,32 @@
+package timedb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInsertValue(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	labels := Labels{"job": "web", "path": `/a "b"`}
+	if err := db.InsertValue(start, "requests", 1.5, labels); err != nil {
+		t.Fatal(err)
+	}
+
+	scanner := db.Query("requests", start, start, 0, 0)
+	defer scanner.Close()
+
+	if !scanner.Scan() {
+		t.Fatal("expected a value")
+	}
+
+	v, l, err := scanner.Data().Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v != 1.5 || l.String() != labels.String() {
+		t.Fatalf("unexpected value %v %v", v, l)
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Package otel traces timedb queries with OpenTelemetry.
+
+	db.SetTracer(otel.NewTracer(provider.Tracer("timedb")))
+
+Each query creates a span with a child span for every file that it reads.
+*/
+package otel
+
+import (
+	"context"
+	"time"
+
+	"github.com/scorredoira/timedb"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer returns a timedb.Tracer that creates spans with t.
+func NewTracer(t trace.Tracer) timedb.Tracer {
+	return tracer{tracer: t}
+}
+
+func (t tracer) StartQuery(ctx context.Context, table string, start, end time.Time) timedb.QuerySpan {
+	ctx, span := t.tracer.Start(ctx, "timedb.Query", trace.WithAttributes(
+		attribute.String("timedb.table", table),
+		attribute.String("timedb.start", start.Format(time.RFC3339)),
+		attribute.String("timedb.end", end.Format(time.RFC3339)),
+	))
+
+	return &querySpan{tracer: t.tracer, ctx: ctx, span: span}
+}
+
+type querySpan struct {
+	tracer trace.Tracer
+	ctx    context.Context
+	span   trace.Span
+	file   trace.Span
+	files  int
+}
+
+func (s *querySpan) FileOpened(name string) {
+	if s.file != nil {
+		s.file.End()
+	}
+
+	s.files++
+	_, s.file = s.tracer.Start(s.ctx, "timedb.ReadFile", trace.WithAttributes(
+		attribute.String("timedb.file", name),
+	))
+}
+
+func (s *querySpan) End(rows, bytes int64, err error) {
+	if s.file != nil {
+		s.file.End()
+		s.file = nil
+	}
+
+	s.span.SetAttributes(
+		attribute.Int64("timedb.rows", rows),
+		attribute.Int64("timedb.bytes", bytes),
+		attribute.Int("timedb.files", s.files),
+	)
+
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+
+	s.span.End()
+}
@@ -0,0 +1,119 @@
+package timedb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// prefetcher reads the days of a query ahead of the scan.
+type prefetcher struct {
+	days    []time.Time
+	results []chan prefetched
+	next    int
+	slots   chan struct{}
+	stop    chan struct{}
+}
+
+type prefetched struct {
+	data   []byte
+	names  []string
+	offset int64
+	merge  *mergeReader
+	err    error
+}
+
+// SetParallel reads up to n days concurrently ahead of the scan, which
+// is faster when the files are not cached. The records are returned in
+// the same order. Each day read ahead is kept in memory until it is
+// scanned. It must be called before the first Scan.
+func (s *Scanner) SetParallel(n int) {
+	r := s.reader
+	if n < 2 || r.prefetch != nil {
+		return
+	}
+
+	p := &prefetcher{
+		days:  days(r.start, r.end),
+		slots: make(chan struct{}, n),
+		stop:  make(chan struct{}),
+	}
+
+	p.results = make([]chan prefetched, len(p.days))
+	for i := range p.days {
+		p.results[i] = make(chan prefetched, 1)
+	}
+
+	r.prefetch = p
+
+	go func() {
+		for i, day := range p.days {
+			select {
+			case p.slots <- struct{}{}:
+			case <-p.stop:
+				return
+			}
+			go func() {
+				p.results[i] <- r.db.readDay(day, r.table, r.start, r.filter, r.gen)
+			}()
+		}
+	}()
+}
+
+// readDay reads all the data of the table for the day.
+func (db *DB) readDay(t time.Time, table string, start time.Time, filter string, gen uint64) prefetched {
+	f, names, err := db.openDay(t, table, start, filter, gen)
+	if err != nil {
+		return prefetched{err: err}
+	}
+	defer f.Close()
+
+	offset := fileOffset(f)
+	data, err := io.ReadAll(f)
+	m, _ := f.(*mergeReader)
+	return prefetched{data: data, names: names, offset: offset, merge: m, err: err}
+}
+
+// nextFile sets the next day read ahead as the current file.
+func (p *prefetcher) nextFile(r *reader) error {
+	for p.next < len(p.days) {
+		res := <-p.results[p.next]
+		p.next++
+		<-p.slots
+
+		if res.err != nil {
+			if errors.Is(res.err, fs.ErrNotExist) {
+				continue
+			}
+			return res.err
+		}
+
+		if r.span != nil {
+			for _, name := range res.names {
+				r.span.FileOpened(name)
+			}
+		}
+
+		day := p.days[p.next-1]
+		r.boundaries = append(r.boundaries, fileBoundary{stream: r.returned, day: day, offset: res.offset, merge: res.merge})
+
+		r.file = io.NopCloser(bytes.NewReader(res.data))
+		r.opened = len(res.names)
+		r.files.Add(int64(r.opened))
+		r.db.metrics.openFiles.Add(int64(r.opened))
+		return nil
+	}
+
+	return io.EOF
+}
+
+// close stops reading ahead.
+func (p *prefetcher) close() {
+	select {
+	case <-p.stop:
+	default:
+		close(p.stop)
+	}
+}
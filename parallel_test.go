@@ -0,0 +1,65 @@
+package timedb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParallel(t *testing.T) {
+	db := New(t.TempDir())
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 30; i++ {
+		// leave some days empty
+		if i%7 == 3 {
+			continue
+		}
+		if err := db.Insert(start.AddDate(0, 0, i), "app-1", "a %d", i); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Insert(start.AddDate(0, 0, i).Add(time.Minute), "app-2", "b %d", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scan := func(parallel int) []string {
+		s := db.Query("app-*", start, start.AddDate(0, 0, 40), 0, 0)
+		defer s.Close()
+		s.SetParallel(parallel)
+
+		var lines []string
+		for s.Scan() {
+			lines = append(lines, s.Data().String())
+		}
+		if s.Error != nil {
+			t.Fatal(s.Error)
+		}
+		return lines
+	}
+
+	open := db.Stats().OpenFiles
+
+	expected := scan(0)
+	lines := scan(4)
+
+	if len(expected) != 52 || len(lines) != len(expected) {
+		t.Fatalf("expected %d lines, got %d", len(expected), len(lines))
+	}
+	for i := range lines {
+		if lines[i] != expected[i] {
+			t.Fatalf("line %d: expected %s, got %s", i, expected[i], lines[i])
+		}
+	}
+
+	// stop before the end
+	s := db.Query("app-1", start, start.AddDate(0, 0, 40), 0, 1)
+	s.SetParallel(4)
+	if !s.Scan() || s.Scan() {
+		t.Fatal("expected one line")
+	}
+	s.Close()
+
+	if n := db.Stats().OpenFiles; n != open {
+		t.Fatalf("expected %d open files, got %d", open, n)
+	}
+}
@@ -0,0 +1,552 @@
+package timedb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ParquetManifest is the file manifest.json of a directory written by
+// ExportParquet. It lists the files with their rows and time range.
+type ParquetManifest struct {
+	Created    time.Time
+	Start, End time.Time
+
+	// Columns are the columns of the files and their SQL types.
+	Columns []ParquetColumn
+	Files   []ParquetFile
+}
+
+type ParquetColumn struct {
+	Name string
+	Type string
+}
+
+// ParquetFile is a file of an export. Path is relative to the directory
+// of the manifest and uses forward slashes.
+type ParquetFile struct {
+	Table string
+	Day   string
+	Path  string
+	Rows  int64
+	Size  int64
+
+	MinTime time.Time
+	MaxTime time.Time
+}
+
+// ParquetManifestFile is the name of the manifest of the exports.
+const ParquetManifestFile = "manifest.json"
+
+const (
+	// parquetRowGroupRows is the number of records of each row group.
+	parquetRowGroupRows = 128 << 10
+
+	// parquetPageSize is the size of the pages before compressing them.
+	parquetPageSize = 1 << 20
+)
+
+// ExportParquet writes the records of the table in [start, end) to dir as
+// Parquet files partitioned by day in the Hive style, table/dt=2006-01-02,
+// and a manifest with the files, so engines like DuckDB, Trino or Spark
+// query them in place:
+//
+//	SELECT * FROM read_parquet('dir/nginx/*/*.parquet', hive_partitioning = true)
+//
+// The files have a column "time", a timestamp in milliseconds, and a column
+// "text". The table can be a pattern and each table is written to its own
+// directory. The files of the days exported again are replaced.
+func (db *DB) ExportParquet(dir, table string, start, end time.Time) (*ParquetManifest, error) {
+	m := &ParquetManifest{
+		Created: time.Now(),
+		Start:   start,
+		End:     end,
+		Columns: []ParquetColumn{{Name: "time", Type: "TIMESTAMP"}, {Name: "text", Type: "VARCHAR"}},
+	}
+
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, fmt.Errorf("timeDB.ExportParquet: %w", err)
+	}
+
+	err := db.eachTableDay(table, start, end, func(table string, day, from, to time.Time) error {
+		f, err := db.exportParquetDay(dir, table, day, from, to)
+		if err != nil {
+			return err
+		}
+		if f != nil {
+			m.Files = append(m.Files, *f)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("timeDB.ExportParquet: %w", err)
+	}
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, ParquetManifestFile), b, 0644); err != nil {
+		return nil, fmt.Errorf("timeDB.ExportParquet: %w", err)
+	}
+
+	return m, nil
+}
+
+// exportParquetDay writes the file of the table for the day. It returns
+// nil if there are no records.
+func (db *DB) exportParquetDay(dir, table string, day, start, end time.Time) (*ParquetFile, error) {
+	file := &ParquetFile{
+		Table: table,
+		Day:   day.Format("2006-01-02"),
+		Path:  path.Join(table, "dt="+day.Format("2006-01-02"), "part-0.parquet"),
+	}
+
+	name := filepath.Join(dir, filepath.FromSlash(file.Path))
+	tmp := name + ".tmp"
+
+	var f *os.File
+	var pw *parquetWriter
+	var rows parquetRows
+
+	s := db.Query(table, start, end, 0, 0)
+	defer s.Close()
+
+	for s.Scan() {
+		d := s.Data()
+		if !d.Time.Before(end) {
+			break
+		}
+
+		if pw == nil {
+			if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+				return nil, err
+			}
+			var err error
+			if f, err = os.Create(tmp); err != nil {
+				return nil, err
+			}
+			defer os.Remove(tmp)
+			defer f.Close()
+
+			if pw, err = newParquetWriter(f); err != nil {
+				return nil, err
+			}
+			defer pw.enc.Close()
+			file.MinTime, file.MaxTime = d.Time, d.Time
+		}
+
+		if d.Time.Before(file.MinTime) {
+			file.MinTime = d.Time
+		}
+		if d.Time.After(file.MaxTime) {
+			file.MaxTime = d.Time
+		}
+
+		rows.add(d.Time.UnixMilli(), trimText(d.Text))
+		file.Rows++
+
+		if len(rows.times) == parquetRowGroupRows {
+			if err := pw.rowGroup(&rows); err != nil {
+				return nil, err
+			}
+			rows.reset()
+		}
+	}
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	if pw == nil {
+		return nil, nil
+	}
+
+	if len(rows.times) > 0 {
+		if err := pw.rowGroup(&rows); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := pw.close(); err != nil {
+		return nil, err
+	}
+	file.Size = pw.pos
+
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// parquetRows are the columns of a row group.
+type parquetRows struct {
+	times []int64
+	texts []string
+}
+
+func (r *parquetRows) add(t int64, text string) {
+	r.times = append(r.times, t)
+	r.texts = append(r.texts, text)
+}
+
+func (r *parquetRows) reset() {
+	r.times = r.times[:0]
+	r.texts = r.texts[:0]
+}
+
+// The values of the Parquet format used. The columns are required, so
+// the pages don't have definition levels, and plain encoded in pages
+// compressed with zstd.
+const (
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	parquetRequired = 0
+
+	parquetUTF8            = 0
+	parquetTimestampMillis = 9
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetZstd = 6
+
+	parquetDataPage = 0
+)
+
+type parquetChunk struct {
+	typ                int32
+	name               string
+	values             int64
+	offset             int64
+	compressed         int64
+	uncompressed       int64
+	minValue, maxValue []byte
+}
+
+type parquetRowGroup struct {
+	rows   int64
+	chunks []parquetChunk
+}
+
+// parquetWriter writes a Parquet file: the magic number, the column
+// chunks of each row group and the metadata at the end.
+type parquetWriter struct {
+	w         *bufio.Writer
+	pos       int64
+	enc       *zstd.Encoder
+	rowGroups []parquetRowGroup
+}
+
+func newParquetWriter(w io.Writer) (*parquetWriter, error) {
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parquetWriter{w: bufio.NewWriter(w), enc: enc}
+	if err := p.write([]byte("PAR1")); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *parquetWriter) write(b []byte) error {
+	n, err := p.w.Write(b)
+	p.pos += int64(n)
+	return err
+}
+
+func (p *parquetWriter) rowGroup(rows *parquetRows) error {
+	g := parquetRowGroup{rows: int64(len(rows.times))}
+
+	// the times are written in pages of the same number of records
+	times := parquetChunk{typ: parquetInt64, name: "time", offset: p.pos}
+	perPage := parquetPageSize / 8
+	for i := 0; i < len(rows.times); i += perPage {
+		var page []byte
+		for _, t := range rows.times[i:min(i+perPage, len(rows.times))] {
+			page = binary.LittleEndian.AppendUint64(page, uint64(t))
+		}
+		if err := p.page(&times, page, len(page)/8); err != nil {
+			return err
+		}
+	}
+
+	minTime, maxTime := rows.times[0], rows.times[0]
+	for _, t := range rows.times {
+		minTime = min(minTime, t)
+		maxTime = max(maxTime, t)
+	}
+	times.minValue = binary.LittleEndian.AppendUint64(nil, uint64(minTime))
+	times.maxValue = binary.LittleEndian.AppendUint64(nil, uint64(maxTime))
+	g.chunks = append(g.chunks, times)
+
+	text := parquetChunk{typ: parquetByteArray, name: "text", offset: p.pos}
+	var page []byte
+	var n int
+	for _, s := range rows.texts {
+		page = binary.LittleEndian.AppendUint32(page, uint32(len(s)))
+		page = append(page, s...)
+		n++
+		if len(page) >= parquetPageSize {
+			if err := p.page(&text, page, n); err != nil {
+				return err
+			}
+			page, n = page[:0], 0
+		}
+	}
+	if n > 0 {
+		if err := p.page(&text, page, n); err != nil {
+			return err
+		}
+	}
+	g.chunks = append(g.chunks, text)
+
+	p.rowGroups = append(p.rowGroups, g)
+	return nil
+}
+
+// page writes a data page with n values.
+func (p *parquetWriter) page(c *parquetChunk, data []byte, n int) error {
+	compressed := p.enc.EncodeAll(data, nil)
+
+	var t thriftWriter
+	t.i32(1, parquetDataPage)
+	t.i32(2, int32(len(data)))
+	t.i32(3, int32(len(compressed)))
+	t.structField(5)
+	t.i32(1, int32(n))
+	t.i32(2, parquetPlain)
+	t.i32(3, parquetRLE)
+	t.i32(4, parquetRLE)
+	t.end()
+	t.stop()
+
+	if err := p.write(t.buf); err != nil {
+		return err
+	}
+	if err := p.write(compressed); err != nil {
+		return err
+	}
+
+	c.values += int64(n)
+	c.compressed += int64(len(t.buf) + len(compressed))
+	c.uncompressed += int64(len(t.buf) + len(data))
+	return nil
+}
+
+// close writes the metadata.
+func (p *parquetWriter) close() error {
+	var numRows int64
+	for _, g := range p.rowGroups {
+		numRows += g.rows
+	}
+
+	var t thriftWriter
+	t.i32(1, 1)
+
+	t.list(2, thriftStruct, 3)
+	t.begin()
+	t.binary(4, []byte("schema"))
+	t.i32(5, 2)
+	t.end()
+
+	t.begin()
+	t.i32(1, parquetInt64)
+	t.i32(3, parquetRequired)
+	t.binary(4, []byte("time"))
+	t.i32(6, parquetTimestampMillis)
+	t.structField(10)
+	t.structField(8)
+	t.bool(1, true)
+	t.structField(2)
+	t.structField(1)
+	t.end()
+	t.end()
+	t.end()
+	t.end()
+	t.end()
+
+	t.begin()
+	t.i32(1, parquetByteArray)
+	t.i32(3, parquetRequired)
+	t.binary(4, []byte("text"))
+	t.i32(6, parquetUTF8)
+	t.structField(10)
+	t.structField(1)
+	t.end()
+	t.end()
+	t.end()
+
+	t.i64(3, numRows)
+
+	t.list(4, thriftStruct, len(p.rowGroups))
+	for i, g := range p.rowGroups {
+		var size int64
+		for _, c := range g.chunks {
+			size += c.uncompressed
+		}
+
+		t.begin()
+		t.list(1, thriftStruct, len(g.chunks))
+		for _, c := range g.chunks {
+			t.begin()
+			t.i64(2, c.offset)
+			t.structField(3)
+			t.i32(1, c.typ)
+			t.list(2, thriftI32, 2)
+			t.listI32(parquetPlain)
+			t.listI32(parquetRLE)
+			t.list(3, thriftBinary, 1)
+			t.listBinary([]byte(c.name))
+			t.i32(4, parquetZstd)
+			t.i64(5, c.values)
+			t.i64(6, c.uncompressed)
+			t.i64(7, c.compressed)
+			t.i64(9, c.offset)
+			if c.minValue != nil {
+				t.structField(12)
+				t.i64(3, 0)
+				t.binary(5, c.maxValue)
+				t.binary(6, c.minValue)
+				t.end()
+			}
+			t.end()
+			t.end()
+		}
+		t.i64(2, size)
+		t.i64(3, g.rows)
+		t.i64(5, g.chunks[0].offset)
+		t.i16(7, int16(i))
+		t.end()
+	}
+
+	t.binary(6, []byte("timedb"))
+	t.stop()
+
+	if err := p.write(t.buf); err != nil {
+		return err
+	}
+	if err := p.write(binary.LittleEndian.AppendUint32(nil, uint32(len(t.buf)))); err != nil {
+		return err
+	}
+	if err := p.write([]byte("PAR1")); err != nil {
+		return err
+	}
+	return p.w.Flush()
+}
+
+// The types of the thrift compact protocol used.
+const (
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftI16    = 4
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes structs with the thrift compact protocol, used by
+// the metadata of the Parquet files. The fields are written in order of
+// their id and each struct ends with end, except the outer one with stop.
+type thriftWriter struct {
+	buf   []byte
+	last  int16
+	stack []int16
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	if d := id - t.last; d > 0 && d <= 15 {
+		t.buf = append(t.buf, byte(d)<<4|typ)
+	} else {
+		t.buf = append(t.buf, typ)
+		t.buf = binary.AppendVarint(t.buf, int64(id))
+	}
+	t.last = id
+}
+
+func (t *thriftWriter) bool(id int16, v bool) {
+	if v {
+		t.field(id, thriftTrue)
+	} else {
+		t.field(id, thriftFalse)
+	}
+}
+
+func (t *thriftWriter) i16(id int16, v int16) {
+	t.field(id, thriftI16)
+	t.buf = binary.AppendVarint(t.buf, int64(v))
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.buf = binary.AppendVarint(t.buf, int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.buf = binary.AppendVarint(t.buf, v)
+}
+
+func (t *thriftWriter) binary(id int16, b []byte) {
+	t.field(id, thriftBinary)
+	t.listBinary(b)
+}
+
+// structField starts a field of type struct.
+func (t *thriftWriter) structField(id int16) {
+	t.field(id, thriftStruct)
+	t.begin()
+}
+
+// list starts a field of type list. The elements follow it.
+func (t *thriftWriter) list(id int16, elem byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf = append(t.buf, byte(n)<<4|elem)
+	} else {
+		t.buf = append(t.buf, 0xF0|elem)
+		t.buf = binary.AppendUvarint(t.buf, uint64(n))
+	}
+}
+
+func (t *thriftWriter) listI32(v int32) {
+	t.buf = binary.AppendVarint(t.buf, int64(v))
+}
+
+func (t *thriftWriter) listBinary(b []byte) {
+	t.buf = binary.AppendUvarint(t.buf, uint64(len(b)))
+	t.buf = append(t.buf, b...)
+}
+
+// begin starts a struct, in a field or as an element of a list.
+func (t *thriftWriter) begin() {
+	t.stack = append(t.stack, t.last)
+	t.last = 0
+}
+
+// end ends a struct started with begin.
+func (t *thriftWriter) end() {
+	t.stop()
+	t.last = t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+}
+
+// stop ends the outer struct.
+func (t *thriftWriter) stop() {
+	t.buf = append(t.buf, 0)
+}
@@ -0,0 +1,190 @@
+package timedb
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// thriftRead decodes the structs of the thrift compact protocol of the
+// test as maps of the field ids.
+type thriftRead struct {
+	buf []byte
+	pos int
+}
+
+func (r *thriftRead) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	r.pos += n
+	return v
+}
+
+func (r *thriftRead) varint() int64 {
+	v, n := binary.Varint(r.buf[r.pos:])
+	r.pos += n
+	return v
+}
+
+func (r *thriftRead) value(typ byte) interface{} {
+	switch typ {
+	case thriftTrue:
+		return true
+	case thriftFalse:
+		return false
+	case thriftI16, thriftI32, thriftI64:
+		return r.varint()
+	case thriftBinary:
+		n := int(r.uvarint())
+		r.pos += n
+		return r.buf[r.pos-n : r.pos]
+	case thriftList:
+		h := r.buf[r.pos]
+		r.pos++
+		n := int(h >> 4)
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			list[i] = r.value(h & 0x0F)
+		}
+		return list
+	case thriftStruct:
+		return r.structure()
+	default:
+		panic("unexpected thrift type")
+	}
+}
+
+func (r *thriftRead) structure() map[int16]interface{} {
+	s := make(map[int16]interface{})
+	var id int16
+	for {
+		h := r.buf[r.pos]
+		r.pos++
+		if h == 0 {
+			return s
+		}
+		if d := h >> 4; d != 0 {
+			id += int16(d)
+		} else {
+			id = int16(r.varint())
+		}
+		s[id] = r.value(h & 0x0F)
+	}
+}
+
+func readParquet(t *testing.T, name string) ([]int64, []string) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data[:4]) != "PAR1" || string(data[len(data)-4:]) != "PAR1" {
+		t.Fatal("missing magic number")
+	}
+
+	size := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	r := &thriftRead{buf: data[len(data)-8-size : len(data)-8]}
+	meta := r.structure()
+
+	schema := meta[2].([]interface{})
+	if len(schema) != 3 || string(schema[1].(map[int16]interface{})[4].([]byte)) != "time" {
+		t.Fatalf("unexpected schema %v", schema)
+	}
+
+	dec, _ := zstd.NewReader(nil)
+	defer dec.Close()
+
+	var times []int64
+	var texts []string
+	var rows int64
+	for _, g := range meta[4].([]interface{}) {
+		group := g.(map[int16]interface{})
+		rows += group[3].(int64)
+
+		for i, c := range group[1].([]interface{}) {
+			cm := c.(map[int16]interface{})[3].(map[int16]interface{})
+			pos := int(cm[9].(int64))
+			for n := int64(0); n < cm[5].(int64); {
+				r := &thriftRead{buf: data, pos: pos}
+				header := r.structure()
+				page := header[5].(map[int16]interface{})
+				values, err := dec.DecodeAll(data[r.pos:r.pos+int(header[3].(int64))], nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(values) != int(header[2].(int64)) {
+					t.Fatal("unexpected page size")
+				}
+				pos = r.pos + int(header[3].(int64))
+				n += page[1].(int64)
+
+				for j := int64(0); j < page[1].(int64); j++ {
+					if i == 0 {
+						times = append(times, int64(binary.LittleEndian.Uint64(values)))
+						values = values[8:]
+					} else {
+						l := binary.LittleEndian.Uint32(values)
+						texts = append(texts, string(values[4:4+l]))
+						values = values[4+l:]
+					}
+				}
+			}
+		}
+	}
+
+	if rows != meta[3].(int64) || len(times) != int(rows) || len(texts) != int(rows) {
+		t.Fatalf("unexpected rows %d", rows)
+	}
+	return times, texts
+}
+
+func TestExportParquet(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 5; j++ {
+			db.Insert(start.AddDate(0, 0, i).Add(time.Duration(j)*time.Second), "nginx", "GET /%d", j)
+		}
+	}
+	db.Insert(start, "redis", "PING")
+
+	dir := t.TempDir()
+	m, err := db.ExportParquet(dir, "*", start, start.AddDate(0, 0, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the last day is out of the range
+	if len(m.Files) != 3 {
+		t.Fatalf("expected 3 files, got %+v", m.Files)
+	}
+
+	f := m.Files[0]
+	if f.Table != "nginx" || f.Path != "nginx/dt=2020-01-01/part-0.parquet" || f.Rows != 5 || !f.MaxTime.Equal(start.Add(4*time.Second)) {
+		t.Fatalf("unexpected file %+v", f)
+	}
+
+	times, texts := readParquet(t, filepath.Join(dir, filepath.FromSlash(f.Path)))
+	if texts[4] != "GET /4" || times[4] != start.Add(4*time.Second).UnixMilli() {
+		t.Fatalf("unexpected records %v %v", times, texts)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, ParquetManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved ParquetManifest
+	if err := json.Unmarshal(b, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Files) != 3 || saved.Files[2].Path != "nginx/dt=2020-01-02/part-0.parquet" {
+		t.Fatalf("unexpected manifest %+v", saved.Files)
+	}
+}
@@ -0,0 +1,193 @@
+package timedb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tables with a maximum file size continue in part files when the file of
+// the day is full: table.log, table.log.1, table.log.2...
+
+// partName returns the name of a part of a data file. The part 0 is the file.
+func partName(name string, part int) string {
+	if part == 0 {
+		return name
+	}
+	return name + "." + strconv.Itoa(part)
+}
+
+// partBase returns the data file of a part.
+func partBase(name string) string {
+	name = strings.TrimSuffix(name, ".zst")
+	i := strings.LastIndex(name, ".log.")
+	if i == -1 {
+		return name
+	}
+	if _, err := strconv.Atoi(name[i+5:]); err != nil {
+		return name
+	}
+	return name[:i+4]
+}
+
+// partExists reports whether the part exists, compressed or not.
+func partExists(s fs.FS, name string) bool {
+	if _, err := fs.Stat(s, name); err == nil {
+		return true
+	}
+	_, err := fs.Stat(s, name+".zst")
+	return err == nil
+}
+
+// lastPart returns the number of the last part of a data file.
+func lastPart(s fs.FS, name string) int {
+	part := 0
+	for partExists(s, partName(name, part+1)) {
+		part++
+	}
+	return part
+}
+
+// partFiles returns the local files of the parts of a data file after
+// the first one, including the compressed ones.
+func partFiles(s storage, name string) []string {
+	var files []string
+	for part := 1; ; part++ {
+		p := partName(name, part)
+		found := false
+		for _, f := range []string{p, p + ".zst"} {
+			if _, err := fs.Stat(s, f); err == nil {
+				files = append(files, f)
+				found = true
+			}
+		}
+		if !found {
+			return files
+		}
+	}
+}
+
+// openPart opens a part of the data file in the writer. The caller must
+// hold the lock of the writer.
+func (db *DB) openPart(w *tableWriter, name string, part int, o TableOptions) error {
+	p := partName(name, part)
+
+	if err := db.checkArchived(p); err != nil {
+		db.metrics.writeErrors.Add(1)
+		return err
+	}
+
+	// the day could have been compressed
+	if err := db.decompressFile(p); err != nil {
+		db.metrics.writeErrors.Add(1)
+		return diskFullError(fmt.Errorf("timeDB: error openning file %s: %w", p, err))
+	}
+
+	// a crash could have left a partial record at the end
+	if err := db.repairTail(p); err != nil {
+		db.metrics.writeErrors.Add(1)
+		return diskFullError(fmt.Errorf("timeDB: error openning file %s: %w", p, err))
+	}
+
+	f, err := db.storage.Append(p)
+	if err != nil {
+		db.metrics.writeErrors.Add(1)
+		return diskFullError(fmt.Errorf("timeDB: error openning file %s: %w", p, err))
+	}
+
+	var size int64
+	if info, err := fs.Stat(localStorage(db.storage), p); err == nil {
+		size = info.Size()
+	}
+
+	n, err := db.writeHeader(f, size)
+	if err != nil {
+		f.Close()
+		db.metrics.writeErrors.Add(1)
+		return diskFullError(fmt.Errorf("timeDB: error writing file %s: %w", p, err))
+	}
+	size += int64(n)
+	db.addFileUsage(name, int64(n))
+
+	w.file = f
+	w.path = name
+	w.part = part
+	w.size = size
+	w.max = o.MaxFileSize
+	w.fsync = o.Fsync
+	db.metrics.openFiles.Add(1)
+
+	db.writers.mutex.Lock()
+	db.writers.active = name
+	db.writers.mutex.Unlock()
+
+	db.closeIdle(w)
+	return nil
+}
+
+// openParts opens all the parts of a data file as a single file.
+func (db *DB) openParts(day time.Time, name string) (fs.File, error) {
+	f, err := db.openFile(day, name)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []fs.File{f}
+	for part := 1; ; part++ {
+		p, err := db.storage.Open(partName(name, part))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				break
+			}
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, err
+		}
+		files = append(files, p)
+	}
+
+	if len(files) == 1 {
+		return f, nil
+	}
+	return &partsFile{files: files}, nil
+}
+
+// partsFile reads the parts of a data file one after the other.
+type partsFile struct {
+	files []fs.File
+	index int
+}
+
+func (f *partsFile) Read(p []byte) (int, error) {
+	for f.index < len(f.files) {
+		n, err := f.files[f.index].Read(p)
+		if err == io.EOF {
+			f.index++
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+	return 0, io.EOF
+}
+
+func (f *partsFile) Stat() (fs.FileInfo, error) {
+	return f.files[0].Stat()
+}
+
+func (f *partsFile) Close() error {
+	var first error
+	for _, file := range f.files {
+		if err := file.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
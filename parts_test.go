@@ -0,0 +1,92 @@
+package timedb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParts(t *testing.T) {
+	dir := t.TempDir()
+	db := New(dir)
+
+	limit := db.headerSize() + 50
+	if err := db.SetTableOptions("log", TableOptions{MaxFileSize: limit}); err != nil {
+		t.Fatal(err)
+	}
+
+	// each line is 13 bytes so 3 fit in each part after the header
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 10; i++ {
+		if err := db.Insert(start.Add(time.Duration(i)*time.Second), "log", "%d", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := db.NewBatch()
+	b.Insert(start.Add(10*time.Second), "log", "x")
+	b.Insert(start.Add(11*time.Second), "log", "y")
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	for _, name := range []string{"log.log", "log.log.1", "log.log.2", "log.log.3"} {
+		info, err := os.Stat(filepath.Join(dir, "2020-01-01", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > limit {
+			t.Fatalf("%s: %d bytes", name, info.Size())
+		}
+	}
+
+	// a new writer continues in the last part
+	db = New(dir)
+	if err := db.Insert(start.Add(12*time.Second), "log", "z"); err != nil {
+		t.Fatal(err)
+	}
+
+	s := db.Query("log", start, start, 0, 0)
+	defer s.Close()
+
+	var lines []string
+	for s.Scan() {
+		lines = append(lines, s.Data().Text)
+	}
+	if len(lines) != 13 || lines[0] != " 0" || lines[10] != " x" || lines[12] != " z" {
+		t.Fatalf("unexpected lines %q", lines)
+	}
+
+	st, err := db.DayStats(start, "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Count != 13 {
+		t.Fatalf("expected 13 records, got %d", st.Count)
+	}
+
+	s.Close()
+
+	// the parts are compressed with the day
+	if err := db.SetTableOptions("log", TableOptions{MaxFileSize: 50, Compress: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.ApplyTableOptions(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "2020-01-01", "log.log.4.zst")); err != nil {
+		t.Fatal(err)
+	}
+
+	s = db.Query("log", start, start, 0, 0)
+	n := 0
+	for s.Scan() {
+		n++
+	}
+	if n != 13 {
+		t.Fatalf("expected 13 lines, got %d", n)
+	}
+}
@@ -0,0 +1,37 @@
+package timedb
+
+import "sync"
+
+// readBufferSize is the size of the buffers of the readers. Larger buffers
+// are kept in the pool too when they grow for long lines.
+const readBufferSize = 64 * 1024
+
+// readBuffers are the staging buffers of the readers, reused between
+// queries to reduce the allocations of services with many queries.
+var readBuffers = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, readBufferSize)
+		return &b
+	},
+}
+
+// grow makes room in the buffer to read n more bytes. The pending data
+// is moved to the start of the pooled buffer when there is space.
+func (r *reader) grow(n int) {
+	if cap(r.buf)-len(r.buf) >= n {
+		return
+	}
+
+	if r.pooled == nil {
+		r.pooled = readBuffers.Get().(*[]byte)
+	}
+
+	pending := len(r.buf)
+	if pending+n > cap(*r.pooled) {
+		*r.pooled = make([]byte, 0, 2*(pending+n))
+	}
+
+	b := (*r.pooled)[:pending]
+	copy(b, r.buf)
+	r.buf = b
+}
@@ -0,0 +1,49 @@
+package timedb
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadBuffers(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	long := strings.Repeat("x", 3*readBufferSize)
+	for i := 0; i < 100; i++ {
+		text := "a"
+		if i%10 == 0 {
+			text = long
+		}
+		if err := db.Insert(start, "log", text); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			s := db.Query("log", start, start, 0, 0)
+			defer s.Close()
+
+			n := 0
+			for s.Scan() {
+				text := s.Data().Text
+				if (n%10 == 0 && text != " "+long) || (n%10 != 0 && text != " a") {
+					t.Errorf("line %d: unexpected %d bytes", n, len(text))
+					return
+				}
+				n++
+			}
+			if n != 100 {
+				t.Errorf("expected 100 lines, got %d", n)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,43 @@
+package timedb
+
+import "sync"
+
+// Progress is how much of a query has been read.
+type Progress struct {
+	Files      int64
+	TotalFiles int64
+	Bytes      int64
+
+	// TotalBytes is estimated like in Explain. The size of compressed
+	// files is not known so Bytes can be larger.
+	TotalBytes int64
+}
+
+// progressTotals are computed once per scanner.
+type progressTotals struct {
+	once  sync.Once
+	files int64
+	bytes int64
+}
+
+// Progress returns how much of the query has been read. It can be
+// called from other goroutines while scanning. The first call
+// computes the totals listing the files of the query.
+func (s *Scanner) Progress() Progress {
+	t := &s.totals
+	t.once.Do(func() {
+		plan, err := s.Explain()
+		if err != nil {
+			return
+		}
+		t.files = int64(len(plan.Files))
+		t.bytes = plan.Bytes
+	})
+
+	return Progress{
+		Files:      s.reader.files.Load(),
+		TotalFiles: t.files,
+		Bytes:      s.reader.bytes.Load(),
+		TotalBytes: t.bytes,
+	}
+}
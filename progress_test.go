@@ -0,0 +1,52 @@
+package timedb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProgress(t *testing.T) {
+	db := New(t.TempDir())
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 3; i++ {
+		if err := db.Insert(start.AddDate(0, 0, i), "log", "a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := db.Query("log", start, start.AddDate(0, 0, 2), 0, 0)
+	defer s.Close()
+
+	size := 3 * (13 + db.headerSize())
+	if p := s.Progress(); p.Files != 0 || p.TotalFiles != 3 || p.TotalBytes != size {
+		t.Fatalf("invalid progress %+v", p)
+	}
+
+	for s.Scan() {
+	}
+	if p := s.Progress(); p.Files != 3 || p.Bytes != size {
+		t.Fatalf("invalid progress %+v", p)
+	}
+}
+
+func TestLimitStopsReading(t *testing.T) {
+	db := New(t.TempDir())
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 3; i++ {
+		if err := db.Insert(start.AddDate(0, 0, i), "log", "a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := db.Query("log", start, start.AddDate(0, 0, 2), 0, 1)
+	defer s.Close()
+
+	for s.Scan() {
+	}
+
+	if p := s.Progress(); p.Files != 1 || p.Bytes != 13+db.headerSize() {
+		t.Fatalf("expected to read only the first file, got %+v", p)
+	}
+}
@@ -0,0 +1,51 @@
+package timedb
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Row is a record projected to the fields captured by a regexp.
+type Row struct {
+	Time   time.Time
+	Fields map[string]string
+}
+
+// SetProjection returns only the records that match the regexp and
+// captures its groups, that are returned by Fields. Named groups use
+// their name and the rest their number, like "1".
+func (s *Scanner) SetProjection(re *regexp.Regexp) {
+	s.project = re
+}
+
+// Fields returns the groups captured by the projection of the
+// current record (see SetProjection).
+func (s *Scanner) Fields() map[string]string {
+	return s.fields
+}
+
+// Row returns the time and the fields of the current record.
+func (s *Scanner) Row() Row {
+	return Row{Time: s.data.Time, Fields: s.fields}
+}
+
+// projectFields returns the captured groups or nil if the text doesn't match.
+func projectFields(re *regexp.Regexp, text string) map[string]string {
+	m := re.FindStringSubmatch(text)
+	if m == nil {
+		return nil
+	}
+
+	fields := make(map[string]string, len(m)-1)
+	for i, name := range re.SubexpNames() {
+		if i == 0 {
+			continue
+		}
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		fields[name] = m[i]
+	}
+	return fields
+}
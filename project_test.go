@@ -0,0 +1,55 @@
+package timedb
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestProjection(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i, line := range []string{"GET /a 200 12ms", "starting", "POST /b 500 7ms"} {
+		if err := db.Insert(start.Add(time.Duration(i)*time.Minute), "nginx", line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := db.Query("nginx", start, start.Add(time.Hour), 0, 0)
+	defer s.Close()
+
+	s.SetProjection(regexp.MustCompile(`^(?P<method>\w+) (\S+) (?P<status>\d+)`))
+
+	var rows []Row
+	for s.Scan() {
+		rows = append(rows, s.Row())
+	}
+
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %v", rows)
+	}
+
+	f := rows[1].Fields
+	if f["method"] != "POST" || f["2"] != "/b" || f["status"] != "500" || len(f) != 3 {
+		t.Fatalf("invalid fields %v", f)
+	}
+	if !rows[1].Time.Equal(start.Add(2 * time.Minute)) {
+		t.Fatalf("invalid time %v", rows[1].Time)
+	}
+
+	res, err := db.RunQuery(`table=nginx | extract "(?P<status>\\d{3}) (?P<ms>\\d+)ms"`, start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Rows) != 2 || res.Rows[0].Fields["ms"] != "12" || len(res.Records) != 0 {
+		t.Fatalf("invalid result %+v", res)
+	}
+
+	if _, err := ParseQuery(`table=nginx | extract "(" `); err == nil {
+		t.Fatal("expected an error")
+	}
+	if _, err := ParseQuery(`table=nginx | extract "a" | count`); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,668 @@
+package timedb
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// PromLookback is how far back an instant selector looks for the last
+// point of a series, like in Prometheus.
+const PromLookback = 5 * time.Minute
+
+// MaxPromPoints is the largest number of steps of a range query, the
+// same resolution limit of Prometheus.
+const MaxPromPoints = 11000
+
+// PromQuery evaluates an expression of a subset of PromQL over the
+// numeric tables at the time t. The name of the metric is the table:
+//
+//	cpu{host="a"}
+//	http_requests[5m]
+//	sum by (code) (rate(http_requests{job=~"web.*"}[5m]))
+//
+// Selectors support the matchers =, !=, =~ and !~. The functions are
+// rate, increase, delta and avg, sum, min, max, count and last _over_time,
+// and the aggregations sum, avg, min, max and count with by or without.
+// Each series of the result has one point at t except for range selectors,
+// that return all the points of the range.
+func (db *DB) PromQuery(query string, t time.Time) ([]Series, error) {
+	expr, err := parsePromQL(query)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &promEval{db: db, times: []time.Time{t}, instant: true}
+	return e.eval(expr)
+}
+
+// PromQueryRange evaluates a PromQL expression (see PromQuery) at each
+// step of the range [start, end], like a Prometheus range query. The
+// step can't be smaller than the range divided by MaxPromPoints.
+func (db *DB) PromQueryRange(query string, start, end time.Time, step time.Duration) ([]Series, error) {
+	if step <= 0 {
+		return nil, fmt.Errorf("timeDB: invalid step %v", step)
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("timeDB: invalid range")
+	}
+	if end.Sub(start)/step > MaxPromPoints {
+		return nil, fmt.Errorf("timeDB: exceeded the maximum of %d points per series, use a larger step", MaxPromPoints)
+	}
+
+	expr, err := parsePromQL(query)
+	if err != nil {
+		return nil, err
+	}
+	if s, ok := expr.(*promSelector); ok && s.window > 0 {
+		return nil, fmt.Errorf("timeDB: range selectors need a function in range queries")
+	}
+
+	e := &promEval{db: db}
+	for t := start; !t.After(end); t = t.Add(step) {
+		e.times = append(e.times, t)
+	}
+	return e.eval(expr)
+}
+
+// PromTables returns the tables of the selectors of a PromQL expression.
+func PromTables(query string) ([]string, error) {
+	expr, err := parsePromQL(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var tables []string
+	for expr != nil {
+		switch x := expr.(type) {
+		case *promSelector:
+			tables = append(tables, x.table)
+			expr = nil
+		case *promCall:
+			expr = x.arg
+		case *promAggregation:
+			expr = x.arg
+		default:
+			expr = nil
+		}
+	}
+	return tables, nil
+}
+
+type promExpr interface{}
+
+// promSelector selects the series of a table.
+type promSelector struct {
+	table    string
+	matchers []promMatcher
+	window   time.Duration
+}
+
+type promMatcher struct {
+	label string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+func (m promMatcher) match(labels Labels) bool {
+	v := labels[m.label]
+	switch m.op {
+	case "=":
+		return v == m.value
+	case "!=":
+		return v != m.value
+	case "=~":
+		return m.re.MatchString(v)
+	default:
+		return !m.re.MatchString(v)
+	}
+}
+
+// promCall applies a function to the points of a range selector.
+type promCall struct {
+	fn  string
+	arg *promSelector
+}
+
+// promAggregation combines the series with the same labels.
+type promAggregation struct {
+	op      string
+	labels  []string
+	without bool
+	arg     promExpr
+}
+
+// promRangeFuncs return the value of the points of a window or NaN.
+var promRangeFuncs = map[string]func(points []Point, window time.Duration) float64{
+	"rate": func(points []Point, window time.Duration) float64 {
+		return promIncrease(points) / window.Seconds()
+	},
+	"increase": func(points []Point, window time.Duration) float64 {
+		return promIncrease(points)
+	},
+	"delta": func(points []Point, window time.Duration) float64 {
+		if len(points) < 2 {
+			return math.NaN()
+		}
+		return points[len(points)-1].Value - points[0].Value
+	},
+	"avg_over_time": func(points []Point, window time.Duration) float64 {
+		return aggregatePoints(points, AggAvg)
+	},
+	"sum_over_time": func(points []Point, window time.Duration) float64 {
+		return aggregatePoints(points, AggSum)
+	},
+	"min_over_time": func(points []Point, window time.Duration) float64 {
+		return aggregatePoints(points, AggMin)
+	},
+	"max_over_time": func(points []Point, window time.Duration) float64 {
+		return aggregatePoints(points, AggMax)
+	},
+	"count_over_time": func(points []Point, window time.Duration) float64 {
+		return aggregatePoints(points, AggCount)
+	},
+	"last_over_time": func(points []Point, window time.Duration) float64 {
+		return aggregatePoints(points, AggLast)
+	},
+}
+
+var promAggregations = map[string]AggregateFunc{
+	"sum":   AggSum,
+	"avg":   AggAvg,
+	"min":   AggMin,
+	"max":   AggMax,
+	"count": AggCount,
+}
+
+// promIncrease returns the increase of a counter. If it decreases it is
+// taken as a reset to zero.
+func promIncrease(points []Point) float64 {
+	if len(points) < 2 {
+		return math.NaN()
+	}
+
+	var v float64
+	for i := 1; i < len(points); i++ {
+		if points[i].Value < points[i-1].Value {
+			v += points[i].Value
+		} else {
+			v += points[i].Value - points[i-1].Value
+		}
+	}
+	return v
+}
+
+// aggregatePoints combines the values of the points.
+func aggregatePoints(points []Point, fn AggregateFunc) float64 {
+	if len(points) == 0 {
+		return math.NaN()
+	}
+
+	v := points[0].Value
+	for _, p := range points[1:] {
+		switch fn {
+		case AggSum, AggAvg:
+			v += p.Value
+		case AggMin:
+			v = math.Min(v, p.Value)
+		case AggMax:
+			v = math.Max(v, p.Value)
+		case AggLast:
+			v = p.Value
+		}
+	}
+
+	switch fn {
+	case AggAvg:
+		v /= float64(len(points))
+	case AggCount:
+		v = float64(len(points))
+	}
+	return v
+}
+
+type promEval struct {
+	db      *DB
+	times   []time.Time
+	instant bool
+}
+
+func (e *promEval) eval(expr promExpr) ([]Series, error) {
+	switch x := expr.(type) {
+	case *promSelector:
+		series, err := e.load(x)
+		if err != nil {
+			return nil, err
+		}
+		if x.window > 0 {
+			// the points of the range
+			t := e.times[0]
+			for i, s := range series {
+				series[i].Points = window(s.Points, t.Add(-x.window), t)
+			}
+		} else {
+			for i, s := range series {
+				series[i].Points = e.steps(s.Points, func(t time.Time) float64 {
+					p := window(s.Points, t.Add(-PromLookback), t)
+					if len(p) == 0 {
+						return math.NaN()
+					}
+					return p[len(p)-1].Value
+				})
+			}
+		}
+		return nonEmpty(series), nil
+
+	case *promCall:
+		series, err := e.load(x.arg)
+		if err != nil {
+			return nil, err
+		}
+		fn := promRangeFuncs[x.fn]
+		for i, s := range series {
+			series[i].Points = e.steps(s.Points, func(t time.Time) float64 {
+				return fn(window(s.Points, t.Add(-x.arg.window), t), x.arg.window)
+			})
+		}
+		return nonEmpty(series), nil
+
+	case *promAggregation:
+		series, err := e.eval(x.arg)
+		if err != nil {
+			return nil, err
+		}
+		return e.aggregate(x, series), nil
+	}
+
+	return nil, fmt.Errorf("timeDB: invalid expression")
+}
+
+// load returns the series of the table that match the selector with the
+// points needed to evaluate all the steps.
+func (e *promEval) load(s *promSelector) ([]Series, error) {
+	back := s.window
+	if back == 0 {
+		back = PromLookback
+	}
+
+	start := e.times[0].Add(-back)
+	end := e.times[len(e.times)-1].Add(time.Nanosecond)
+
+	series, err := e.db.Series(s.table, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Series
+	for _, sr := range series {
+		matched := true
+		for _, m := range s.matchers {
+			if !m.match(sr.Labels) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			result = append(result, sr)
+		}
+	}
+	return result, nil
+}
+
+// steps evaluates fn at each step. The NaN values are omitted.
+func (e *promEval) steps(points []Point, fn func(t time.Time) float64) []Point {
+	var result []Point
+	for _, t := range e.times {
+		if v := fn(t); !math.IsNaN(v) {
+			result = append(result, Point{Time: t, Value: v})
+		}
+	}
+	return result
+}
+
+// aggregate combines the series by the labels at each step.
+func (e *promEval) aggregate(a *promAggregation, series []Series) []Series {
+	type group struct {
+		labels Labels
+		points map[int64][]Point
+	}
+
+	groups := make(map[string]*group)
+	for _, s := range series {
+		labels := Labels{}
+		if a.without {
+			for k, v := range s.Labels {
+				labels[k] = v
+			}
+			for _, k := range a.labels {
+				delete(labels, k)
+			}
+		} else {
+			for _, k := range a.labels {
+				if v, ok := s.Labels[k]; ok {
+					labels[k] = v
+				}
+			}
+		}
+
+		key := labels.String()
+		g, ok := groups[key]
+		if !ok {
+			g = &group{labels: labels, points: make(map[int64][]Point)}
+			groups[key] = g
+		}
+		for _, p := range s.Points {
+			t := p.Time.UnixNano()
+			g.points[t] = append(g.points[t], p)
+		}
+	}
+
+	result := make([]Series, 0, len(groups))
+	for _, g := range groups {
+		s := Series{}
+		if len(g.labels) > 0 {
+			s.Labels = g.labels
+		}
+		for _, t := range e.times {
+			if p, ok := g.points[t.UnixNano()]; ok {
+				s.Points = append(s.Points, Point{Time: t, Value: aggregatePoints(p, promAggregations[a.op])})
+			}
+		}
+		result = append(result, s)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Labels.String() < result[j].Labels.String()
+	})
+	return result
+}
+
+// window returns the points, sorted by time, of the range (start, end].
+func window(points []Point, start, end time.Time) []Point {
+	i := sort.Search(len(points), func(i int) bool { return points[i].Time.After(start) })
+	j := sort.Search(len(points), func(i int) bool { return points[i].Time.After(end) })
+	return points[i:j]
+}
+
+// nonEmpty removes the series without points.
+func nonEmpty(series []Series) []Series {
+	result := series[:0]
+	for _, s := range series {
+		if len(s.Points) > 0 {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+type promParser struct {
+	tokens []string
+	pos    int
+}
+
+func parsePromQL(query string) (promExpr, error) {
+	tokens, err := promTokens(query)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &promParser{tokens: tokens}
+	expr, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("timeDB: invalid expression: unexpected %s", p.tokens[p.pos])
+	}
+	return expr, nil
+}
+
+func (p *promParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *promParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *promParser) expect(t string) error {
+	if p.next() != t {
+		return fmt.Errorf("timeDB: invalid expression: expected %s", t)
+	}
+	return nil
+}
+
+func (p *promParser) expr() (promExpr, error) {
+	name := p.next()
+	if name == "" || !isPromWord(name[0]) {
+		return nil, fmt.Errorf("timeDB: invalid expression: unexpected %q", name)
+	}
+
+	if _, ok := promAggregations[name]; ok && (p.peek() == "(" || p.peek() == "by" || p.peek() == "without") {
+		return p.aggregation(name)
+	}
+
+	if _, ok := promRangeFuncs[name]; ok && p.peek() == "(" {
+		p.next()
+		arg, err := p.selector(p.next())
+		if err != nil {
+			return nil, err
+		}
+		if arg.window == 0 {
+			return nil, fmt.Errorf("timeDB: %s needs a range selector", name)
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return &promCall{fn: name, arg: arg}, nil
+	}
+
+	return p.selector(name)
+}
+
+func (p *promParser) aggregation(op string) (promExpr, error) {
+	a := &promAggregation{op: op}
+
+	grouping := func() error {
+		if p.peek() != "by" && p.peek() != "without" {
+			return nil
+		}
+		a.without = p.next() == "without"
+		if err := p.expect("("); err != nil {
+			return err
+		}
+		for p.peek() != ")" {
+			label := p.next()
+			if label == "" || !isPromWord(label[0]) {
+				return fmt.Errorf("timeDB: invalid expression: expected a label")
+			}
+			a.labels = append(a.labels, label)
+			if p.peek() == "," {
+				p.next()
+			}
+		}
+		p.next()
+		return nil
+	}
+
+	if err := grouping(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	arg, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if s, ok := arg.(*promSelector); ok && s.window > 0 {
+		return nil, fmt.Errorf("timeDB: %s needs an instant vector", op)
+	}
+	a.arg = arg
+
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if a.labels == nil {
+		if err := grouping(); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+func (p *promParser) selector(table string) (*promSelector, error) {
+	if err := validTable(table); err != nil {
+		return nil, err
+	}
+	s := &promSelector{table: table}
+
+	if p.peek() == "{" {
+		p.next()
+		for p.peek() != "}" {
+			m := promMatcher{label: p.next(), op: p.next()}
+			if m.label == "" || !isPromWord(m.label[0]) {
+				return nil, fmt.Errorf("timeDB: invalid expression: expected a label")
+			}
+
+			v, err := promString(p.next())
+			if err != nil {
+				return nil, err
+			}
+			m.value = v
+
+			switch m.op {
+			case "=", "!=":
+			case "=~", "!~":
+				if m.re, err = regexp.Compile("^(?:" + v + ")$"); err != nil {
+					return nil, err
+				}
+			default:
+				return nil, fmt.Errorf("timeDB: invalid matcher %q", m.op)
+			}
+			s.matchers = append(s.matchers, m)
+
+			if p.peek() == "," {
+				p.next()
+			} else if p.peek() != "}" {
+				return nil, fmt.Errorf("timeDB: invalid expression: expected }")
+			}
+		}
+		p.next()
+	}
+
+	if p.peek() == "[" {
+		p.next()
+		d, err := ParsePromDuration(p.next())
+		if err != nil {
+			return nil, err
+		}
+		s.window = d
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// ParsePromDuration parses a duration like "5m" or "1h30m". It also
+// supports days and weeks like "7d" or "2w".
+func ParsePromDuration(s string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+
+	if n, ok := strings.CutSuffix(s, "d"); ok {
+		var v int
+		v, err = strconv.Atoi(n)
+		d = time.Duration(v) * 24 * time.Hour
+	} else if n, ok := strings.CutSuffix(s, "w"); ok {
+		var v int
+		v, err = strconv.Atoi(n)
+		d = time.Duration(v) * 7 * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(s)
+	}
+
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("timeDB: invalid duration %q", s)
+	}
+	return d, nil
+}
+
+// promString returns the value of a quoted string.
+func promString(t string) (string, error) {
+	if len(t) >= 2 && t[0] == '\'' && t[len(t)-1] == '\'' {
+		t = strconv.Quote(t[1 : len(t)-1])
+	}
+	if len(t) >= 2 && (t[0] == '"' || t[0] == '`') {
+		return strconv.Unquote(t)
+	}
+	return "", fmt.Errorf("timeDB: invalid expression: expected a string, found %q", t)
+}
+
+// promTokens splits an expression in names, strings and symbols.
+func promTokens(s string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+
+		case c == '"' || c == '\'' || c == '`':
+			j := i + 1
+			for ; j < len(s) && s[j] != c; j++ {
+				if s[j] == '\\' && c != '`' {
+					j++
+				}
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("timeDB: invalid expression: unterminated string")
+			}
+			tokens = append(tokens, s[i:j+1])
+			i = j + 1
+
+		case c == '=' || c == '!':
+			j := i + 1
+			if j < len(s) && (s[j] == '=' || s[j] == '~') {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+
+		case strings.IndexByte("(){}[],", c) != -1:
+			tokens = append(tokens, s[i:i+1])
+			i++
+
+		default:
+			j := i
+			for j < len(s) && isPromWord(s[j]) {
+				j++
+			}
+			if j == i {
+				return nil, fmt.Errorf("timeDB: invalid expression: unexpected %q", c)
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+func isPromWord(c byte) bool {
+	return c == '_' || c == ':' || c == '.' || c == '/' || c == '-' ||
+		'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
@@ -0,0 +1,89 @@
+package timedb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPromQuery(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 10; i++ {
+		tm := start.Add(time.Duration(i) * 30 * time.Second)
+		for _, host := range []string{"a", "b"} {
+			v := float64(i * 10)
+			if host == "b" {
+				v = float64(i * 20)
+			}
+			if err := db.InsertValue(tm, "requests", v, Labels{"host": host, "job": "web"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	end := start.Add(270 * time.Second)
+
+	res, err := db.PromQuery(`requests{host="b"}`, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Labels["host"] != "b" || res[0].Points[0].Value != 180 {
+		t.Fatalf("invalid result %v", res)
+	}
+
+	res, err = db.PromQuery(`requests{host=~"a|b"}[1m]`, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || len(res[0].Points) != 2 || res[0].Points[1].Value != 90 {
+		t.Fatalf("invalid result %v", res)
+	}
+
+	res, err = db.PromQuery(`sum by (job) (rate(requests[1m]))`, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Labels["job"] != "web" || res[0].Points[0].Value != 0.5 {
+		t.Fatalf("invalid result %v", res)
+	}
+
+	res, err = db.PromQueryRange(`sum(increase(requests{host!="a"}[1m])) without (job)`, start.Add(time.Minute), end, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Labels["host"] != "b" || len(res[0].Points) != 4 || res[0].Points[0].Value != 20 {
+		t.Fatalf("invalid result %v", res)
+	}
+
+	// the points older than the lookback are not returned
+	res, err = db.PromQuery(`requests`, end.Add(PromLookback+time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 0 {
+		t.Fatalf("invalid result %v", res)
+	}
+
+	for _, q := range []string{
+		`rate(requests)`,
+		`sum(requests[1m])`,
+		`requests{host~"a"}`,
+		`requests{host="a}`,
+		`requests[5x]`,
+		`sum by (job (requests)`,
+	} {
+		if _, err := db.PromQuery(q, end); err == nil {
+			t.Fatalf("expected an error in %q", q)
+		}
+	}
+
+	if _, err := db.PromQueryRange(`requests[1m]`, start, end, time.Minute); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// too many steps
+	if _, err := db.PromQueryRange(`requests`, start, start.Add(24*time.Hour), time.Millisecond); err == nil {
+		t.Fatal("expected an error")
+	}
+}
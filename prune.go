@@ -0,0 +1,234 @@
+package timedb
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// PruneReport is the result of Prune: the files deleted or, in a dry
+// run, the files that would be deleted.
+type PruneReport struct {
+	DryRun bool
+
+	// Files are the files of the days deleted.
+	Files []PrunedFile
+
+	// Archives are the archives of the months deleted.
+	Archives []PrunedFile
+
+	// Bytes is the size of all the files.
+	Bytes int64
+
+	Duration time.Duration
+}
+
+// PrunedFile is a file deleted by Prune.
+type PrunedFile struct {
+	// Day is zero for the archives.
+	Day time.Time
+
+	// Table is empty for the archives.
+	Table string
+
+	Path string
+	Size int64
+}
+
+// Tables returns the bytes deleted of each table.
+func (r PruneReport) Tables() map[string]int64 {
+	tables := make(map[string]int64)
+	for _, f := range r.Files {
+		tables[f.Table] += f.Size
+	}
+	return tables
+}
+
+// Prune deletes the data of the days before the given time, including
+// the archives of the months that end before it.
+func (db *DB) Prune(before time.Time) error {
+	_, err := db.prune(before, false)
+	return err
+}
+
+// PruneWithReport is like Prune but returns the files deleted.
+func (db *DB) PruneWithReport(before time.Time) (PruneReport, error) {
+	return db.prune(before, false)
+}
+
+// PruneDryRun returns the files that Prune would delete without
+// deleting anything.
+func (db *DB) PruneDryRun(before time.Time) (PruneReport, error) {
+	return db.prune(before, true)
+}
+
+func (db *DB) prune(before time.Time, dryRun bool) (PruneReport, error) {
+	start := time.Now()
+	r := PruneReport{DryRun: dryRun}
+
+	unlock, err := db.lockMaintenance()
+	if err != nil {
+		return r, err
+	}
+	defer unlock()
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	before = before.Local()
+	limit := time.Date(before.Year(), before.Month(), before.Day(), 0, 0, 0, 0, time.Local)
+
+	dayList, err := db.days()
+	if err != nil {
+		return r, err
+	}
+
+	for _, day := range dayList {
+		if !day.Before(limit) {
+			break
+		}
+
+		dir := db.getDir(day)
+
+		files, err := dayFiles(db.storage, dir)
+		if err != nil {
+			return r, err
+		}
+
+		for _, f := range files {
+			pf := PrunedFile{Day: day, Table: fileTable(strings.TrimPrefix(f, dir+"/")), Path: f}
+			if info, err := fs.Stat(db.storage, f); err == nil {
+				pf.Size = info.Size()
+			}
+			r.Files = append(r.Files, pf)
+			r.Bytes += pf.Size
+		}
+
+		if dryRun {
+			continue
+		}
+
+		db.closeFiles(func(p string) bool { return strings.HasPrefix(p, dir+"/") })
+
+		// archived files don't exist locally
+		if err := db.retire(db.storage, files...); err != nil {
+			return r, fmt.Errorf("timeDB.Prune: error removing %s: %v", dir, err)
+		}
+
+		removeDayDir(db.storage, dir)
+	}
+
+	if !dryRun {
+		db.resetUsage()
+	}
+
+	if err := db.pruneArchives(limit, dryRun, &r); err != nil {
+		return r, err
+	}
+
+	r.Duration = time.Since(start)
+	if !dryRun && len(r.Files)+len(r.Archives) > 0 {
+		db.log().Info("timedb: prune", "files", len(r.Files), "archives", len(r.Archives), "bytes", r.Bytes)
+	}
+	return r, nil
+}
+
+// pruneArchives deletes the archives of the months that end before the limit.
+func (db *DB) pruneArchives(limit time.Time, dryRun bool, r *PruneReport) error {
+	entries, err := db.storage.ReadDir(".")
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".tar.zst") {
+			continue
+		}
+
+		month, err := time.ParseInLocation("2006-01", strings.TrimSuffix(name, ".tar.zst"), time.Local)
+		if err != nil || month.AddDate(0, 1, 0).After(limit) {
+			continue
+		}
+
+		pf := PrunedFile{Path: name}
+		if info, err := e.Info(); err == nil {
+			pf.Size = info.Size()
+		}
+		r.Archives = append(r.Archives, pf)
+		r.Bytes += pf.Size
+
+		if dryRun {
+			continue
+		}
+
+		if err := db.storage.Remove(name); err != nil {
+			return fmt.Errorf("timeDB.Prune: error removing %s: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// fileTable returns the table of a file of a day, that can be a part,
+// compressed or a sidecar file like the stats.
+func fileTable(name string) string {
+	name = strings.TrimSuffix(name, ".zst")
+	for _, ext := range []string{".stats", ".bloom", ".idx", ".ids"} {
+		if n, ok := strings.CutSuffix(name, ext); ok {
+			name = n
+			break
+		}
+	}
+	name = partBase(name)
+	if i := strings.LastIndex(name, ".log."); i != -1 {
+		// the sidecar files of the parts
+		name = name[:i]
+	}
+	return strings.TrimSuffix(name, ".log")
+}
+
+// size returns the bytes used by the files of the database.
+func (db *DB) size() (int64, error) {
+	s := localStorage(db.storage)
+
+	files, err := dayFiles(s, ".")
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	var total int64
+	for _, f := range files {
+		info, err := fs.Stat(s, f)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return 0, err
+		}
+		total += info.Size()
+	}
+	return total, nil
+}
+
+// localStorage returns the storage without the archive and remote layers.
+func localStorage(s storage) storage {
+	for {
+		switch t := s.(type) {
+		case archiveStorage:
+			s = t.storage
+		case *tieredStorage:
+			s = t.storage
+		default:
+			return s
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package timedb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPruneDryRun(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2020, 1, 30, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 4; i++ {
+		if err := db.Insert(start.AddDate(0, 0, i), "logs", "v%d", i); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Insert(start.AddDate(0, 0, i), "web/nginx", "v%d", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.Archive(start); err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Date(2020, 2, 2, 0, 0, 0, 0, time.Local)
+
+	r, err := db.PruneDryRun(before)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the 2 archived days and 2020-02-01
+	if !r.DryRun || len(r.Files) != 6 || len(r.Archives) != 1 || r.Archives[0].Path != "2020-01.tar.zst" {
+		t.Fatalf("invalid report %+v", r)
+	}
+	if tables := r.Tables(); len(tables) != 2 || tables["logs"] == 0 || tables["web/nginx"] == 0 {
+		t.Fatalf("invalid tables %v", tables)
+	}
+	if n := countRecords(t, db, "logs", start); n != 2 {
+		t.Fatalf("the dry run deleted data: %d", n)
+	}
+
+	r2, err := db.PruneWithReport(before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r2.DryRun || len(r2.Files) != len(r.Files) || r2.Bytes != r.Bytes {
+		t.Fatalf("invalid report %+v", r2)
+	}
+	if n := countRecords(t, db, "logs", start); n != 0 {
+		t.Fatalf("expected the data to be deleted: %d", n)
+	}
+}
+
+func TestFileTable(t *testing.T) {
+	for name, table := range map[string]string{
+		"nginx.log":           "nginx",
+		"nginx.log.2.zst":     "nginx",
+		"web/nginx.stats":     "web/nginx",
+		"web/nginx.log.1.idx": "web/nginx",
+		"app.bloom":           "app",
+		"app.v2.log":          "app.v2",
+	} {
+		if got := fileTable(name); got != table {
+			t.Fatalf("%s: expected %s, got %s", name, table, got)
+		}
+	}
+}
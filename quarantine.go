@@ -0,0 +1,483 @@
+package timedb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// QuarantineDir is the directory where Repair moves the records that can't
+// be read, so no data is lost while repairing the files.
+const QuarantineDir = "quarantine"
+
+// QuarantinedRecord is a record that can't be read and where it was found.
+type QuarantinedRecord struct {
+	// File is the data file and Offset and Line the position of the
+	// record in it when it was found. Line is zero for the partial
+	// records removed from the end of the files and for the frames of
+	// the compressed files that can't be decompressed, whose Data is
+	// compressed.
+	File   string
+	Offset int64
+	Line   int
+
+	Reason string
+
+	// Time is when the record was moved to the quarantine.
+	Time time.Time `json:",omitempty"`
+
+	// Data are the bytes of the record without the new line.
+	Data []byte
+}
+
+// VerifyReport is the result of Verify and Repair.
+type VerifyReport struct {
+	Files   int
+	Records int64
+
+	// Invalid are the records that can't be read.
+	Invalid []QuarantinedRecord
+}
+
+// Verify reads the files of the table between start and end and reports
+// the records that can't be read: lines without a valid time or that
+// can't be decrypted, and the frames of the compressed files that can't
+// be decompressed, after which the file is read from the next sync
+// marker. The table can be a pattern.
+func (db *DB) Verify(table string, start, end time.Time) (VerifyReport, error) {
+	var report VerifyReport
+
+	err := db.eachDataFile(table, start, end, func(day time.Time, table, name string) error {
+		report.Files++
+		n, err := db.checkFile(name, func(line []byte, bad *QuarantinedRecord) error {
+			if bad != nil {
+				report.Invalid = append(report.Invalid, *bad)
+			}
+			return nil
+		})
+		report.Records += n
+		return err
+	})
+	if err != nil {
+		return report, fmt.Errorf("timeDB.Verify: %w", err)
+	}
+
+	return report, nil
+}
+
+// Repair rewrites the files of the table between start and end without the
+// records that can't be read, which are moved to the quarantine with the
+// position where they were found (see Quarantined). The table can be a pattern.
+func (db *DB) Repair(table string, start, end time.Time) (VerifyReport, error) {
+	var report VerifyReport
+
+	unlock, err := db.lockMaintenance()
+	if err != nil {
+		return report, err
+	}
+	defer unlock()
+
+	err = db.eachDataFile(table, start, end, func(day time.Time, table, name string) error {
+		db.mutex.Lock()
+		defer db.mutex.Unlock()
+
+		report.Files++
+		return db.repairFile(name, &report)
+	})
+
+	db.resetUsage()
+
+	if err != nil {
+		return report, fmt.Errorf("timeDB.Repair: %w", err)
+	}
+
+	if len(report.Invalid) > 0 {
+		db.log().Warn("timedb: records moved to the quarantine", "table", table, "records", len(report.Invalid))
+	}
+	return report, nil
+}
+
+// repairFile rewrites a data file if it has invalid records.
+// The caller must hold the lock.
+func (db *DB) repairFile(name string, report *VerifyReport) error {
+	var bad []QuarantinedRecord
+	n, err := db.checkFile(name, func(line []byte, r *QuarantinedRecord) error {
+		if r != nil {
+			bad = append(bad, *r)
+		}
+		return nil
+	})
+	report.Records += n
+	if err != nil || len(bad) == 0 {
+		return err
+	}
+
+	// archived and tiered files are not modified
+	local := localStorage(db.storage)
+	if _, err := fs.Stat(local, name); errors.Is(err, fs.ErrNotExist) {
+		if _, err := fs.Stat(local, name+".zst"); err != nil {
+			return fmt.Errorf("%s is not a local file", name)
+		}
+	}
+
+	// the file is going to be replaced, uncompressed
+	db.closeFile(partBase(name))
+
+	now := time.Now()
+	for i := range bad {
+		bad[i].Time = now
+	}
+	if err := db.quarantine(name, bad); err != nil {
+		return err
+	}
+
+	tmpName := name + ".tmp"
+	tmp, err := db.storage.Create(tmpName)
+	if err != nil {
+		return fmt.Errorf("error creating temp file: %v", err)
+	}
+	defer db.storage.Remove(tmpName)
+
+	w := bufio.NewWriter(tmp)
+	_, err = db.checkFile(name, func(line []byte, r *QuarantinedRecord) error {
+		if r != nil {
+			return nil
+		}
+		_, err := w.Write(line)
+		return err
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return fmt.Errorf("error writing %s: %v", name, err)
+	}
+
+	// the queries running keep reading the old file and the
+	// stats and indexes of the day are built again
+	base := partBase(name)
+	files := []string{name, name + ".zst", statsFile(base), bloomFile(base), indexFile(base), columnsFile(base)}
+	if err := db.retire(db.storage, files...); err != nil {
+		return fmt.Errorf("error replacing %s: %v", name, err)
+	}
+	if err := db.storage.Rename(tmpName, name); err != nil {
+		return err
+	}
+
+	db.forgetFileUsage(base)
+	report.Invalid = append(report.Invalid, bad...)
+	return nil
+}
+
+// repairTail truncates the last line of a data file if it doesn't end with
+// a new line, which happens when the process crashes in the middle of a
+// write, so the next record is not appended to it. The bytes removed are
+// moved to the quarantine. The caller must hold the lock, or the one of
+// the writer of the table.
+func (db *DB) repairTail(name string) error {
+	local := localStorage(db.storage)
+
+	f, err := local.Open(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	keep, data, err := tornTail(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", name, err)
+	}
+	if data == nil {
+		return nil
+	}
+
+	r := QuarantinedRecord{File: name, Offset: keep, Reason: "torn write", Time: time.Now(), Data: data}
+	if err := db.quarantine(name, []QuarantinedRecord{r}); err != nil {
+		return err
+	}
+
+	if err := local.Truncate(name, keep); err != nil {
+		return fmt.Errorf("error truncating %s: %v", name, err)
+	}
+
+	db.forgetFileUsage(partBase(name))
+	db.log().Warn("timedb: partial record removed from the end of the file", "file", name, "offset", keep, "bytes", len(data))
+	return nil
+}
+
+// repairTails repairs the tail of the last file of each table the first
+// time the database writes. The tail is also repaired when a file is
+// opened for appending, but the last file of a table may not be written
+// again, like the one of the day before a crash near midnight.
+func (db *DB) repairTails() {
+	if db.tailsChecked.Load() {
+		return
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if db.tailsChecked.Swap(true) || (db.lock != nil && db.lock.mode == LockRead) {
+		return
+	}
+
+	if err := db.repairLastFiles(); err != nil {
+		db.log().Warn("timedb: error repairing the last files", "error", err)
+	}
+}
+
+// repairLastFiles repairs the tail of the last file of each table, from
+// the last day that has the table. The caller must hold the lock.
+func (db *DB) repairLastFiles() error {
+	local := localStorage(db.storage)
+
+	days, err := db.storageDays(local)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	for i := len(days) - 1; i >= 0; i-- {
+		dir := db.getDir(days[i])
+		files, err := dayFiles(local, dir)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range files {
+			base := partBase(name)
+			if !strings.HasSuffix(base, ".log") || seen[base[len(dir):]] {
+				continue
+			}
+			seen[base[len(dir):]] = true
+
+			// the compressed files are not found and can't be torn
+			if err := db.repairTail(partName(base, lastPart(local, base))); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// tornTail returns the offset and the bytes of the last line of the file
+// if it doesn't end with a new line. It reads backwards from the end, so
+// only the last line is read.
+func tornTail(f fs.File) (int64, []byte, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	ra, ok := f.(io.ReaderAt)
+	size := info.Size()
+	if !ok || size == 0 {
+		return 0, nil, nil
+	}
+
+	var keep int64
+	buf := make([]byte, 4096)
+	for end := size; end > 0; end -= int64(len(buf)) {
+		start := max(end-int64(len(buf)), 0)
+		b := buf[:end-start]
+		if _, err := ra.ReadAt(b, start); err != nil && err != io.EOF {
+			return 0, nil, err
+		}
+		if end == size && b[len(b)-1] == '\n' {
+			return 0, nil, nil
+		}
+		if i := bytes.LastIndexByte(b, '\n'); i != -1 {
+			keep = start + int64(i) + 1
+			break
+		}
+	}
+
+	data := make([]byte, size-keep)
+	if _, err := ra.ReadAt(data, keep); err != nil && err != io.EOF {
+		return 0, nil, err
+	}
+	return keep, data, nil
+}
+
+// quarantine appends the records to the quarantine file of the data file.
+func (db *DB) quarantine(name string, records []QuarantinedRecord) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+
+	w, err := db.storage.Append(quarantineFile(name))
+	if err != nil {
+		return fmt.Errorf("error writing the quarantine: %v", err)
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		w.Close()
+		return fmt.Errorf("error writing the quarantine: %v", err)
+	}
+	return w.Close()
+}
+
+// quarantineFile returns the quarantine file of the day of a data file,
+// shared by all its parts.
+func quarantineFile(name string) string {
+	return path.Join(QuarantineDir, strings.TrimSuffix(partBase(name), ".log")+".json")
+}
+
+// Quarantined returns the records of the table moved to the quarantine
+// in the day by Repair or when a partial record was found at the end of
+// a file opened for writing.
+func (db *DB) Quarantined(day time.Time, table string) ([]QuarantinedRecord, error) {
+	f, err := db.storage.Open(quarantineFile(db.getTablePath(day, table)))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []QuarantinedRecord
+	dec := json.NewDecoder(f)
+	for {
+		var r QuarantinedRecord
+		if err := dec.Decode(&r); err != nil {
+			if err == io.EOF {
+				return records, nil
+			}
+			return nil, fmt.Errorf("timeDB.Quarantined: %v", err)
+		}
+		records = append(records, r)
+	}
+}
+
+// eachDataFile calls fn with each data file of the tables between
+// start and end, including the parts.
+func (db *DB) eachDataFile(table string, start, end time.Time, fn func(day time.Time, table, name string) error) error {
+	for _, day := range days(start.Local(), end.Local()) {
+		tables := []string{table}
+		if isPattern(table) {
+			var err error
+			if tables, err = db.matchTables(day, table); err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return err
+			}
+		}
+
+		for _, t := range tables {
+			name := db.getTablePath(day, t)
+			for part := 0; ; part++ {
+				p := partName(name, part)
+				if _, err := fs.Stat(db.storage, p); err != nil {
+					if errors.Is(err, fs.ErrNotExist) {
+						break
+					}
+					return err
+				}
+				if err := fn(day, t, p); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkFile reads a data file and calls fn with each line and, if it
+// can't be read, the record to quarantine. It returns the number of
+// valid records.
+func (db *DB) checkFile(name string, fn func(line []byte, bad *QuarantinedRecord) error) (int64, error) {
+	f, err := db.storage.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	// the frames that can't be decompressed are reported at the end
+	var in io.Reader = f
+	var frames []QuarantinedRecord
+	if cf, ok := f.(*compressedFile); ok {
+		in, err = cf.frames(func(offset int64, frame []byte) {
+			frames = append(frames, QuarantinedRecord{File: name, Offset: offset, Reason: "corrupt compressed frame", Data: frame})
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	r := bufio.NewReader(in)
+
+	var records, offset int64
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			var bad *QuarantinedRecord
+			if !isHeader(line) {
+				data := bytes.TrimSuffix(line, []byte("\n"))
+				if reason := db.checkLine(data); reason != "" {
+					bad = &QuarantinedRecord{File: name, Offset: offset, Line: n, Reason: reason, Data: data}
+				} else {
+					records++
+				}
+			}
+
+			if err := fn(line, bad); err != nil {
+				return records, err
+			}
+			offset += int64(len(line))
+		}
+
+		if err != nil {
+			if err != io.EOF {
+				return records, fmt.Errorf("error reading %s: %v", name, err)
+			}
+			for i := range frames {
+				if err := fn(nil, &frames[i]); err != nil {
+					return records, err
+				}
+			}
+			return records, nil
+		}
+	}
+}
+
+// checkLine returns why a line can't be read or an empty string.
+func (db *DB) checkLine(line []byte) string {
+	i := bytes.IndexByte(line, ' ')
+	if i == -1 {
+		return "missing time"
+	}
+
+	epoch, _, err := parseTimeField(string(line[:i]))
+	if err != nil {
+		return "invalid time"
+	}
+
+	text := string(line[i+1:])
+	if db.keys != nil && strings.HasPrefix(text, encryptedPrefix) {
+		if _, err := db.decrypt(epoch, text); err != nil {
+			return "can't decrypt: " + err.Error()
+		}
+	}
+
+	return ""
+}
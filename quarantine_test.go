@@ -0,0 +1,177 @@
+package timedb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRepair(t *testing.T) {
+	dir := t.TempDir()
+	db := New(dir)
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 3; i++ {
+		if err := db.Insert(start, "nginx", "GET /%d", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	// a torn write and garbage in the middle of the file
+	name := filepath.Join(dir, "2020-01-01", "nginx.log")
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("\x00\x00garbage\n157786\n")
+	f.Close()
+
+	if err := db.Insert(start, "nginx", "GET /3"); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := db.Verify("ng*", start, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Files != 1 || report.Records != 4 || len(report.Invalid) != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	report, err = db.Repair("nginx", start, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Invalid) != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	if n := countRecords(t, db, "nginx", start); n != 4 {
+		t.Fatalf("expected 4 records, got %d", n)
+	}
+
+	q, err := db.Quarantined(start, "nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(q) != 2 || string(q[0].Data) != "\x00\x00garbage" || q[1].Reason != "missing time" || q[0].Line != 5 {
+		t.Fatalf("unexpected quarantine %+v", q)
+	}
+	if q[0].File != "2020-01-01/nginx.log" || q[0].Offset != db.headerSize()+3*18 || q[0].Time.IsZero() {
+		t.Fatalf("unexpected provenance %+v", q[0])
+	}
+
+	report, err = db.Verify("nginx", start, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Invalid) != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
+
+func TestTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	db := New(dir)
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 3; i++ {
+		if err := db.Insert(start, "nginx", "GET /%d", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	// a crash in the middle of a write
+	name := filepath.Join(dir, "2020-01-01", "nginx.log")
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("1577869200 GET")
+	f.Close()
+
+	db = New(dir)
+	defer db.Close()
+
+	if err := db.Insert(start, "nginx", "GET /3"); err != nil {
+		t.Fatal(err)
+	}
+
+	s := db.Query("nginx", start, start.Add(time.Hour), 0, 0)
+	var got string
+	for s.Scan() {
+		got += s.Data().Text
+	}
+	s.Close()
+	if s.Error != nil {
+		t.Fatal(s.Error)
+	}
+	if got != " GET /0 GET /1 GET /2 GET /3" {
+		t.Fatalf("unexpected records %q", got)
+	}
+
+	report, err := db.Verify("nginx", start, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Invalid) != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	q, err := db.Quarantined(start, "nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(q) != 1 || string(q[0].Data) != "1577869200 GET" || q[0].Reason != "torn write" || q[0].Offset != db.headerSize()+3*18 {
+		t.Fatalf("unexpected quarantine %+v", q)
+	}
+}
+
+func TestTornWriteLastDay(t *testing.T) {
+	dir := t.TempDir()
+	db := New(dir)
+
+	start := time.Date(2020, 1, 1, 23, 59, 0, 0, time.Local)
+	for _, table := range []string{"nginx", "prod/api"} {
+		if err := db.Insert(start, table, "GET /0"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	// a crash near midnight in the files of the day before
+	for _, table := range []string{"nginx", "prod/api"} {
+		name := filepath.Join(dir, "2020-01-01", filepath.FromSlash(table)+".log")
+		f, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString("1577919540 GET")
+		f.Close()
+	}
+
+	// the next day is written to another table
+	db = New(dir)
+	defer db.Close()
+
+	if err := db.Insert(start.Add(time.Hour), "other", "GET /1"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range []string{"nginx", "prod/api"} {
+		if n := countRecords(t, db, table, start); n != 1 {
+			t.Fatalf("%s: expected 1 record, got %d", table, n)
+		}
+
+		q, err := db.Quarantined(start, table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(q) != 1 || q[0].Reason != "torn write" {
+			t.Fatalf("%s: unexpected quarantine %+v", table, q)
+		}
+	}
+}
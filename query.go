@@ -0,0 +1,250 @@
+package timedb
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Statement is a query parsed by ParseQuery.
+type Statement struct {
+	Table  string
+	Filter string
+
+	// Extract is a regexp whose groups are returned as Rows.
+	Extract string
+
+	Bucket time.Duration
+	Fill   FillPolicy
+	Limit  int
+
+	// Aggregate is true if the query has an aggregation function.
+	Aggregate bool
+	Func      AggregateFunc
+}
+
+var aggregateFuncs = map[string]AggregateFunc{
+	"avg":   AggAvg,
+	"sum":   AggSum,
+	"min":   AggMin,
+	"max":   AggMax,
+	"count": AggCount,
+	"last":  AggLast,
+}
+
+var fillPolicies = map[string]FillPolicy{
+	"none":     FillNone,
+	"null":     FillNull,
+	"zero":     FillZero,
+	"previous": FillPrevious,
+	"linear":   FillLinear,
+}
+
+// ParseQuery parses a query with stages separated by "|". The first one
+// selects the table and the rest are:
+//
+//	filter "text"    the records must contain the text
+//	extract "re"     returns the groups captured by the regexp as rows
+//	bucket 1m        the size of the buckets of the aggregation
+//	fill zero        the fill policy: none, null, zero, previous or linear
+//	limit 100        the maximum number of records
+//	count            or sum, avg, min, max and last, aggregates the records
+//
+// For example:
+//
+//	table=nginx | filter "status=500" | bucket 1m | count
+func ParseQuery(query string) (*Statement, error) {
+	stages, err := splitStages(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(stages) == 0 || len(stages[0]) != 1 || !strings.HasPrefix(stages[0][0], "table=") {
+		return nil, fmt.Errorf("timeDB: the query must start with table=name")
+	}
+
+	st := &Statement{Table: strings.TrimPrefix(stages[0][0], "table=")}
+	if err := validTable(st.Table); err != nil && !isPattern(st.Table) {
+		return nil, err
+	}
+
+	for _, stage := range stages[1:] {
+		if len(stage) == 0 {
+			return nil, fmt.Errorf("timeDB: empty stage in query")
+		}
+
+		name, args := stage[0], stage[1:]
+
+		if fn, ok := aggregateFuncs[name]; ok {
+			if len(args) != 0 {
+				return nil, fmt.Errorf("timeDB: %s has no arguments", name)
+			}
+			if st.Aggregate {
+				return nil, fmt.Errorf("timeDB: only one aggregation is allowed")
+			}
+			st.Aggregate = true
+			st.Func = fn
+			continue
+		}
+
+		if len(args) != 1 {
+			return nil, fmt.Errorf("timeDB: %s expects one argument", name)
+		}
+		arg := args[0]
+
+		switch name {
+		case "filter":
+			st.Filter = arg
+		case "extract":
+			if _, err := regexp.Compile(arg); err != nil {
+				return nil, fmt.Errorf("timeDB: invalid extract: %v", err)
+			}
+			st.Extract = arg
+		case "bucket":
+			d, err := time.ParseDuration(arg)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("timeDB: invalid bucket %s", arg)
+			}
+			st.Bucket = d
+		case "fill":
+			f, ok := fillPolicies[arg]
+			if !ok {
+				return nil, fmt.Errorf("timeDB: invalid fill %s", arg)
+			}
+			st.Fill = f
+		case "limit":
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("timeDB: invalid limit %s", arg)
+			}
+			st.Limit = n
+		default:
+			return nil, fmt.Errorf("timeDB: unknown stage %s", name)
+		}
+	}
+
+	if (st.Bucket != 0 || st.Fill != FillNone) && !st.Aggregate {
+		return nil, fmt.Errorf("timeDB: bucket and fill need an aggregation")
+	}
+
+	if st.Extract != "" && st.Aggregate {
+		return nil, fmt.Errorf("timeDB: extract can't be used with an aggregation")
+	}
+
+	return st, nil
+}
+
+// splitStages splits the query in stages and each stage in words.
+// Words can be quoted with double quotes.
+func splitStages(query string) ([][]string, error) {
+	var stages [][]string
+	var words []string
+
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '|':
+			stages = append(stages, words)
+			words = nil
+			i++
+		case c == '"':
+			s, err := strconv.QuotedPrefix(query[i:])
+			if err != nil {
+				return nil, fmt.Errorf("timeDB: invalid string in query at %d", i)
+			}
+			i += len(s)
+			s, _ = strconv.Unquote(s)
+			words = append(words, s)
+		default:
+			j := i
+			for j < len(query) && !strings.ContainsRune(" \t\n|\"", rune(query[j])) {
+				j++
+			}
+			words = append(words, query[i:j])
+			i = j
+		}
+	}
+
+	return append(stages, words), nil
+}
+
+// QueryResult is the result of a statement. Queries without
+// aggregation return Records, or Rows if they extract fields,
+// and the rest Series.
+type QueryResult struct {
+	Records []DataPoint `json:",omitempty"`
+	Rows    []Row       `json:",omitempty"`
+	Series  []Series    `json:",omitempty"`
+}
+
+// Run executes the statement in the range [start, end). Without bucket the
+// aggregation is done over the whole range. Count works with any table
+// and the rest of the functions with numeric tables.
+func (db *DB) Run(st *Statement, start, end time.Time) (*QueryResult, error) {
+	if !st.Aggregate {
+		s := db.Query(st.Table, start, end, 0, st.Limit)
+		defer s.Close()
+
+		s.SetFilter(st.Filter)
+
+		if st.Extract != "" {
+			re, err := regexp.Compile(st.Extract)
+			if err != nil {
+				return nil, fmt.Errorf("timeDB: invalid extract: %v", err)
+			}
+			s.SetProjection(re)
+		}
+
+		res := &QueryResult{}
+		for s.Scan() {
+			d := s.Data()
+			if !d.Time.Before(end) {
+				break
+			}
+			if st.Extract != "" {
+				res.Rows = append(res.Rows, s.Row())
+				continue
+			}
+			d.Text = trimText(d.Text)
+			res.Records = append(res.Records, d)
+		}
+		return res, s.Error
+	}
+
+	bucket := st.Bucket
+	if bucket == 0 {
+		bucket = end.Sub(start)
+	}
+
+	if st.Func == AggCount {
+		buckets, err := db.Histogram(st.Table, start, end, bucket, st.Filter)
+		if err != nil {
+			return nil, err
+		}
+
+		points := make([]Point, len(buckets))
+		for i, b := range buckets {
+			points[i] = Point{Time: b.Time, Value: float64(b.Count)}
+		}
+		return &QueryResult{Series: []Series{{Points: points}}}, nil
+	}
+
+	series, err := db.aggregate(st.Table, start, end, bucket, st.Func, st.Fill, st.Filter)
+	if err != nil {
+		return nil, err
+	}
+	return &QueryResult{Series: series}, nil
+}
+
+// RunQuery parses and executes a query (see ParseQuery).
+func (db *DB) RunQuery(query string, start, end time.Time) (*QueryResult, error) {
+	st, err := ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	return db.Run(st, start, end)
+}
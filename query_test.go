@@ -0,0 +1,70 @@
+package timedb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	st, err := ParseQuery(`table=nginx |filter "status=500"| bucket 1m | count`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if st.Table != "nginx" || st.Filter != "status=500" || st.Bucket != time.Minute || !st.Aggregate || st.Func != AggCount {
+		t.Fatalf("invalid statement %+v", st)
+	}
+
+	for _, q := range []string{
+		"nginx",
+		"table=nginx | bucket 1m",
+		"table=nginx | count | sum",
+		"table=nginx | filter",
+		`table=nginx | filter "a`,
+		"table=nginx | sort",
+	} {
+		if _, err := ParseQuery(q); err == nil {
+			t.Fatalf("expected an error in %q", q)
+		}
+	}
+}
+
+func TestRunQuery(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i, status := range []int{200, 500, 500, 200} {
+		if err := db.Insert(start.Add(time.Duration(i)*40*time.Second), "nginx", "GET / status=%d", status); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.InsertValue(start.Add(time.Duration(i)*40*time.Second), "cpu", float64(i), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	end := start.Add(3 * time.Minute)
+
+	res, err := db.RunQuery(`table=nginx | filter "status=500" | bucket 1m | count`, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := res.Series[0].Points; len(p) != 3 || p[0].Value != 1 || p[1].Value != 1 || p[2].Value != 0 {
+		t.Fatalf("invalid result %v", p)
+	}
+
+	res, err = db.RunQuery(`table=nginx | filter "status=200" | limit 1`, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Records) != 1 || res.Records[0].Text != "GET / status=200" {
+		t.Fatalf("invalid result %v", res.Records)
+	}
+
+	res, err = db.RunQuery(`table=cpu | max`, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := res.Series[0].Points; len(p) != 1 || p[0].Value != 3 {
+		t.Fatalf("invalid result %v", p)
+	}
+}
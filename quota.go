@@ -0,0 +1,266 @@
+package timedb
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+)
+
+// ErrQuotaExceeded is returned when a write would exceed a quota
+// with the QuotaReject policy.
+var ErrQuotaExceeded = errors.New("timeDB: quota exceeded")
+
+// QuotaPolicy is what happens when a write would exceed a quota.
+type QuotaPolicy int
+
+const (
+	// QuotaReject refuses the write with ErrQuotaExceeded.
+	QuotaReject QuotaPolicy = iota
+
+	// QuotaPrune deletes the oldest days until the write fits. The last
+	// day is never deleted, so it can exceed the quota by itself.
+	QuotaPrune
+)
+
+// Quota is a maximum size in bytes.
+type Quota struct {
+	MaxBytes int64
+	Policy   QuotaPolicy
+}
+
+// SetQuota sets the maximum size of the whole database.
+// A quota of zero bytes is unlimited.
+func (db *DB) SetQuota(q Quota) {
+	db.mutex.Lock()
+	db.quota = q
+	db.mutex.Unlock()
+}
+
+// usage tracks the bytes used by the database and its tables
+// so the quotas are checked without reading the directories on
+// every write.
+type usage struct {
+	mutex  sync.Mutex
+	known  bool
+	total  int64
+	tables map[string]int64
+
+	// the size of the data files of each day with their parts
+	// by the name of the first one (see DiskUsageByDay)
+	files map[string]int64
+}
+
+// checkQuota checks that n bytes can be written to the table.
+func (db *DB) checkQuota(table string, n int64) error {
+	db.mutex.RLock()
+	q := db.quota
+	db.mutex.RUnlock()
+
+	if q.MaxBytes > 0 {
+		if err := db.checkDBQuota(q, n); err != nil {
+			return err
+		}
+	}
+
+	o := db.TableOptions(table)
+	if o.MaxBytes > 0 {
+		q := Quota{MaxBytes: o.MaxBytes, Policy: o.QuotaPolicy}
+		if err := db.checkTableQuota(table, q, n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (db *DB) checkDBQuota(q Quota, n int64) error {
+	for {
+		used, err := db.totalUsage()
+		if err != nil {
+			return err
+		}
+
+		if used+n <= q.MaxBytes {
+			return nil
+		}
+
+		if q.Policy == QuotaReject {
+			return fmt.Errorf("%w: %d of %d bytes used", ErrQuotaExceeded, used, q.MaxBytes)
+		}
+
+		dayList, err := db.days()
+		if err != nil {
+			return err
+		}
+		if len(dayList) < 2 {
+			return nil
+		}
+
+		if err := db.Prune(dayList[0].AddDate(0, 0, 1)); err != nil {
+			return err
+		}
+	}
+}
+
+func (db *DB) checkTableQuota(table string, q Quota, n int64) error {
+	for {
+		used, err := db.tableUsage(table)
+		if err != nil {
+			return err
+		}
+
+		if used+n <= q.MaxBytes {
+			return nil
+		}
+
+		if q.Policy == QuotaReject {
+			return fmt.Errorf("%w: table %s: %d of %d bytes used", ErrQuotaExceeded, table, used, q.MaxBytes)
+		}
+
+		pruned, err := db.pruneOldestTableDay(table)
+		if err != nil {
+			return err
+		}
+		if !pruned {
+			return nil
+		}
+	}
+}
+
+// pruneOldestTableDay deletes the oldest day of the table unless it is the only one.
+func (db *DB) pruneOldestTableDay(table string) (bool, error) {
+	unlock, err := db.lockMaintenance()
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	files, err := db.tableFiles(table)
+	if err != nil {
+		return false, err
+	}
+
+	oldest := ""
+	for _, f := range files {
+		dir := f[:strings.IndexByte(f, '/')]
+		if oldest == "" {
+			oldest = dir
+		} else if dir != oldest {
+			// there is more than one day
+			for _, f := range files {
+				if !strings.HasPrefix(f, oldest+"/") {
+					break
+				}
+				db.closeFile(partBase(f))
+				if err := db.retire(localStorage(db.storage), append([]string{f}, sidecarFiles(f)...)...); err != nil {
+					return false, err
+				}
+			}
+			removeDirs(localStorage(db.storage), oldest)
+			db.resetUsage()
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// tableFiles returns the local files of the table sorted by day.
+func (db *DB) tableFiles(table string) ([]string, error) {
+	dayList, err := db.storageDays(localStorage(db.storage))
+	if err != nil {
+		return nil, err
+	}
+
+	local := localStorage(db.storage)
+
+	var files []string
+	for _, day := range dayList {
+		name := db.getTablePath(day, table)
+		for _, f := range []string{name, name + ".zst"} {
+			if _, err := fs.Stat(local, f); err == nil {
+				files = append(files, f)
+			}
+		}
+		files = append(files, partFiles(local, name)...)
+	}
+	return files, nil
+}
+
+func (db *DB) totalUsage() (int64, error) {
+	u := &db.usage
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if !u.known {
+		size, err := db.size()
+		if err != nil {
+			return 0, err
+		}
+		u.total = size
+		u.known = true
+	}
+	return u.total, nil
+}
+
+func (db *DB) tableUsage(table string) (int64, error) {
+	u := &db.usage
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if size, ok := u.tables[table]; ok {
+		return size, nil
+	}
+
+	files, err := db.tableFiles(table)
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	for _, f := range files {
+		info, err := fs.Stat(localStorage(db.storage), f)
+		if err != nil {
+			return 0, err
+		}
+		size += info.Size()
+	}
+
+	if u.tables == nil {
+		u.tables = make(map[string]int64)
+	}
+	u.tables[table] = size
+	return size, nil
+}
+
+// addUsage counts the bytes written to a data file of a table.
+func (db *DB) addUsage(table, name string, n int64) {
+	u := &db.usage
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if u.known {
+		u.total += n
+	}
+	if _, ok := u.tables[table]; ok {
+		u.tables[table] += n
+	}
+	if _, ok := u.files[name]; ok {
+		u.files[name] += n
+	}
+}
+
+// resetUsage forgets the usage after files are deleted or rewritten.
+func (db *DB) resetUsage() {
+	u := &db.usage
+	u.mutex.Lock()
+	u.known = false
+	u.tables = nil
+	u.files = nil
+	u.mutex.Unlock()
+}
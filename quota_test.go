@@ -0,0 +1,58 @@
+package timedb
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQuota(t *testing.T) {
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+
+	// each line is 22 bytes
+	insert := func(db *DB, table string, days int) error {
+		for i := 0; i < days; i++ {
+			if err := db.Insert(start.AddDate(0, 0, i), table, "aaaaaaaaaa"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	db := New(t.TempDir())
+	db.SetQuota(Quota{MaxBytes: 50})
+	if err := insert(db, "log", 3); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+
+	db = New(t.TempDir())
+	db.SetQuota(Quota{MaxBytes: 50, Policy: QuotaPrune})
+	if err := insert(db, "log", 5); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := db.days(); len(n) != 2 {
+		t.Fatalf("expected 2 days, got %d", len(n))
+	}
+
+	db = New(t.TempDir())
+	db.SetTableOptions("limited", TableOptions{MaxBytes: 50, QuotaPolicy: QuotaPrune})
+	if err := insert(db, "limited", 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := insert(db, "other", 5); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := db.tableFiles("limited")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %v", files)
+	}
+
+	db.SetTableOptions("rejected", TableOptions{MaxBytes: 50})
+	if err := insert(db, "rejected", 3); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+}
@@ -0,0 +1,312 @@
+package timedb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// RangeStore is a RemoteStore that can read a part of the objects, like
+// object storages and HTTP servers with range requests. Its files are read
+// on demand, so queries touching cold data download only the byte ranges
+// they read instead of the whole files.
+type RangeStore interface {
+	RemoteStore
+
+	// Size returns the size of the object. It must return an error that
+	// matches fs.ErrNotExist if the object doesn't exist.
+	Size(name string) (int64, error)
+
+	// GetRange returns length bytes of the object starting at offset.
+	GetRange(name string, offset, length int64) (io.ReadCloser, error)
+}
+
+const (
+	// rangeReadAhead is the size of the requests of sequential reads.
+	rangeReadAhead = 1 << 20
+
+	// rangeBlockSize is the size of the requests of random reads, like
+	// the binary search of the start of the queries.
+	rangeBlockSize = 64 << 10
+)
+
+// rangeFile reads a file from a RangeStore. It keeps the last block
+// read so the small reads don't make a request each.
+type rangeFile struct {
+	store RangeStore
+	name  string
+	size  int64
+	pos   int64
+
+	block    []byte
+	blockOff int64
+}
+
+func openRange(store RangeStore, name string) (*rangeFile, error) {
+	size, err := store.Size(name)
+	if err != nil {
+		return nil, err
+	}
+	return &rangeFile{store: store, name: name, size: size}, nil
+}
+
+func (f *rangeFile) Read(p []byte) (int, error) {
+	n, err := f.readAt(p, f.pos, rangeReadAhead)
+	f.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *rangeFile) ReadAt(p []byte, off int64) (int, error) {
+	var read int
+	for read < len(p) {
+		n, err := f.readAt(p[read:], off+int64(read), rangeBlockSize)
+		read += n
+		if err != nil {
+			return read, err
+		}
+	}
+	return read, nil
+}
+
+// readAt copies the bytes at off from the current block, requesting
+// a new one of size bytes if it doesn't contain them.
+func (f *rangeFile) readAt(p []byte, off, size int64) (int, error) {
+	if off >= f.size {
+		return 0, io.EOF
+	}
+
+	if off < f.blockOff || off >= f.blockOff+int64(len(f.block)) {
+		if err := f.fetch(off, size); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, f.block[off-f.blockOff:])
+	if off+int64(n) >= f.size {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *rangeFile) fetch(off, size int64) error {
+	size = min(size, f.size-off)
+
+	r, err := f.store.GetRange(f.name, off, size)
+	if err != nil {
+		return fmt.Errorf("timeDB: error reading %s: %w", f.name, err)
+	}
+	defer r.Close()
+
+	b := f.block[:0]
+	if int64(cap(b)) < size {
+		b = make([]byte, size)
+	}
+	b = b[:size]
+
+	if _, err := io.ReadFull(r, b); err != nil {
+		return fmt.Errorf("timeDB: error reading %s: %w", f.name, err)
+	}
+
+	f.block = b
+	f.blockOff = off
+	return nil
+}
+
+func (f *rangeFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return 0, errors.New("timeDB: invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("timeDB: negative position")
+	}
+
+	f.pos = offset
+	return offset, nil
+}
+
+func (f *rangeFile) Stat() (fs.FileInfo, error) {
+	return memInfo{name: path.Base(f.name), size: f.size}, nil
+}
+
+func (f *rangeFile) Close() error {
+	f.block = nil
+	return nil
+}
+
+// HTTPStore is a RangeStore in a plain HTTP server, like a directory
+// served by nginx with autoindex or http.FileServer. The objects are
+// listed from the links of the directory pages and uploaded with PUT
+// requests, so tiering to it needs a server that accepts them (WebDAV).
+type HTTPStore struct {
+	// URL is the base url of the objects, like "http://host/timedb".
+	URL string
+
+	// Header are added to all the requests, for example for authentication.
+	Header http.Header
+
+	Client *http.Client
+}
+
+func (s *HTTPStore) Put(name string, r io.Reader) error {
+	res, err := s.do("PUT", name, r, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return responseError(res)
+	}
+	return nil
+}
+
+func (s *HTTPStore) Get(name string) (io.ReadCloser, error) {
+	res, err := s.do("GET", name, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(res, name, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+func (s *HTTPStore) Size(name string) (int64, error) {
+	res, err := s.do("HEAD", name, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+
+	if err := checkResponse(res, name, http.StatusOK); err != nil {
+		return 0, err
+	}
+	if res.ContentLength < 0 {
+		return 0, fmt.Errorf("timeDB: unknown size of %s", name)
+	}
+	return res.ContentLength, nil
+}
+
+func (s *HTTPStore) GetRange(name string, offset, length int64) (io.ReadCloser, error) {
+	h := http.Header{}
+	h.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+
+	res, err := s.do("GET", name, nil, h)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(res, name, http.StatusPartialContent); err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+var hrefRegex = regexp.MustCompile(`href="([^"?#]+)"`)
+
+// List walks the directory pages from the one of the prefix.
+func (s *HTTPStore) List(prefix string) ([]string, error) {
+	dir := prefix[:strings.LastIndexByte(prefix, '/')+1]
+
+	var names []string
+	if err := s.list(dir, prefix, &names); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return names, nil
+}
+
+func (s *HTTPStore) list(dir, prefix string, names *[]string) error {
+	res, err := s.do("GET", dir, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if err := checkResponse(res, dir, http.StatusOK); err != nil {
+		return err
+	}
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range hrefRegex.FindAllSubmatch(b, -1) {
+		link, err := url.PathUnescape(string(m[1]))
+		if err != nil || link == "" || strings.HasPrefix(link, "/") || strings.HasPrefix(link, ".") || strings.Contains(link, ":") {
+			continue
+		}
+
+		name := dir + link
+		if !strings.HasPrefix(name, prefix) && !strings.HasPrefix(prefix, name) {
+			continue
+		}
+
+		if strings.HasSuffix(link, "/") {
+			if err := s.list(name, prefix, names); err != nil {
+				return err
+			}
+		} else if strings.HasPrefix(name, prefix) {
+			*names = append(*names, name)
+		}
+	}
+	return nil
+}
+
+func (s *HTTPStore) do(method, name string, body io.Reader, header http.Header) (*http.Response, error) {
+	u := strings.TrimSuffix(s.URL, "/") + "/" + (&url.URL{Path: name}).EscapedPath()
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range s.Header {
+		req.Header[k] = v
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+// checkResponse closes the body and returns an error if the response
+// doesn't have the status.
+func checkResponse(res *http.Response, name string, status int) error {
+	switch res.StatusCode {
+	case status:
+		return nil
+	case http.StatusNotFound:
+		res.Body.Close()
+		return &fs.PathError{Op: "get", Path: name, Err: fs.ErrNotExist}
+	default:
+		defer res.Body.Close()
+		return responseError(res)
+	}
+}
+
+func responseError(res *http.Response) error {
+	return fmt.Errorf("timeDB: %s %s: %s", res.Request.Method, res.Request.URL, res.Status)
+}
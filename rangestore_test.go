@@ -0,0 +1,101 @@
+package timedb
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPStore(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local)
+
+	var buf bytes.Buffer
+	for i := 0; i < 300000; i++ {
+		fmt.Fprintf(&buf, "%d line %d\n", start.Add(time.Duration(i/4)*time.Second).Unix(), i)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "2020-01-01"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "2020-01-01", "logs.log"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the stats allow to seek the start of the query
+	if _, err := New(dir).DayStats(start, "logs"); err != nil {
+		t.Fatal(err)
+	}
+
+	var downloaded atomic.Int64
+	files := http.FileServer(http.Dir(dir))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		files.ServeHTTP(countingWriter{w, &downloaded}, r)
+	}))
+	defer ts.Close()
+
+	db := New(t.TempDir())
+	db.SetRemote(&HTTPStore{URL: ts.URL})
+
+	from := start.Add(60000 * time.Second)
+	s := db.Query("logs", from, from.Add(time.Hour), 0, 2)
+	var got []string
+	for s.Scan() {
+		got = append(got, s.Data().Text)
+	}
+	s.Close()
+	if s.Error != nil {
+		t.Fatal(s.Error)
+	}
+
+	if len(got) != 2 || got[0] != " line 240000" || got[1] != " line 240001" {
+		t.Fatalf("unexpected result %q", got)
+	}
+
+	if n := downloaded.Load(); n > int64(buf.Len())/4 {
+		t.Fatalf("downloaded %d bytes of %d", n, buf.Len())
+	}
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	n *atomic.Int64
+}
+
+func (w countingWriter) Write(p []byte) (int, error) {
+	w.n.Add(int64(len(p)))
+	return w.ResponseWriter.Write(p)
+}
+
+func TestHTTPStoreList(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"2020-01-01/logs.log", "2020-01-01/prod/nginx.log", "2020-01-02/logs.log"} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(p), 0777)
+		if err := os.WriteFile(p, []byte("1 a\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ts := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer ts.Close()
+
+	s := &HTTPStore{URL: ts.URL}
+
+	names, err := s.List("2020-01-01/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(names) != "[2020-01-01/logs.log 2020-01-01/prod/nginx.log]" {
+		t.Fatalf("unexpected names %v", names)
+	}
+
+	if _, err := s.Size("missing.log"); !os.IsNotExist(err) {
+		t.Fatalf("expected not exist, got %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package timedb
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Point is a value of a numeric series.
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// MarshalJSON encodes NaN values, used for the empty buckets, as null.
+func (p Point) MarshalJSON() ([]byte, error) {
+	var v *float64
+	if !math.IsNaN(p.Value) {
+		v = &p.Value
+	}
+	return json.Marshal(struct {
+		Time  time.Time
+		Value *float64
+	}{p.Time, v})
+}
+
+// UnmarshalJSON decodes null values as NaN.
+func (p *Point) UnmarshalJSON(b []byte) error {
+	var v struct {
+		Time  time.Time
+		Value *float64
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	p.Time = v.Time
+	p.Value = math.NaN()
+	if v.Value != nil {
+		p.Value = *v.Value
+	}
+	return nil
+}
+
+// Series are the points of a numeric table with the same labels.
+type Series struct {
+	Labels Labels
+	Points []Point
+}
+
+// Series returns the points of the range [start, end) of a numeric table
+// grouped by labels. The series are sorted by labels and the points by
+// time. Records that are not numeric are ignored.
+func (db *DB) Series(table string, start, end time.Time) ([]Series, error) {
+	return db.series(table, start, end, "")
+}
+
+func (db *DB) series(table string, start, end time.Time, filter string) ([]Series, error) {
+	index := make(map[string]int)
+	var result []Series
+
+	err := db.scanRange(table, start, end, filter, func(d DataPoint) {
+		v, labels, err := d.Value()
+		if err != nil {
+			return
+		}
+
+		key := labels.String()
+		i, ok := index[key]
+		if !ok {
+			i = len(result)
+			index[key] = i
+			result = append(result, Series{Labels: labels})
+		}
+		result[i].Points = append(result[i].Points, Point{Time: d.Time, Value: v})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Labels.String() < result[j].Labels.String()
+	})
+
+	// points inserted late are appended at the end of the day
+	for _, s := range result {
+		sort.SliceStable(s.Points, func(i, j int) bool {
+			return s.Points[i].Time.Before(s.Points[j].Time)
+		})
+	}
+	return result, nil
+}
+
+// Increase returns how much the counters of the table increased in each
+// window of the range [start, end). If a counter decreases it is taken
+// as a reset to zero. Windows without samples are omitted.
+func (db *DB) Increase(table string, start, end time.Time, window time.Duration) ([]Series, error) {
+	return db.windowDeltas(table, start, end, window, func(prev, v float64) float64 {
+		if v < prev {
+			// the counter was reset
+			return v
+		}
+		return v - prev
+	})
+}
+
+// Rate is like Increase but returns the increase per second.
+func (db *DB) Rate(table string, start, end time.Time, window time.Duration) ([]Series, error) {
+	series, err := db.Increase(table, start, end, window)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range series {
+		for i := range s.Points {
+			s.Points[i].Value /= window.Seconds()
+		}
+	}
+	return series, nil
+}
+
+// Delta returns the difference between the values of gauges in each
+// window of the range [start, end). Windows without samples are omitted.
+func (db *DB) Delta(table string, start, end time.Time, window time.Duration) ([]Series, error) {
+	return db.windowDeltas(table, start, end, window, func(prev, v float64) float64 {
+		return v - prev
+	})
+}
+
+// windowDeltas sums the deltas between consecutive points of each series.
+// The delta is added to the window of the later point.
+func (db *DB) windowDeltas(table string, start, end time.Time, window time.Duration, delta func(prev, v float64) float64) ([]Series, error) {
+	if window <= 0 {
+		return nil, fmt.Errorf("timeDB: invalid window %v", window)
+	}
+
+	series, err := db.Series(table, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, s := range series {
+		var points []Point
+		for j := 1; j < len(s.Points); j++ {
+			p := s.Points[j]
+			t := start.Add(p.Time.Sub(start) / window * window)
+			d := delta(s.Points[j-1].Value, p.Value)
+
+			if n := len(points); n > 0 && points[n-1].Time.Equal(t) {
+				points[n-1].Value += d
+			} else {
+				points = append(points, Point{Time: t, Value: d})
+			}
+		}
+		series[i].Points = points
+	}
+
+	return series, nil
+}
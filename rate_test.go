@@ -0,0 +1,80 @@
+package timedb
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRate(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+
+	// the counter is reset after 40
+	values := []float64{0, 10, 20, 40, 5, 15}
+	for i, v := range values {
+		if err := db.InsertValue(start.Add(time.Duration(i)*30*time.Second), "requests", v, Labels{"job": "web"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.InsertValue(start, "requests", 100, Labels{"job": "db"}); err != nil {
+		t.Fatal(err)
+	}
+
+	series, err := db.Increase("requests", start, start.Add(time.Hour), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(series) != 2 || series[1].Labels["job"] != "web" {
+		t.Fatalf("invalid series %v", series)
+	}
+
+	if len(series[0].Points) != 0 {
+		t.Fatalf("expected no points, got %v", series[0].Points)
+	}
+
+	p := series[1].Points
+	if len(p) != 3 || p[0].Value != 10 || p[1].Value != 30 || p[2].Value != 15 {
+		t.Fatalf("invalid points %v", p)
+	}
+	if !p[1].Time.Equal(start.Add(time.Minute)) {
+		t.Fatalf("invalid time %v", p[1].Time)
+	}
+
+	series, err = db.Rate("requests", start, start.Add(time.Hour), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := series[1].Points[1].Value; v != 0.5 {
+		t.Fatalf("expected 0.5, got %v", v)
+	}
+
+	series, err = db.Delta("requests", start, start.Add(time.Hour), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := series[1].Points[2].Value; v != -25 {
+		t.Fatalf("expected -25, got %v", v)
+	}
+}
+
+func TestPointJSON(t *testing.T) {
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+
+	b, err := json.Marshal([]Point{{start, 1.5}, {start, math.NaN()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var points []Point
+	if err := json.Unmarshal(b, &points); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(points) != 2 || points[0].Value != 1.5 || !math.IsNaN(points[1].Value) || !points[1].Time.Equal(start) {
+		t.Fatalf("invalid points %s", b)
+	}
+}
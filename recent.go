@@ -0,0 +1,110 @@
+package timedb
+
+import (
+	"bytes"
+	"io/fs"
+	"path"
+	"sync"
+	"time"
+)
+
+// recentCache keeps in memory the last records written to each table.
+type recentCache struct {
+	mutex  sync.Mutex
+	window time.Duration
+	since  time.Time
+	tables map[string]*recentTable
+}
+
+type recentTable struct {
+	// start is the time since all the records of the table are cached.
+	start   time.Time
+	records []recentRecord
+}
+
+type recentRecord struct {
+	time time.Time
+	line string
+}
+
+// SetRecentCache keeps in memory the records of the last window of time of
+// each table written, so queries of recent data don't read the files. Only
+// the records written by this DB are cached so it must be the only writer.
+// Zero disables the cache.
+func (db *DB) SetRecentCache(window time.Duration) {
+	var c *recentCache
+	if window > 0 {
+		c = &recentCache{window: window, since: time.Now(), tables: make(map[string]*recentTable)}
+	}
+	db.recent.Store(c)
+}
+
+// add adds the lines written to a table.
+func (c *recentCache) add(table string, lines []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	limit := now.Add(-c.window)
+
+	rt, ok := c.tables[table]
+	if !ok {
+		rt = &recentTable{start: c.since}
+		c.tables[table] = rt
+	}
+
+	for len(lines) > 0 {
+		i := bytes.IndexByte(lines, '\n')
+		if i == -1 {
+			break
+		}
+		t := time.Unix(lineEpoch(lines[:i]), 0)
+		if !t.Before(limit) {
+			rt.records = append(rt.records, recentRecord{time: t, line: string(lines[:i+1])})
+		}
+		lines = lines[i+1:]
+	}
+
+	// discard the records out of the window
+	if rt.start.Before(limit) {
+		rt.start = limit
+	}
+	i := 0
+	for i < len(rt.records) && rt.records[i].time.Before(limit) {
+		i++
+	}
+	if i > 0 {
+		rt.records = append(rt.records[:0:0], rt.records[i:]...)
+	}
+}
+
+// open returns the cached records of the table for the day after start
+// if all of them are cached. The records before start are not needed.
+func (c *recentCache) open(day time.Time, table string, start time.Time) (fs.File, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	rt, ok := c.tables[table]
+	if !ok || start.Before(rt.start) {
+		return nil, false
+	}
+
+	dir := day.Format("2006-01-02")
+
+	var buf bytes.Buffer
+	for _, r := range rt.records {
+		if r.time.Before(start) || r.time.Format("2006-01-02") != dir {
+			continue
+		}
+		buf.WriteString(r.line)
+	}
+
+	info := memInfo{name: path.Base(table) + ".log", size: int64(buf.Len()), modTime: time.Now()}
+	return &recentFile{&memFile{Reader: bytes.NewReader(buf.Bytes()), info: info}}, true
+}
+
+// recentFile has the cached records of a day, so its offsets are not
+// positions in the data file.
+type recentFile struct {
+	*memFile
+}
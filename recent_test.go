@@ -0,0 +1,57 @@
+package timedb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecentCache(t *testing.T) {
+	dir := t.TempDir()
+	db := New(dir)
+	db.SetRecentCache(time.Hour)
+
+	now := time.Now()
+
+	// after now because the time of the records is truncated to seconds
+	recent := now.Add(2 * time.Second)
+	for i := 0; i < 3; i++ {
+		if err := db.Insert(recent, "log", "a %d", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// too old to be cached
+	if err := db.Insert(now.Add(-2*time.Hour), "log", "old"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// the recent records are read without the files
+	for _, d := range []time.Time{now, recent} {
+		if err := os.RemoveAll(filepath.Join(dir, db.getDir(d))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	count := func(start time.Time) int {
+		s := db.Query("log", start, recent, 0, 0)
+		defer s.Close()
+
+		n := 0
+		for s.Scan() {
+			n++
+		}
+		return n
+	}
+
+	if n := count(now); n != 3 {
+		t.Fatalf("expected 3 records, got %d", n)
+	}
+
+	// older ranges are read from the files
+	if n := count(now.Add(-3 * time.Hour)); n != 0 && n != 1 {
+		t.Fatalf("expected the files, got %d", n)
+	}
+}
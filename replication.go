@@ -0,0 +1,545 @@
+package timedb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Replication copies the appended bytes of the primary to a standby.
+// The standby polls the primary for the size of its files and asks for
+// the bytes after the size of its local copy, so after a disconnection
+// it catches up from where it stopped. The files that are rewritten in
+// the primary, for example by Merge, Repair or Migrate, are copied again.
+
+const (
+	// replicaChunk is the size of the chunks of a file that the standby
+	// asks for, and maxReplicaChunk the largest that the primary sends.
+	replicaChunk    = 4 << 20
+	maxReplicaChunk = 64 << 20
+
+	// replicaCheckSize is the size of the end of the files that is
+	// compared to know if they have been rewritten.
+	replicaCheckSize = 4096
+
+	// replicaFullCheck is how often the standby compares all the
+	// files and not only the ones of the last day.
+	replicaFullCheck = time.Hour
+)
+
+// errReplicaChanged is returned when a file of the primary doesn't start
+// with the bytes of the copy of the standby.
+var errReplicaChanged = errors.New("timeDB: the file has been rewritten")
+
+// replicaFile is a file in the replication list.
+type replicaFile struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+
+	// Check is the checksum of the end of the file.
+	Check uint32 `json:"check"`
+}
+
+// ReplicationHandler returns the handler that a standby uses to replicate
+// the database. It serves:
+//
+//	GET ?since=2006-01-02                   the files of the days since the given day
+//	GET ?file=name&offset=n&max=m&check=c   the complete lines of the file after offset
+//
+// The check is the checksum of the bytes before offset. If the file
+// doesn't have them it responds with 409 Conflict.
+func (db *DB) ReplicationHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		if name := q.Get("file"); name != "" {
+			offset, err := strconv.ParseInt(q.Get("offset"), 10, 64)
+			if err != nil || offset < 0 {
+				http.Error(w, "invalid offset", http.StatusBadRequest)
+				return
+			}
+
+			max := int64(replicaChunk)
+			if s := q.Get("max"); s != "" {
+				max, err = strconv.ParseInt(s, 10, 64)
+				if err != nil || max <= 0 || max > maxReplicaChunk {
+					http.Error(w, "invalid max", http.StatusBadRequest)
+					return
+				}
+			}
+
+			var check uint32
+			if s := q.Get("check"); s != "" {
+				c, err := strconv.ParseUint(s, 10, 32)
+				if err != nil {
+					http.Error(w, "invalid check", http.StatusBadRequest)
+					return
+				}
+				check = uint32(c)
+			}
+
+			b, err := db.readFrom(name, offset, max, check)
+			if err != nil {
+				switch {
+				case errors.Is(err, fs.ErrNotExist):
+					http.Error(w, err.Error(), http.StatusNotFound)
+				case errors.Is(err, errReplicaChanged):
+					http.Error(w, err.Error(), http.StatusConflict)
+				default:
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+				}
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(b)
+			return
+		}
+
+		var since time.Time
+		if s := q.Get("since"); s != "" {
+			var err error
+			since, err = time.ParseInLocation("2006-01-02", s, time.Local)
+			if err != nil {
+				http.Error(w, "invalid day", http.StatusBadRequest)
+				return
+			}
+		}
+
+		files, err := db.replicaFiles(since)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(files)
+	})
+}
+
+// replicaFiles returns the table files of the days since the given day.
+func (db *DB) replicaFiles(since time.Time) ([]replicaFile, error) {
+	dayList, err := db.days()
+	if err != nil {
+		return nil, err
+	}
+
+	local := localStorage(db.storage)
+
+	files := []replicaFile{}
+	for _, day := range dayList {
+		if day.Before(since) {
+			continue
+		}
+
+		names, err := db.replicaDayFiles(day)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range names {
+			info, err := fs.Stat(local, name)
+			if err != nil {
+				return nil, err
+			}
+			check, err := tailCheck(local, name, info.Size())
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, replicaFile{Name: name, Size: info.Size(), Check: check})
+		}
+	}
+
+	return files, nil
+}
+
+// replicaDayFiles returns the local files of a day that are replicated.
+func (db *DB) replicaDayFiles(day time.Time) ([]string, error) {
+	names, err := dayFiles(localStorage(db.storage), db.getDir(day))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var files []string
+	for _, name := range names {
+		if isReplicaData(name) {
+			files = append(files, name)
+		}
+	}
+	return files, nil
+}
+
+// tailCheck returns the checksum of the bytes of a file before end.
+func tailCheck(s fs.FS, name string, end int64) (uint32, error) {
+	if end == 0 {
+		return 0, nil
+	}
+
+	f, err := s.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	start := max(0, end-replicaCheckSize)
+	if err := skip(f, start); err != nil {
+		return 0, err
+	}
+
+	h := crc32.NewIEEE()
+	if _, err := io.CopyN(h, f, end-start); err != nil {
+		if err == io.EOF {
+			return 0, errReplicaChanged
+		}
+		return 0, err
+	}
+	return h.Sum32(), nil
+}
+
+// skip advances the file to offset.
+func skip(f io.Reader, offset int64) error {
+	if s, ok := f.(io.Seeker); ok {
+		_, err := s.Seek(offset, io.SeekStart)
+		return err
+	}
+	if _, err := io.CopyN(io.Discard, f, offset); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// readFrom returns up to max bytes of complete lines of a file after
+// offset. The check is the checksum of the bytes before offset, to
+// know that the file has not been rewritten since they were read.
+func (db *DB) readFrom(name string, offset, max int64, check uint32) ([]byte, error) {
+	if !db.validReplicaName(name) {
+		return nil, fmt.Errorf("timeDB: invalid file %s: %w", name, fs.ErrNotExist)
+	}
+
+	local := localStorage(db.storage)
+
+	info, err := fs.Stat(local, name)
+	if err != nil {
+		return nil, err
+	}
+	if offset > info.Size() {
+		return nil, fmt.Errorf("%w: %s", errReplicaChanged, name)
+	}
+
+	c, err := tailCheck(local, name, offset)
+	if err != nil {
+		return nil, err
+	}
+	if c != check {
+		return nil, fmt.Errorf("%w: %s", errReplicaChanged, name)
+	}
+
+	f, err := local.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := skip(f, offset); err != nil {
+		return nil, err
+	}
+
+	b, err := io.ReadAll(io.LimitReader(f, max))
+	if err != nil {
+		return nil, err
+	}
+
+	// the compressed files are written at once
+	if strings.HasSuffix(name, ".zst") {
+		return b, nil
+	}
+
+	// the last line can be half written, unless it is a line longer
+	// than the chunk
+	i := bytes.LastIndexByte(b, '\n')
+	if i == -1 && int64(len(b)) == max {
+		return b, nil
+	}
+	return b[:i+1], nil
+}
+
+// isReplicaData reports if the name is a data file or a part of one,
+// compressed or not, like "table.log", "table.log.1" or "table.log.zst".
+func isReplicaData(name string) bool {
+	return strings.HasSuffix(partBase(name), ".log")
+}
+
+// validReplicaName reports if the name is a table file like "2006-01-02/table.log".
+func (db *DB) validReplicaName(name string) bool {
+	if !fs.ValidPath(name) || !isReplicaData(name) {
+		return false
+	}
+
+	// the directory of the day can have several levels
+	parts := strings.Split(name, "/")
+	depth := strings.Count(db.getDir(time.Now()), "/") + 1
+	if len(parts) <= depth {
+		return false
+	}
+	_, ok := db.parseDir(strings.Join(parts[:depth], "/"))
+	return ok
+}
+
+// Replicate copies the data of the primary, served by ReplicationHandler at
+// url, polling every interval until the context is canceled. The database
+// must not be written by anything else.
+func (db *DB) Replicate(ctx context.Context, url string, interval time.Duration) error {
+	client := &http.Client{Timeout: time.Minute}
+
+	var checked time.Time
+	for {
+		full := time.Since(checked) >= replicaFullCheck
+		if err := db.replicate(ctx, client, url, full); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			db.log().Warn("timedb: replication error", "primary", url, "error", err)
+		} else if full {
+			checked = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// replicate copies the changes of the files of the primary. Unless full
+// is set, only the files since the last local day are compared.
+func (db *DB) replicate(ctx context.Context, client *http.Client, primary string, full bool) error {
+	// the days before the last local day are usually complete
+	dayList, err := db.days()
+	if err != nil {
+		return err
+	}
+
+	var since time.Time
+	q := url.Values{}
+	if !full && len(dayList) > 0 {
+		since = dayList[len(dayList)-1]
+		q.Set("since", since.Format("2006-01-02"))
+	}
+
+	var files []replicaFile
+	if err := getReplica(ctx, client, primary, q, func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&files)
+	}); err != nil {
+		return err
+	}
+
+	local := localStorage(db.storage)
+	listed := make(map[string]bool, len(files))
+
+	for _, f := range files {
+		if !db.validReplicaName(f.Name) {
+			return fmt.Errorf("timeDB: invalid file %s", f.Name)
+		}
+		listed[f.Name] = true
+
+		var size int64
+		if info, err := fs.Stat(local, f.Name); err == nil {
+			size = info.Size()
+		}
+
+		if size == f.Size {
+			check, err := tailCheck(local, f.Name, size)
+			if err != nil {
+				return err
+			}
+			if check == f.Check {
+				continue
+			}
+		}
+
+		if size < f.Size {
+			err = db.replicateFile(ctx, client, primary, f.Name, f.Name, size, f.Size)
+		} else {
+			err = errReplicaChanged
+		}
+
+		if errors.Is(err, errReplicaChanged) {
+			err = db.resyncReplica(ctx, client, primary, f)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// the files that the primary doesn't have anymore, like the data
+	// files compressed or the parts merged
+	for _, day := range dayList {
+		if day.Before(since) {
+			continue
+		}
+
+		names, err := db.replicaDayFiles(day)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			if !listed[name] {
+				if err := db.removeReplica(name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// replicateFile copies the bytes of the file of the primary after size to
+// the local file in chunks, until it reaches end.
+func (db *DB) replicateFile(ctx context.Context, client *http.Client, primary, name, localName string, size, end int64) error {
+	local := localStorage(db.storage)
+
+	for size < end {
+		check, err := tailCheck(local, localName, size)
+		if err != nil {
+			return err
+		}
+
+		q := url.Values{
+			"file":   {name},
+			"offset": {strconv.FormatInt(size, 10)},
+			"max":    {strconv.Itoa(replicaChunk)},
+			"check":  {strconv.FormatUint(uint64(check), 10)},
+		}
+
+		var n int
+		if err := getReplica(ctx, client, primary, q, func(r io.Reader) error {
+			b, err := io.ReadAll(io.LimitReader(r, replicaChunk+1))
+			if err != nil {
+				return err
+			}
+			if len(b) > replicaChunk {
+				return fmt.Errorf("timeDB: replication error: chunk of %s too large", name)
+			}
+			n = len(b)
+			return db.appendReplica(localName, b)
+		}); err != nil {
+			return err
+		}
+
+		if n == 0 {
+			// the rest is a line half written
+			return nil
+		}
+		size += int64(n)
+	}
+
+	return nil
+}
+
+// resyncReplica copies again a file that has been rewritten in the primary.
+// The local copy is replaced when the new one is complete.
+func (db *DB) resyncReplica(ctx context.Context, client *http.Client, primary string, f replicaFile) error {
+	local := localStorage(db.storage)
+
+	tmpName := f.Name + ".replica"
+	if err := local.Remove(tmpName); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	defer local.Remove(tmpName)
+
+	if err := db.replicateFile(ctx, client, primary, f.Name, tmpName, 0, f.Size); err != nil {
+		return err
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	name := f.Name
+	db.closeFile(partBase(name))
+
+	// the queries running keep reading the old file
+	if err := db.retire(local, name); err != nil {
+		return fmt.Errorf("timeDB: error replacing %s: %w", name, err)
+	}
+	if _, err := fs.Stat(local, tmpName); errors.Is(err, fs.ErrNotExist) {
+		// the file is empty
+		return nil
+	}
+	return local.Rename(tmpName, name)
+}
+
+// removeReplica removes a local file that the primary doesn't have.
+func (db *DB) removeReplica(name string) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.closeFile(partBase(name))
+
+	if err := db.retire(localStorage(db.storage), name); err != nil {
+		return fmt.Errorf("timeDB: error removing %s: %w", name, err)
+	}
+	return nil
+}
+
+func getReplica(ctx context.Context, client *http.Client, primary string, q url.Values, fn func(r io.Reader) error) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", primary+"?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusConflict {
+		return fmt.Errorf("%w: %s", errReplicaChanged, q.Get("file"))
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("timeDB: replication error: %s", res.Status)
+	}
+
+	return fn(res.Body)
+}
+
+// appendReplica appends a chunk received from the primary to a file.
+func (db *DB) appendReplica(name string, b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.closeFile(partBase(name))
+
+	w, err := localStorage(db.storage).Append(name)
+	if err != nil {
+		return fmt.Errorf("timeDB: error openning file %s: %w", name, err)
+	}
+
+	if _, err := w.Write(b); err != nil {
+		w.Close()
+		return err
+	}
+
+	db.metrics.bytesWritten.Add(int64(len(b)))
+	return w.Close()
+}
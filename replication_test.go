@@ -0,0 +1,226 @@
+package timedb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReplicate(t *testing.T) {
+	primary := NewMemory()
+	standby := New(t.TempDir())
+
+	srv := httptest.NewServer(primary.ReplicationHandler())
+	defer srv.Close()
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+
+	insert := func(day int, text string) {
+		if err := primary.Insert(start.AddDate(0, 0, day), "log", text); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	insert(0, "a")
+	insert(1, "b")
+
+	ctx := context.Background()
+	client := srv.Client()
+
+	if err := standby.replicate(ctx, client, srv.URL, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the new bytes are copied
+	insert(1, "c")
+	insert(2, "d")
+
+	if err := standby.replicate(ctx, client, srv.URL, false); err != nil {
+		t.Fatal(err)
+	}
+
+	s := standby.Query("log", start, start.AddDate(0, 0, 3), 0, 0)
+	defer s.Close()
+
+	var got string
+	for s.Scan() {
+		got += s.Data().Text
+	}
+
+	if got != " a b c d" {
+		t.Fatalf("unexpected data %q", got)
+	}
+}
+
+func TestReadFromPartialLine(t *testing.T) {
+	db := NewMemory()
+
+	w, err := db.storage.Append("2020-01-01/log.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("1577869200 a\n1577869201 b\n15778"))
+
+	check, err := tailCheck(db.storage, "2020-01-01/log.log", 13)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := db.readFrom("2020-01-01/log.log", 13, replicaChunk, check)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "1577869201 b\n" {
+		t.Fatalf("unexpected data %q", b)
+	}
+
+	// the chunk ends in the middle of the second line
+	b, err = db.readFrom("2020-01-01/log.log", 0, 20, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "1577869200 a\n" {
+		t.Fatalf("unexpected data %q", b)
+	}
+
+	// the bytes before the offset are not the ones of the standby
+	if _, err := db.readFrom("2020-01-01/log.log", 13, replicaChunk, check+1); !errors.Is(err, errReplicaChanged) {
+		t.Fatalf("expected errReplicaChanged, got %v", err)
+	}
+	if _, err := db.readFrom("2020-01-01/log.log", 100, replicaChunk, 0); !errors.Is(err, errReplicaChanged) {
+		t.Fatalf("expected errReplicaChanged, got %v", err)
+	}
+
+	if _, err := db.readFrom("../log.log", 0, replicaChunk, 0); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestReplicateRewritten(t *testing.T) {
+	dir := t.TempDir()
+	primary := New(dir)
+	standby := New(t.TempDir())
+
+	srv := httptest.NewServer(primary.ReplicationHandler())
+	defer srv.Close()
+
+	ctx := context.Background()
+	client := srv.Client()
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i, text := range []string{"a", "b", "c"} {
+		if err := primary.Insert(start.Add(time.Duration(i*2)*time.Second), "log", text); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := standby.replicate(ctx, client, srv.URL, true); err != nil {
+		t.Fatal(err)
+	}
+
+	assertReplica := func(expected string) {
+		t.Helper()
+
+		s := standby.Query("log", start, start, 0, 0)
+		defer s.Close()
+
+		var got string
+		for s.Scan() {
+			got += s.Data().Text
+		}
+		if got != expected {
+			t.Fatalf("expected %q, got %q", expected, got)
+		}
+	}
+
+	// the merge adds a record in the middle of the file
+	other := NewMemory()
+	other.Insert(start.Add(time.Second), "log", "x")
+	if err := Merge(primary, other); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := standby.replicate(ctx, client, srv.URL, false); err != nil {
+		t.Fatal(err)
+	}
+	assertReplica(" a x b c")
+
+	// the last record is removed, like Repair does with the invalid ones
+	primary.Close()
+	name := filepath.Join(dir, "2020-01-01", "log.log")
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = b[:bytes.LastIndexByte(b[:len(b)-1], '\n')+1]
+	if err := os.WriteFile(name, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := standby.replicate(ctx, client, srv.URL, false); err != nil {
+		t.Fatal(err)
+	}
+	assertReplica(" a x b")
+
+	// the data file is replaced by the compressed one
+	if err := primary.SetTableOptions("log", TableOptions{Compress: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := primary.ApplyTableOptions(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := standby.replicate(ctx, client, srv.URL, true); err != nil {
+		t.Fatal(err)
+	}
+	assertReplica(" a x b")
+
+	names, err := standby.replicaDayFiles(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "2020-01-01/log.log.zst" {
+		t.Fatalf("unexpected files %v", names)
+	}
+}
+
+func TestReplicateParts(t *testing.T) {
+	primary := NewMemory()
+	standby := New(t.TempDir())
+
+	if err := primary.SetTableOptions("log", TableOptions{MaxFileSize: primary.headerSize() + 30}); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(primary.ReplicationHandler())
+	defer srv.Close()
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 4; i++ {
+		if err := primary.Insert(start.Add(time.Duration(i)*time.Second), "log", "a%d", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := standby.replicate(context.Background(), srv.Client(), srv.URL, true); err != nil {
+		t.Fatal(err)
+	}
+
+	s := standby.Query("log", start, start, 0, 0)
+	defer s.Close()
+
+	var got string
+	for s.Scan() {
+		got += s.Data().Text
+	}
+
+	if got != " a0 a1 a2 a3" {
+		t.Fatalf("unexpected data %q", got)
+	}
+}
@@ -0,0 +1,99 @@
+package timedb
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// currentDir is the directory of the links to the files being written.
+const currentDir = "current"
+
+// RolloverFunc is called when the file written for a table changes,
+// because a new day starts or the file is full and continues in a new
+// part. The paths are relative to the root of the database.
+type RolloverFunc func(table, oldPath, newPath string)
+
+// OnRollover adds a function that is called when the file written for a
+// table changes. Only the changes since the database is opened are seen,
+// when the first record of the new file is written. It runs in a new
+// goroutine so it can use the database.
+func (db *DB) OnRollover(fn RolloverFunc) {
+	db.mutex.Lock()
+	db.rollovers = append(db.rollovers, fn)
+	db.mutex.Unlock()
+}
+
+// SetCurrentLinks maintains a symbolic link for each table in the
+// "current" directory, like "current/nginx.log", that points to the
+// file being written. It only works with databases stored on disk.
+func (db *DB) SetCurrentLinks(enabled bool) {
+	db.currentLinks.Store(enabled)
+}
+
+// rollover checks if the file being written for the table is a new one.
+// The caller must hold the lock of the writer.
+func (db *DB) rollover(w *tableWriter, table string) {
+	links := db.currentLinks.Load()
+	if !links && len(db.rollovers) == 0 {
+		return
+	}
+
+	p := partName(w.path, w.part)
+
+	db.writers.mutex.Lock()
+	old, ok := db.currentFiles[table]
+	if old != p {
+		if db.currentFiles == nil {
+			db.currentFiles = make(map[string]string)
+		}
+		db.currentFiles[table] = p
+	}
+	db.writers.mutex.Unlock()
+
+	if old == p {
+		return
+	}
+
+	if links {
+		if err := db.linkCurrent(table, p); err != nil {
+			db.log().Warn("timedb: error linking the current file", "table", table, "error", err)
+		}
+	}
+
+	if ok {
+		for _, fn := range db.rollovers {
+			go fn(table, old, p)
+		}
+	}
+}
+
+// linkCurrent points the link of the table to the file.
+func (db *DB) linkCurrent(table, name string) error {
+	ds, ok := localStorage(db.storage).(diskStorage)
+	if !ok {
+		return nil
+	}
+
+	link := ds.path(path.Join(currentDir, table+".log"))
+	if err := os.MkdirAll(filepath.Dir(link), 0777); err != nil {
+		return err
+	}
+
+	target, err := filepath.Rel(filepath.Dir(link), ds.path(name))
+	if err != nil {
+		return err
+	}
+
+	// replace the link atomically
+	tmp := link + ".tmp"
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
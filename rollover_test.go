@@ -0,0 +1,67 @@
+package timedb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRollover(t *testing.T) {
+	dir := t.TempDir()
+	db := New(dir)
+	db.SetCurrentLinks(true)
+
+	type rollover struct{ table, old, new string }
+	done := make(chan rollover, 1)
+	db.OnRollover(func(table, oldPath, newPath string) {
+		done <- rollover{table, oldPath, newPath}
+	})
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	if err := db.Insert(start, "app", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Insert(start.Add(time.Second), "app", "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	link := filepath.Join(dir, "current", "app.log")
+	if target, err := os.Readlink(link); err != nil || target != filepath.Join("..", "2020-01-01", "app.log") {
+		t.Fatalf("invalid link %s %v", target, err)
+	}
+
+	// writing other tables doesn't rotate the table
+	if err := db.Insert(start, "other", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Insert(start.Add(2*time.Second), "app", "c"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Insert(start.AddDate(0, 0, 1), "app", "d"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case r := <-done:
+		if r.table != "app" || r.old != "2020-01-01/app.log" || r.new != "2020-01-02/app.log" {
+			t.Fatalf("unexpected rollover %+v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a rollover")
+	}
+
+	b, err := os.ReadFile(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(b) - int(db.headerSize()); n != len("1577955600 d\n") {
+		t.Fatalf("unexpected data %q", b)
+	}
+
+	// the links are not data
+	if size, err := db.size(); err != nil || size != 3*db.headerSize()+5*13 {
+		t.Fatalf("unexpected size %d %v", size, err)
+	}
+}
@@ -0,0 +1,215 @@
+package timedb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+)
+
+// rollupsMeta is the metadata file with the rollups of the tables.
+const rollupsMeta = "rollups.json"
+
+// Rollup is a table with the points of a numeric table aggregated at a
+// coarser resolution. It is built by BuildRollups and used by Aggregate
+// when the buckets are multiple of the resolution.
+type Rollup struct {
+	Table      string
+	Resolution time.Duration
+	Func       AggregateFunc
+
+	// Until is the time until the rollup is built.
+	Until time.Time `json:",omitempty"`
+}
+
+// AddRollup saves a rollup of a numeric table.
+func (db *DB) AddRollup(table string, r Rollup) error {
+	if err := validTable(table); err != nil {
+		return err
+	}
+	if err := validTable(r.Table); err != nil {
+		return err
+	}
+	if r.Resolution <= 0 {
+		return fmt.Errorf("timeDB.AddRollup: invalid resolution %v", r.Resolution)
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	rollups, err := db.rollups()
+	if err != nil {
+		return err
+	}
+
+	for _, v := range rollups[table] {
+		if v.Table == r.Table {
+			return fmt.Errorf("timeDB.AddRollup: the rollup %s already exists", r.Table)
+		}
+	}
+
+	r.Until = time.Time{}
+	rollups[table] = append(rollups[table], r)
+	return db.saveRollups(rollups)
+}
+
+// Rollups returns the rollups of a table.
+func (db *DB) Rollups(table string) ([]Rollup, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	rollups, err := db.rollups()
+	if err != nil {
+		return nil, err
+	}
+	return rollups[table], nil
+}
+
+func (db *DB) rollups() (map[string][]Rollup, error) {
+	rollups := make(map[string][]Rollup)
+
+	b, err := db.ReadMeta(rollupsMeta)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return rollups, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &rollups); err != nil {
+		return nil, fmt.Errorf("timeDB: invalid rollups: %v", err)
+	}
+	return rollups, nil
+}
+
+func (db *DB) saveRollups(rollups map[string][]Rollup) error {
+	b, err := json.Marshal(rollups)
+	if err != nil {
+		return err
+	}
+	return db.WriteMeta(rollupsMeta, b)
+}
+
+// BuildRollups adds to the rollups the buckets that end before now.
+// It can be run as a maintenance task.
+func (db *DB) BuildRollups(now time.Time) error {
+	db.mutex.RLock()
+	rollups, err := db.rollups()
+	db.mutex.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	for table, list := range rollups {
+		for i, r := range list {
+			until, err := db.buildRollup(table, r, now)
+			if err != nil {
+				return err
+			}
+			list[i].Until = until
+		}
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	// save only the progress, the rollups could have changed
+	current, err := db.rollups()
+	if err != nil {
+		return err
+	}
+	for table, list := range current {
+		for i, r := range list {
+			for _, built := range rollups[table] {
+				if built.Table == r.Table && built.Until.After(r.Until) {
+					list[i].Until = built.Until
+				}
+			}
+		}
+	}
+	return db.saveRollups(current)
+}
+
+// buildRollup writes the complete buckets after r.Until and returns
+// the time until the rollup is built.
+func (db *DB) buildRollup(table string, r Rollup, now time.Time) (time.Time, error) {
+	start := r.Until
+	if start.IsZero() {
+		dayList, err := db.days()
+		if err != nil {
+			return start, err
+		}
+		if len(dayList) == 0 {
+			return start, nil
+		}
+		start = dayList[0]
+	}
+
+	start = start.Truncate(r.Resolution)
+	end := now.Truncate(r.Resolution)
+	if !end.After(start) {
+		return r.Until, nil
+	}
+
+	series, err := db.Series(table, start, end)
+	if err != nil {
+		return r.Until, err
+	}
+
+	b := db.NewBatch()
+	for _, s := range series {
+		for _, p := range aggregate(s.Points, start, r.Resolution, r.Func) {
+			if err := b.Insert(p.Time, r.Table, FormatValue(p.Value, s.Labels)); err != nil {
+				return r.Until, err
+			}
+		}
+	}
+
+	if err := b.Commit(); err != nil {
+		return r.Until, err
+	}
+	return end, nil
+}
+
+// routeAggregate returns the rollup that can answer the aggregation with
+// the coarsest resolution and the function to aggregate its points.
+func (db *DB) routeAggregate(table string, start, end time.Time, bucket time.Duration, fn AggregateFunc) (Rollup, AggregateFunc, bool) {
+	if isPattern(table) {
+		return Rollup{}, 0, false
+	}
+
+	rollups, err := db.Rollups(table)
+	if err != nil {
+		db.log().Warn("timedb: error reading the rollups", "error", err)
+		return Rollup{}, 0, false
+	}
+
+	var best Rollup
+	var bestFn AggregateFunc
+	found := false
+
+	for _, r := range rollups {
+		if bucket%r.Resolution != 0 || !start.Truncate(r.Resolution).Equal(start) || end.After(r.Until) {
+			continue
+		}
+
+		var f AggregateFunc
+		switch {
+		case r.Func == fn && fn != AggAvg && fn != AggCount:
+			f = fn
+		case r.Func == AggCount && fn == AggCount:
+			f = AggSum
+		case r.Func == AggAvg && fn == AggAvg && bucket == r.Resolution:
+			f = AggAvg
+		default:
+			continue
+		}
+
+		if !found || r.Resolution > best.Resolution {
+			best, bestFn, found = r, f, true
+		}
+	}
+
+	return best, bestFn, found
+}
@@ -0,0 +1,55 @@
+package timedb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRollup(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 120; i++ {
+		if err := db.InsertValue(start.Add(time.Duration(i)*time.Minute), "requests", 1, Labels{"job": "web"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.AddRollup("requests", Rollup{Table: "requests-1h", Resolution: time.Hour, Func: AggSum}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.BuildRollups(start.Add(2*time.Hour + time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	rollups, err := db.Rollups("requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rollups) != 1 || !rollups[0].Until.Equal(start.Add(2*time.Hour)) {
+		t.Fatalf("invalid rollups %v", rollups)
+	}
+
+	// a late point is not in the rollup
+	if err := db.InsertValue(start, "requests", 1, Labels{"job": "web"}); err != nil {
+		t.Fatal(err)
+	}
+
+	series, err := db.Aggregate("requests", start, start.Add(2*time.Hour), time.Hour, AggSum, FillNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := series[0].Points; len(p) != 2 || p[0].Value != 60 || series[0].Labels["job"] != "web" {
+		t.Fatalf("expected the rollup, got %v", series)
+	}
+
+	// short buckets are read from the raw data
+	series, err = db.Aggregate("requests", start, start.Add(2*time.Hour), time.Minute, AggSum, FillNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := series[0].Points; len(p) != 120 || p[0].Value != 2 {
+		t.Fatalf("expected the raw data, got %v", p[:1])
+	}
+}
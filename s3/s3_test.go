@@ -0,0 +1,87 @@
+package s3
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	objects := map[string]string{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+		switch {
+		case r.Method == "PUT":
+			b, _ := io.ReadAll(r.Body)
+			objects[key] = string(b)
+		case r.URL.Query().Get("list-type") == "2":
+			io.WriteString(w, "<ListBucketResult>")
+			for k := range objects {
+				if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+					io.WriteString(w, "<Contents><Key>"+k+"</Key></Contents>")
+				}
+			}
+			io.WriteString(w, "</ListBucketResult>")
+		default:
+			v, ok := objects[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			http.ServeContent(w, r, key, time.Time{}, strings.NewReader(v))
+		}
+	}))
+	defer server.Close()
+
+	s := &Store{Endpoint: server.URL, Region: "us-east-1", Bucket: "bucket", Prefix: "db/", AccessKey: "key", SecretKey: "secret"}
+
+	if err := s.Put("2020-01-01/logs.log", strings.NewReader("1 a\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := s.List("2020-01-01/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "2020-01-01/logs.log" {
+		t.Fatalf("unexpected names %v", names)
+	}
+
+	r, err := s.Get("2020-01-01/logs.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(r)
+	r.Close()
+	if string(b) != "1 a\n" {
+		t.Fatalf("unexpected data %q", b)
+	}
+
+	size, err := s.Size("2020-01-01/logs.log")
+	if err != nil || size != 4 {
+		t.Fatalf("unexpected size %d %v", size, err)
+	}
+
+	r, err = s.GetRange("2020-01-01/logs.log", 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = io.ReadAll(r)
+	r.Close()
+	if string(b) != "a" {
+		t.Fatalf("unexpected range %q", b)
+	}
+
+	if _, err := s.Get("missing"); err == nil {
+		t.Fatal("expected an error")
+	}
+}
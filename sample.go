@@ -0,0 +1,58 @@
+package timedb
+
+import "math/rand"
+
+// sampler selects the records returned by a scanner.
+type sampler struct {
+	every   int
+	matched int
+	rate    float64
+	rand    *rand.Rand
+}
+
+func (s *sampler) keep() bool {
+	if s.every > 1 {
+		s.matched++
+		return (s.matched-1)%s.every == 0
+	}
+	if s.rand != nil {
+		return s.rand.Float64() < s.rate
+	}
+	return true
+}
+
+// SetSample returns only every nth record that matches the filter,
+// starting with the first one. The offset and the size of the query
+// are applied to the sampled records.
+func (s *Scanner) SetSample(n int) {
+	s.sample = sampler{every: n}
+}
+
+// SetSampleSize returns a random sample of approximately k records.
+// The number of records of the range is estimated with the stats of
+// the days (see DayStats) so with a filter the result can be smaller.
+func (s *Scanner) SetSampleSize(k int) error {
+	r := s.reader
+
+	var total int64
+	for _, day := range days(r.start, r.end) {
+		stats, err := r.db.tableStats(day, r.table)
+		if err != nil {
+			return err
+		}
+		for _, st := range stats {
+			total += st.Count
+		}
+	}
+
+	if total <= int64(k) {
+		s.sample = sampler{}
+		return nil
+	}
+
+	s.sample = sampler{
+		rate: float64(k) / float64(total),
+		rand: rand.New(rand.NewSource(rand.Int63())),
+	}
+	return nil
+}
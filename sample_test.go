@@ -0,0 +1,45 @@
+package timedb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSample(t *testing.T) {
+	db := New(t.TempDir())
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 1000; i++ {
+		if err := db.Insert(start.Add(time.Duration(i)*time.Second), "log", "line %d", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := db.Query("log", start, start, 0, 0)
+	s.SetSample(100)
+
+	var lines []string
+	for s.Scan() {
+		lines = append(lines, s.Data().Text)
+	}
+	s.Close()
+
+	if len(lines) != 10 || lines[0] != " line 0" || lines[1] != " line 100" {
+		t.Fatalf("invalid sample %v", lines)
+	}
+
+	s = db.Query("log", start, start, 0, 0)
+	if err := s.SetSampleSize(100); err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	for s.Scan() {
+		n++
+	}
+	s.Close()
+
+	if n < 50 || n > 150 {
+		t.Fatalf("expected about 100 records, got %d", n)
+	}
+}
@@ -0,0 +1,99 @@
+package timedb
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// seekStart moves the file to the first line with a time equal or after
+// start with a binary search instead of reading all the lines before it.
+// The search is limited to the part of the file that the stats of the
+// day say that is sorted (see DayStats). Without stats nothing is done.
+func (db *DB) seekStart(f fs.File, name string, start time.Time) error {
+	ra, ok := f.(io.ReaderAt)
+	if !ok {
+		return nil
+	}
+	seeker, ok := f.(io.Seeker)
+	if !ok {
+		return nil
+	}
+
+	st, ok := db.savedStats(name)
+	if !ok || !st.Sorted || st.Count == 0 || !start.After(st.First) {
+		return nil
+	}
+
+	// the file could have been replaced
+	info, err := f.Stat()
+	if err != nil || info.Size() < st.Size {
+		return nil
+	}
+
+	epoch := start.Unix()
+	size := st.Size
+
+	lo, hi := int64(0), size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		pos, t, err := lineAt(ra, mid, size)
+		if err != nil {
+			return err
+		}
+		if pos >= size || t >= epoch {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+
+	pos, _, err := lineAt(ra, lo, size)
+	if err != nil {
+		return err
+	}
+
+	_, err = seeker.Seek(pos, io.SeekStart)
+	return err
+}
+
+// lineAt returns the offset and the time of the first line that starts at
+// or after off. If there is none before limit it returns limit.
+func lineAt(ra io.ReaderAt, off, limit int64) (int64, int64, error) {
+	buf := make([]byte, 4096)
+
+	pos := off
+	if off > 0 {
+		// the line starts after the previous new line
+		pos = off - 1
+		for {
+			if pos >= limit {
+				return limit, 0, nil
+			}
+			n, err := ra.ReadAt(buf, pos)
+			if i := bytes.IndexByte(buf[:n], '\n'); i != -1 {
+				pos += int64(i) + 1
+				break
+			}
+			if err != nil {
+				if err == io.EOF {
+					return limit, 0, nil
+				}
+				return 0, 0, err
+			}
+			pos += int64(n)
+		}
+	}
+
+	if pos >= limit {
+		return limit, 0, nil
+	}
+
+	n, err := ra.ReadAt(buf[:32], pos)
+	if err != nil && err != io.EOF {
+		return 0, 0, err
+	}
+
+	return pos, lineEpoch(buf[:n]), nil
+}
@@ -0,0 +1,61 @@
+package timedb
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSeekStart(t *testing.T) {
+	for _, db := range []*DB{New(t.TempDir()), NewMemory()} {
+		start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local)
+		for i := 0; i < 1000; i++ {
+			if err := db.Insert(start.Add(time.Duration(i)*time.Minute), "log", "line %d", i); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if _, err := db.DayStats(start, "log"); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, i := range []int{0, 1, 500, 999, 1000} {
+			from := start.Add(time.Duration(i) * time.Minute)
+			s := db.Query("log", from, from, 0, 1)
+			ok := s.Scan()
+			text := s.Data().Text
+			bytes := s.Progress().Bytes
+			s.Close()
+
+			if i == 1000 {
+				if ok {
+					t.Fatalf("expected no lines, got %s", text)
+				}
+				continue
+			}
+
+			if !ok || text != fmt.Sprintf(" line %d", i) {
+				t.Fatalf("%d: unexpected %q", i, text)
+			}
+
+			if i == 999 && bytes > 100 {
+				t.Fatalf("expected to read the last line, read %d bytes", bytes)
+			}
+		}
+
+		// a line inserted late makes the file unsorted
+		if err := db.Insert(start.Add(500*time.Minute), "log", "late"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.DayStats(start, "log"); err != nil {
+			t.Fatal(err)
+		}
+
+		s := db.Query("log", start.Add(500*time.Minute), start.Add(500*time.Minute), 0, 0)
+		s.SetFilter("late")
+		if !s.Scan() {
+			t.Fatal("expected the late line")
+		}
+		s.Close()
+	}
+}
@@ -0,0 +1,186 @@
+package timedb
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tables with TableOptions.Sequence store a sequence number after the
+// time of each record:
+//
+//	1577869200:42 text
+//
+// The numbers start at 1 and increase by one with each record of the
+// table, so they are stable cursors even if many records share a second.
+
+// sequencesMeta is the metadata file with the last number of each table.
+const sequencesMeta = "sequences.json"
+
+// parseTimeField parses the time and the optional sequence at the start of a line.
+func parseTimeField(s string) (int64, uint64, error) {
+	epoch, seq, ok := strings.Cut(s, ":")
+
+	t, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil || !ok {
+		return t, 0, err
+	}
+
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return t, n, nil
+}
+
+// timeField returns the start of a line: the time and the sequence number
+// if the table has them.
+func timeField(t time.Time, seq uint64) string {
+	s := strconv.FormatInt(t.Unix(), 10)
+	if seq > 0 {
+		s += ":" + strconv.FormatUint(seq, 10)
+	}
+	return s
+}
+
+// SetAfterSeq returns only the records with a sequence number greater
+// than seq, for example the last one returned by a previous query.
+func (s *Scanner) SetAfterSeq(seq uint64) {
+	s.afterSeq = seq
+}
+
+// nextSeq returns the next number of the table or 0 if it doesn't have
+// sequence numbers. The caller must hold the lock of the table writer.
+func (db *DB) nextSeq(table string) (uint64, error) {
+	if !db.TableOptions(table).Sequence {
+		return 0, nil
+	}
+
+	db.seqMutex.Lock()
+	defer db.seqMutex.Unlock()
+
+	if db.seqs == nil {
+		db.seqs = make(map[string]uint64)
+		if b, err := db.ReadMeta(sequencesMeta); err == nil {
+			if err := json.Unmarshal(b, &db.seqs); err != nil {
+				return 0, fmt.Errorf("timeDB: invalid %s: %v", sequencesMeta, err)
+			}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return 0, err
+		}
+		db.seqLoaded = make(map[string]bool)
+	}
+
+	if !db.seqLoaded[table] {
+		// the numbers saved can be behind if the database was not closed
+		last, err := db.lastSeq(table)
+		if err != nil {
+			return 0, err
+		}
+		if last > db.seqs[table] {
+			db.seqs[table] = last
+		}
+		db.seqLoaded[table] = true
+	}
+
+	db.seqs[table]++
+	return db.seqs[table], nil
+}
+
+// numberLines writes again the lines of the group with sequence numbers
+// if the table has them and returns the first one. The caller must hold
+// the lock of the table writer.
+func (db *DB) numberLines(g *writeGroup) (uint64, error) {
+	if !db.TableOptions(g.table).Sequence {
+		return 0, nil
+	}
+
+	var first uint64
+	g.buf.Reset()
+	for _, r := range g.records {
+		seq, err := db.nextSeq(g.table)
+		if err != nil {
+			db.releaseSeq(g.table, first)
+			return 0, err
+		}
+		if first == 0 {
+			first = seq
+		}
+
+		g.buf.WriteString(timeField(r.time, seq))
+		g.buf.WriteByte(' ')
+		g.buf.WriteString(r.stored)
+		g.buf.WriteByte('\n')
+	}
+	return first, nil
+}
+
+// releaseSeq returns the numbers from first, of records that were not
+// written, so there are no gaps. The caller must hold the lock of the
+// table writer.
+func (db *DB) releaseSeq(table string, first uint64) {
+	if first > 0 {
+		db.seqMutex.Lock()
+		db.seqs[table] = first - 1
+		db.seqMutex.Unlock()
+	}
+}
+
+// lastSeq returns the greatest number in the last day of the table.
+func (db *DB) lastSeq(table string) (uint64, error) {
+	dayList, err := db.days()
+	if err != nil {
+		return 0, err
+	}
+
+	for i := len(dayList) - 1; i >= 0; i-- {
+		f, err := db.openParts(dayList[i], db.getTablePath(dayList[i], table))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return 0, err
+		}
+
+		var last uint64
+		r := bufio.NewReader(f)
+		for {
+			line, err := r.ReadString('\n')
+			if i := strings.IndexByte(line, ' '); i != -1 {
+				if _, seq, err := parseTimeField(line[:i]); err == nil && seq > last {
+					last = seq
+				}
+			}
+			if err != nil {
+				f.Close()
+				if err == io.EOF {
+					break
+				}
+				return 0, fmt.Errorf("timeDB: error reading %s: %v", table, err)
+			}
+		}
+		return last, nil
+	}
+	return 0, nil
+}
+
+// saveSeqs saves the last number of each table. The caller must hold the lock.
+func (db *DB) saveSeqs() error {
+	db.seqMutex.Lock()
+	if len(db.seqs) == 0 {
+		db.seqMutex.Unlock()
+		return nil
+	}
+	b, err := json.Marshal(db.seqs)
+	db.seqMutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return db.WriteMeta(sequencesMeta, b)
+}
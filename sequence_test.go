@@ -0,0 +1,93 @@
+package timedb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSequence(t *testing.T) {
+	dir := t.TempDir()
+	db := New(dir)
+
+	if err := db.SetTableOptions("events", TableOptions{Sequence: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 3; i++ {
+		if err := db.Insert(start, "events", "a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := db.NewBatch()
+	b.Insert(start, "events", "b")
+	b.Insert(start.Add(time.Second), "events", "c")
+	b.Insert(start, "other", "x")
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// the numbers continue after reopening, even without Close
+	db = New(dir)
+	if err := db.Insert(start.Add(2*time.Second), "events", "d"); err != nil {
+		t.Fatal(err)
+	}
+
+	db2 := New(dir)
+	db.Close()
+	if err := db2.Insert(start.Add(3*time.Second), "events", "e"); err != nil {
+		t.Fatal(err)
+	}
+	db2.Close()
+
+	seqs := func(after uint64) []uint64 {
+		s := db.Query("events", start, start.Add(time.Hour), 0, 0)
+		defer s.Close()
+		s.SetAfterSeq(after)
+
+		var result []uint64
+		for s.Scan() {
+			d := s.Data()
+			if trimText(d.Text) == "" {
+				t.Fatalf("invalid record %v", d)
+			}
+			result = append(result, d.Seq)
+		}
+		if s.Error != nil {
+			t.Fatal(s.Error)
+		}
+		return result
+	}
+
+	r := seqs(0)
+	if len(r) != 7 {
+		t.Fatalf("expected 7 records, got %v", r)
+	}
+	for i, seq := range r {
+		if seq != uint64(i+1) {
+			t.Fatalf("invalid sequence %v", r)
+		}
+	}
+
+	if r := seqs(5); len(r) != 2 || r[0] != 6 {
+		t.Fatalf("invalid sequence after 5 %v", r)
+	}
+
+	// the stats work with the numbers
+	st, err := db.DayStats(start, "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Count != 7 {
+		t.Fatalf("invalid stats %+v", st)
+	}
+
+	// tables without the option are not numbered
+	s := db.Query("other", start, start.Add(time.Hour), 0, 0)
+	defer s.Close()
+	if !s.Scan() || s.Data().Seq != 0 {
+		t.Fatalf("invalid record %v", s.Data())
+	}
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/scorredoira/timedb"
+)
+
+// createAnnotation saves an annotation received as JSON.
+func (s *Server) createAnnotation(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, PermWrite, timedb.AnnotationsTable) {
+		return
+	}
+
+	b, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+
+	var a timedb.Annotation
+	if err := json.Unmarshal(b, &a); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.DB.CreateAnnotation(a); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listAnnotations returns the annotations of the range given by the start
+// and end parameters in RFC 3339 format that have the tags, separated by commas.
+func (s *Server) listAnnotations(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, PermRead, timedb.AnnotationsTable) {
+		return
+	}
+
+	q := r.URL.Query()
+
+	start, err := time.Parse(time.RFC3339, q.Get("start"))
+	if err != nil {
+		http.Error(w, "invalid start: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	end, err := time.Parse(time.RFC3339, q.Get("end"))
+	if err != nil {
+		http.Error(w, "invalid end: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	a, err := s.DB.ListAnnotations(start, end, splitTags(q.Get("tags"))...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a)
+}
+
+// grafanaAnnotationsRequest is the request of the annotations of the
+// Grafana JSON data source. The query has the tags separated by commas.
+type grafanaAnnotationsRequest struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	Annotation map[string]interface{} `json:"annotation"`
+}
+
+type grafanaAnnotation struct {
+	Annotation map[string]interface{} `json:"annotation"`
+	Time       int64                  `json:"time"`
+	TimeEnd    int64                  `json:"timeEnd,omitempty"`
+	IsRegion   bool                   `json:"isRegion,omitempty"`
+	Title      string                 `json:"title"`
+	Text       string                 `json:"text"`
+	Tags       []string               `json:"tags"`
+}
+
+// grafanaAnnotations implements the annotations endpoint of the Grafana
+// JSON data source.
+func (s *Server) grafanaAnnotations(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, PermRead, timedb.AnnotationsTable) {
+		return
+	}
+
+	b, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+
+	var req grafanaAnnotationsRequest
+	if err := json.Unmarshal(b, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query, _ := req.Annotation["query"].(string)
+
+	annotations, err := s.DB.ListAnnotations(req.Range.From, req.Range.To, splitTags(query)...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := make([]grafanaAnnotation, len(annotations))
+	for i, a := range annotations {
+		g := grafanaAnnotation{
+			Annotation: req.Annotation,
+			Time:       a.Time.UnixMilli(),
+			Title:      a.Title,
+			Text:       a.Text,
+			Tags:       a.Tags,
+		}
+		if !a.End.IsZero() {
+			g.TimeEnd = a.End.UnixMilli()
+			g.IsRegion = true
+		}
+		if g.Tags == nil {
+			g.Tags = []string{}
+		}
+		result[i] = g
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// splitTags returns the tags of a list separated by commas.
+func splitTags(s string) []string {
+	var tags []string
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
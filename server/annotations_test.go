@@ -0,0 +1,63 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scorredoira/timedb"
+)
+
+func TestAnnotations(t *testing.T) {
+	db := timedb.NewMemory()
+	srv := New(db)
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	body := `{"Time":"2020-01-01T10:00:00Z","End":"2020-01-01T10:05:00Z","Title":"deploy v1.2.3","Tags":["deploy"]}`
+	req := httptest.NewRequest("POST", "/api/v1/annotations", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+
+	body = `{"range":{"from":"2020-01-01T09:00:00Z","to":"2020-01-01T11:00:00Z"},"annotation":{"name":"deploys","query":"deploy"}}`
+	req = httptest.NewRequest("POST", "/annotations", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+
+	var res []grafanaAnnotation
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res) != 1 || res[0].Title != "deploy v1.2.3" || res[0].Time != start.UnixMilli() ||
+		res[0].TimeEnd != start.Add(5*time.Minute).UnixMilli() || res[0].Annotation["name"] != "deploys" {
+		t.Fatalf("invalid result %s", w.Body.String())
+	}
+}
+
+func TestAnnotationsTooLarge(t *testing.T) {
+	srv := New(timedb.NewMemory())
+	srv.Limits.MaxBodySize = 1024
+
+	body := `{"Time":"2020-01-01T10:00:00Z","Title":"` + strings.Repeat("x", 2048) + `"}`
+	for _, url := range []string{"/api/v1/annotations", "/annotations"} {
+		req := httptest.NewRequest("POST", url, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("%s: unexpected status %d: %s", url, w.Code, w.Body.String())
+		}
+	}
+}
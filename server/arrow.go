@@ -0,0 +1,50 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/scorredoira/timedb"
+)
+
+// arrow streams the records of the table in the range given by the start
+// and end parameters, in RFC 3339 format, as Arrow record batches. The
+// records can be filtered with the filter parameter.
+func (s *Server) arrow(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	start, err := time.Parse(time.RFC3339, q.Get("start"))
+	if err != nil {
+		http.Error(w, "invalid start: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	end, err := time.Parse(time.RFC3339, q.Get("end"))
+	if err != nil {
+		http.Error(w, "invalid end: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	table := q.Get("table")
+	if table == "" {
+		http.Error(w, "missing table", http.StatusBadRequest)
+		return
+	}
+	if !s.authorize(w, r, PermRead, table) {
+		return
+	}
+	if !s.allowQuery(w, r, start, end, table) {
+		return
+	}
+
+	sc := s.DB.QueryContext(r.Context(), table, start, end, 0, 0)
+	defer sc.Close()
+	sc.SetFilter(q.Get("filter"))
+
+	w.Header().Set("Content-Type", timedb.ArrowContentType)
+	if err := sc.WriteArrow(w, 0); err != nil {
+		// the stream has started, so the connection is closed
+		// for the client not to take it as complete
+		panic(http.ErrAbortHandler)
+	}
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/scorredoira/timedb"
+)
+
+func TestArrow(t *testing.T) {
+	db := timedb.NewMemory()
+	srv := New(db)
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	db.Insert(start, "nginx", "GET / status=500")
+	db.Insert(start, "nginx", "GET / status=200")
+
+	q := url.Values{
+		"table":  {"nginx"},
+		"filter": {"status=500"},
+		"start":  {start.Format(time.RFC3339)},
+		"end":    {start.Add(time.Hour).Format(time.RFC3339)},
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/arrow?"+q.Encode(), nil)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != timedb.ArrowContentType {
+		t.Fatalf("unexpected content type %s", ct)
+	}
+
+	b := w.Body.Bytes()
+	if !bytes.Contains(b, []byte("GET / status=500")) || bytes.Contains(b, []byte("status=200")) {
+		t.Fatalf("unexpected stream %q", b)
+	}
+	if !bytes.HasSuffix(b, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0, 0, 0, 0}) {
+		t.Fatal("missing end of stream")
+	}
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/scorredoira/timedb"
+)
+
+// Permission is what a token can do.
+type Permission int
+
+const (
+	// PermRead allows the queries.
+	PermRead Permission = 1 << iota
+
+	// PermWrite allows the inserts.
+	PermWrite
+
+	PermReadWrite = PermRead | PermWrite
+)
+
+// Token is a credential of the server. If the server has tokens all the
+// requests need one of them, except the health check.
+type Token struct {
+	// Token is sent in the header "Authorization: Bearer <token>".
+	Token string
+
+	// User and Password are sent with basic authentication.
+	User     string
+	Password string
+
+	// CommonName is the common name of a client certificate verified
+	// by the TLS configuration of the server (see TLSConfig).
+	CommonName string
+
+	Permissions Permission
+
+	// Tables are the tables that the token can access, they can be
+	// patterns like "prod/**". If empty it can access all of them.
+	Tables []string
+}
+
+// allows reports whether the token has the permission in the table.
+func (t *Token) allows(perm Permission, table string) bool {
+	if t.Permissions&perm != perm {
+		return false
+	}
+	if len(t.Tables) == 0 {
+		return true
+	}
+
+	for _, p := range t.Tables {
+		// patterns are only allowed if they are the same
+		if p == table || timedb.MatchTable(p, table) && !strings.ContainsAny(table, "*?[") {
+			return true
+		}
+	}
+	return false
+}
+
+type tokenKey struct{}
+
+// authenticate returns the token of the request or nil if it doesn't have
+// valid credentials.
+func (s *Server) authenticate(r *http.Request) *Token {
+	bearer, hasBearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	user, password, hasBasic := r.BasicAuth()
+
+	var cn string
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		cn = r.TLS.VerifiedChains[0][0].Subject.CommonName
+	}
+
+	for i := range s.Tokens {
+		t := &s.Tokens[i]
+		switch {
+		case hasBearer && t.Token != "" && equal(bearer, t.Token):
+			return t
+		case hasBasic && t.User != "" && equal(user, t.User) && equal(password, t.Password):
+			return t
+		case cn != "" && t.CommonName == cn:
+			return t
+		}
+	}
+	return nil
+}
+
+// equal compares secrets in constant time.
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// authorize checks that the token of the request has the permission in the
+// tables. If not it responds with an error and returns false.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, perm Permission, tables ...string) bool {
+	t, _ := r.Context().Value(tokenKey{}).(*Token)
+	if t == nil {
+		// the authentication is disabled
+		return true
+	}
+
+	for _, table := range tables {
+		if !t.allows(perm, table) {
+			http.Error(w, fmt.Sprintf("access denied to %s", table), http.StatusForbidden)
+			return false
+		}
+	}
+	return true
+}
+
+// withAuth authenticates the requests if the server has tokens.
+func (s *Server) withAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(s.Tokens) == 0 || r.URL.Path == "/health" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		t := s.authenticate(r)
+		if t == nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="timedb"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenKey{}, t)))
+	})
+}
+
+// TLSConfig returns a TLS configuration with the certificate. If clientCAFile
+// is not empty the clients must present a certificate signed by it (mTLS),
+// whose common name can be used in Token.CommonName.
+func TLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCAFile != "" {
+		b, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("invalid client CA %s", clientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// ListenAndServeTLS serves the API with TLS (see TLSConfig).
+func (s *Server) ListenAndServeTLS(addr string, config *tls.Config) error {
+	srv := &http.Server{Addr: addr, Handler: s, TLSConfig: config}
+	return srv.ListenAndServeTLS("", "")
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/scorredoira/timedb"
+)
+
+func TestAuth(t *testing.T) {
+	srv := New(timedb.NewMemory())
+	srv.Tokens = []Token{
+		{Token: "admin", Permissions: PermReadWrite},
+		{User: "reader", Password: "secret", Permissions: PermRead, Tables: []string{"prod/**"}},
+		{CommonName: "agent", Permissions: PermWrite, Tables: []string{"nginx"}},
+	}
+
+	insert := func(table string) *http.Request {
+		body := `[{"Table":"` + table + `","Time":"2020-01-01T10:00:00Z","Text":"GET /"}]`
+		return httptest.NewRequest("POST", "/api/v1/insert", strings.NewReader(body))
+	}
+
+	query := func(table string) *http.Request {
+		q := url.Values{
+			"q":     {"table=" + table},
+			"start": {"2020-01-01T00:00:00Z"},
+			"end":   {"2020-01-02T00:00:00Z"},
+		}
+		return httptest.NewRequest("GET", "/api/v1/query?"+q.Encode(), nil)
+	}
+
+	agent := insert("nginx")
+	agent.TLS = &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "agent"}}}},
+	}
+
+	tests := []struct {
+		name   string
+		req    *http.Request
+		auth   func(r *http.Request)
+		status int
+	}{
+		{"no credentials", insert("nginx"), nil, http.StatusUnauthorized},
+		{"invalid token", insert("nginx"), bearer("x"), http.StatusUnauthorized},
+		{"health", httptest.NewRequest("GET", "/health", nil), nil, http.StatusOK},
+		{"admin insert", insert("nginx"), bearer("admin"), http.StatusNoContent},
+		{"admin query", query("nginx"), bearer("admin"), http.StatusOK},
+		{"reader insert", insert("prod/web"), basic("reader", "secret"), http.StatusForbidden},
+		{"reader query", query("prod/web"), basic("reader", "secret"), http.StatusOK},
+		{"reader other table", query("nginx"), basic("reader", "secret"), http.StatusForbidden},
+		{"reader pattern", query("*"), basic("reader", "secret"), http.StatusForbidden},
+		{"reader wrong password", query("prod/web"), basic("reader", "x"), http.StatusUnauthorized},
+		{"client certificate", agent, nil, http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		if tt.auth != nil {
+			tt.auth(tt.req)
+		}
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, tt.req)
+		if w.Code != tt.status {
+			t.Fatalf("%s: expected %d, got %d: %s", tt.name, tt.status, w.Code, w.Body.String())
+		}
+	}
+}
+
+func bearer(token string) func(r *http.Request) {
+	return func(r *http.Request) {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+func basic(user, password string) func(r *http.Request) {
+	return func(r *http.Request) {
+		r.SetBasicAuth(user, password)
+	}
+}
@@ -0,0 +1,15 @@
+package server
+
+import (
+	"net/http"
+)
+
+// health responds 503 if the database is not healthy (see timedb.DB.Health),
+// for readiness probes.
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	if err := s.DB.Health(); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/scorredoira/timedb"
+)
+
+// insertRecord is a record received by the insert API. Records with an
+// ID are inserted only once so clients can retry.
+type insertRecord struct {
+	Table string
+	Time  time.Time
+	ID    string
+	Text  string
+}
+
+// insert saves a JSON array of records.
+func (s *Server) insert(w http.ResponseWriter, r *http.Request) {
+	b, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+
+	var records []insertRecord
+	if err := json.Unmarshal(b, &records); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for i, rec := range records {
+		if rec.Table == "" {
+			http.Error(w, fmt.Sprintf("record %d: missing table", i), http.StatusBadRequest)
+			return
+		}
+		if strings.ContainsAny(rec.Text, "\r\n") {
+			// checked before saving any record so the request can be retried
+			http.Error(w, fmt.Sprintf("record %d: %v", i, timedb.ErrNewLine), http.StatusBadRequest)
+			return
+		}
+		if !s.authorize(w, r, PermWrite, rec.Table) {
+			return
+		}
+	}
+
+	if !s.allowIngest(w, r, len(records)) {
+		return
+	}
+
+	for _, rec := range records {
+		if rec.Time.IsZero() {
+			rec.Time = time.Now()
+		}
+
+		var err error
+		if rec.ID != "" {
+			err = s.DB.InsertID(rec.Time, rec.Table, rec.ID, rec.Text)
+		} else {
+			err = s.DB.Insert(rec.Time, rec.Table, rec.Text)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scorredoira/timedb"
+)
+
+func TestInsert(t *testing.T) {
+	db := timedb.NewMemory()
+	srv := New(db)
+
+	body := `[
+		{"Table": "app", "Time": "2020-01-01T10:00:00Z", "ID": "a1", "Text": "first"},
+		{"Table": "app", "Time": "2020-01-01T10:00:01Z", "Text": "second"}
+	]`
+
+	// the retry inserts only the record without id
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("POST", "/api/v1/insert", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := db.Query("app", start, start.Add(24*time.Hour), 0, 0)
+	defer s.Close()
+
+	var texts []string
+	for s.Scan() {
+		texts = append(texts, strings.TrimSpace(s.Data().Text))
+	}
+
+	if strings.Join(texts, ",") != "first,second,second" {
+		t.Fatalf("invalid records %v", texts)
+	}
+}
+
+func TestInsertNewLine(t *testing.T) {
+	db := timedb.NewMemory()
+	srv := New(db)
+
+	// the second record would forge a record of another time
+	body := `[
+		{"Table": "app", "Time": "2020-01-01T10:00:00Z", "Text": "first"},
+		{"Table": "app", "Time": "2020-01-01T10:00:01Z", "Text": "x\n1577836800 forged"}
+	]`
+
+	req := httptest.NewRequest("POST", "/api/v1/insert", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := db.Query("app", start, start.Add(24*time.Hour), 0, 0)
+	defer s.Close()
+	if s.Scan() {
+		t.Fatalf("unexpected record %q", s.Data().Text)
+	}
+}
+
+func TestInsertTooLarge(t *testing.T) {
+	srv := New(timedb.NewMemory())
+	srv.Limits.MaxBodySize = 1024
+
+	body := `[{"Table": "app", "Text": "` + strings.Repeat("x", 2048) + `"}]`
+	req := httptest.NewRequest("POST", "/api/v1/insert", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+}
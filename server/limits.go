@@ -0,0 +1,291 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+)
+
+// Limits protect the server from clients that send or query too much.
+// The clients are identified by their token or, without authentication,
+// by their IP address. Zero values are unlimited.
+type Limits struct {
+	// IngestRate is the number of records per second that each client
+	// can insert and IngestBurst how many can be sent at once.
+	IngestRate  float64
+	IngestBurst int
+
+	// QueryBytesRate is the number of bytes per second that the queries
+	// of each client can scan and QueryBytesBurst how many a query can
+	// scan at once. The size of a query is estimated with the files it
+	// reads (see timedb.DB.ScanSize).
+	QueryBytesRate  float64
+	QueryBytesBurst int64
+
+	// MaxConcurrent is the number of requests served at the same time
+	// and MaxClientConcurrent the number of them of each client.
+	MaxConcurrent       int
+	MaxClientConcurrent int
+
+	// MaxBodySize is the size of the largest body of the requests that
+	// insert records, both compressed and decompressed. Zero is
+	// DefaultMaxBodySize.
+	MaxBodySize int64
+}
+
+// DefaultMaxBodySize is the default size of the largest body of the
+// requests that insert records.
+const DefaultMaxBodySize = 64 << 20
+
+// errBodyTooLarge is returned when a body is larger than MaxBodySize
+// after decompressing it.
+var errBodyTooLarge = errors.New("the body is too large")
+
+// the state of the clients is forgotten after they are idle for this time.
+const clientIdle = 10 * time.Minute
+
+// limiter keeps the state of the limits of the clients.
+type limiter struct {
+	mutex   sync.Mutex
+	active  int
+	clients map[string]*clientState
+	sweep   time.Time
+}
+
+type clientState struct {
+	active int
+	ingest tokenBucket
+	query  tokenBucket
+	last   time.Time
+}
+
+// tokenBucket is refilled at a rate up to a burst. It can be in debt
+// after a request that costs more than the tokens available.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take takes n tokens if there are enough or the bucket is full. If not
+// it returns how long to wait until there are.
+func (b *tokenBucket) take(now time.Time, rate, burst, n float64) (bool, time.Duration) {
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else {
+		b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	}
+	b.last = now
+
+	need := math.Min(n, burst)
+	if b.tokens < need {
+		return false, time.Duration((need - b.tokens) / rate * float64(time.Second))
+	}
+	b.tokens -= n
+	return true, 0
+}
+
+// client returns the state of the client of the request. The caller must
+// hold the lock.
+func (l *limiter) client(id string, now time.Time) *clientState {
+	if l.clients == nil {
+		l.clients = make(map[string]*clientState)
+	}
+
+	if now.Sub(l.sweep) > clientIdle {
+		l.sweep = now
+		for k, c := range l.clients {
+			if c.active == 0 && now.Sub(c.last) > clientIdle {
+				delete(l.clients, k)
+			}
+		}
+	}
+
+	c, ok := l.clients[id]
+	if !ok {
+		c = &clientState{}
+		l.clients[id] = c
+	}
+	c.last = now
+	return c
+}
+
+// clientID returns the identity of the client of the request.
+func clientID(r *http.Request) string {
+	if t, _ := r.Context().Value(tokenKey{}).(*Token); t != nil {
+		switch {
+		case t.Token != "":
+			return "token:" + t.Token
+		case t.User != "":
+			return "user:" + t.User
+		default:
+			return "cn:" + t.CommonName
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// withLimits limits the requests served at the same time.
+func (s *Server) withLimits(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		max, maxClient := s.Limits.MaxConcurrent, s.Limits.MaxClientConcurrent
+		if max == 0 && maxClient == 0 || r.URL.Path == "/health" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		l := &s.limiter
+		id := clientID(r)
+
+		l.mutex.Lock()
+		c := l.client(id, time.Now())
+		if max > 0 && l.active >= max || maxClient > 0 && c.active >= maxClient {
+			l.mutex.Unlock()
+			tooMany(w, time.Second, "too many concurrent requests")
+			return
+		}
+		l.active++
+		c.active++
+		l.mutex.Unlock()
+
+		defer func() {
+			l.mutex.Lock()
+			l.active--
+			c.active--
+			l.mutex.Unlock()
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) maxBodySize() int64 {
+	if s.Limits.MaxBodySize > 0 {
+		return s.Limits.MaxBodySize
+	}
+	return DefaultMaxBodySize
+}
+
+// readBody reads the body of a request that inserts records. If it can't
+// be read or it is too large it responds with an error and returns false.
+func (s *Server) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxBodySize()))
+	if err != nil {
+		var e *http.MaxBytesError
+		if errors.As(err, &e) {
+			http.Error(w, errBodyTooLarge.Error(), http.StatusRequestEntityTooLarge)
+			return nil, false
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return b, true
+}
+
+// decodeSnappy decompresses a snappy block checking its size before.
+func (s *Server) decodeSnappy(b []byte) ([]byte, error) {
+	n, err := s2.DecodedLen(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snappy data: %v", err)
+	}
+	if int64(n) > s.maxBodySize() {
+		return nil, errBodyTooLarge
+	}
+
+	data, err := s2.Decode(nil, b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snappy data: %v", err)
+	}
+	return data, nil
+}
+
+// bodyError responds with the error of a body that can't be decoded.
+func bodyError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errBodyTooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+// allowIngest checks that the client can insert n records. If not it
+// responds with an error and returns false.
+func (s *Server) allowIngest(w http.ResponseWriter, r *http.Request, n int) bool {
+	rate := s.Limits.IngestRate
+	if rate <= 0 {
+		return true
+	}
+
+	burst := float64(s.Limits.IngestBurst)
+	if burst <= 0 {
+		burst = math.Max(rate, 1)
+	}
+
+	l := &s.limiter
+	l.mutex.Lock()
+	now := time.Now()
+	ok, wait := l.client(clientID(r), now).ingest.take(now, rate, burst, float64(n))
+	l.mutex.Unlock()
+
+	if !ok {
+		tooMany(w, wait, "ingest rate exceeded")
+	}
+	return ok
+}
+
+// allowQuery checks that the client can scan the files of the tables in
+// the range. If not it responds with an error and returns false.
+func (s *Server) allowQuery(w http.ResponseWriter, r *http.Request, start, end time.Time, tables ...string) bool {
+	rate := s.Limits.QueryBytesRate
+	if rate <= 0 {
+		return true
+	}
+
+	burst := float64(s.Limits.QueryBytesBurst)
+	if burst <= 0 {
+		burst = math.Max(rate, 1)
+	}
+
+	var size int64
+	for _, table := range tables {
+		n, err := s.DB.ScanSize(table, start, end)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return false
+		}
+		size += n
+	}
+
+	l := &s.limiter
+	l.mutex.Lock()
+	now := time.Now()
+	ok, wait := l.client(clientID(r), now).query.take(now, rate, burst, float64(size))
+	l.mutex.Unlock()
+
+	if !ok {
+		tooMany(w, wait, fmt.Sprintf("query rate exceeded: the query scans %d bytes", size))
+	}
+	return ok
+}
+
+// tooMany responds that the client must wait before retrying.
+func tooMany(w http.ResponseWriter, wait time.Duration, msg string) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, msg, http.StatusTooManyRequests)
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scorredoira/timedb"
+)
+
+func TestIngestLimit(t *testing.T) {
+	srv := New(timedb.NewMemory())
+	srv.Limits = Limits{IngestRate: 0.001, IngestBurst: 2}
+
+	insert := func(n int) *httptest.ResponseRecorder {
+		records := make([]string, n)
+		for i := range records {
+			records[i] = `{"Table":"nginx","Text":"GET /"}`
+		}
+		body := "[" + strings.Join(records, ",") + "]"
+		req := httptest.NewRequest("POST", "/api/v1/insert", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := insert(2); w.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+
+	w := insert(1)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestQueryLimit(t *testing.T) {
+	db := timedb.NewMemory()
+	srv := New(db)
+	srv.Limits = Limits{QueryBytesRate: 0.001, QueryBytesBurst: 100}
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 10; i++ {
+		if err := db.Insert(start, "nginx", "GET / status=500"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	query := func() int {
+		q := url.Values{
+			"q":     {"table=nginx"},
+			"start": {start.Format(time.RFC3339)},
+			"end":   {start.Add(time.Hour).Format(time.RFC3339)},
+		}
+		req := httptest.NewRequest("GET", "/api/v1/query?"+q.Encode(), nil)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// the first query leaves the client in debt
+	if code := query(); code != http.StatusOK {
+		t.Fatalf("unexpected status %d", code)
+	}
+	if code := query(); code != http.StatusTooManyRequests {
+		t.Fatalf("unexpected status %d", code)
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	srv := &Server{Limits: Limits{MaxConcurrent: 1}}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	h := srv.withLimits(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		close(done)
+	}()
+	<-started
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+
+	close(release)
+	<-done
+}
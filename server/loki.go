@@ -0,0 +1,197 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scorredoira/timedb"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type lokiStream struct {
+	labels  timedb.Labels
+	entries []lokiEntry
+}
+
+type lokiEntry struct {
+	time time.Time
+	line string
+}
+
+// lokiTable returns the table of a Loki stream.
+func (s *Server) lokiTable(labels timedb.Labels) string {
+	if s.LokiTable != nil {
+		return s.LokiTable(labels)
+	}
+
+	for _, k := range []string{"job", "app"} {
+		if v := labels[k]; v != "" {
+			return v
+		}
+	}
+	return "loki"
+}
+
+// lokiPush implements the Loki push API both in JSON and protobuf.
+func (s *Server) lokiPush(w http.ResponseWriter, r *http.Request) {
+	body, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+
+	var streams []lokiStream
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		streams, err = parseLokiJSON(body)
+	} else {
+		// the protobuf body is compressed with the snappy block format
+		body, err = s.decodeSnappy(body)
+		if err == nil {
+			streams, err = parseLokiProto(body)
+		}
+	}
+	if err != nil {
+		bodyError(w, err)
+		return
+	}
+
+	tables := make([]string, len(streams))
+	for i, st := range streams {
+		tables[i] = s.lokiTable(st.labels)
+	}
+	if !s.authorize(w, r, PermWrite, tables...) {
+		return
+	}
+
+	var entries int
+	for _, st := range streams {
+		entries += len(st.entries)
+	}
+	if !s.allowIngest(w, r, entries) {
+		return
+	}
+
+	// the invalid entries, like the ones with several lines, reject the
+	// request before anything is written so the client can't duplicate
+	// records retrying it
+	b := s.DB.NewBatch()
+	for i, st := range streams {
+		table := tables[i]
+		for _, e := range st.entries {
+			if err := b.Insert(e.time, table, strings.TrimRight(e.line, "\r\n")); err != nil {
+				b.Discard()
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	if err := b.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func parseLokiJSON(b []byte) ([]lokiStream, error) {
+	var req struct {
+		Streams []struct {
+			Stream map[string]string
+			Values [][]string
+		}
+	}
+
+	if err := json.Unmarshal(b, &req); err != nil {
+		return nil, err
+	}
+
+	var streams []lokiStream
+	for _, st := range req.Streams {
+		ls := lokiStream{labels: st.Stream}
+		for _, v := range st.Values {
+			if len(v) < 2 {
+				return nil, fmt.Errorf("invalid entry %v", v)
+			}
+
+			ns, err := strconv.ParseInt(v[0], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timestamp %s", v[0])
+			}
+
+			ls.entries = append(ls.entries, lokiEntry{time: time.Unix(0, ns), line: v[1]})
+		}
+		streams = append(streams, ls)
+	}
+
+	return streams, nil
+}
+
+// parseLokiProto decodes a logproto.PushRequest.
+func parseLokiProto(b []byte) ([]lokiStream, error) {
+	var streams []lokiStream
+	err := parseMessage(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+
+		var st lokiStream
+		err := parseMessage(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+			switch num {
+			case 1:
+				labels, err := timedb.ParseLabels(string(v))
+				if err != nil {
+					return err
+				}
+				st.labels = labels
+			case 2:
+				e, err := parseLokiEntry(v)
+				if err != nil {
+					return err
+				}
+				st.entries = append(st.entries, e)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		streams = append(streams, st)
+		return nil
+	})
+
+	return streams, err
+}
+
+func parseLokiEntry(b []byte) (lokiEntry, error) {
+	var e lokiEntry
+	err := parseMessage(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch num {
+		case 1:
+			var sec, nsec int64
+			err := parseMessage(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				x, _ := protowire.ConsumeVarint(v)
+				switch num {
+				case 1:
+					sec = int64(x)
+				case 2:
+					nsec = int64(x)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			e.time = time.Unix(sec, nsec)
+		case 2:
+			e.line = string(v)
+		}
+		return nil
+	})
+	return e, err
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/scorredoira/timedb"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestLokiPushJSON(t *testing.T) {
+	db := timedb.NewMemory()
+	srv := New(db)
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	body := `{"streams":[{"stream":{"job":"nginx"},"values":[["` + strconv.FormatInt(start.UnixNano(), 10) + `","GET /"]]}]}`
+
+	req := httptest.NewRequest("POST", "/loki/api/v1/push", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+
+	assertLine(t, db, "nginx", start, " GET /")
+}
+
+func TestLokiPushProto(t *testing.T) {
+	db := timedb.NewMemory()
+	srv := New(db)
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+
+	var ts []byte
+	ts = protowire.AppendTag(ts, 1, protowire.VarintType)
+	ts = protowire.AppendVarint(ts, uint64(start.Unix()))
+
+	var entry []byte
+	entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+	entry = protowire.AppendBytes(entry, ts)
+	entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+	entry = protowire.AppendString(entry, "hello")
+
+	var stream []byte
+	stream = protowire.AppendTag(stream, 1, protowire.BytesType)
+	stream = protowire.AppendString(stream, `{app="api", env="prod"}`)
+	stream = protowire.AppendTag(stream, 2, protowire.BytesType)
+	stream = protowire.AppendBytes(stream, entry)
+
+	var push []byte
+	push = protowire.AppendTag(push, 1, protowire.BytesType)
+	push = protowire.AppendBytes(push, stream)
+
+	req := httptest.NewRequest("POST", "/loki/api/v1/push", strings.NewReader(string(s2.EncodeSnappy(nil, push))))
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+
+	assertLine(t, db, "api", start, " hello")
+}
+
+func TestLokiPushMultiline(t *testing.T) {
+	db := timedb.NewMemory()
+	srv := New(db)
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	ns := strconv.FormatInt(start.UnixNano(), 10)
+
+	// the second entry would add a forged record after the first one
+	body := `{"streams":[{"stream":{"job":"nginx"},"values":[["` + ns + `","GET /\n"],["` + ns + `","panic\n1577869200 forged"]]}]}`
+
+	req := httptest.NewRequest("POST", "/loki/api/v1/push", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+
+	// nothing is written so the client can send the valid entries again
+	scanner := db.Query("nginx", start, start, 0, 0)
+	defer scanner.Close()
+	if scanner.Scan() {
+		t.Fatalf("unexpected line %q", scanner.Data().Text)
+	}
+
+	// the new line at the end is not part of the entry
+	body = `{"streams":[{"stream":{"job":"nginx"},"values":[["` + ns + `","GET /\n"]]}]}`
+	req = httptest.NewRequest("POST", "/loki/api/v1/push", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+
+	assertLine(t, db, "nginx", start, " GET /")
+}
+
+func TestLokiPushTooLarge(t *testing.T) {
+	srv := New(timedb.NewMemory())
+	srv.Limits.MaxBodySize = 1024
+
+	for _, body := range []string{
+		`{"streams":[{"stream":{"job":"nginx"},"values":[["1","` + strings.Repeat("x", 2048) + `"]]}]}`,
+		string(s2.EncodeSnappy(nil, []byte(strings.Repeat("x", 4096)))),
+	} {
+		req := httptest.NewRequest("POST", "/loki/api/v1/push", strings.NewReader(body))
+		if strings.HasPrefix(body, "{") {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+		}
+	}
+}
+
+func assertLine(t *testing.T, db *timedb.DB, table string, start time.Time, expected string) {
+	t.Helper()
+
+	scanner := db.Query(table, start, start, 0, 0)
+	defer scanner.Close()
+
+	if !scanner.Scan() {
+		t.Fatal("expected a line")
+	}
+
+	if text := scanner.Data().Text; text != expected {
+		t.Fatalf("unexpected data %q", text)
+	}
+}
@@ -0,0 +1,534 @@
+package server
+
+import (
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scorredoira/timedb"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The OpenTelemetry protocol over HTTP. The requests are protobuf or JSON
+// messages, optionally compressed with gzip, decoded here by hand like
+// the ones of the Prometheus and Loki APIs.
+
+// otlpLog is a log record of an OTLP request.
+type otlpLog struct {
+	time   time.Time
+	labels timedb.Labels
+	record otlpRecord
+}
+
+// otlpRecord is the JSON text stored for each log record.
+type otlpRecord struct {
+	Body     interface{}   `json:"body"`
+	Severity string        `json:"severity,omitempty"`
+	TraceID  string        `json:"trace_id,omitempty"`
+	SpanID   string        `json:"span_id,omitempty"`
+	Labels   timedb.Labels `json:"labels,omitempty"`
+}
+
+// otlpTable returns the table of the records of a resource.
+func (s *Server) otlpTable(labels timedb.Labels) string {
+	if s.OTLPTable != nil {
+		return s.OTLPTable(labels)
+	}
+
+	if v := labels["service.name"]; v != "" {
+		return v
+	}
+	return "otlp"
+}
+
+// readOTLP returns the body of an OTLP request and whether it is JSON.
+// Both the compressed and the decompressed body are limited to
+// MaxBodySize.
+func (s *Server) readOTLP(r *http.Request) ([]byte, bool, error) {
+	max := s.maxBodySize()
+	compressed := &io.LimitedReader{R: r.Body, N: max + 1}
+
+	var body io.Reader = compressed
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(compressed)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid gzip data: %v", err)
+		}
+		defer gz.Close()
+		body = io.LimitReader(gz, max+1)
+	}
+
+	b, err := io.ReadAll(body)
+	if compressed.N == 0 || int64(len(b)) > max {
+		return nil, false, errBodyTooLarge
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return b, strings.HasPrefix(r.Header.Get("Content-Type"), "application/json"), nil
+}
+
+// writeOTLP writes an empty response, which means that all the
+// records were accepted.
+func writeOTLP(w http.ResponseWriter, isJSON bool) {
+	if isJSON {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.WriteHeader(http.StatusOK)
+}
+
+// otlpLogs implements the OTLP/HTTP logs endpoint. The records are saved in
+// the table of the service as JSON with the body and the attributes of the
+// resource, the scope and the record as labels.
+func (s *Server) otlpLogs(w http.ResponseWriter, r *http.Request) {
+	b, isJSON, err := s.readOTLP(r)
+	if err != nil {
+		bodyError(w, err)
+		return
+	}
+
+	var logs []otlpLog
+	if isJSON {
+		logs, err = parseOTLPLogsJSON(b)
+	} else {
+		logs, err = parseOTLPLogs(b)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tables := make([]string, len(logs))
+	for i, l := range logs {
+		tables[i] = s.otlpTable(l.labels)
+	}
+	if !s.authorize(w, r, PermWrite, tables...) {
+		return
+	}
+	if !s.allowIngest(w, r, len(logs)) {
+		return
+	}
+
+	for i, l := range logs {
+		l.record.Labels = l.labels
+		text, err := json.Marshal(l.record)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.DB.Insert(l.time, tables[i], string(text)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeOTLP(w, isJSON)
+}
+
+// otlpSeverities are the names of the severity numbers, used when the
+// records don't have a severity text.
+var otlpSeverities = []string{"", "TRACE", "DEBUG", "INFO", "WARN", "ERROR", "FATAL"}
+
+func otlpSeverity(n int) string {
+	if n <= 0 || n > 24 {
+		return ""
+	}
+	return otlpSeverities[(n-1)/4+1]
+}
+
+// otlpTime returns the time of a record, the observed time if it
+// doesn't have one or now.
+func otlpTime(t, observed uint64) time.Time {
+	switch {
+	case t != 0:
+		return time.Unix(0, int64(t))
+	case observed != 0:
+		return time.Unix(0, int64(observed))
+	default:
+		return time.Now()
+	}
+}
+
+// addLabels returns a copy of the labels with the others added.
+func addLabels(labels, others timedb.Labels) timedb.Labels {
+	result := make(timedb.Labels, len(labels)+len(others))
+	for k, v := range labels {
+		result[k] = v
+	}
+	for k, v := range others {
+		result[k] = v
+	}
+	return result
+}
+
+// labelValue returns the value of an attribute as a label.
+func labelValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case int64, bool:
+		return fmt.Sprint(v)
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
+
+// parseOTLPLogs decodes an ExportLogsServiceRequest.
+func parseOTLPLogs(b []byte) ([]otlpLog, error) {
+	var logs []otlpLog
+
+	err := parseMessage(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+
+		// ResourceLogs: the resource and the scope logs
+		var resource timedb.Labels
+		var scopes [][]byte
+		err := parseMessage(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+			var err error
+			switch num {
+			case 1:
+				resource, err = parseOTLPResource(v)
+			case 2:
+				scopes = append(scopes, v)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, sc := range scopes {
+			labels := resource
+			var records [][]byte
+			err := parseMessage(sc, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				var err error
+				switch num {
+				case 1:
+					var scope timedb.Labels
+					scope, err = parseOTLPScope(v)
+					labels = addLabels(resource, scope)
+				case 2:
+					records = append(records, v)
+				}
+				return err
+			})
+			if err != nil {
+				return err
+			}
+
+			for _, rec := range records {
+				l, err := parseOTLPLogRecord(rec, labels)
+				if err != nil {
+					return err
+				}
+				logs = append(logs, l)
+			}
+		}
+		return nil
+	})
+
+	return logs, err
+}
+
+func parseOTLPLogRecord(b []byte, labels timedb.Labels) (otlpLog, error) {
+	var t, observed uint64
+	var severity int
+	var attrs timedb.Labels
+
+	l := otlpLog{}
+	err := parseMessage(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		var err error
+		switch num {
+		case 1:
+			t = decodeFixed64(v)
+		case 11:
+			observed = decodeFixed64(v)
+		case 2:
+			x, _ := protowire.ConsumeVarint(v)
+			severity = int(x)
+		case 3:
+			l.record.Severity = string(v)
+		case 5:
+			l.record.Body, err = parseAnyValue(v, 0)
+		case 6:
+			var k string
+			var value interface{}
+			if k, value, err = parseKeyValue(v, 0); err == nil {
+				if attrs == nil {
+					attrs = timedb.Labels{}
+				}
+				attrs[k] = labelValue(value)
+			}
+		case 9:
+			l.record.TraceID = hex.EncodeToString(v)
+		case 10:
+			l.record.SpanID = hex.EncodeToString(v)
+		}
+		return err
+	})
+
+	if l.record.Severity == "" {
+		l.record.Severity = otlpSeverity(severity)
+	}
+	l.time = otlpTime(t, observed)
+	l.labels = addLabels(labels, attrs)
+	return l, err
+}
+
+// parseOTLPResource returns the attributes of a Resource.
+func parseOTLPResource(b []byte) (timedb.Labels, error) {
+	labels := timedb.Labels{}
+	err := parseMessage(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num != 1 {
+			return nil
+		}
+		k, value, err := parseKeyValue(v, 0)
+		labels[k] = labelValue(value)
+		return err
+	})
+	return labels, err
+}
+
+// parseOTLPScope returns the attributes of an InstrumentationScope with
+// its name as the label "otel.scope.name".
+func parseOTLPScope(b []byte) (timedb.Labels, error) {
+	labels := timedb.Labels{}
+	err := parseMessage(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch num {
+		case 1:
+			if len(v) > 0 {
+				labels["otel.scope.name"] = string(v)
+			}
+		case 3:
+			k, value, err := parseKeyValue(v, 0)
+			labels[k] = labelValue(value)
+			return err
+		}
+		return nil
+	})
+	return labels, err
+}
+
+// maxAnyValueDepth is the maximum nesting of the arrays and maps of an
+// AnyValue.
+const maxAnyValueDepth = 32
+
+var errAnyValueDepth = fmt.Errorf("values nested more than %d levels", maxAnyValueDepth)
+
+// parseKeyValue decodes a KeyValue. depth is the nesting of the value.
+func parseKeyValue(b []byte, depth int) (string, interface{}, error) {
+	var key string
+	var value interface{}
+	err := parseMessage(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		var err error
+		switch num {
+		case 1:
+			key = string(v)
+		case 2:
+			value, err = parseAnyValue(v, depth)
+		}
+		return err
+	})
+	return key, value, err
+}
+
+// parseAnyValue decodes an AnyValue as the value that it has in JSON.
+// depth is the number of arrays and maps that contain it.
+func parseAnyValue(b []byte, depth int) (interface{}, error) {
+	if depth > maxAnyValueDepth {
+		return nil, errAnyValueDepth
+	}
+
+	var value interface{}
+	err := parseMessage(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch num {
+		case 1:
+			value = string(v)
+		case 2:
+			x, _ := protowire.ConsumeVarint(v)
+			value = x != 0
+		case 3:
+			x, _ := protowire.ConsumeVarint(v)
+			value = int64(x)
+		case 4:
+			value = math.Float64frombits(decodeFixed64(v))
+		case 5:
+			var list []interface{}
+			err := parseMessage(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				item, err := parseAnyValue(v, depth+1)
+				list = append(list, item)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			value = list
+		case 6:
+			m := make(map[string]interface{})
+			err := parseMessage(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				k, item, err := parseKeyValue(v, depth+1)
+				m[k] = item
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			value = m
+		case 7:
+			value = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	return value, err
+}
+
+// The OTLP JSON encoding. The 64 bit integers are strings and the
+// trace and span ids hexadecimal.
+
+type otlpKeyValue struct {
+	Key   string
+	Value otlpAnyValue
+}
+
+type otlpAnyValue struct {
+	StringValue *string
+	BoolValue   *bool
+	IntValue    json.Number
+	DoubleValue *float64
+	BytesValue  []byte
+	ArrayValue  *struct{ Values []otlpAnyValue }
+	KvlistValue *struct{ Values []otlpKeyValue }
+}
+
+func (v otlpAnyValue) value() interface{} {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return *v.BoolValue
+	case v.IntValue != "":
+		i, _ := v.IntValue.Int64()
+		return i
+	case v.DoubleValue != nil:
+		return *v.DoubleValue
+	case v.BytesValue != nil:
+		return v.BytesValue
+	case v.ArrayValue != nil:
+		list := make([]interface{}, len(v.ArrayValue.Values))
+		for i, item := range v.ArrayValue.Values {
+			list[i] = item.value()
+		}
+		return list
+	case v.KvlistValue != nil:
+		m := make(map[string]interface{}, len(v.KvlistValue.Values))
+		for _, kv := range v.KvlistValue.Values {
+			m[kv.Key] = kv.Value.value()
+		}
+		return m
+	default:
+		return nil
+	}
+}
+
+func otlpAttributes(attrs []otlpKeyValue) timedb.Labels {
+	labels := timedb.Labels{}
+	for _, kv := range attrs {
+		labels[kv.Key] = labelValue(kv.Value.value())
+	}
+	return labels
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue
+}
+
+type otlpScope struct {
+	Name       string
+	Attributes []otlpKeyValue
+}
+
+func (s otlpScope) labels() timedb.Labels {
+	labels := otlpAttributes(s.Attributes)
+	if s.Name != "" {
+		labels["otel.scope.name"] = s.Name
+	}
+	return labels
+}
+
+func parseOTLPLogsJSON(b []byte) ([]otlpLog, error) {
+	var req struct {
+		ResourceLogs []struct {
+			Resource  otlpResource
+			ScopeLogs []struct {
+				Scope      otlpScope
+				LogRecords []struct {
+					TimeUnixNano         json.Number
+					ObservedTimeUnixNano json.Number
+					SeverityNumber       int
+					SeverityText         string
+					Body                 otlpAnyValue
+					Attributes           []otlpKeyValue
+					TraceID              string
+					SpanID               string
+				}
+			}
+		}
+	}
+
+	if err := json.Unmarshal(b, &req); err != nil {
+		return nil, err
+	}
+
+	var logs []otlpLog
+	for _, rl := range req.ResourceLogs {
+		resource := otlpAttributes(rl.Resource.Attributes)
+		for _, sl := range rl.ScopeLogs {
+			labels := addLabels(resource, sl.Scope.labels())
+			for _, lr := range sl.LogRecords {
+				t, _ := strconv.ParseUint(lr.TimeUnixNano.String(), 10, 64)
+				observed, _ := strconv.ParseUint(lr.ObservedTimeUnixNano.String(), 10, 64)
+
+				l := otlpLog{
+					time:   otlpTime(t, observed),
+					labels: labels,
+					record: otlpRecord{
+						Body:     lr.Body.value(),
+						Severity: lr.SeverityText,
+						TraceID:  strings.ToLower(lr.TraceID),
+						SpanID:   strings.ToLower(lr.SpanID),
+					},
+				}
+				if l.record.Severity == "" {
+					l.record.Severity = otlpSeverity(lr.SeverityNumber)
+				}
+				if len(lr.Attributes) > 0 {
+					l.labels = addLabels(labels, otlpAttributes(lr.Attributes))
+				}
+				logs = append(logs, l)
+			}
+		}
+	}
+
+	return logs, nil
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scorredoira/timedb"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func appendKeyValue(b []byte, num protowire.Number, key, value string) []byte {
+	var v []byte
+	v = protowire.AppendTag(v, 1, protowire.BytesType)
+	v = protowire.AppendString(v, value)
+
+	var kv []byte
+	kv = protowire.AppendTag(kv, 1, protowire.BytesType)
+	kv = protowire.AppendString(kv, key)
+	kv = protowire.AppendTag(kv, 2, protowire.BytesType)
+	kv = protowire.AppendBytes(kv, v)
+
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, kv)
+}
+
+func otlpRecordOf(t *testing.T, db *timedb.DB, table string, start time.Time) otlpRecord {
+	t.Helper()
+
+	s := db.Query(table, start, start, 0, 0)
+	defer s.Close()
+	if !s.Scan() {
+		t.Fatalf("expected a record in %s", table)
+	}
+
+	var r otlpRecord
+	if err := json.Unmarshal([]byte(s.Data().Text), &r); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestOTLPLogs(t *testing.T) {
+	db := timedb.NewMemory()
+	srv := New(db)
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+
+	var resource []byte
+	resource = appendKeyValue(resource, 1, "service.name", "checkout")
+
+	var scope []byte
+	scope = protowire.AppendTag(scope, 1, protowire.BytesType)
+	scope = protowire.AppendString(scope, "http")
+
+	var body []byte
+	body = protowire.AppendTag(body, 1, protowire.BytesType)
+	body = protowire.AppendString(body, "GET /\npanic")
+
+	var record []byte
+	record = protowire.AppendTag(record, 1, protowire.Fixed64Type)
+	record = protowire.AppendFixed64(record, uint64(start.UnixNano()))
+	record = protowire.AppendTag(record, 2, protowire.VarintType)
+	record = protowire.AppendVarint(record, 17)
+	record = protowire.AppendTag(record, 5, protowire.BytesType)
+	record = protowire.AppendBytes(record, body)
+	record = appendKeyValue(record, 6, "http.method", "GET")
+	record = protowire.AppendTag(record, 9, protowire.BytesType)
+	record = protowire.AppendBytes(record, []byte{0xAB, 0xCD})
+
+	var scopeLogs []byte
+	scopeLogs = protowire.AppendTag(scopeLogs, 1, protowire.BytesType)
+	scopeLogs = protowire.AppendBytes(scopeLogs, scope)
+	scopeLogs = protowire.AppendTag(scopeLogs, 2, protowire.BytesType)
+	scopeLogs = protowire.AppendBytes(scopeLogs, record)
+
+	var resourceLogs []byte
+	resourceLogs = protowire.AppendTag(resourceLogs, 1, protowire.BytesType)
+	resourceLogs = protowire.AppendBytes(resourceLogs, resource)
+	resourceLogs = protowire.AppendTag(resourceLogs, 2, protowire.BytesType)
+	resourceLogs = protowire.AppendBytes(resourceLogs, scopeLogs)
+
+	var req []byte
+	req = protowire.AppendTag(req, 1, protowire.BytesType)
+	req = protowire.AppendBytes(req, resourceLogs)
+
+	r := httptest.NewRequest("POST", "/v1/logs", bytes.NewReader(req))
+	r.Header.Set("Content-Type", "application/x-protobuf")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+
+	rec := otlpRecordOf(t, db, "checkout", start)
+	if rec.Body != "GET /\npanic" || rec.Severity != "ERROR" || rec.TraceID != "abcd" {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+	if rec.Labels["service.name"] != "checkout" || rec.Labels["otel.scope.name"] != "http" || rec.Labels["http.method"] != "GET" {
+		t.Fatalf("unexpected labels %v", rec.Labels)
+	}
+}
+
+func TestOTLPLogsJSON(t *testing.T) {
+	db := timedb.NewMemory()
+	srv := New(db)
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	body := `{"resourceLogs":[{"resource":{"attributes":[{"key":"host.name","value":{"stringValue":"web1"}}]},
+		"scopeLogs":[{"scope":{"name":"app"},"logRecords":[{"timeUnixNano":"` + strconv.FormatInt(start.UnixNano(), 10) + `",
+		"severityText":"INFO","body":{"kvlistValue":{"values":[{"key":"status","value":{"intValue":"200"}}]}},
+		"attributes":[{"key":"retry","value":{"boolValue":true}}]}]}]}]}`
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(body))
+	zw.Close()
+
+	r := httptest.NewRequest("POST", "/v1/logs", &gz)
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "{}" {
+		t.Fatalf("unexpected response %d: %s", w.Code, w.Body.String())
+	}
+
+	// without service.name the records go to the otlp table
+	rec := otlpRecordOf(t, db, "otlp", start)
+	if m, ok := rec.Body.(map[string]interface{}); !ok || m["status"] != float64(200) {
+		t.Fatalf("unexpected body %v", rec.Body)
+	}
+	if rec.Severity != "INFO" || rec.Labels["host.name"] != "web1" || rec.Labels["otel.scope.name"] != "app" || rec.Labels["retry"] != "true" {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+}
+
+func TestOTLPTooLarge(t *testing.T) {
+	srv := New(timedb.NewMemory())
+	srv.Limits.MaxBodySize = 1024
+
+	// a small body that is large decompressed and a large one
+	var bomb bytes.Buffer
+	zw := gzip.NewWriter(&bomb)
+	zw.Write(bytes.Repeat([]byte{' '}, 1<<20))
+	zw.Close()
+
+	for _, body := range [][]byte{bomb.Bytes(), bytes.Repeat([]byte{' '}, 2048)} {
+		for _, path := range []string{"/v1/logs", "/v1/metrics"} {
+			r := httptest.NewRequest("POST", path, bytes.NewReader(body))
+			r.Header.Set("Content-Type", "application/json")
+			if len(body) < 1024 {
+				r.Header.Set("Content-Encoding", "gzip")
+			}
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, r)
+
+			if w.Code != http.StatusRequestEntityTooLarge {
+				t.Fatalf("%s: unexpected status %d: %s", path, w.Code, w.Body.String())
+			}
+		}
+	}
+}
+
+func TestParseAnyValueDepth(t *testing.T) {
+	// nested ArrayValues: AnyValue{array_value: ArrayValue{values: [...]}}
+	nested := func(levels int) []byte {
+		v := protowire.AppendTag(nil, 1, protowire.BytesType)
+		v = protowire.AppendString(v, "a")
+		for i := 0; i < levels; i++ {
+			var array []byte
+			array = protowire.AppendTag(array, 1, protowire.BytesType)
+			array = protowire.AppendBytes(array, v)
+			v = protowire.AppendTag(nil, 5, protowire.BytesType)
+			v = protowire.AppendBytes(v, array)
+		}
+		return v
+	}
+
+	if _, err := parseAnyValue(nested(maxAnyValueDepth), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseAnyValue(nested(maxAnyValueDepth+1), 0); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,401 @@
+package server
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/scorredoira/timedb"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// otlpPoint is a value of a metric of an OTLP request.
+type otlpPoint struct {
+	table  string
+	time   time.Time
+	value  float64
+	labels timedb.Labels
+}
+
+// otlpMetrics implements the OTLP/HTTP metrics endpoint. Each metric is
+// stored in a numeric table with its name and the attributes of the
+// resource, the scope and the data point as labels. Histograms and
+// summaries are stored like Prometheus does, in the tables name_bucket,
+// with the label "le", or name with the label "quantile", name_sum and
+// name_count.
+func (s *Server) otlpMetrics(w http.ResponseWriter, r *http.Request) {
+	b, isJSON, err := s.readOTLP(r)
+	if err != nil {
+		bodyError(w, err)
+		return
+	}
+
+	var points []otlpPoint
+	if isJSON {
+		points, err = parseOTLPMetricsJSON(b)
+	} else {
+		points, err = parseOTLPMetrics(b)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tables := make([]string, len(points))
+	for i, p := range points {
+		tables[i] = p.table
+	}
+	if !s.authorize(w, r, PermWrite, tables...) {
+		return
+	}
+	if !s.allowIngest(w, r, len(points)) {
+		return
+	}
+
+	for _, p := range points {
+		if err := s.DB.InsertValue(p.time, p.table, p.value, p.labels); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeOTLP(w, isJSON)
+}
+
+// otlpDataPoint are the fields of the data points of all the types.
+type otlpDataPoint struct {
+	time   uint64
+	labels timedb.Labels
+
+	value float64
+
+	count, sum   float64
+	hasSum       bool
+	bounds       []float64
+	bucketCounts []uint64
+	quantiles    [][2]float64
+}
+
+// add appends the values of the data point of the metric to points.
+func (d otlpDataPoint) add(points []otlpPoint, name, kind string) []otlpPoint {
+	t := otlpTime(d.time, 0)
+	point := func(table string, v float64, labels timedb.Labels) {
+		points = append(points, otlpPoint{table: table, time: t, value: v, labels: labels})
+	}
+
+	switch kind {
+	case "gauge", "sum":
+		point(name, d.value, d.labels)
+		return points
+
+	case "histogram":
+		var cumulative uint64
+		for i, n := range d.bucketCounts {
+			cumulative += n
+			le := "+Inf"
+			if i < len(d.bounds) {
+				le = strconv.FormatFloat(d.bounds[i], 'g', -1, 64)
+			}
+			point(name+"_bucket", float64(cumulative), addLabels(d.labels, timedb.Labels{"le": le}))
+		}
+
+	case "summary":
+		for _, q := range d.quantiles {
+			point(name, q[1], addLabels(d.labels, timedb.Labels{"quantile": strconv.FormatFloat(q[0], 'g', -1, 64)}))
+		}
+	}
+
+	// the exponential histograms only have the sum and the count
+	if d.hasSum {
+		point(name+"_sum", d.sum, d.labels)
+	}
+	point(name+"_count", d.count, d.labels)
+	return points
+}
+
+// otlpMetricKinds are the data fields of a Metric by number.
+var otlpMetricKinds = map[protowire.Number]string{
+	5:  "gauge",
+	7:  "sum",
+	9:  "histogram",
+	10: "exponential",
+	11: "summary",
+}
+
+// parseOTLPMetrics decodes an ExportMetricsServiceRequest.
+func parseOTLPMetrics(b []byte) ([]otlpPoint, error) {
+	var points []otlpPoint
+
+	err := parseMessage(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+
+		// ResourceMetrics: the resource and the scope metrics
+		var resource timedb.Labels
+		var scopes [][]byte
+		err := parseMessage(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+			var err error
+			switch num {
+			case 1:
+				resource, err = parseOTLPResource(v)
+			case 2:
+				scopes = append(scopes, v)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, sc := range scopes {
+			labels := resource
+			var metrics [][]byte
+			err := parseMessage(sc, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				var err error
+				switch num {
+				case 1:
+					var scope timedb.Labels
+					scope, err = parseOTLPScope(v)
+					labels = addLabels(resource, scope)
+				case 2:
+					metrics = append(metrics, v)
+				}
+				return err
+			})
+			if err != nil {
+				return err
+			}
+
+			for _, m := range metrics {
+				if points, err = parseOTLPMetric(m, labels, points); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+
+	return points, err
+}
+
+func parseOTLPMetric(b []byte, labels timedb.Labels, points []otlpPoint) ([]otlpPoint, error) {
+	var name, kind string
+	var data []byte
+	err := parseMessage(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num == 1 {
+			name = string(v)
+		} else if k, ok := otlpMetricKinds[num]; ok {
+			kind, data = k, v
+		}
+		return nil
+	})
+	if err != nil || name == "" {
+		return points, err
+	}
+
+	err = parseMessage(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num != 1 {
+			return nil
+		}
+		d, err := parseOTLPDataPoint(v, kind, labels)
+		if err != nil {
+			return err
+		}
+		points = d.add(points, name, kind)
+		return nil
+	})
+	return points, err
+}
+
+// parseOTLPDataPoint decodes a NumberDataPoint, HistogramDataPoint,
+// ExponentialHistogramDataPoint or SummaryDataPoint.
+func parseOTLPDataPoint(b []byte, kind string, labels timedb.Labels) (otlpDataPoint, error) {
+	// the number of the field of the attributes and the sum
+	attributes, sum := protowire.Number(7), protowire.Number(5)
+	switch kind {
+	case "histogram":
+		attributes = 9
+	case "exponential":
+		attributes = 1
+	}
+
+	var d otlpDataPoint
+	var attrs timedb.Labels
+	err := parseMessage(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch {
+		case num == attributes:
+			k, value, err := parseKeyValue(v, 0)
+			if err != nil {
+				return err
+			}
+			if attrs == nil {
+				attrs = timedb.Labels{}
+			}
+			attrs[k] = labelValue(value)
+
+		case num == 3:
+			d.time = decodeFixed64(v)
+
+		case kind == "gauge" || kind == "sum":
+			switch num {
+			case 4:
+				d.value = math.Float64frombits(decodeFixed64(v))
+			case 6:
+				d.value = float64(int64(decodeFixed64(v)))
+			}
+
+		case num == 4:
+			d.count = float64(decodeFixed64(v))
+
+		case num == sum:
+			d.sum, d.hasSum = math.Float64frombits(decodeFixed64(v)), true
+
+		case kind == "histogram" && num == 6:
+			d.bucketCounts = append(d.bucketCounts, fixed64s(typ, v)...)
+
+		case kind == "histogram" && num == 7:
+			for _, x := range fixed64s(typ, v) {
+				d.bounds = append(d.bounds, math.Float64frombits(x))
+			}
+
+		case kind == "summary" && num == 6:
+			var q [2]float64
+			err := parseMessage(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				if num == 1 || num == 2 {
+					q[num-1] = math.Float64frombits(decodeFixed64(v))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			d.quantiles = append(d.quantiles, q)
+		}
+		return nil
+	})
+
+	d.labels = addLabels(labels, attrs)
+	return d, err
+}
+
+// fixed64s returns the values of a repeated fixed64 or double field,
+// packed or not.
+func fixed64s(typ protowire.Type, v []byte) []uint64 {
+	if typ != protowire.BytesType {
+		return []uint64{decodeFixed64(v)}
+	}
+
+	var values []uint64
+	for len(v) >= 8 {
+		values = append(values, decodeFixed64(v))
+		v = v[8:]
+	}
+	return values
+}
+
+type otlpDataPointJSON struct {
+	Attributes     []otlpKeyValue
+	TimeUnixNano   json.Number
+	AsDouble       *float64
+	AsInt          json.Number
+	Count          json.Number
+	Sum            *float64
+	BucketCounts   []json.Number
+	ExplicitBounds []float64
+	QuantileValues []struct {
+		Quantile float64
+		Value    float64
+	}
+}
+
+type otlpMetricJSON struct {
+	Name                 string
+	Gauge                *struct{ DataPoints []otlpDataPointJSON }
+	Sum                  *struct{ DataPoints []otlpDataPointJSON }
+	Histogram            *struct{ DataPoints []otlpDataPointJSON }
+	ExponentialHistogram *struct{ DataPoints []otlpDataPointJSON }
+	Summary              *struct{ DataPoints []otlpDataPointJSON }
+}
+
+// data returns the kind of the metric and its data points.
+func (m otlpMetricJSON) data() (string, []otlpDataPointJSON) {
+	switch {
+	case m.Gauge != nil:
+		return "gauge", m.Gauge.DataPoints
+	case m.Sum != nil:
+		return "sum", m.Sum.DataPoints
+	case m.Histogram != nil:
+		return "histogram", m.Histogram.DataPoints
+	case m.ExponentialHistogram != nil:
+		return "exponential", m.ExponentialHistogram.DataPoints
+	case m.Summary != nil:
+		return "summary", m.Summary.DataPoints
+	default:
+		return "", nil
+	}
+}
+
+func parseOTLPMetricsJSON(b []byte) ([]otlpPoint, error) {
+	var req struct {
+		ResourceMetrics []struct {
+			Resource     otlpResource
+			ScopeMetrics []struct {
+				Scope   otlpScope
+				Metrics []otlpMetricJSON
+			}
+		}
+	}
+
+	if err := json.Unmarshal(b, &req); err != nil {
+		return nil, err
+	}
+
+	var points []otlpPoint
+	for _, rm := range req.ResourceMetrics {
+		resource := otlpAttributes(rm.Resource.Attributes)
+		for _, sm := range rm.ScopeMetrics {
+			labels := addLabels(resource, sm.Scope.labels())
+			for _, m := range sm.Metrics {
+				kind, data := m.data()
+				if m.Name == "" {
+					continue
+				}
+
+				for _, p := range data {
+					d := otlpDataPoint{labels: labels}
+					d.time, _ = strconv.ParseUint(p.TimeUnixNano.String(), 10, 64)
+					if len(p.Attributes) > 0 {
+						d.labels = addLabels(labels, otlpAttributes(p.Attributes))
+					}
+
+					if p.AsDouble != nil {
+						d.value = *p.AsDouble
+					} else if p.AsInt != "" {
+						i, _ := strconv.ParseInt(p.AsInt.String(), 10, 64)
+						d.value = float64(i)
+					}
+
+					d.count, _ = strconv.ParseFloat(p.Count.String(), 64)
+					if p.Sum != nil {
+						d.sum, d.hasSum = *p.Sum, true
+					}
+					for _, n := range p.BucketCounts {
+						c, _ := strconv.ParseUint(n.String(), 10, 64)
+						d.bucketCounts = append(d.bucketCounts, c)
+					}
+					d.bounds = p.ExplicitBounds
+					for _, q := range p.QuantileValues {
+						d.quantiles = append(d.quantiles, [2]float64{q.Quantile, q.Value})
+					}
+
+					points = d.add(points, m.Name, kind)
+				}
+			}
+		}
+	}
+
+	return points, nil
+}
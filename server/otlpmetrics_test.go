@@ -0,0 +1,149 @@
+package server
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scorredoira/timedb"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func assertValue(t *testing.T, db *timedb.DB, table string, start time.Time, expected float64, labels timedb.Labels) {
+	t.Helper()
+
+	s := db.Query(table, start, start, 0, 0)
+	defer s.Close()
+
+	for s.Scan() {
+		v, l, err := s.Data().Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l.String() == labels.String() {
+			if v != expected {
+				t.Fatalf("expected %v in %s%s, got %v", expected, table, labels, v)
+			}
+			return
+		}
+	}
+	t.Fatalf("expected a value in %s%s", table, labels)
+}
+
+func TestOTLPMetrics(t *testing.T) {
+	db := timedb.NewMemory()
+	srv := New(db)
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+
+	var point []byte
+	point = appendKeyValue(point, 7, "path", "/")
+	point = protowire.AppendTag(point, 3, protowire.Fixed64Type)
+	point = protowire.AppendFixed64(point, uint64(start.UnixNano()))
+	point = protowire.AppendTag(point, 6, protowire.Fixed64Type)
+	point = protowire.AppendFixed64(point, 42)
+
+	var sum []byte
+	sum = protowire.AppendTag(sum, 1, protowire.BytesType)
+	sum = protowire.AppendBytes(sum, point)
+
+	var counter []byte
+	counter = protowire.AppendTag(counter, 1, protowire.BytesType)
+	counter = protowire.AppendString(counter, "http.requests")
+	counter = protowire.AppendTag(counter, 7, protowire.BytesType)
+	counter = protowire.AppendBytes(counter, sum)
+
+	// a histogram with the buckets (-inf, 0.1], (0.1, 1] and (1, +inf)
+	var packedCounts, packedBounds []byte
+	for _, n := range []uint64{3, 2, 1} {
+		packedCounts = protowire.AppendFixed64(packedCounts, n)
+	}
+	for _, b := range []float64{0.1, 1} {
+		packedBounds = protowire.AppendFixed64(packedBounds, math.Float64bits(b))
+	}
+
+	var hp []byte
+	hp = protowire.AppendTag(hp, 3, protowire.Fixed64Type)
+	hp = protowire.AppendFixed64(hp, uint64(start.UnixNano()))
+	hp = protowire.AppendTag(hp, 4, protowire.Fixed64Type)
+	hp = protowire.AppendFixed64(hp, 6)
+	hp = protowire.AppendTag(hp, 5, protowire.Fixed64Type)
+	hp = protowire.AppendFixed64(hp, math.Float64bits(2.5))
+	hp = protowire.AppendTag(hp, 6, protowire.BytesType)
+	hp = protowire.AppendBytes(hp, packedCounts)
+	hp = protowire.AppendTag(hp, 7, protowire.BytesType)
+	hp = protowire.AppendBytes(hp, packedBounds)
+
+	var histogram []byte
+	histogram = protowire.AppendTag(histogram, 1, protowire.BytesType)
+	histogram = protowire.AppendBytes(histogram, hp)
+
+	var latency []byte
+	latency = protowire.AppendTag(latency, 1, protowire.BytesType)
+	latency = protowire.AppendString(latency, "latency")
+	latency = protowire.AppendTag(latency, 9, protowire.BytesType)
+	latency = protowire.AppendBytes(latency, histogram)
+
+	var resource []byte
+	resource = appendKeyValue(resource, 1, "service.name", "api")
+
+	var scopeMetrics []byte
+	scopeMetrics = protowire.AppendTag(scopeMetrics, 2, protowire.BytesType)
+	scopeMetrics = protowire.AppendBytes(scopeMetrics, counter)
+	scopeMetrics = protowire.AppendTag(scopeMetrics, 2, protowire.BytesType)
+	scopeMetrics = protowire.AppendBytes(scopeMetrics, latency)
+
+	var resourceMetrics []byte
+	resourceMetrics = protowire.AppendTag(resourceMetrics, 1, protowire.BytesType)
+	resourceMetrics = protowire.AppendBytes(resourceMetrics, resource)
+	resourceMetrics = protowire.AppendTag(resourceMetrics, 2, protowire.BytesType)
+	resourceMetrics = protowire.AppendBytes(resourceMetrics, scopeMetrics)
+
+	var req []byte
+	req = protowire.AppendTag(req, 1, protowire.BytesType)
+	req = protowire.AppendBytes(req, resourceMetrics)
+
+	r := httptest.NewRequest("POST", "/v1/metrics", bytes.NewReader(req))
+	r.Header.Set("Content-Type", "application/x-protobuf")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+
+	assertValue(t, db, "http.requests", start, 42, timedb.Labels{"service.name": "api", "path": "/"})
+	assertValue(t, db, "latency_bucket", start, 5, timedb.Labels{"service.name": "api", "le": "1"})
+	assertValue(t, db, "latency_bucket", start, 6, timedb.Labels{"service.name": "api", "le": "+Inf"})
+	assertValue(t, db, "latency_sum", start, 2.5, timedb.Labels{"service.name": "api"})
+	assertValue(t, db, "latency_count", start, 6, timedb.Labels{"service.name": "api"})
+}
+
+func TestOTLPMetricsJSON(t *testing.T) {
+	db := timedb.NewMemory()
+	srv := New(db)
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	ts := strconv.FormatInt(start.UnixNano(), 10)
+	body := `{"resourceMetrics":[{"scopeMetrics":[{"scope":{"name":"runtime"},"metrics":[
+		{"name":"cpu","gauge":{"dataPoints":[{"timeUnixNano":"` + ts + `","asDouble":0.25,"attributes":[{"key":"core","value":{"intValue":"1"}}]}]}},
+		{"name":"rpc","summary":{"dataPoints":[{"timeUnixNano":"` + ts + `","count":"4","sum":10,"quantileValues":[{"quantile":0.5,"value":2}]}]}}]}]}]}`
+
+	r := httptest.NewRequest("POST", "/v1/metrics", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+
+	assertValue(t, db, "cpu", start, 0.25, timedb.Labels{"otel.scope.name": "runtime", "core": "1"})
+	assertValue(t, db, "rpc", start, 2, timedb.Labels{"otel.scope.name": "runtime", "quantile": "0.5"})
+	assertValue(t, db, "rpc_count", start, 4, timedb.Labels{"otel.scope.name": "runtime"})
+}
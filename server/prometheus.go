@@ -0,0 +1,179 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/scorredoira/timedb"
+)
+
+// The Prometheus query API is served under /prometheus so Grafana and
+// other clients can use it as a Prometheus data source. The expressions
+// are evaluated with timedb.PromQuery.
+
+type promResponse struct {
+	Status    string    `json:"status"`
+	Data      *promData `json:"data,omitempty"`
+	ErrorType string    `json:"errorType,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type promData struct {
+	ResultType string       `json:"resultType"`
+	Result     []promResult `json:"result"`
+}
+
+type promResult struct {
+	Metric timedb.Labels   `json:"metric"`
+	Value  []interface{}   `json:"value,omitempty"`
+	Values [][]interface{} `json:"values,omitempty"`
+}
+
+// promQuery implements the instant queries of the Prometheus API.
+func (s *Server) promQuery(w http.ResponseWriter, r *http.Request) {
+	t := time.Now()
+	if v := r.FormValue("time"); v != "" {
+		var err error
+		if t, err = parsePromTime(v); err != nil {
+			writePromError(w, err)
+			return
+		}
+	}
+
+	if !s.authorizeProm(w, r, t, t) {
+		return
+	}
+
+	series, err := s.DB.PromQuery(r.FormValue("query"), t)
+	if err != nil {
+		writePromError(w, err)
+		return
+	}
+
+	data := &promData{ResultType: "vector", Result: []promResult{}}
+	for _, sr := range series {
+		if len(sr.Points) > 1 || len(sr.Points) == 1 && !sr.Points[0].Time.Equal(t) {
+			// a range selector
+			data.ResultType = "matrix"
+		}
+	}
+
+	for _, sr := range series {
+		res := promResult{Metric: promMetric(sr.Labels)}
+		if data.ResultType == "matrix" {
+			res.Values = promValues(sr.Points)
+		} else {
+			res.Value = promValue(sr.Points[0])
+		}
+		data.Result = append(data.Result, res)
+	}
+
+	writePromData(w, data)
+}
+
+// promQueryRange implements the range queries of the Prometheus API.
+func (s *Server) promQueryRange(w http.ResponseWriter, r *http.Request) {
+	start, err := parsePromTime(r.FormValue("start"))
+	if err != nil {
+		writePromError(w, err)
+		return
+	}
+
+	end, err := parsePromTime(r.FormValue("end"))
+	if err != nil {
+		writePromError(w, err)
+		return
+	}
+
+	step, err := parsePromStep(r.FormValue("step"))
+	if err != nil {
+		writePromError(w, err)
+		return
+	}
+
+	if !s.authorizeProm(w, r, start, end) {
+		return
+	}
+
+	series, err := s.DB.PromQueryRange(r.FormValue("query"), start, end, step)
+	if err != nil {
+		writePromError(w, err)
+		return
+	}
+
+	data := &promData{ResultType: "matrix", Result: []promResult{}}
+	for _, sr := range series {
+		data.Result = append(data.Result, promResult{Metric: promMetric(sr.Labels), Values: promValues(sr.Points)})
+	}
+
+	writePromData(w, data)
+}
+
+// authorizeProm checks that the request can read the tables of the query
+// and the limits of the client allow to scan them in the range.
+func (s *Server) authorizeProm(w http.ResponseWriter, r *http.Request, start, end time.Time) bool {
+	tables, err := timedb.PromTables(r.FormValue("query"))
+	if err != nil {
+		writePromError(w, err)
+		return false
+	}
+	if !s.authorize(w, r, PermRead, tables...) {
+		return false
+	}
+	return s.allowQuery(w, r, start.Add(-timedb.PromLookback), end, tables...)
+}
+
+func promMetric(labels timedb.Labels) timedb.Labels {
+	if labels == nil {
+		return timedb.Labels{}
+	}
+	return labels
+}
+
+func promValue(p timedb.Point) []interface{} {
+	t := float64(p.Time.UnixMilli()) / 1000
+	return []interface{}{t, strconv.FormatFloat(p.Value, 'f', -1, 64)}
+}
+
+func promValues(points []timedb.Point) [][]interface{} {
+	values := make([][]interface{}, len(points))
+	for i, p := range points {
+		values[i] = promValue(p)
+	}
+	return values
+}
+
+// parsePromTime parses a time in RFC 3339 or Unix format with decimals.
+func parsePromTime(s string) (time.Time, error) {
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		sec, dec := math.Modf(f)
+		return time.Unix(int64(sec), int64(dec*1e9)), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// parsePromStep parses a step in seconds or as a duration like "1m".
+func parsePromStep(s string) (time.Duration, error) {
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		if !(f > 0 && f < math.MaxInt64/float64(time.Second)) {
+			return 0, fmt.Errorf("invalid step %s", s)
+		}
+		return time.Duration(f * float64(time.Second)), nil
+	}
+	return timedb.ParsePromDuration(s)
+}
+
+func writePromData(w http.ResponseWriter, data *promData) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(promResponse{Status: "success", Data: data})
+}
+
+func writePromError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(promResponse{Status: "error", ErrorType: "bad_data", Error: err.Error()})
+}
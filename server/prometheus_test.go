@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/scorredoira/timedb"
+)
+
+func TestPromQueryRange(t *testing.T) {
+	db := timedb.NewMemory()
+	srv := New(db)
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 4; i++ {
+		if err := db.InsertValue(start.Add(time.Duration(i)*time.Minute), "cpu", float64(i), timedb.Labels{"host": "a"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	q := url.Values{
+		"query": {`max by (host) (cpu)`},
+		"start": {strconv.FormatInt(start.Unix(), 10)},
+		"end":   {start.Add(3 * time.Minute).Format(time.RFC3339)},
+		"step":  {"60"},
+	}
+
+	req := httptest.NewRequest("GET", "/prometheus/api/v1/query_range?"+q.Encode(), nil)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+
+	var res struct {
+		Status string
+		Data   struct {
+			ResultType string
+			Result     []struct {
+				Metric map[string]string
+				Values [][]interface{}
+			}
+		}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Status != "success" || res.Data.ResultType != "matrix" || len(res.Data.Result) != 1 {
+		t.Fatalf("invalid result %s", w.Body.String())
+	}
+	r := res.Data.Result[0]
+	if r.Metric["host"] != "a" || len(r.Values) != 4 || r.Values[3][1] != "3" {
+		t.Fatalf("invalid result %s", w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/prometheus/api/v1/query?query=rate(cpu)", nil)
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+
+	for _, step := range []string{"0.001", "-1", "1e300"} {
+		q.Set("step", step)
+		req = httptest.NewRequest("GET", "/prometheus/api/v1/query_range?"+q.Encode(), nil)
+		w = httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("step %s: unexpected status %d", step, w.Code)
+		}
+	}
+}
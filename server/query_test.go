@@ -0,0 +1,45 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/scorredoira/timedb"
+)
+
+func TestQuery(t *testing.T) {
+	db := timedb.NewMemory()
+	srv := New(db)
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	if err := db.Insert(start, "nginx", "GET / status=500"); err != nil {
+		t.Fatal(err)
+	}
+
+	q := url.Values{
+		"q":     {`table=nginx | filter "status=500" | count`},
+		"start": {start.Format(time.RFC3339)},
+		"end":   {start.Add(time.Hour).Format(time.RFC3339)},
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/query?"+q.Encode(), nil)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+
+	var res timedb.QueryResult
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Series) != 1 || res.Series[0].Points[0].Value != 1 {
+		t.Fatalf("invalid result %s", w.Body.String())
+	}
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/scorredoira/timedb"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// remoteWrite implements the Prometheus remote_write protocol. Each metric
+// is stored in a numeric table with the name of the metric.
+func (s *Server) remoteWrite(w http.ResponseWriter, r *http.Request) {
+	compressed, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+
+	// the body is compressed with the snappy block format
+	data, err := s.decodeSnappy(compressed)
+	if err != nil {
+		bodyError(w, err)
+		return
+	}
+
+	series, err := parseWriteRequest(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tables := make([]string, 0, len(series))
+	for _, ts := range series {
+		if table := ts.labels["__name__"]; table != "" {
+			tables = append(tables, table)
+		}
+	}
+	if !s.authorize(w, r, PermWrite, tables...) {
+		return
+	}
+
+	var samples int
+	for _, ts := range series {
+		samples += len(ts.samples)
+	}
+	if !s.allowIngest(w, r, samples) {
+		return
+	}
+
+	for _, ts := range series {
+		table := ts.labels["__name__"]
+		if table == "" {
+			continue
+		}
+		delete(ts.labels, "__name__")
+
+		for _, sample := range ts.samples {
+			t := time.UnixMilli(sample.timestamp)
+			if err := s.DB.InsertValue(t, table, sample.value, ts.labels); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type timeSeries struct {
+	labels  timedb.Labels
+	samples []sample
+}
+
+type sample struct {
+	value     float64
+	timestamp int64
+}
+
+// parseWriteRequest decodes a prometheus.WriteRequest message.
+func parseWriteRequest(b []byte) ([]timeSeries, error) {
+	var result []timeSeries
+
+	err := parseMessage(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+
+		ts, err := parseTimeSeries(v)
+		if err != nil {
+			return err
+		}
+		result = append(result, ts)
+		return nil
+	})
+
+	return result, err
+}
+
+func parseTimeSeries(b []byte) (timeSeries, error) {
+	ts := timeSeries{labels: timedb.Labels{}}
+
+	err := parseMessage(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+
+		switch num {
+		case 1:
+			var name, value string
+			err := parseMessage(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				switch num {
+				case 1:
+					name = string(v)
+				case 2:
+					value = string(v)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			ts.labels[name] = value
+
+		case 2:
+			var smp sample
+			err := parseMessage(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				switch {
+				case num == 1 && typ == protowire.Fixed64Type:
+					smp.value = math.Float64frombits(decodeFixed64(v))
+				case num == 2 && typ == protowire.VarintType:
+					x, _ := protowire.ConsumeVarint(v)
+					smp.timestamp = int64(x)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			ts.samples = append(ts.samples, smp)
+		}
+		return nil
+	})
+
+	return ts, err
+}
+
+func decodeFixed64(b []byte) uint64 {
+	v, _ := protowire.ConsumeFixed64(b)
+	return v
+}
+
+// parseMessage calls fn for each field of a protobuf message. For bytes
+// fields v is the content and for the rest it is the raw encoded value.
+func parseMessage(b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("invalid protobuf message: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		var v []byte
+		if typ == protowire.BytesType {
+			v, n = protowire.ConsumeBytes(b)
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n >= 0 {
+				v = b[:n]
+			}
+		}
+		if n < 0 {
+			return fmt.Errorf("invalid protobuf message: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		if err := fn(num, typ, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
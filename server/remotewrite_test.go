@@ -0,0 +1,88 @@
+package server
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/scorredoira/timedb"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestRemoteWrite(t *testing.T) {
+	db := timedb.NewMemory()
+	srv := New(db)
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+
+	label := func(name, value string) []byte {
+		var b []byte
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, name)
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendString(b, value)
+		return b
+	}
+
+	var smp []byte
+	smp = protowire.AppendTag(smp, 1, protowire.Fixed64Type)
+	smp = protowire.AppendFixed64(smp, math.Float64bits(42))
+	smp = protowire.AppendTag(smp, 2, protowire.VarintType)
+	smp = protowire.AppendVarint(smp, uint64(start.UnixMilli()))
+
+	var ts []byte
+	ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+	ts = protowire.AppendBytes(ts, label("__name__", "up"))
+	ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+	ts = protowire.AppendBytes(ts, label("job", "web"))
+	ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+	ts = protowire.AppendBytes(ts, smp)
+
+	var req []byte
+	req = protowire.AppendTag(req, 1, protowire.BytesType)
+	req = protowire.AppendBytes(req, ts)
+
+	body := s2.EncodeSnappy(nil, req)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/write", bytes.NewReader(body)))
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+
+	scanner := db.Query("up", start, start, 0, 0)
+	defer scanner.Close()
+
+	if !scanner.Scan() {
+		t.Fatal("expected a value")
+	}
+
+	if text := scanner.Data().Text; text != ` 42 {job="web"}` {
+		t.Fatalf("unexpected data %q", text)
+	}
+}
+
+func TestRemoteWriteTooLarge(t *testing.T) {
+	srv := New(timedb.NewMemory())
+	srv.Limits.MaxBodySize = 1024
+
+	// a large body and a small one that is large decompressed
+	large := s2.EncodeSnappy(nil, bytes.Repeat([]byte("x"), 4096))
+	if int64(len(large)) > srv.Limits.MaxBodySize {
+		t.Fatal("the body should be small")
+	}
+
+	for _, body := range [][]byte{bytes.Repeat([]byte("x"), 2048), large} {
+		req := httptest.NewRequest("POST", "/api/v1/write", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,64 @@
+/*
+Package server exposes a timedb database over HTTP.
+
+	srv := server.New(db)
+	http.ListenAndServe(":9000", srv)
+*/
+package server
+
+import (
+	"net/http"
+
+	"github.com/scorredoira/timedb"
+)
+
+type Server struct {
+	DB *timedb.DB
+
+	// LokiTable returns the table of the streams received with the Loki
+	// push API. By default it is the "job" or "app" label.
+	LokiTable func(labels timedb.Labels) string
+
+	// OTLPTable returns the table of the records received with the
+	// OpenTelemetry protocol from their labels: the attributes of the
+	// resource, the scope and the record. By default it is the
+	// "service.name" attribute.
+	OTLPTable func(labels timedb.Labels) string
+
+	// Tokens are the credentials accepted by the server. If there are
+	// none the authentication is disabled.
+	Tokens []Token
+
+	// Limits are the limits of the requests of each client.
+	Limits Limits
+
+	mux     *http.ServeMux
+	handler http.Handler
+	limiter limiter
+}
+
+func New(db *timedb.DB) *Server {
+	s := &Server{DB: db, mux: http.NewServeMux()}
+	s.mux.HandleFunc("POST /api/v1/write", s.remoteWrite)
+	s.mux.HandleFunc("POST /api/v1/insert", s.insert)
+	s.mux.HandleFunc("POST /loki/api/v1/push", s.lokiPush)
+	s.mux.HandleFunc("POST /v1/logs", s.otlpLogs)
+	s.mux.HandleFunc("POST /v1/metrics", s.otlpMetrics)
+	s.mux.HandleFunc("GET /api/v1/query", s.query)
+	s.mux.HandleFunc("GET /api/v1/sql", s.sql)
+	s.mux.HandleFunc("GET /api/v1/arrow", s.arrow)
+	s.mux.HandleFunc("GET /prometheus/api/v1/query", s.promQuery)
+	s.mux.HandleFunc("POST /prometheus/api/v1/query", s.promQuery)
+	s.mux.HandleFunc("GET /prometheus/api/v1/query_range", s.promQueryRange)
+	s.mux.HandleFunc("POST /prometheus/api/v1/query_range", s.promQueryRange)
+	s.mux.HandleFunc("POST /api/v1/annotations", s.createAnnotation)
+	s.mux.HandleFunc("GET /api/v1/annotations", s.listAnnotations)
+	s.mux.HandleFunc("POST /annotations", s.grafanaAnnotations)
+	s.mux.HandleFunc("GET /health", s.health)
+	s.handler = s.withAuth(s.withLimits(s.mux))
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
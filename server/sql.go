@@ -0,0 +1,34 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/scorredoira/timedb"
+)
+
+// sql runs a query of the SQL subset of timedb.RunSQL given by the q parameter.
+func (s *Server) sql(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+
+	table, start, end, err := timedb.SQLScope(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !s.authorize(w, r, PermRead, table) {
+		return
+	}
+	if !s.allowQuery(w, r, start, end, table) {
+		return
+	}
+
+	res, err := s.DB.RunSQL(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
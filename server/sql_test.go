@@ -0,0 +1,46 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/scorredoira/timedb"
+)
+
+func TestSQL(t *testing.T) {
+	db := timedb.NewMemory()
+	srv := New(db)
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	if err := db.Insert(start, "nginx", "GET / status=500"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Insert(start, "nginx", "GET / status=200"); err != nil {
+		t.Fatal(err)
+	}
+
+	q := url.Values{
+		"q": {"SELECT status FROM nginx WHERE time >= '" + start.Format(time.RFC3339) + "' AND status = 500"},
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/sql?"+q.Encode(), nil)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+
+	var res timedb.QueryResult
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Rows) != 1 || res.Rows[0].Fields["status"] != "500" {
+		t.Fatalf("invalid result %s", w.Body.String())
+	}
+}
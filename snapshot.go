@@ -0,0 +1,202 @@
+package timedb
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Queries see the data as it was when they started even if it is deleted
+// while they run. The data files deleted by Prune, the retention and the
+// quotas or replaced by Merge are moved to the trash directory while there
+// are queries that started before, and deleted when they end. Compressing,
+// archiving and tiering keep the same data so they don't need it.
+// Queries must be closed or read to the end to release the files.
+
+const trashDir = ".trash"
+
+type snapshots struct {
+	mutex sync.Mutex
+
+	// gen is incremented each time that files are retired.
+	gen    uint64
+	active map[uint64]int
+	ops    []retiredOp
+}
+
+// retiredOp are the files retired at once.
+type retiredOp struct {
+	gen     uint64
+	storage storage
+
+	// files are the parts in the trash of each data file, without
+	// the compression extension.
+	files map[string][]string
+}
+
+// pin registers a query and returns the generation that it sees.
+func (db *DB) pin() uint64 {
+	s := &db.snapshots
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.active == nil {
+		s.active = make(map[uint64]int)
+	}
+	s.active[s.gen]++
+	return s.gen
+}
+
+// unpin is called when a query ends and deletes the files that no
+// query needs anymore.
+func (db *DB) unpin(gen uint64) {
+	s := &db.snapshots
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.active[gen]--; s.active[gen] <= 0 {
+		delete(s.active, gen)
+	}
+
+	// the queries only need the files retired after they started
+	oldest := s.gen
+	for g := range s.active {
+		oldest = min(oldest, g)
+	}
+
+	i := 0
+	for ; i < len(s.ops) && s.ops[i].gen <= oldest; i++ {
+		op := s.ops[i]
+		for _, parts := range op.files {
+			for _, p := range parts {
+				for _, f := range []string{p, p + ".zst"} {
+					if err := op.storage.Remove(f); err != nil && !errors.Is(err, fs.ErrNotExist) {
+						db.log().Warn("timedb: error removing retired file", "file", f, "error", err)
+					}
+				}
+			}
+		}
+		removeDirs(op.storage, trashDir)
+	}
+	s.ops = s.ops[i:]
+}
+
+// retire deletes files from the storage or moves the data files to the
+// trash if there are queries that can be reading them.
+func (db *DB) retire(st storage, files ...string) error {
+	s := &db.snapshots
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.active) == 0 {
+		for _, f := range files {
+			if err := st.Remove(f); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+		return nil
+	}
+
+	s.gen++
+	op := retiredOp{gen: s.gen, storage: st, files: make(map[string][]string)}
+	dir := path.Join(trashDir, strconv.FormatUint(s.gen, 10))
+
+	for _, f := range files {
+		if _, ok := tableFileName(partBase(f)); !ok {
+			if err := st.Remove(f); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			continue
+		}
+
+		trash := path.Join(dir, f)
+		if err := makeDir(st, trash); err != nil {
+			return fmt.Errorf("timeDB: error creating the trash: %v", err)
+		}
+		if err := st.Rename(f, trash); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+
+		name := partBase(f)
+		op.files[name] = append(op.files[name], strings.TrimSuffix(trash, ".zst"))
+	}
+
+	for _, parts := range op.files {
+		sort.Slice(parts, func(i, j int) bool {
+			return partNumber(parts[i]) < partNumber(parts[j])
+		})
+	}
+
+	s.ops = append(s.ops, op)
+	return nil
+}
+
+// openRetired opens the data file as it was in the generation if it
+// was retired after it.
+func (db *DB) openRetired(gen uint64, name string) (fs.File, bool, error) {
+	s := &db.snapshots
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, op := range s.ops {
+		if op.gen <= gen {
+			continue
+		}
+
+		parts, ok := op.files[name]
+		if !ok {
+			continue
+		}
+
+		files := make([]fs.File, 0, len(parts))
+		for _, p := range parts {
+			f, err := db.storage.Open(p)
+			if err != nil {
+				for _, f := range files {
+					f.Close()
+				}
+				return nil, true, err
+			}
+			files = append(files, f)
+		}
+
+		if len(files) == 1 {
+			return files[0], true, nil
+		}
+		return &partsFile{files: files}, true, nil
+	}
+
+	return nil, false, nil
+}
+
+// partNumber returns the number of a part file.
+func partNumber(name string) int {
+	i := strings.LastIndex(name, ".log.")
+	if i == -1 {
+		return 0
+	}
+	n, err := strconv.Atoi(name[i+5:])
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// makeDir creates the directory of a file.
+func makeDir(s storage, name string) error {
+	keep := path.Join(path.Dir(name), ".keep")
+	w, err := s.Create(keep)
+	if err != nil {
+		return err
+	}
+	w.Close()
+	return s.Remove(keep)
+}
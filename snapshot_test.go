@@ -0,0 +1,95 @@
+package timedb
+
+import (
+	"io/fs"
+	"testing"
+	"time"
+)
+
+func TestSnapshotPrune(t *testing.T) {
+	dir := t.TempDir()
+	db := New(dir)
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	next := start.AddDate(0, 0, 1)
+
+	for i := 0; i < 10; i++ {
+		if err := db.Insert(start.Add(time.Duration(i)*time.Second), "app", "a"); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Insert(next.Add(time.Duration(i)*time.Second), "app", "b"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	s := db.Query("app", start, next.Add(time.Hour), 0, 0)
+	defer s.Close()
+
+	if !s.Scan() {
+		t.Fatal(s.Error)
+	}
+
+	if err := db.Prune(next.AddDate(0, 0, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	// a new query doesn't see the data
+	if n := countRecords(t, db, "app", next); n != 0 {
+		t.Fatalf("expected 0, got %d", n)
+	}
+
+	count := 1
+	for s.Scan() {
+		count++
+	}
+	if s.Error != nil {
+		t.Fatal(s.Error)
+	}
+	if count != 20 {
+		t.Fatalf("expected 20, got %d", count)
+	}
+
+	if _, err := fs.Stat(db.storage, trashDir); err == nil {
+		t.Fatal("expected the trash to be empty")
+	}
+}
+
+func TestSnapshotMerge(t *testing.T) {
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+
+	db := New(t.TempDir())
+	src := New(t.TempDir())
+	for i := 0; i < 10; i++ {
+		if err := db.Insert(start.Add(time.Duration(i)*time.Second), "app", "a"); err != nil {
+			t.Fatal(err)
+		}
+		if err := src.Insert(start.Add(time.Duration(i)*time.Second+time.Millisecond), "app", "b"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+	src.Close()
+
+	s := db.Query("app", start, start, 0, 0)
+	defer s.Close()
+
+	if err := Merge(db, src); err != nil {
+		t.Fatal(err)
+	}
+
+	count := 0
+	for s.Scan() {
+		count++
+	}
+	if s.Error != nil {
+		t.Fatal(s.Error)
+	}
+	if count != 10 {
+		t.Fatalf("expected 10, got %d", count)
+	}
+
+	if n := countRecords(t, db, "app", start); n != 20 {
+		t.Fatalf("expected 20, got %d", n)
+	}
+}
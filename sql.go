@@ -0,0 +1,708 @@
+package timedb
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// RunSQL executes a query in a small subset of SQL:
+//
+//	SELECT columns FROM table
+//	WHERE time >= '2020-01-01' AND time < '2020-01-02' AND status = 500
+//	GROUP BY time(1m), host
+//	LIMIT 100
+//
+// The columns are time, text, the fields of the records or one aggregation:
+// count(*), avg(field), sum(field), min(field) or max(field). The fields of
+// numeric tables are their labels and "value", of JSON records their keys
+// and of the rest the key=value pairs of the text.
+//
+// The WHERE clause needs the start time. The time can be compared with >,
+// >=, <, <=, = and BETWEEN, the fields with =, !=, <, <=, > and >= and
+// text with LIKE. The conditions are combined with AND.
+//
+// Queries with aggregation return Series, grouped by the fields of GROUP BY
+// in buckets of the size of time(), queries with fields return Rows and the
+// rest Records.
+func (db *DB) RunSQL(query string) (*QueryResult, error) {
+	st, err := parseSQL(query)
+	if err != nil {
+		return nil, err
+	}
+	return db.runSQL(st)
+}
+
+// SQLScope returns the table, that can be a pattern, and the range
+// [start, end) of a query of RunSQL.
+func SQLScope(query string) (table string, start, end time.Time, err error) {
+	st, err := parseSQL(query)
+	if err != nil {
+		return "", time.Time{}, time.Time{}, err
+	}
+	return st.table, st.start, st.end, nil
+}
+
+// sqlStatement is a parsed SQL query.
+type sqlStatement struct {
+	columns []string
+	agg     string
+	aggArg  string
+	table   string
+	start   time.Time
+	end     time.Time
+	conds   []sqlCond
+	bucket  time.Duration
+	groupBy []string
+	limit   int
+}
+
+// sqlCond compares a field or the text with a literal.
+type sqlCond struct {
+	field string
+	op    string
+	value string
+	like  *regexp.Regexp
+}
+
+var sqlAggregates = map[string]bool{"count": true, "avg": true, "sum": true, "min": true, "max": true}
+
+type sqlParser struct {
+	tokens []string
+	pos    int
+}
+
+func parseSQL(query string) (*sqlStatement, error) {
+	tokens, err := sqlTokens(query)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &sqlParser{tokens: tokens}
+	st, err := p.statement()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("timeDB: invalid query: unexpected %s", p.tokens[p.pos])
+	}
+	return st, nil
+}
+
+func (p *sqlParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *sqlParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *sqlParser) keyword(k string) bool {
+	if strings.EqualFold(p.peek(), k) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *sqlParser) expect(k string) error {
+	if !p.keyword(k) {
+		return fmt.Errorf("timeDB: invalid query: expected %s, found %q", k, p.peek())
+	}
+	return nil
+}
+
+// ident returns the next token if it is an identifier.
+func (p *sqlParser) ident() (string, error) {
+	t := p.next()
+	if t == "" || !isSQLWord(t[0]) && t[0] != '"' {
+		return "", fmt.Errorf("timeDB: invalid query: expected a name, found %q", t)
+	}
+	return strings.Trim(t, `"`), nil
+}
+
+func (p *sqlParser) statement() (*sqlStatement, error) {
+	st := &sqlStatement{}
+
+	if err := p.expect("SELECT"); err != nil {
+		return nil, err
+	}
+
+	for {
+		if p.peek() == "*" {
+			p.next()
+			st.columns = append(st.columns, "time", "text")
+		} else {
+			name, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			fn := strings.ToLower(name)
+			if sqlAggregates[fn] && p.peek() == "(" {
+				if st.agg != "" {
+					return nil, fmt.Errorf("timeDB: only one aggregation is allowed")
+				}
+				p.next()
+				st.agg = fn
+				if p.peek() == "*" && fn == "count" {
+					p.next()
+				} else if st.aggArg, err = p.ident(); err != nil {
+					return nil, err
+				}
+				if err := p.expect(")"); err != nil {
+					return nil, err
+				}
+			} else {
+				st.columns = append(st.columns, name)
+			}
+		}
+
+		if p.peek() != "," {
+			break
+		}
+		p.next()
+	}
+
+	if err := p.expect("FROM"); err != nil {
+		return nil, err
+	}
+
+	table, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	if err := validTable(table); err != nil && !isPattern(table) {
+		return nil, err
+	}
+	st.table = table
+
+	if err := p.expect("WHERE"); err != nil {
+		return nil, err
+	}
+	for {
+		if err := p.cond(st); err != nil {
+			return nil, err
+		}
+		if !p.keyword("AND") {
+			break
+		}
+	}
+
+	if st.start.IsZero() {
+		return nil, fmt.Errorf("timeDB: the query needs the start time")
+	}
+	if st.end.IsZero() {
+		st.end = time.Now().Truncate(time.Second).Add(time.Second)
+	}
+	if !st.start.Before(st.end) {
+		return nil, fmt.Errorf("timeDB: empty time range")
+	}
+
+	if p.keyword("GROUP") {
+		if err := p.expect("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			name, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			if strings.EqualFold(name, "time") && p.peek() == "(" {
+				p.next()
+				d, err := time.ParseDuration(p.next())
+				if err != nil || d <= 0 {
+					return nil, fmt.Errorf("timeDB: invalid bucket")
+				}
+				st.bucket = d
+				if err := p.expect(")"); err != nil {
+					return nil, err
+				}
+			} else {
+				st.groupBy = append(st.groupBy, name)
+			}
+			if p.peek() != "," {
+				break
+			}
+			p.next()
+		}
+		if st.agg == "" {
+			return nil, fmt.Errorf("timeDB: GROUP BY needs an aggregation")
+		}
+	}
+
+	if p.keyword("LIMIT") {
+		n, err := strconv.Atoi(p.next())
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("timeDB: invalid limit")
+		}
+		st.limit = n
+	}
+
+	return st, nil
+}
+
+// cond parses a condition. The time conditions are converted to the
+// range [start, end) of the statement.
+func (p *sqlParser) cond(st *sqlStatement) error {
+	field, err := p.ident()
+	if err != nil {
+		return err
+	}
+
+	if strings.EqualFold(field, "time") {
+		var op string
+		var times []time.Time
+		if p.keyword("BETWEEN") {
+			op = "between"
+			for i := 0; i < 2; i++ {
+				if i == 1 {
+					if err := p.expect("AND"); err != nil {
+						return err
+					}
+				}
+				t, err := sqlTime(p.next())
+				if err != nil {
+					return err
+				}
+				times = append(times, t)
+			}
+		} else {
+			op = p.next()
+			t, err := sqlTime(p.next())
+			if err != nil {
+				return err
+			}
+			times = append(times, t)
+		}
+
+		// the times have a precision of seconds
+		switch op {
+		case "between":
+			st.start, st.end = times[0], times[1].Add(time.Second)
+		case "=":
+			st.start, st.end = times[0], times[0].Add(time.Second)
+		case ">=":
+			st.start = times[0]
+		case ">":
+			st.start = times[0].Add(time.Second)
+		case "<":
+			st.end = times[0]
+		case "<=":
+			st.end = times[0].Add(time.Second)
+		default:
+			return fmt.Errorf("timeDB: invalid operator %q", op)
+		}
+		return nil
+	}
+
+	c := sqlCond{field: field, op: strings.ToLower(p.next())}
+	switch c.op {
+	case "=", "!=", "<>", "<", "<=", ">", ">=", "like":
+	default:
+		return fmt.Errorf("timeDB: invalid operator %q", c.op)
+	}
+
+	c.value = sqlLiteral(p.next())
+	if c.op == "like" {
+		c.like = likePattern(c.value)
+	}
+
+	st.conds = append(st.conds, c)
+	return nil
+}
+
+// sqlLiteral returns the value of a quoted string or a number.
+func sqlLiteral(t string) string {
+	if len(t) >= 2 && t[0] == '\'' {
+		return strings.ReplaceAll(t[1:len(t)-1], "''", "'")
+	}
+	return t
+}
+
+func sqlTime(t string) (time.Time, error) {
+	s := sqlLiteral(t)
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if d, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return d, nil
+		}
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(n, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("timeDB: invalid time %s", s)
+}
+
+// likePattern converts a LIKE pattern to a regexp.
+func likePattern(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^(?s)")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// sqlTokens splits a query in names, literals and symbols.
+func sqlTokens(s string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+
+		case c == '\'' || c == '"':
+			j := i + 1
+			for ; j < len(s); j++ {
+				if s[j] == c {
+					if j+1 < len(s) && s[j+1] == c {
+						j++
+						continue
+					}
+					break
+				}
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("timeDB: invalid query: unterminated string")
+			}
+			tokens = append(tokens, s[i:j+1])
+			i = j + 1
+
+		case c == '<' || c == '>' || c == '!':
+			j := i + 1
+			if j < len(s) && (s[j] == '=' || c == '<' && s[j] == '>') {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+
+		case strings.IndexByte(",*()=", c) != -1:
+			tokens = append(tokens, s[i:i+1])
+			i++
+
+		case c == ';' && strings.TrimSpace(s[i+1:]) == "":
+			i = len(s)
+
+		default:
+			j := i
+			for j < len(s) && isSQLWord(s[j]) {
+				j++
+			}
+			if j == i {
+				return nil, fmt.Errorf("timeDB: invalid query: unexpected %q", c)
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+func isSQLWord(c byte) bool {
+	return c == '_' || c == '-' || c == '.' || c == '/' || c == ':' ||
+		'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// RecordFields returns the fields of the text of a record: the labels and
+// the value of numeric records, the keys of JSON objects or the key=value
+// pairs of the text.
+func RecordFields(text string) map[string]string {
+	if v, labels, err := ParseValue(text); err == nil {
+		fields := map[string]string{"value": strconv.FormatFloat(v, 'g', -1, 64)}
+		for k, l := range labels {
+			fields[k] = l
+		}
+		return fields
+	}
+
+	fields := make(map[string]string)
+
+	if strings.HasPrefix(text, "{") {
+		var v map[string]interface{}
+		if err := json.Unmarshal([]byte(text), &v); err == nil {
+			flattenJSON(fields, "", v)
+			return fields
+		}
+	}
+
+	for rest := text; rest != ""; {
+		rest = strings.TrimLeft(rest, " ")
+		i := strings.IndexAny(rest, "= ")
+		if i == -1 || rest[i] == ' ' {
+			// words without value
+			if i == -1 {
+				break
+			}
+			rest = rest[i:]
+			continue
+		}
+
+		key, value := rest[:i], rest[i+1:]
+		if strings.HasPrefix(value, `"`) {
+			if q, err := strconv.QuotedPrefix(value); err == nil {
+				rest = value[len(q):]
+				fields[key], _ = strconv.Unquote(q)
+				continue
+			}
+		}
+
+		j := strings.IndexByte(value, ' ')
+		if j == -1 {
+			j = len(value)
+		}
+		fields[key] = value[:j]
+		rest = value[j:]
+	}
+	return fields
+}
+
+// flattenJSON adds the fields of a JSON object with the keys of the
+// nested objects joined by dots.
+func flattenJSON(fields map[string]string, prefix string, v map[string]interface{}) {
+	for k, value := range v {
+		switch t := value.(type) {
+		case map[string]interface{}:
+			flattenJSON(fields, prefix+k+".", t)
+		case string:
+			fields[prefix+k] = t
+		case nil:
+		default:
+			b, _ := json.Marshal(t)
+			fields[prefix+k] = string(b)
+		}
+	}
+}
+
+// match reports whether the record matches the condition.
+func (c sqlCond) match(text string, fields map[string]string) bool {
+	var v string
+	var ok bool
+	if strings.EqualFold(c.field, "text") {
+		v, ok = text, true
+	} else {
+		v, ok = fields[c.field]
+	}
+
+	if c.like != nil {
+		return ok && c.like.MatchString(v)
+	}
+
+	if !ok {
+		return c.op == "!=" || c.op == "<>"
+	}
+
+	cmp := strings.Compare(v, c.value)
+	if a, err := strconv.ParseFloat(v, 64); err == nil {
+		if b, err := strconv.ParseFloat(c.value, 64); err == nil {
+			cmp = 0
+			if a < b {
+				cmp = -1
+			} else if a > b {
+				cmp = 1
+			}
+		}
+	}
+
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "!=", "<>":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+// sqlGroup is a series of an aggregation.
+type sqlGroup struct {
+	labels Labels
+	count  []int
+	values []float64
+}
+
+func (db *DB) runSQL(st *sqlStatement) (*QueryResult, error) {
+	// the fields are only parsed if they are used
+	needFields := len(st.groupBy) > 0 || st.aggArg != ""
+	for _, c := range st.columns {
+		if c != "time" && c != "text" {
+			needFields = true
+		}
+	}
+	for _, c := range st.conds {
+		if !strings.EqualFold(c.field, "text") {
+			needFields = true
+		}
+	}
+
+	bucket := st.bucket
+	if bucket == 0 {
+		bucket = st.end.Sub(st.start)
+	}
+	n, err := bucketCount(st.start, st.end, bucket)
+	if err != nil {
+		return nil, err
+	}
+	groups := make(map[string]*sqlGroup)
+
+	res := &QueryResult{}
+
+	s := db.Query(st.table, st.start, st.end, 0, 0)
+	defer s.Close()
+
+	for s.Scan() {
+		d := s.Data()
+		if !d.Time.Before(st.end) {
+			break
+		}
+		if d.Time.Before(st.start) {
+			continue
+		}
+
+		text := trimText(d.Text)
+		var fields map[string]string
+		if needFields {
+			fields = RecordFields(text)
+		}
+
+		matched := true
+		for _, c := range st.conds {
+			if !c.match(text, fields) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		if st.agg == "" {
+			if st.limit > 0 && len(res.Records)+len(res.Rows) >= st.limit {
+				break
+			}
+			if needFields {
+				row := Row{Time: d.Time, Fields: make(map[string]string)}
+				for _, c := range st.columns {
+					switch c {
+					case "time":
+					case "text":
+						row.Fields[c] = text
+					default:
+						if v, ok := fields[c]; ok {
+							row.Fields[c] = v
+						}
+					}
+				}
+				res.Rows = append(res.Rows, row)
+			} else {
+				res.Records = append(res.Records, DataPoint{Time: d.Time, Text: text, Seq: d.Seq})
+			}
+			continue
+		}
+
+		value := 1.0
+		if st.aggArg != "" {
+			var err error
+			if value, err = strconv.ParseFloat(fields[st.aggArg], 64); err != nil {
+				continue
+			}
+		}
+
+		labels := Labels{}
+		for _, g := range st.groupBy {
+			labels[g] = fields[g]
+		}
+		key := labels.String()
+
+		g, ok := groups[key]
+		if !ok {
+			g = &sqlGroup{labels: labels, count: make([]int, n), values: make([]float64, n)}
+			groups[key] = g
+		}
+
+		i := int(d.Time.Sub(st.start) / bucket)
+		if g.count[i] == 0 {
+			g.values[i] = value
+		} else {
+			switch st.agg {
+			case "min":
+				g.values[i] = math.Min(g.values[i], value)
+			case "max":
+				g.values[i] = math.Max(g.values[i], value)
+			default:
+				g.values[i] += value
+			}
+		}
+		g.count[i]++
+	}
+
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	if st.agg == "" {
+		return res, nil
+	}
+
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// an aggregation without groups returns a series with empty buckets
+	if len(keys) == 0 && len(st.groupBy) == 0 {
+		keys = append(keys, "")
+		groups[""] = &sqlGroup{count: make([]int, n), values: make([]float64, n)}
+	}
+
+	for _, k := range keys {
+		g := groups[k]
+		points := make([]Point, n)
+		for i := range points {
+			p := Point{Time: st.start.Add(time.Duration(i) * bucket), Value: math.NaN()}
+			switch {
+			case st.agg == "count":
+				p.Value = float64(g.count[i])
+			case g.count[i] == 0:
+			case st.agg == "avg":
+				p.Value = g.values[i] / float64(g.count[i])
+			default:
+				p.Value = g.values[i]
+			}
+			points[i] = p
+		}
+
+		var labels Labels
+		if len(g.labels) > 0 {
+			labels = g.labels
+		}
+		res.Series = append(res.Series, Series{Labels: labels, Points: points})
+	}
+
+	return res, nil
+}
@@ -0,0 +1,398 @@
+package sql
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// query is a parsed SELECT statement.
+type query struct {
+	columns []string
+	table   string
+	conds   []cond
+	limit   *value
+	offset  *value
+	params  int
+}
+
+// cond is a condition of the WHERE clause.
+type cond struct {
+	column string
+	op     string
+	values []value
+}
+
+// value is a literal or a parameter.
+type value struct {
+	param   int
+	literal interface{}
+}
+
+func (v value) get(args []driver.Value) interface{} {
+	if v.param > 0 {
+		return args[v.param-1]
+	}
+	return v.literal
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+	params int
+}
+
+func parse(s string) (*query, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	q, err := p.query()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("timedb: unexpected %s", p.tokens[p.pos])
+	}
+
+	q.params = p.params
+	return q, nil
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+// keyword consumes the next token if it is the keyword.
+func (p *parser) keyword(k string) bool {
+	if strings.EqualFold(p.peek(), k) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(k string) error {
+	if !p.keyword(k) {
+		return fmt.Errorf("timedb: expected %s, found %q", k, p.peek())
+	}
+	return nil
+}
+
+func (p *parser) query() (*query, error) {
+	q := &query{}
+
+	if err := p.expect("SELECT"); err != nil {
+		return nil, err
+	}
+
+	for {
+		c := strings.ToLower(p.next())
+		switch c {
+		case "*":
+			q.columns = append(q.columns, "time", "data")
+		case "time", "data":
+			q.columns = append(q.columns, c)
+		default:
+			return nil, fmt.Errorf("timedb: invalid column %q", c)
+		}
+		if p.peek() != "," {
+			break
+		}
+		p.next()
+	}
+
+	if err := p.expect("FROM"); err != nil {
+		return nil, err
+	}
+
+	q.table = unquote(p.next())
+	if q.table == "" {
+		return nil, fmt.Errorf("timedb: expected a table")
+	}
+
+	if p.keyword("WHERE") {
+		for {
+			c, err := p.cond()
+			if err != nil {
+				return nil, err
+			}
+			q.conds = append(q.conds, c)
+			if !p.keyword("AND") {
+				break
+			}
+		}
+	}
+
+	for {
+		switch {
+		case p.keyword("LIMIT"):
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			q.limit = &v
+		case p.keyword("OFFSET"):
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			q.offset = &v
+		default:
+			return q, nil
+		}
+	}
+}
+
+func (p *parser) cond() (cond, error) {
+	c := cond{column: strings.ToLower(p.next())}
+
+	switch c.column {
+	case "time":
+		if p.keyword("BETWEEN") {
+			c.op = "between"
+			from, err := p.value()
+			if err != nil {
+				return c, err
+			}
+			if err := p.expect("AND"); err != nil {
+				return c, err
+			}
+			to, err := p.value()
+			if err != nil {
+				return c, err
+			}
+			c.values = []value{from, to}
+			return c, nil
+		}
+
+		c.op = p.next()
+		switch c.op {
+		case ">", ">=", "<", "<=", "=":
+		default:
+			return c, fmt.Errorf("timedb: invalid operator %q", c.op)
+		}
+
+	case "data":
+		if err := p.expect("LIKE"); err != nil {
+			return c, err
+		}
+		c.op = "like"
+
+	default:
+		return c, fmt.Errorf("timedb: invalid column %q", c.column)
+	}
+
+	v, err := p.value()
+	if err != nil {
+		return c, err
+	}
+	c.values = []value{v}
+	return c, nil
+}
+
+func (p *parser) value() (value, error) {
+	t := p.next()
+	switch {
+	case t == "?":
+		p.params++
+		return value{param: p.params}, nil
+	case strings.HasPrefix(t, "'"):
+		return value{literal: strings.ReplaceAll(t[1:len(t)-1], "''", "'")}, nil
+	}
+
+	n, err := strconv.ParseInt(t, 10, 64)
+	if err != nil {
+		return value{}, fmt.Errorf("timedb: invalid value %q", t)
+	}
+	return value{literal: n}, nil
+}
+
+// bind returns the rows of the query with the arguments.
+func (q *query) bind(args []driver.Value) (*rows, error) {
+	r := &rows{columns: q.columns, table: q.table, end: time.Now(), limit: -1}
+
+	hasStart := false
+	for _, c := range q.conds {
+		if c.column == "data" {
+			s, ok := c.values[0].get(args).(string)
+			if !ok {
+				return nil, fmt.Errorf("timedb: LIKE needs a string")
+			}
+			r.like = like(s)
+			continue
+		}
+
+		times := make([]time.Time, len(c.values))
+		for i, v := range c.values {
+			t, err := toTime(v.get(args))
+			if err != nil {
+				return nil, err
+			}
+			times[i] = t
+		}
+
+		switch c.op {
+		case "between":
+			r.start, r.end = times[0], times[1]
+			hasStart = true
+		case "=":
+			r.start, r.end = times[0], times[0]
+			hasStart = true
+		case ">", ">=":
+			r.start, r.afterStart = times[0], c.op == ">"
+			hasStart = true
+		case "<", "<=":
+			r.end, r.beforeEnd = times[0], c.op == "<"
+		}
+	}
+
+	if !hasStart {
+		return nil, fmt.Errorf("timedb: the query needs the start time")
+	}
+
+	var err error
+	if q.limit != nil {
+		if r.limit, err = toInt(q.limit.get(args)); err != nil {
+			return nil, err
+		}
+	}
+	if q.offset != nil {
+		if r.offset, err = toInt(q.offset.get(args)); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func toTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case int64:
+		return time.Unix(t, 0), nil
+	case string:
+		for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+			if d, err := time.ParseInLocation(layout, t, time.Local); err == nil {
+				return d, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("timedb: invalid time %v", v)
+}
+
+func toInt(v interface{}) (int, error) {
+	n, ok := v.(int64)
+	if !ok || n < 0 {
+		return 0, fmt.Errorf("timedb: invalid number %v", v)
+	}
+	return int(n), nil
+}
+
+// like returns a function that matches a LIKE pattern.
+func like(pattern string) func(string) bool {
+	var b strings.Builder
+	b.WriteString("^(?s)")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+
+	re := regexp.MustCompile(b.String())
+	return re.MatchString
+}
+
+// unquote removes the quotes of an identifier.
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '`') {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// tokenize splits the query in words, quoted strings and symbols.
+func tokenize(s string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for ; j < len(s); j++ {
+				if s[j] == c {
+					// '' is an escaped quote in strings
+					if c == '\'' && j+1 < len(s) && s[j+1] == '\'' {
+						j++
+						continue
+					}
+					break
+				}
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("timedb: unterminated string")
+			}
+			tokens = append(tokens, s[i:j+1])
+			i = j + 1
+
+		case c == '>' || c == '<':
+			if i+1 < len(s) && s[i+1] == '=' {
+				tokens = append(tokens, s[i:i+2])
+				i += 2
+			} else {
+				tokens = append(tokens, s[i:i+1])
+				i++
+			}
+
+		case strings.IndexByte(",*?=", c) != -1:
+			tokens = append(tokens, s[i:i+1])
+			i++
+
+		case c == ';' && strings.TrimSpace(s[i+1:]) == "":
+			i = len(s)
+
+		default:
+			j := i
+			for j < len(s) && isWord(s[j]) {
+				j++
+			}
+			if j == i {
+				return nil, fmt.Errorf("timedb: unexpected %q", c)
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+func isWord(c byte) bool {
+	return c == '_' || c == '-' || c == '.' || c == '/' || c == ':' ||
+		'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
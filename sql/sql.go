@@ -0,0 +1,177 @@
+/*
+Package sql is a database/sql driver that reads the data of a timedb
+database, so tools that speak SQL can query it. It is registered with
+the name "timedb" and the data directory as the data source name:
+
+	db, err := sql.Open("timedb", "path/to/data")
+	rows, err := db.Query("SELECT time, data FROM nginx WHERE time BETWEEN ? AND ? AND data LIKE ? LIMIT 10", start, end, "%500%")
+
+Only queries with this form are supported:
+
+	SELECT time, data FROM table
+	WHERE time BETWEEN a AND b [AND data LIKE pattern]
+	[LIMIT n] [OFFSET n]
+
+The time can also be compared with >, >=, < and <=. The values are ?
+parameters or literals: 'strings' and numbers. Times can be time.Time,
+strings in RFC 3339 or "2006-01-02 15:04:05" format, or Unix times.
+Table names with characters like "*" must be quoted with double quotes.
+*/
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/scorredoira/timedb"
+)
+
+func init() {
+	sql.Register("timedb", &Driver{})
+}
+
+// Driver opens the databases by the path of their data directory.
+type Driver struct{}
+
+func (d *Driver) Open(name string) (driver.Conn, error) {
+	return &conn{db: timedb.New(name)}, nil
+}
+
+// OpenDB returns a sql.DB that reads an open timedb database.
+func OpenDB(db *timedb.DB) *sql.DB {
+	return sql.OpenDB(connector{db})
+}
+
+type connector struct {
+	db *timedb.DB
+}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) {
+	return &conn{db: c.db}, nil
+}
+
+func (c connector) Driver() driver.Driver {
+	return &Driver{}
+}
+
+type conn struct {
+	db *timedb.DB
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	q, err := parse(query)
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{db: c.db, query: q}, nil
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return nil, errors.New("timedb: transactions are not supported")
+}
+
+type stmt struct {
+	db    *timedb.DB
+	query *query
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return s.query.params
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("timedb: only SELECT is supported")
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	r, err := s.query.bind(args)
+	if err != nil {
+		return nil, err
+	}
+
+	r.scanner = s.db.Query(r.table, r.start, r.end, 0, 0)
+	return r, nil
+}
+
+// rows are the results of a query.
+type rows struct {
+	columns []string
+	table   string
+	start   time.Time
+	end     time.Time
+
+	// the ranges are inclusive unless these are set
+	afterStart bool
+	beforeEnd  bool
+
+	like    func(text string) bool
+	offset  int
+	limit   int
+	count   int
+	scanner *timedb.Scanner
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	r.scanner.Close()
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.limit >= 0 && r.count >= r.limit {
+		return io.EOF
+	}
+
+	for r.scanner.Scan() {
+		d := r.scanner.Data()
+		if d.Time.After(r.end) || (r.beforeEnd && d.Time.Equal(r.end)) {
+			break
+		}
+		if d.Time.Before(r.start) || (r.afterStart && d.Time.Equal(r.start)) {
+			continue
+		}
+
+		text := d.Text
+		if len(text) > 0 && text[0] == ' ' {
+			text = text[1:]
+		}
+		if r.like != nil && !r.like(text) {
+			continue
+		}
+
+		if r.offset > 0 {
+			r.offset--
+			continue
+		}
+
+		for i, c := range r.columns {
+			if c == "time" {
+				dest[i] = d.Time
+			} else {
+				dest[i] = text
+			}
+		}
+		r.count++
+		return nil
+	}
+
+	if r.scanner.Error != nil {
+		return r.scanner.Error
+	}
+	return io.EOF
+}
@@ -0,0 +1,109 @@
+package sql
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/scorredoira/timedb"
+)
+
+func TestQuery(t *testing.T) {
+	tdb := timedb.NewMemory()
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 10; i++ {
+		status := 200
+		if i%3 == 0 {
+			status = 500
+		}
+		if err := tdb.Insert(start.Add(time.Duration(i)*time.Second), "nginx", "GET /%d %d", i, status); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db := OpenDB(tdb)
+	defer db.Close()
+
+	query := func(q string, args ...interface{}) []string {
+		t.Helper()
+		rows, err := db.Query(q, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var result []string
+		for rows.Next() {
+			var tm time.Time
+			var data string
+			if err := rows.Scan(&tm, &data); err != nil {
+				t.Fatal(err)
+			}
+			result = append(result, data)
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	got := query("SELECT time, data FROM nginx WHERE time BETWEEN ? AND ? AND data LIKE ?", start, start.Add(5*time.Second), "% 500")
+	if len(got) != 2 || got[0] != "GET /0 500" || got[1] != "GET /3 500" {
+		t.Fatalf("unexpected rows %v", got)
+	}
+
+	got = query("SELECT * FROM \"ngi*\" WHERE time >= ? AND time < ? LIMIT 2 OFFSET ?", start.Add(time.Second), start.Add(5*time.Second), 1)
+	if len(got) != 2 || got[0] != "GET /2 200" || got[1] != "GET /3 500" {
+		t.Fatalf("unexpected rows %v", got)
+	}
+
+	got = query("SELECT time, data FROM nginx WHERE time > '2020-01-01 10:00:08'")
+	if len(got) != 1 || got[0] != "GET /9 500" {
+		t.Fatalf("unexpected rows %v", got)
+	}
+
+	var data string
+	if err := db.QueryRow("SELECT data FROM nginx WHERE time = ?", start.Add(time.Second).Unix()).Scan(&data); err != nil || data != "GET /1 200" {
+		t.Fatalf("unexpected row %q %v", data, err)
+	}
+
+	for _, q := range []string{
+		"SELECT data FROM nginx",
+		"SELECT text FROM nginx WHERE time > 0",
+		"DELETE FROM nginx",
+		"SELECT data FROM nginx WHERE data = 'x'",
+	} {
+		if _, err := db.Query(q); err == nil {
+			t.Fatalf("expected an error for %s", q)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	tdb := timedb.New(dir)
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	if err := tdb.Insert(start, "app", "a"); err != nil {
+		t.Fatal(err)
+	}
+	tdb.Close()
+
+	db, err := sql.Open("timedb", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var n int
+	rows, err := db.Query("SELECT data FROM app WHERE time BETWEEN ? AND ?", start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		n++
+	}
+	if n != 1 {
+		t.Fatalf("expected 1, got %d", n)
+	}
+}
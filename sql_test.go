@@ -0,0 +1,108 @@
+package timedb
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRunSQL(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i, status := range []int{200, 500, 500, 200} {
+		tm := start.Add(time.Duration(i) * 40 * time.Second)
+		host := []string{"a", "b"}[i%2]
+		if err := db.Insert(tm, "nginx", `{"status":%d,"req":{"host":"%s","ms":%d}}`, status, host, i*10); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.InsertValue(tm, "cpu", float64(i), Labels{"host": host}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Insert(tm, "app", "level=info msg=%q", "hello world"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := db.RunSQL("SELECT * FROM app WHERE time BETWEEN '2020-01-01 10:00:00' AND '2020-01-01 10:01:00' AND text LIKE '%hello%' LIMIT 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Records) != 1 || res.Records[0].Text != `level=info msg="hello world"` {
+		t.Fatalf("invalid result %v", res.Records)
+	}
+
+	res, err = db.RunSQL("SELECT msg FROM app WHERE time >= '2020-01-01' AND time < '2020-01-02' AND level = 'info'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Rows) != 4 || res.Rows[0].Fields["msg"] != "hello world" {
+		t.Fatalf("invalid result %v", res.Rows)
+	}
+
+	res, err = db.RunSQL("SELECT req.host, status FROM nginx WHERE time >= '2020-01-01' AND time < '2020-01-02' AND status > 300 AND req.ms <= 10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Rows) != 1 || res.Rows[0].Fields["req.host"] != "b" || res.Rows[0].Fields["status"] != "500" {
+		t.Fatalf("invalid result %v", res.Rows)
+	}
+
+	res, err = db.RunSQL("SELECT count(*) FROM nginx WHERE time >= '2020-01-01 10:00:00' AND time < '2020-01-01 10:03:00' AND status = 500 GROUP BY time(1m)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := res.Series[0].Points; len(p) != 3 || p[0].Value != 1 || p[1].Value != 1 || p[2].Value != 0 {
+		t.Fatalf("invalid result %v", p)
+	}
+
+	res, err = db.RunSQL("SELECT avg(value) FROM cpu WHERE time >= '2020-01-01 10:00:00' AND time < '2020-01-01 10:03:00' GROUP BY time(2m), host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Series) != 2 || res.Series[0].Labels["host"] != "a" || res.Series[1].Labels["host"] != "b" {
+		t.Fatalf("invalid result %v", res.Series)
+	}
+	if p := res.Series[0].Points; len(p) != 2 || p[0].Value != 1 || !math.IsNaN(p[1].Value) {
+		t.Fatalf("invalid result %v", p)
+	}
+	if p := res.Series[1].Points; p[0].Value != 1 || p[1].Value != 3 {
+		t.Fatalf("invalid result %v", p)
+	}
+
+	for _, q := range []string{
+		"SELECT * FROM nginx",
+		"SELECT * FROM nginx WHERE status = 500",
+		"SELECT * FROM nginx WHERE time >= '2020-01-01' GROUP BY time(1m)",
+		"SELECT count(*), sum(value) FROM cpu WHERE time >= '2020-01-01'",
+		"SELECT * FROM nginx WHERE time >= 'a'",
+		"SELECT * FROM nginx WHERE time >= '2020-01-01' LIMIT x",
+		"SELECT * FROM nginx WHERE time >= '2020-01-01",
+	} {
+		if _, err := db.RunSQL(q); err == nil {
+			t.Fatalf("expected an error in %q", q)
+		}
+	}
+}
+
+func TestRecordFields(t *testing.T) {
+	f := RecordFields(`GET /index.html status=200 agent="Mozilla 5.0" ms=12`)
+	if len(f) != 3 || f["status"] != "200" || f["agent"] != "Mozilla 5.0" || f["ms"] != "12" {
+		t.Fatalf("invalid fields %v", f)
+	}
+
+	f = RecordFields(`{"a":{"b":1},"c":"x","d":null}`)
+	if len(f) != 2 || f["a.b"] != "1" || f["c"] != "x" {
+		t.Fatalf("invalid fields %v", f)
+	}
+}
+
+func TestRunSQLTooManyBuckets(t *testing.T) {
+	db := NewMemory()
+
+	_, err := db.RunSQL("SELECT count(*) FROM t WHERE time >= '2020-01-01' GROUP BY time(1s)")
+	if !errors.Is(err, ErrTooManyBuckets) {
+		t.Fatalf("expected ErrTooManyBuckets, got %v", err)
+	}
+}
@@ -0,0 +1,372 @@
+/*
+Package statsd receives metrics with the StatsD and Graphite plaintext
+protocols, aggregates them and saves a numeric point per flush interval.
+
+	s := &statsd.Server{DB: db}
+	go s.ListenStatsD(":8125")
+	go s.ListenGraphite(":2003")
+
+Each metric is stored in a table with its name. Timers are saved with a
+"stat" label (count, mean, min, max and p90).
+*/
+package statsd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/scorredoira/timedb"
+)
+
+const defaultFlushInterval = 10 * time.Second
+
+type Server struct {
+	DB *timedb.DB
+
+	// FlushInterval is how often the aggregated values are saved.
+	FlushInterval time.Duration
+
+	// Error is called with the lines that can't be parsed and other errors.
+	Error func(err error)
+
+	mutex     sync.Mutex
+	series    map[string]*series
+	once      sync.Once
+	done      chan struct{}
+	conns     []net.PacketConn
+	listeners []net.Listener
+}
+
+type series struct {
+	kind     string
+	name     string
+	labels   timedb.Labels
+	value    float64
+	count    int
+	values   []float64
+	set      map[string]bool
+	updated  bool
+	gaugeSet bool
+}
+
+func (s *Server) init() {
+	s.once.Do(func() {
+		s.series = make(map[string]*series)
+		s.done = make(chan struct{})
+		go s.run()
+	})
+}
+
+func (s *Server) run() {
+	interval := s.FlushInterval
+	if interval == 0 {
+		interval = defaultFlushInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Flush(); err != nil {
+				s.error(err)
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Server) error(err error) {
+	if s.Error != nil {
+		s.Error(err)
+	}
+}
+
+func (s *Server) get(kind, name string, labels timedb.Labels) *series {
+	key := kind + " " + name + labels.String()
+	sr, ok := s.series[key]
+	if !ok {
+		sr = &series{kind: kind, name: name, labels: labels}
+		s.series[key] = sr
+	}
+	sr.updated = true
+	return sr
+}
+
+// ParseStatsD adds a StatsD line like "name:1|c|@0.5|#tag:value".
+func (s *Server) ParseStatsD(line string) error {
+	s.init()
+
+	name, rest, ok := strings.Cut(strings.TrimSpace(line), ":")
+	if !ok || name == "" {
+		return fmt.Errorf("statsd: invalid line %q", line)
+	}
+
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 {
+		return fmt.Errorf("statsd: invalid line %q", line)
+	}
+
+	value, kind := parts[0], parts[1]
+	rate := 1.0
+	var labels timedb.Labels
+
+	for _, p := range parts[2:] {
+		switch {
+		case strings.HasPrefix(p, "@"):
+			r, err := strconv.ParseFloat(p[1:], 64)
+			if err != nil || r <= 0 {
+				return fmt.Errorf("statsd: invalid sample rate %q", line)
+			}
+			rate = r
+		case strings.HasPrefix(p, "#"):
+			labels = timedb.Labels{}
+			for _, tag := range strings.Split(p[1:], ",") {
+				k, v, _ := strings.Cut(tag, ":")
+				labels[k] = v
+			}
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if kind == "s" {
+		sr := s.get(kind, name, labels)
+		if sr.set == nil {
+			sr.set = make(map[string]bool)
+		}
+		sr.set[value] = true
+		return nil
+	}
+
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("statsd: invalid value %q", line)
+	}
+
+	switch kind {
+	case "c":
+		s.get(kind, name, labels).value += v / rate
+	case "g":
+		sr := s.get(kind, name, labels)
+		if (value[0] == '+' || value[0] == '-') && sr.gaugeSet {
+			sr.value += v
+		} else {
+			sr.value = v
+		}
+		sr.gaugeSet = true
+	case "ms", "h", "d":
+		sr := s.get("ms", name, labels)
+		sr.values = append(sr.values, v)
+	default:
+		return fmt.Errorf("statsd: invalid type %q", line)
+	}
+
+	return nil
+}
+
+// ParseGraphite adds a Graphite plaintext line like "path.to.metric 1.5 1577869200".
+// The values received in a flush interval are averaged.
+func (s *Server) ParseGraphite(line string) error {
+	s.init()
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return fmt.Errorf("graphite: invalid line %q", line)
+	}
+
+	v, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return fmt.Errorf("graphite: invalid value %q", line)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sr := s.get("graphite", fields[0], nil)
+	sr.value += v
+	sr.count++
+	return nil
+}
+
+// Flush saves the aggregated values and resets them.
+func (s *Server) Flush() error {
+	s.init()
+
+	s.mutex.Lock()
+	var points []point
+	for key, sr := range s.series {
+		if !sr.updated {
+			// gauges keep their value between intervals
+			if sr.kind != "g" {
+				delete(s.series, key)
+			}
+			continue
+		}
+		points = append(points, sr.points()...)
+		sr.reset()
+	}
+	s.mutex.Unlock()
+
+	now := time.Now()
+	for _, p := range points {
+		if err := s.DB.InsertValue(now, p.name, p.value, p.labels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type point struct {
+	name   string
+	value  float64
+	labels timedb.Labels
+}
+
+func (sr *series) points() []point {
+	switch sr.kind {
+	case "s":
+		return []point{{sr.name, float64(len(sr.set)), sr.labels}}
+	case "graphite":
+		return []point{{sr.name, sr.value / float64(sr.count), sr.labels}}
+	case "ms":
+		values := sr.values
+		sort.Float64s(values)
+
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+
+		stat := func(name string, v float64) point {
+			labels := timedb.Labels{"stat": name}
+			for k, v := range sr.labels {
+				labels[k] = v
+			}
+			return point{sr.name, v, labels}
+		}
+
+		p90 := values[(len(values)*9+9)/10-1]
+		return []point{
+			stat("count", float64(len(values))),
+			stat("mean", sum/float64(len(values))),
+			stat("min", values[0]),
+			stat("max", values[len(values)-1]),
+			stat("p90", p90),
+		}
+	default:
+		return []point{{sr.name, sr.value, sr.labels}}
+	}
+}
+
+func (sr *series) reset() {
+	sr.updated = false
+	sr.count = 0
+	sr.values = nil
+	sr.set = nil
+	if sr.kind != "g" {
+		sr.value = 0
+	}
+}
+
+// ListenStatsD receives StatsD metrics over UDP until the server is closed.
+func (s *Server) ListenStatsD(addr string) error {
+	s.init()
+
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	s.conns = append(s.conns, conn)
+	s.mutex.Unlock()
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if err := s.ParseStatsD(line); err != nil {
+				s.error(err)
+			}
+		}
+	}
+}
+
+// ListenGraphite receives Graphite metrics over TCP until the server is closed.
+func (s *Server) ListenGraphite(addr string) error {
+	s.init()
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	s.listeners = append(s.listeners, ln)
+	s.mutex.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		go func() {
+			defer conn.Close()
+			sc := bufio.NewScanner(conn)
+			for sc.Scan() {
+				if err := s.ParseGraphite(sc.Text()); err != nil {
+					s.error(err)
+				}
+			}
+		}()
+	}
+}
+
+// Close stops the listeners and saves the pending values.
+func (s *Server) Close() error {
+	s.init()
+
+	s.mutex.Lock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+	for _, ln := range s.listeners {
+		ln.Close()
+	}
+	s.conns = nil
+	s.listeners = nil
+	s.mutex.Unlock()
+
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+
+	return s.Flush()
+}
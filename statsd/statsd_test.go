@@ -0,0 +1,70 @@
+package statsd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/scorredoira/timedb"
+)
+
+func TestFlush(t *testing.T) {
+	db := timedb.NewMemory()
+	s := &Server{DB: db, FlushInterval: time.Hour}
+	defer s.Close()
+
+	lines := []string{
+		"hits:1|c",
+		"hits:1|c|@0.5",
+		"temp:20|g",
+		"temp:+2|g",
+		"users:a|s",
+		"users:b|s",
+		"users:a|s",
+		"latency:10|ms|#env:prod",
+		"latency:30|ms|#env:prod",
+	}
+	for _, l := range lines {
+		if err := s.ParseStatsD(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.ParseGraphite("servers.a.load 2 1577869200"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ParseGraphite("servers.a.load 4 1577869200"); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := map[string]string{
+		"hits":           " 3",
+		"temp":           " 22",
+		"users":          " 2",
+		"servers.a.load": " 3",
+	}
+
+	for table, value := range expect {
+		scanner := db.Query(table, start.Add(-time.Second), start, 0, 0)
+		if !scanner.Scan() || scanner.Data().Text != value {
+			t.Fatalf("%s: unexpected value %q", table, scanner.Data().Text)
+		}
+		scanner.Close()
+	}
+
+	scanner := db.Query("latency", start.Add(-time.Second), start, 0, 0)
+	defer scanner.Close()
+
+	var got []string
+	for scanner.Scan() {
+		got = append(got, scanner.Data().Text)
+	}
+
+	if len(got) != 5 || got[1] != ` 20 {env="prod",stat="mean"}` {
+		t.Fatalf("unexpected timer values %q", got)
+	}
+}
@@ -0,0 +1,325 @@
+package timedb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// storage is where the files of a database are kept. Names are slash
+// separated paths relative to the root of the database, like in fs.FS.
+type storage interface {
+	fs.ReadDirFS
+
+	// Append opens the file for appending creating it and its directory if necessary.
+	Append(name string) (io.WriteCloser, error)
+
+	// Create creates or truncates the file creating its directory if necessary.
+	Create(name string) (io.WriteCloser, error)
+
+	Rename(oldname, newname string) error
+	Remove(name string) error
+
+	// Truncate changes the size of the file.
+	Truncate(name string, size int64) error
+}
+
+// ErrReadOnly is returned when writing to a read only database.
+var ErrReadOnly = errors.New("timeDB: read only database")
+
+// diskStorage stores the files in a directory.
+type diskStorage struct {
+	root string
+}
+
+func (s diskStorage) path(name string) string {
+	return filepath.Join(s.root, filepath.FromSlash(name))
+}
+
+func (s diskStorage) Open(name string) (fs.File, error) {
+	return os.Open(s.path(name))
+}
+
+func (s diskStorage) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(s.path(name))
+}
+
+// Append and Create unshare the files linked by a snapshot before
+// writing them (see SnapshotHardlink).
+func (s diskStorage) Append(name string) (io.WriteCloser, error) {
+	if err := unshare(s.path(name)); err != nil {
+		return nil, err
+	}
+	return s.openFile(name, os.O_APPEND|os.O_WRONLY|os.O_CREATE)
+}
+
+func (s diskStorage) Create(name string) (io.WriteCloser, error) {
+	// the content is replaced so it doesn't need a copy
+	if info, err := os.Stat(s.path(name)); err == nil && linkCount(info) > 1 {
+		if err := s.Remove(name); err != nil {
+			return nil, err
+		}
+	}
+	return s.openFile(name, os.O_TRUNC|os.O_WRONLY|os.O_CREATE)
+}
+
+func (s diskStorage) openFile(name string, flag int) (*os.File, error) {
+	p := s.path(name)
+	if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(p, flag, 0644)
+}
+
+func (s diskStorage) Rename(oldname, newname string) error {
+	return os.Rename(s.path(oldname), s.path(newname))
+}
+
+func (s diskStorage) Remove(name string) error {
+	return os.Remove(s.path(name))
+}
+
+func (s diskStorage) Truncate(name string, size int64) error {
+	if err := unshare(s.path(name)); err != nil {
+		return err
+	}
+	return os.Truncate(s.path(name), size)
+}
+
+// fsStorage reads the files from a fs.FS. It doesn't support writing.
+type fsStorage struct {
+	fsys fs.FS
+}
+
+func (s fsStorage) Open(name string) (fs.File, error) {
+	return s.fsys.Open(name)
+}
+
+func (s fsStorage) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(s.fsys, name)
+}
+
+func (s fsStorage) Append(name string) (io.WriteCloser, error) {
+	return nil, ErrReadOnly
+}
+
+func (s fsStorage) Create(name string) (io.WriteCloser, error) {
+	return nil, ErrReadOnly
+}
+
+func (s fsStorage) Rename(oldname, newname string) error {
+	return ErrReadOnly
+}
+
+func (s fsStorage) Remove(name string) error {
+	return ErrReadOnly
+}
+
+func (s fsStorage) Truncate(name string, size int64) error {
+	return ErrReadOnly
+}
+
+// memStorage keeps the files in memory.
+type memStorage struct {
+	mutex sync.RWMutex
+	files map[string]*memData
+}
+
+type memData struct {
+	data    []byte
+	modTime time.Time
+}
+
+func newMemStorage() *memStorage {
+	return &memStorage{files: make(map[string]*memData)}
+}
+
+func (s *memStorage) Open(name string) (fs.File, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if d, ok := s.files[name]; ok {
+		// data is only appended so the slice is a stable snapshot
+		info := memInfo{name: path.Base(name), size: int64(len(d.data)), modTime: d.modTime}
+		return &memFile{Reader: bytes.NewReader(d.data), info: info}, nil
+	}
+
+	if name == "." || s.isDir(name) {
+		return &memFile{Reader: bytes.NewReader(nil), info: memInfo{name: path.Base(name), dir: true}}, nil
+	}
+
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func (s *memStorage) isDir(name string) bool {
+	prefix := name + "/"
+	for k := range s.files {
+		if strings.HasPrefix(k, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memStorage) ReadDir(name string) ([]fs.DirEntry, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	prefix := name + "/"
+	if name == "." {
+		prefix = ""
+	}
+
+	entries := make(map[string]fs.DirEntry)
+	for k, d := range s.files {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+
+		rest := k[len(prefix):]
+		if i := strings.IndexByte(rest, '/'); i != -1 {
+			dir := rest[:i]
+			entries[dir] = fs.FileInfoToDirEntry(memInfo{name: dir, dir: true})
+		} else {
+			info := memInfo{name: rest, size: int64(len(d.data)), modTime: d.modTime}
+			entries[rest] = fs.FileInfoToDirEntry(info)
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	result := make([]fs.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, e)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name() < result[j].Name() })
+	return result, nil
+}
+
+func (s *memStorage) Append(name string) (io.WriteCloser, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.files[name]; !ok {
+		s.files[name] = &memData{modTime: time.Now()}
+	}
+	return &memWriter{storage: s, name: name}, nil
+}
+
+func (s *memStorage) Create(name string) (io.WriteCloser, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.files[name] = &memData{modTime: time.Now()}
+	return &memWriter{storage: s, name: name}, nil
+}
+
+func (s *memStorage) Rename(oldname, newname string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	d, ok := s.files[oldname]
+	if !ok {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: fs.ErrNotExist}
+	}
+
+	delete(s.files, oldname)
+	s.files[newname] = d
+	return nil
+}
+
+func (s *memStorage) Remove(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.files[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+
+	delete(s.files, name)
+	return nil
+}
+
+func (s *memStorage) Truncate(name string, size int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	d, ok := s.files[name]
+	if !ok {
+		return &fs.PathError{Op: "truncate", Path: name, Err: fs.ErrNotExist}
+	}
+
+	// a copy because the open readers keep the old slice
+	d.data = append([]byte(nil), d.data[:min(size, int64(len(d.data)))]...)
+	d.modTime = time.Now()
+	return nil
+}
+
+type memWriter struct {
+	storage *memStorage
+	name    string
+}
+
+func (w *memWriter) Write(p []byte) (int, error) {
+	s := w.storage
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	d, ok := s.files[w.name]
+	if !ok {
+		// the file was removed or renamed while open
+		return 0, &fs.PathError{Op: "write", Path: w.name, Err: fs.ErrClosed}
+	}
+
+	// appending never modifies the bytes seen by open readers
+	d.data = append(d.data, p...)
+	d.modTime = time.Now()
+	return len(p), nil
+}
+
+func (w *memWriter) Close() error {
+	return nil
+}
+
+type memFile struct {
+	*bytes.Reader
+	info memInfo
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
+
+type memInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return i.size }
+func (i memInfo) ModTime() time.Time { return i.modTime }
+func (i memInfo) IsDir() bool        { return i.dir }
+func (i memInfo) Sys() interface{}   { return nil }
+
+func (i memInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0777
+	}
+	return 0644
+}
@@ -0,0 +1,70 @@
+package timedb
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 3; i++ {
+		if err := db.Insert(start.Add(time.Duration(i)*time.Hour*24), "logs", "v%d", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.Insert(start, "other", "x"); err != nil {
+		t.Fatal(err)
+	}
+
+	scanner := db.Query("logs", start, start.Add(time.Hour*48), 1, 5)
+	defer scanner.Close()
+
+	var got string
+	for scanner.Scan() {
+		got += scanner.Data().Text
+	}
+
+	if scanner.Error != nil {
+		t.Fatal(scanner.Error)
+	}
+
+	if got != " v1 v2" {
+		t.Fatalf("unexpected result %q", got)
+	}
+
+	tables, err := db.matchTables(start, "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tables) != 2 || tables[0] != "logs" || tables[1] != "other" {
+		t.Fatalf("unexpected tables %v", tables)
+	}
+}
+
+func TestOpenFS(t *testing.T) {
+	db := New(t.TempDir())
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	if err := db.Insert(start, "logs", "archived"); err != nil {
+		t.Fatal(err)
+	}
+
+	ro := OpenFS(os.DirFS(db.Path))
+
+	scanner := ro.Query("logs", start, start, 0, 0)
+	defer scanner.Close()
+
+	if !scanner.Scan() || scanner.Data().Text != " archived" {
+		t.Fatal("expected the archived record")
+	}
+
+	if err := ro.Insert(start, "logs", "x"); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+}
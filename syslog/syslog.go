@@ -0,0 +1,339 @@
+/*
+Package syslog receives syslog messages (RFC 3164 and RFC 5424) over UDP
+or TCP and saves them in a timedb database.
+
+	l := &syslog.Listener{DB: db}
+	go l.ListenUDP(":514")
+*/
+package syslog
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/scorredoira/timedb"
+)
+
+var severities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+var facilities = []string{"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7"}
+
+type Message struct {
+	Time     time.Time
+	Facility int
+	Severity int
+	Hostname string
+	AppName  string
+	ProcID   string
+	MsgID    string
+	Text     string
+}
+
+// FacilityName returns the name of the facility like "daemon" or "local0".
+func (m *Message) FacilityName() string {
+	if m.Facility < len(facilities) {
+		return facilities[m.Facility]
+	}
+	return strconv.Itoa(m.Facility)
+}
+
+// String returns the message in the format it is stored:
+// "severity hostname app[procid]: text".
+func (m *Message) String() string {
+	var b strings.Builder
+	b.WriteString(severities[m.Severity&7])
+
+	if m.Hostname != "" {
+		b.WriteString(" " + m.Hostname)
+	}
+
+	if m.AppName != "" {
+		b.WriteString(" " + m.AppName)
+		if m.ProcID != "" {
+			b.WriteString("[" + m.ProcID + "]")
+		}
+		b.WriteString(":")
+	}
+
+	b.WriteString(" " + m.Text)
+	return b.String()
+}
+
+// Parse parses a RFC 5424 or RFC 3164 message.
+func Parse(b []byte) (*Message, error) {
+	s := strings.TrimRight(string(b), "\r\n\x00")
+	if len(s) < 3 || s[0] != '<' {
+		return nil, fmt.Errorf("syslog: invalid message %q", s)
+	}
+
+	end := strings.IndexByte(s, '>')
+	if end == -1 || end > 4 {
+		return nil, fmt.Errorf("syslog: invalid priority %q", s)
+	}
+
+	pri, err := strconv.Atoi(s[1:end])
+	if err != nil || pri > 191 {
+		return nil, fmt.Errorf("syslog: invalid priority %q", s)
+	}
+
+	m := &Message{Facility: pri / 8, Severity: pri % 8}
+	s = s[end+1:]
+
+	if strings.HasPrefix(s, "1 ") {
+		parse5424(m, s[2:])
+	} else {
+		parse3164(m, s)
+	}
+
+	if m.Time.IsZero() {
+		m.Time = time.Now()
+	}
+	return m, nil
+}
+
+func parse5424(m *Message, s string) {
+	fields := strings.SplitN(s, " ", 6)
+	for len(fields) < 6 {
+		fields = append(fields, "-")
+	}
+
+	nilValue := func(v string) string {
+		if v == "-" {
+			return ""
+		}
+		return v
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, fields[0]); err == nil {
+		m.Time = t
+	}
+	m.Hostname = nilValue(fields[1])
+	m.AppName = nilValue(fields[2])
+	m.ProcID = nilValue(fields[3])
+	m.MsgID = nilValue(fields[4])
+
+	// skip the structured data
+	rest := fields[5]
+	if strings.HasPrefix(rest, "-") {
+		rest = rest[1:]
+	} else {
+		for strings.HasPrefix(rest, "[") {
+			i := structuredDataEnd(rest)
+			if i == -1 {
+				break
+			}
+			rest = rest[i+1:]
+		}
+	}
+
+	m.Text = strings.TrimPrefix(strings.TrimPrefix(rest, " "), "\ufeff")
+}
+
+// structuredDataEnd returns the index of the "]" that closes the element.
+func structuredDataEnd(s string) int {
+	quoted := false
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case ']':
+			if !quoted {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func parse3164(m *Message, s string) {
+	// Mmm dd hh:mm:ss has no year
+	if len(s) >= 16 && s[15] == ' ' {
+		if t, err := time.ParseInLocation(time.Stamp, s[:15], time.Local); err == nil {
+			now := time.Now()
+			t = t.AddDate(now.Year(), 0, 0)
+			if t.After(now.Add(24 * time.Hour)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+			m.Time = t
+			s = s[16:]
+
+			if i := strings.IndexByte(s, ' '); i != -1 {
+				m.Hostname = s[:i]
+				s = s[i+1:]
+			}
+		}
+	}
+
+	// the tag ends at the first ":" or "[" and it is alphanumeric
+	if i := strings.Index(s, ": "); i != -1 && i <= 48 && !strings.Contains(s[:i], " ") {
+		tag := s[:i]
+		if j := strings.IndexByte(tag, '['); j != -1 && strings.HasSuffix(tag, "]") {
+			m.ProcID = tag[j+1 : len(tag)-1]
+			tag = tag[:j]
+		}
+		m.AppName = tag
+		s = s[i+2:]
+	}
+
+	m.Text = s
+}
+
+type Listener struct {
+	DB *timedb.DB
+
+	// Table returns the table of a message. By default it is
+	// the application name or "syslog" if it is empty.
+	Table func(m *Message) string
+
+	// Error is called with the messages that can't be parsed or saved.
+	Error func(err error)
+
+	mutex     sync.Mutex
+	conns     []net.PacketConn
+	listeners []net.Listener
+}
+
+func (l *Listener) table(m *Message) string {
+	if l.Table != nil {
+		return l.Table(m)
+	}
+	if m.AppName != "" {
+		return m.AppName
+	}
+	return "syslog"
+}
+
+func (l *Listener) handle(b []byte) {
+	m, err := Parse(b)
+	if err == nil {
+		err = l.DB.Insert(m.Time, l.table(m), m.String())
+	}
+
+	if err != nil && l.Error != nil {
+		l.Error(err)
+	}
+}
+
+// ListenUDP receives messages in addr until the listener is closed.
+func (l *Listener) ListenUDP(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	l.conns = append(l.conns, conn)
+	l.mutex.Unlock()
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if isClosed(err) {
+				return nil
+			}
+			return err
+		}
+		l.handle(buf[:n])
+	}
+}
+
+// ListenTCP receives messages in addr until the listener is closed. Messages
+// can be delimited by new lines or with octet counting (RFC 6587).
+func (l *Listener) ListenTCP(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	l.listeners = append(l.listeners, ln)
+	l.mutex.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if isClosed(err) {
+				return nil
+			}
+			return err
+		}
+		go l.serveTCP(conn)
+	}
+}
+
+func (l *Listener) serveTCP(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	for {
+		b, err := readFrame(r)
+		if len(b) > 0 {
+			l.handle(b)
+		}
+		if err != nil {
+			if err != io.EOF && l.Error != nil {
+				l.Error(err)
+			}
+			return
+		}
+	}
+}
+
+// readFrame reads an octet counted or a new line delimited message.
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	c, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if c[0] >= '1' && c[0] <= '9' {
+		size, err := r.ReadString(' ')
+		if err != nil {
+			return nil, err
+		}
+
+		n, err := strconv.Atoi(strings.TrimSpace(size))
+		if err != nil || n > 1024*1024 {
+			return nil, fmt.Errorf("syslog: invalid frame size %q", size)
+		}
+
+		b := make([]byte, n)
+		_, err = io.ReadFull(r, b)
+		return b, err
+	}
+
+	return r.ReadBytes('\n')
+}
+
+// Close stops all the listeners.
+func (l *Listener) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for _, c := range l.conns {
+		c.Close()
+	}
+	for _, ln := range l.listeners {
+		ln.Close()
+	}
+
+	l.conns = nil
+	l.listeners = nil
+	return nil
+}
+
+func isClosed(err error) bool {
+	return errors.Is(err, net.ErrClosed)
+}
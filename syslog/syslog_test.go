@@ -0,0 +1,169 @@
+package syslog
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scorredoira/timedb"
+)
+
+func TestParse5424(t *testing.T) {
+	m, err := Parse([]byte(`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application"] An application event`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.FacilityName() != "local4" || m.Severity != 5 || m.Hostname != "mymachine.example.com" ||
+		m.AppName != "evntslog" || m.MsgID != "ID47" || m.Text != "An application event" {
+		t.Fatalf("unexpected message %+v", m)
+	}
+
+	if !m.Time.Equal(time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC)) {
+		t.Fatalf("unexpected time %v", m.Time)
+	}
+
+	if s := m.String(); s != "notice mymachine.example.com evntslog: An application event" {
+		t.Fatalf("unexpected string %q", s)
+	}
+}
+
+func TestParse3164(t *testing.T) {
+	m, err := Parse([]byte("<34>Oct 11 22:14:15 mymachine su[123]: 'su root' failed\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.FacilityName() != "auth" || m.Severity != 2 || m.Hostname != "mymachine" ||
+		m.AppName != "su" || m.ProcID != "123" || m.Text != "'su root' failed" {
+		t.Fatalf("unexpected message %+v", m)
+	}
+
+	if m.Time.Month() != time.October || m.Time.Day() != 11 || m.Time.Hour() != 22 {
+		t.Fatalf("unexpected time %v", m.Time)
+	}
+}
+
+func TestReadFrame(t *testing.T) {
+	// octet counted, new line delimited, a frame with a new line inside
+	// and the last one without the new line at the end
+	r := bufio.NewReader(strings.NewReader("6 <14>ab<14>cd\n9 <14>a\nbcd<14>ef"))
+
+	for _, expected := range []string{"<14>ab", "<14>cd\n", "<14>a\nbcd", "<14>ef"} {
+		b, err := readFrame(r)
+		if err != nil && err != io.EOF {
+			t.Fatal(err)
+		}
+		if string(b) != expected {
+			t.Fatalf("expected %q, got %q", expected, b)
+		}
+	}
+
+	if _, err := readFrame(r); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+
+	for _, s := range []string{"99999999 <14>a", "5x <14>a", "10 <14>a"} {
+		if _, err := readFrame(bufio.NewReader(strings.NewReader(s))); err == nil || err == io.EOF {
+			t.Fatalf("%q: expected an error, got %v", s, err)
+		}
+	}
+}
+
+func TestListenerTCP(t *testing.T) {
+	db := timedb.NewMemory()
+
+	var errs []error
+	l := &Listener{DB: db, Error: func(err error) { errs = append(errs, err) }}
+
+	client, server := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		l.serveTCP(server)
+		close(done)
+	}()
+
+	// the new line of the second message would forge a record
+	frames := []string{
+		"<14>1 2020-01-01T10:00:00Z web1 app - - - first\n",
+		"<14>1 2020-01-01T10:00:01Z web1 app - - - second\n1577872800 forged",
+		"<14>1 2020-01-01T10:00:02Z web1 app - - - third",
+	}
+	var b strings.Builder
+	b.WriteString(frames[0])
+	for _, f := range frames[1:] {
+		b.WriteString(strconv.Itoa(len(f)) + " " + f)
+	}
+
+	client.Write([]byte(b.String()))
+	client.Close()
+	<-done
+
+	if len(errs) != 1 || !errors.Is(errs[0], timedb.ErrNewLine) {
+		t.Fatalf("expected ErrNewLine, got %v", errs)
+	}
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := db.Query("app", start, start.Add(24*time.Hour), 0, 0)
+	defer s.Close()
+
+	var got []string
+	for s.Scan() {
+		got = append(got, s.Data().Text)
+	}
+	if strings.Join(got, ",") != " info web1 app: first, info web1 app: third" {
+		t.Fatalf("unexpected records %q", got)
+	}
+}
+
+func TestListenerUDP(t *testing.T) {
+	db := timedb.NewMemory()
+	l := &Listener{DB: db, Error: func(err error) { t.Error(err) }}
+	defer l.Close()
+
+	go l.ListenUDP("127.0.0.1:0")
+
+	var addr net.Addr
+	for i := 0; addr == nil && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+		l.mutex.Lock()
+		if len(l.conns) > 0 {
+			addr = l.conns[0].LocalAddr()
+		}
+		l.mutex.Unlock()
+	}
+	if addr == nil {
+		t.Fatal("the listener didn't start")
+	}
+
+	conn, err := net.Dial("udp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// each datagram is a message
+	conn.Write([]byte("<14>1 2020-01-01T10:00:00Z web1 app - - - hello\n"))
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 100; i++ {
+		s := db.Query("app", start, start.Add(24*time.Hour), 0, 0)
+		ok := s.Scan()
+		text := s.Data().Text
+		s.Close()
+
+		if ok {
+			if text != " info web1 app: hello" {
+				t.Fatalf("unexpected record %q", text)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("expected a record")
+}
@@ -0,0 +1,429 @@
+package timedb
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// tablesMeta is the metadata file with the options of the tables.
+const tablesMeta = "tables.json"
+
+// FsyncPolicy is when the data written to a table is synced to disk.
+type FsyncPolicy int
+
+const (
+	// FsyncNever leaves it to the operating system.
+	FsyncNever FsyncPolicy = iota
+
+	// FsyncAlways syncs after every write.
+	FsyncAlways
+
+	// FsyncOnClose syncs when the file is closed, when writing
+	// to another table or day.
+	FsyncOnClose
+)
+
+// TableOptions are the settings of a table. They are saved in the data
+// directory and used by the writer and by ApplyTableOptions.
+type TableOptions struct {
+	// Retention is how long the data is kept. Zero keeps it forever.
+	Retention time.Duration `json:",omitempty"`
+
+	// Compress compresses with zstd the days before today.
+	Compress bool `json:",omitempty"`
+
+	// Dictionary trains a zstd dictionary with the first day compressed
+	// if the table doesn't have one (see TrainDictionary).
+	Dictionary bool `json:",omitempty"`
+
+	Fsync FsyncPolicy `json:",omitempty"`
+
+	// MaxLineSize is the maximum size of a record. Zero is unlimited.
+	MaxLineSize int `json:",omitempty"`
+
+	// MaxFileSize is the maximum size of the file of a day. When it
+	// is full the records continue in part files: table.log.1,
+	// table.log.2... Zero is unlimited.
+	MaxFileSize int64 `json:",omitempty"`
+
+	// Sequence stores a sequence number with each record
+	// (see DataPoint.Seq).
+	Sequence bool `json:",omitempty"`
+
+	// FullText builds a full text index of the days before today
+	// to speed up Search. It is not built with encryption.
+	FullText bool `json:",omitempty"`
+
+	// Columns are fields of the JSON records stored in columnar blocks
+	// for the days before today, so ScanColumns and AggregateColumn
+	// read only the fields they need. Nested fields are separated
+	// with dots. They are not built with encryption.
+	Columns []string `json:",omitempty"`
+
+	// MaxBytes is the quota of the table. Zero is unlimited.
+	MaxBytes    int64       `json:",omitempty"`
+	QuotaPolicy QuotaPolicy `json:",omitempty"`
+}
+
+// SetTableOptions saves the options of a table. The table can be a
+// pattern like "prod/**" to set the options of many tables. A table
+// uses the options of its exact name or else of the first pattern
+// that matches it in alphabetical order.
+func (db *DB) SetTableOptions(table string, o TableOptions) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	opts := make(map[string]TableOptions)
+	for k, v := range db.loadTableOptions() {
+		opts[k] = v
+	}
+	opts[table] = o
+
+	b, err := json.Marshal(opts)
+	if err != nil {
+		return err
+	}
+
+	if err := db.WriteMeta(tablesMeta, b); err != nil {
+		return err
+	}
+
+	db.tableOptions.Store(&opts)
+	return nil
+}
+
+// TableOptions returns the options of a table.
+func (db *DB) TableOptions(table string) TableOptions {
+	opts := db.loadTableOptions()
+
+	if o, ok := opts[table]; ok {
+		return o
+	}
+
+	patterns := make([]string, 0, len(opts))
+	for k := range opts {
+		if isPattern(k) {
+			patterns = append(patterns, k)
+		}
+	}
+	sort.Strings(patterns)
+
+	for _, p := range patterns {
+		if matchTable(p, table) {
+			return opts[p]
+		}
+	}
+
+	return TableOptions{}
+}
+
+// loadTableOptions returns the options of the tables reading them
+// from the data directory the first time.
+func (db *DB) loadTableOptions() map[string]TableOptions {
+	if opts := db.tableOptions.Load(); opts != nil {
+		return *opts
+	}
+
+	opts := make(map[string]TableOptions)
+
+	b, err := db.ReadMeta(tablesMeta)
+	if err == nil {
+		if err := json.Unmarshal(b, &opts); err != nil {
+			db.log().Warn("timedb: invalid table options", "error", err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		db.log().Warn("timedb: error reading the table options", "error", err)
+	}
+
+	db.tableOptions.Store(&opts)
+	return opts
+}
+
+// ApplyTableOptions deletes the data older than the retention of each table,
+// indexes the days before today of the tables with full text search and
+// compresses them if the tables are compressed.
+func (db *DB) ApplyTableOptions() error {
+	if len(db.loadTableOptions()) == 0 {
+		return nil
+	}
+
+	unlock, err := db.lockMaintenance()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+
+	dayList, err := db.days()
+	if err != nil {
+		return err
+	}
+
+	local := localStorage(db.storage)
+
+	for _, day := range dayList {
+		tables, err := db.matchTables(day, "**")
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+
+		for _, table := range tables {
+			o := db.TableOptions(table)
+			name := db.getTablePath(day, table)
+
+			if o.Retention > 0 && !day.AddDate(0, 0, 1).After(now.Add(-o.Retention)) {
+				db.closeFile(name)
+				files := append([]string{name, name + ".zst"}, sidecarFiles(name)...)
+				files = append(files, partFiles(local, name)...)
+				if err := db.retire(local, files...); err != nil {
+					return fmt.Errorf("timeDB: error removing %s: %v", name, err)
+				}
+				continue
+			}
+
+			// the indexes would have the encrypted text in clear
+			if o.FullText && day.Before(today) && db.keys == nil {
+				if _, ok := db.savedIndex(name); !ok {
+					if err := db.buildIndex(day, name); err != nil {
+						return err
+					}
+				}
+			}
+
+			if len(o.Columns) > 0 && day.Before(today) && db.keys == nil {
+				if _, ok := db.savedColumns(name, o.Columns); !ok {
+					if err := db.buildColumns(day, name, o.Columns); err != nil {
+						return err
+					}
+				}
+			}
+
+			if o.Compress && day.Before(today) {
+				db.closeFile(name)
+				var opts []zstd.EOption
+				var ready bool
+				for part := 0; part <= lastPart(local, name); part++ {
+					p := partName(name, part)
+					if _, err := fs.Stat(local, p); err != nil {
+						continue
+					}
+					// the dictionary is trained only if there is
+					// something to compress
+					if !ready {
+						if opts, err = db.compressor(day, table, o); err != nil {
+							return err
+						}
+						ready = true
+					}
+					if err := compressFile(local, p, opts...); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		removeDayDir(local, db.getDir(day))
+	}
+
+	db.resetUsage()
+	return nil
+}
+
+// compressFile replaces the file with a zstd compressed copy with the
+// ".zst" extension, in frames with sync markers (see frameWriter). Files
+// that don't exist locally are ignored.
+func compressFile(s storage, name string, opts ...zstd.EOption) error {
+	in, err := s.Open(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer in.Close()
+
+	tmp := name + ".zst.tmp"
+	out, err := s.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	zw, err := newFrameWriter(out, opts...)
+	if err != nil {
+		out.Close()
+		return err
+	}
+
+	_, err = io.Copy(zw, in)
+	if err == nil {
+		err = zw.Close()
+	} else {
+		zw.Close()
+	}
+	if e := out.Close(); err == nil {
+		err = e
+	}
+
+	if err != nil {
+		s.Remove(tmp)
+		return fmt.Errorf("timeDB: error compressing %s: %v", name, err)
+	}
+
+	if err := s.Rename(tmp, name+".zst"); err != nil {
+		return err
+	}
+
+	in.Close()
+	return s.Remove(name)
+}
+
+// decompressFile restores a compressed file so it can be appended. The
+// caller must hold the lock, or the one of the writer of the table.
+func (db *DB) decompressFile(name string) error {
+	local := localStorage(db.storage)
+
+	if _, err := fs.Stat(local, name); !errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	in, err := openCompressed(local, name, db.dicts)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer in.Close()
+
+	tmp := name + ".tmp"
+	out, err := local.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		local.Remove(tmp)
+		return fmt.Errorf("timeDB: error decompressing %s: %v", name, err)
+	}
+
+	if err := local.Rename(tmp, name); err != nil {
+		return err
+	}
+	db.forgetFileUsage(partBase(name))
+	return local.Remove(name + ".zst")
+}
+
+// openCompressed opens the compressed version of a file. The files
+// compressed with a dictionary are read with the one in dicts.
+func openCompressed(s fs.FS, name string, dicts *dictionaries) (fs.File, error) {
+	f, err := s.Open(name + ".zst")
+	if err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(f)
+	opts, err := dicts.decompressor(s, r)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &compressedFile{file: f, r: r, opts: opts, name: name[strings.LastIndexByte(name, '/')+1:]}, nil
+}
+
+// fsFunc is a function used as a fs.FS.
+type fsFunc func(name string) (fs.File, error)
+
+func (f fsFunc) Open(name string) (fs.File, error) {
+	return f(name)
+}
+
+// syncFile syncs the file to disk if the storage supports it.
+func syncFile(w io.Writer) error {
+	if s, ok := w.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+// compressedFile is a file being decompressed. The decoder is created
+// when it is read.
+type compressedFile struct {
+	file fs.File
+	r    *bufio.Reader
+	opts []zstd.DOption
+	zstd *zstd.Decoder
+	name string
+}
+
+func (f *compressedFile) Read(p []byte) (int, error) {
+	if f.zstd == nil {
+		zr, err := zstd.NewReader(f.r, f.opts...)
+		if err != nil {
+			return 0, err
+		}
+		f.zstd = zr
+	}
+	return f.zstd.Read(p)
+}
+
+// frames returns a reader of the decompressed data that skips the frames
+// that can't be decompressed, calling corrupt with each one. Files without
+// sync markers are read as they are. It must be called before reading.
+func (f *compressedFile) frames(corrupt func(offset int64, frame []byte)) (io.Reader, error) {
+	b, _ := f.r.Peek(syncMarkerSize)
+	if _, ok := parseSyncMarker(b); !ok {
+		return f, nil
+	}
+
+	dec, err := zstd.NewReader(nil, f.opts...)
+	if err != nil {
+		return nil, err
+	}
+	f.zstd = dec
+
+	return &frameReader{r: f.r, dec: dec, corrupt: corrupt}, nil
+}
+
+func (f *compressedFile) Stat() (fs.FileInfo, error) {
+	// the size is unknown
+	return memInfo{name: f.name}, nil
+}
+
+func (f *compressedFile) Close() error {
+	if f.zstd != nil {
+		f.zstd.Close()
+	}
+	return f.file.Close()
+}
+
+// tableFileName returns the table of a file name like "nginx.log" or
+// "nginx.log.zst" if it is compressed.
+func tableFileName(name string) (string, bool) {
+	name = strings.TrimSuffix(name, ".zst")
+	if !strings.HasSuffix(name, ".log") {
+		return "", false
+	}
+	return strings.TrimSuffix(name, ".log"), true
+}
@@ -0,0 +1,103 @@
+package timedb
+
+import (
+	"io/fs"
+	"testing"
+	"time"
+)
+
+func TestTableOptions(t *testing.T) {
+	dir := t.TempDir()
+	db := New(dir)
+
+	if err := db.SetTableOptions("prod/**", TableOptions{MaxLineSize: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetTableOptions("prod/web", TableOptions{Fsync: FsyncAlways}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the options are saved in the data directory
+	db = New(dir)
+
+	if o := db.TableOptions("prod/api"); o.MaxLineSize != 5 {
+		t.Fatalf("unexpected options %+v", o)
+	}
+	if o := db.TableOptions("prod/web"); o.MaxLineSize != 0 || o.Fsync != FsyncAlways {
+		t.Fatalf("unexpected options %+v", o)
+	}
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+
+	if err := db.Insert(start, "prod/api", "123456"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if err := db.Insert(start, "prod/api", "12345"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Insert(start, "prod/web", "123456"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApplyTableOptions(t *testing.T) {
+	db := New(t.TempDir())
+
+	db.SetTableOptions("old", TableOptions{Retention: 48 * time.Hour})
+	db.SetTableOptions("zipped", TableOptions{Compress: true})
+
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		t := now.AddDate(0, 0, -i)
+		db.Insert(t, "old", "a")
+		db.Insert(t, "zipped", "b%d", i)
+		db.Insert(t, "other", "c")
+	}
+
+	if err := db.ApplyTableOptions(); err != nil {
+		t.Fatal(err)
+	}
+
+	count := func(table string) int {
+		s := db.Query(table, now.AddDate(0, 0, -5), now, 0, 0)
+		defer s.Close()
+
+		n := 0
+		for s.Scan() {
+			n++
+		}
+		if s.Error != nil {
+			t.Fatal(s.Error)
+		}
+		return n
+	}
+
+	if n := count("old"); n != 3 {
+		t.Fatalf("expected 3 records, got %d", n)
+	}
+	if n := count("other"); n != 4 {
+		t.Fatalf("expected 4 records, got %d", n)
+	}
+	if n := count("zipped"); n != 4 {
+		t.Fatalf("expected 4 records, got %d", n)
+	}
+
+	yesterday := db.getTablePath(now.AddDate(0, 0, -1), "zipped")
+	if _, err := fs.Stat(localStorage(db.storage), yesterday+".zst"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat(localStorage(db.storage), db.getTablePath(now, "zipped")+".zst"); err == nil {
+		t.Fatal("today should not be compressed")
+	}
+
+	// writing to a compressed day restores it
+	if err := db.Insert(now.AddDate(0, 0, -1), "zipped", "late"); err != nil {
+		t.Fatal(err)
+	}
+	if n := count("zipped"); n != 5 {
+		t.Fatalf("expected 5 records, got %d", n)
+	}
+	if n := count("z*"); n != 5 {
+		t.Fatalf("expected 5 records, got %d", n)
+	}
+}
@@ -0,0 +1,113 @@
+package timedb
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// Table names can be hierarchical like "prod/web/nginx". Each level is a
+// directory inside the day: "2006-01-02/prod/web/nginx.log".
+
+// validTable reports an error if the table name can't be used as a path.
+func validTable(table string) error {
+	if !fs.ValidPath(table) || table == "." || isPattern(table) {
+		return fmt.Errorf("timeDB: invalid table name %q", table)
+	}
+	return nil
+}
+
+// MatchTable reports whether the table matches the pattern (see matchTable).
+func MatchTable(pattern, table string) bool {
+	return matchTable(pattern, table)
+}
+
+// matchTable reports whether the table matches the pattern. Each level is
+// matched with path.Match and "**" matches any number of levels, so
+// "prod/*/nginx" and "prod/**" are valid patterns.
+func matchTable(pattern, table string) bool {
+	return matchLevels(strings.Split(pattern, "/"), strings.Split(table, "/"))
+}
+
+func matchLevels(pattern, table []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(table); i++ {
+				if matchLevels(pattern[1:], table[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(table) == 0 {
+			return false
+		}
+
+		if ok, _ := path.Match(pattern[0], table[0]); !ok {
+			return false
+		}
+
+		pattern, table = pattern[1:], table[1:]
+	}
+
+	return len(table) == 0
+}
+
+// dayFiles returns the files of a directory and its subdirectories.
+func dayFiles(s storage, dir string) ([]string, error) {
+	entries, err := s.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, e := range entries {
+		name := path.Join(dir, e.Name())
+		if e.Type()&fs.ModeSymlink != 0 {
+			// the links of SetCurrentLinks
+			continue
+		}
+		if !e.IsDir() {
+			files = append(files, name)
+			continue
+		}
+
+		sub, err := dayFiles(s, name)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, sub...)
+	}
+
+	return files, nil
+}
+
+// removeDirs removes the directory and its subdirectories if they are
+// empty. It returns the number of directories removed and their size.
+func removeDirs(s storage, dir string) (int, int64) {
+	entries, err := s.ReadDir(dir)
+	if err != nil {
+		return 0, 0
+	}
+
+	var count int
+	var size int64
+	for _, e := range entries {
+		if e.IsDir() {
+			n, b := removeDirs(s, path.Join(dir, e.Name()))
+			count += n
+			size += b
+		}
+	}
+
+	info, err := fs.Stat(s, dir)
+	if s.Remove(dir) == nil {
+		count++
+		if err == nil {
+			size += info.Size()
+		}
+	}
+	return count, size
+}
@@ -0,0 +1,85 @@
+package timedb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMatchTable(t *testing.T) {
+	tests := []struct {
+		pattern string
+		table   string
+		match   bool
+	}{
+		{"app-*", "app-1", true},
+		{"app-*", "app/1", false},
+		{"prod/*/nginx", "prod/web/nginx", true},
+		{"prod/*/nginx", "prod/web/api", false},
+		{"prod/*", "prod/web/nginx", false},
+		{"prod/**", "prod/web/nginx", true},
+		{"prod/**", "prod/web", true},
+		{"**/nginx", "prod/web/nginx", true},
+		{"**/nginx", "nginx", true},
+		{"**", "prod/web/nginx", true},
+		{"prod/**/api", "prod/web/nginx", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchTable(tt.pattern, tt.table); got != tt.match {
+			t.Errorf("matchTable(%q, %q) = %v", tt.pattern, tt.table, got)
+		}
+	}
+}
+
+func TestHierarchicalTables(t *testing.T) {
+	db := New(t.TempDir())
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+
+	tables := []string{"prod/web/nginx", "prod/api/nginx", "prod/web/app", "dev/web/nginx"}
+	for i, table := range tables {
+		if err := db.Insert(start.Add(time.Duration(i)*time.Second), table, table); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, table := range []string{"../x", "/x", "a//b", "a/*"} {
+		if err := db.Insert(start, table, "x"); err == nil {
+			t.Fatalf("expected an error for %q", table)
+		}
+	}
+
+	query := func(table string) []string {
+		s := db.Query(table, start, start.Add(time.Hour), 0, 0)
+		defer s.Close()
+
+		var result []string
+		for s.Scan() {
+			result = append(result, s.Data().Text)
+		}
+		if s.Error != nil {
+			t.Fatal(s.Error)
+		}
+		return result
+	}
+
+	if got := query("prod/web/nginx"); len(got) != 1 {
+		t.Fatalf("unexpected data %q", got)
+	}
+	if got := query("prod/*/nginx"); len(got) != 2 {
+		t.Fatalf("unexpected data %q", got)
+	}
+	if got := query("prod/**"); len(got) != 3 {
+		t.Fatalf("unexpected data %q", got)
+	}
+	if got := query("**/nginx"); len(got) != 3 {
+		t.Fatalf("unexpected data %q", got)
+	}
+
+	// nested tables are archived too
+	if err := db.Archive(start); err != nil {
+		t.Fatal(err)
+	}
+	if got := query("**"); len(got) != 4 {
+		t.Fatalf("unexpected data %q", got)
+	}
+}
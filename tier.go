@@ -0,0 +1,407 @@
+package timedb
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RemoteStore is an object storage (like S3) where old partitions are moved.
+// Names are slash separated paths like "2006-01-02/table.log".
+//
+// Get must return an error that matches fs.ErrNotExist if the object
+// doesn't exist.
+type RemoteStore interface {
+	Put(name string, r io.Reader) error
+	Get(name string) (io.ReadCloser, error)
+
+	// List returns the names of all the objects that start with prefix.
+	List(prefix string) ([]string, error)
+}
+
+// SetRemote sets the remote store used for tiering. Partitions that
+// are not found locally are read from the remote store, only the byte
+// ranges needed if it is a RangeStore. The records written to a day
+// after it was tiered are read merged with the remote ones.
+func (db *DB) SetRemote(remote RemoteStore) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	local := db.storage
+	if t, ok := local.(*tieredStorage); ok {
+		local = t.storage
+	}
+
+	db.storage = &tieredStorage{storage: local, remote: remote, key: db.recordKey}
+}
+
+// Tier uploads the partitions of the days before the given time to the
+// remote store and deletes them locally. The records written to a day
+// after it was tiered are merged with the remote one.
+func (db *DB) Tier(before time.Time) error {
+	t, ok := db.storage.(*tieredStorage)
+	if !ok {
+		return fmt.Errorf("timeDB.Tier: no remote store")
+	}
+
+	unlock, err := db.lockMaintenance()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	dayList, err := db.storageDays(t.storage)
+	if err != nil {
+		return err
+	}
+
+	before = before.Local()
+	limit := time.Date(before.Year(), before.Month(), before.Day(), 0, 0, 0, 0, time.Local)
+
+	for _, day := range dayList {
+		if !day.Before(limit) {
+			break
+		}
+
+		if err := db.tierDay(t, day); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (db *DB) tierDay(t *tieredStorage, day time.Time) error {
+	dir := db.getDir(day)
+
+	db.mutex.RLock()
+	files, err := dayFiles(t.storage, dir)
+	db.mutex.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range files {
+		if err := db.tierFile(t, name); err != nil {
+			return err
+		}
+	}
+
+	// the directory should be empty now
+	db.mutex.Lock()
+	removeDirs(t.storage, dir)
+	db.mutex.Unlock()
+
+	db.resetUsage()
+	db.log().Info("timedb: day moved to the remote store", "day", dir, "files", len(files))
+	return nil
+}
+
+// tierFile uploads the file and removes it locally. The database is only
+// locked to take the size of the file and to remove it, not while it is
+// uploaded. A file written meanwhile is kept and uploaded again by the
+// next Tier, merged with the object uploaded now.
+func (db *DB) tierFile(t *tieredStorage, name string) error {
+	// the writes after closing the file start after size
+	db.mutex.Lock()
+	db.closeFile(name)
+	info, err := fs.Stat(t.storage, name)
+	db.mutex.Unlock()
+	if err != nil {
+		return fmt.Errorf("timeDB.Tier: error openning file %s: %v", name, err)
+	}
+
+	if err := db.upload(t, name, info.Size()); err != nil {
+		return err
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.closeFile(name)
+	if now, err := fs.Stat(t.storage, name); err != nil || now.Size() != info.Size() {
+		db.log().Warn("timedb: file written while it was moved to the remote store", "file", name)
+		return nil
+	}
+
+	if err := t.storage.Remove(name); err != nil {
+		return fmt.Errorf("timeDB.Tier: error removing %s: %v", name, err)
+	}
+	return nil
+}
+
+// upload puts the first size bytes of the file in the remote store. If
+// a data file already is there, because records were written to the day
+// after it was tiered, the records of both are merged.
+func (db *DB) upload(t *tieredStorage, name string, size int64) error {
+	f, err := t.storage.Open(name)
+	if err != nil {
+		return fmt.Errorf("timeDB.Tier: error openning file %s: %v", name, err)
+	}
+
+	var r io.ReadCloser = readCloser{io.LimitReader(f, size), f}
+
+	if _, ok := tableFileName(partBase(name)); ok {
+		old, err := t.remote.Get(name)
+		switch {
+		case err == nil && strings.HasSuffix(name, ".zst"):
+			old.Close()
+			r.Close()
+			return fmt.Errorf("timeDB.Tier: %s is already in the remote store", name)
+		case err == nil:
+			r = db.mergeRemote(old, r)
+		case !errors.Is(err, fs.ErrNotExist):
+			r.Close()
+			return fmt.Errorf("timeDB.Tier: error downloading %s: %v", name, err)
+		}
+	}
+
+	err = t.remote.Put(name, r)
+	r.Close()
+	if err != nil {
+		return fmt.Errorf("timeDB.Tier: error uploading %s: %v", name, err)
+	}
+
+	t.uploaded(name)
+	return nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// mergeRemote returns the records of the remote object and the local
+// file merged like Merge does.
+func (db *DB) mergeRemote(remote, local io.ReadCloser) io.ReadCloser {
+	pr, pw := io.Pipe()
+	m := newMergeReader([]io.ReadCloser{remote, local})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		defer m.Close()
+		_, err := db.writeHeader(pw, 0)
+		if err == nil {
+			err = writeUnique(pw, m, db.recordKey)
+		}
+		pw.CloseWithError(err)
+	}()
+
+	// closing waits for the files to be closed
+	return readCloser{pr, closerFunc(func() error {
+		pr.Close()
+		<-done
+		return nil
+	})}
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
+
+// tieredStorage reads from the remote store the files that
+// don't exist locally.
+type tieredStorage struct {
+	storage
+	remote RemoteStore
+
+	// key identifies the records repeated in the local file and the
+	// remote object (see writeUnique).
+	key func(line []byte) string
+
+	// objects are the names of the remote objects of the directories
+	// listed.
+	mutex   sync.Mutex
+	objects map[string]map[string]bool
+}
+
+func (s *tieredStorage) Open(name string) (fs.File, error) {
+	f, err := s.storage.Open(name)
+	if err == nil {
+		return s.openMerged(name, f)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	if rs, ok := s.remote.(RangeStore); ok {
+		return openRange(rs, name)
+	}
+
+	r, err := s.remote.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &remoteFile{ReadCloser: r, name: path.Base(name)}, nil
+}
+
+// openMerged returns the records of a local data file merged with the
+// ones of the remote object of the same name, if the day was tiered
+// before the records of the file were written. The records that both
+// have, because the file was written while it was tiered, are returned
+// only once.
+func (s *tieredStorage) openMerged(name string, local fs.File) (fs.File, error) {
+	if _, ok := tableFileName(partBase(name)); !ok || strings.HasSuffix(name, ".zst") {
+		return local, nil
+	}
+
+	ok, err := s.inRemote(name)
+	if err != nil {
+		local.Close()
+		return nil, fmt.Errorf("timeDB: error listing the remote store: %v", err)
+	}
+	if !ok {
+		return local, nil
+	}
+
+	remote, err := s.remote.Get(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return local, nil
+	}
+	if err != nil {
+		local.Close()
+		return nil, err
+	}
+
+	// the header of the local file, that has the current format
+	br := bufio.NewReader(local)
+	var header []byte
+	if b, err := br.Peek(len(headerMagic)); err == nil && isHeader(b) {
+		header, _ = br.ReadBytes('\n')
+	}
+
+	pr, pw := io.Pipe()
+	m := newMergeReader([]io.ReadCloser{remote, readCloser{br, local}})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		defer m.Close()
+		_, err := pw.Write(header)
+		if err == nil {
+			err = writeUnique(pw, m, s.key)
+		}
+		pw.CloseWithError(err)
+	}()
+
+	// closing waits for the files to be closed
+	r := readCloser{pr, closerFunc(func() error {
+		pr.Close()
+		<-done
+		return nil
+	})}
+	return &remoteFile{ReadCloser: r, name: path.Base(name)}, nil
+}
+
+// inRemote reports whether the object exists in the remote store. The
+// objects of each directory are listed once.
+func (s *tieredStorage) inRemote(name string) (bool, error) {
+	dir := path.Dir(name)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	objects, ok := s.objects[dir]
+	if !ok {
+		names, err := s.remote.List(dir + "/")
+		if err != nil {
+			return false, err
+		}
+
+		objects = make(map[string]bool, len(names))
+		for _, n := range names {
+			objects[n] = true
+		}
+
+		if s.objects == nil {
+			s.objects = make(map[string]map[string]bool)
+		}
+		s.objects[dir] = objects
+	}
+
+	return objects[name], nil
+}
+
+// uploaded records that the object is in the remote store.
+func (s *tieredStorage) uploaded(name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if objects, ok := s.objects[path.Dir(name)]; ok {
+		objects[name] = true
+	}
+}
+
+func (s *tieredStorage) ReadDir(name string) ([]fs.DirEntry, error) {
+	local, err := s.storage.ReadDir(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	prefix := name + "/"
+	if name == "." {
+		prefix = ""
+	}
+
+	names, err := s.remote.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]fs.DirEntry)
+	for _, e := range local {
+		entries[e.Name()] = e
+	}
+
+	for _, n := range names {
+		rest := strings.TrimPrefix(n, prefix)
+		if rest == "" {
+			continue
+		}
+
+		if _, ok := entries[rest]; ok {
+			continue
+		}
+
+		if i := strings.IndexByte(rest, '/'); i != -1 {
+			dir := rest[:i]
+			if _, ok := entries[dir]; !ok {
+				entries[dir] = fs.FileInfoToDirEntry(memInfo{name: dir, dir: true})
+			}
+		} else {
+			entries[rest] = fs.FileInfoToDirEntry(memInfo{name: rest})
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	result := make([]fs.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, e)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name() < result[j].Name() })
+	return result, nil
+}
+
+// remoteFile is a file being downloaded from the remote store.
+type remoteFile struct {
+	io.ReadCloser
+	name string
+}
+
+func (f *remoteFile) Stat() (fs.FileInfo, error) {
+	return memInfo{name: f.name}, nil
+}
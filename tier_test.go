@@ -0,0 +1,152 @@
+package timedb
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mapRemote map[string][]byte
+
+func (m mapRemote) Put(name string, r io.Reader) error {
+	b, err := io.ReadAll(r)
+	m[name] = b
+	return err
+}
+
+func (m mapRemote) Get(name string) (io.ReadCloser, error) {
+	b, ok := m[name]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (m mapRemote) List(prefix string) ([]string, error) {
+	var names []string
+	for k := range m {
+		if strings.HasPrefix(k, prefix) {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func TestTier(t *testing.T) {
+	db := New(t.TempDir())
+	remote := mapRemote{}
+	db.SetRemote(remote)
+
+	day1 := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	day2 := day1.AddDate(0, 0, 1)
+
+	if err := db.Insert(day1, "logs", "old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Insert(day2, "logs", "new"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Tier(day2); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := remote["2020-01-01/logs.log"]; !ok || len(remote) != 1 {
+		t.Fatalf("unexpected remote %v", remote)
+	}
+
+	scanner := db.Query("lo*", day1, day2, 0, 0)
+	defer scanner.Close()
+
+	var got string
+	for scanner.Scan() {
+		got += scanner.Data().Text
+	}
+
+	if scanner.Error != nil {
+		t.Fatal(scanner.Error)
+	}
+
+	if got != " old new" {
+		t.Fatalf("unexpected result %q", got)
+	}
+}
+
+func TestTierAgain(t *testing.T) {
+	db := New(t.TempDir())
+	remote := mapRemote{}
+	db.SetRemote(remote)
+
+	day := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	if err := db.Insert(day, "logs", "old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Tier(day.AddDate(0, 0, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	// a late record for the day is merged with the remote object
+	if err := db.Insert(day.Add(time.Hour), "logs", "new"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Tier(day.AddDate(0, 0, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	scanner := db.Query("logs", day, day.Add(2*time.Hour), 0, 0)
+	defer scanner.Close()
+
+	var got string
+	for scanner.Scan() {
+		got += scanner.Data().Text
+	}
+	if got != " old new" {
+		t.Fatalf("unexpected result %q", got)
+	}
+}
+
+func TestTierLateWrite(t *testing.T) {
+	db := New(t.TempDir())
+	remote := mapRemote{}
+	db.SetRemote(remote)
+
+	day := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	if err := db.Insert(day, "logs", "old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Tier(day.AddDate(0, 0, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the late record is local and the old one remote until the
+	// day is tiered again
+	if err := db.Insert(day.Add(time.Hour), "logs", "new"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mmap := range []bool{false, true} {
+		db.SetMmap(mmap)
+
+		for _, table := range []string{"logs", "lo*"} {
+			scanner := db.Query(table, day, day.Add(2*time.Hour), 0, 0)
+
+			var got string
+			for scanner.Scan() {
+				got += scanner.Data().Text
+			}
+			scanner.Close()
+
+			if scanner.Error != nil {
+				t.Fatal(scanner.Error)
+			}
+			if got != " old new" {
+				t.Fatalf("%s: unexpected result %q", table, got)
+			}
+		}
+	}
+}
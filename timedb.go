@@ -8,29 +8,93 @@ package timedb
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"log/slog"
 	"os"
-	"path/filepath"
-	"strconv"
+	"path"
+	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type DB struct {
-	Path      string
-	mutex     *sync.RWMutex
-	file      *os.File
-	writePath string
+	Path       string
+	mutex      *sync.RWMutex
+	storage    storage
+	keys       KeyProvider
+	writeHooks []WriteHook
+	readHooks  []readHook
+	observers  []WriteObserver
+	metrics    *metrics
+	tracer     Tracer
+	logger     atomic.Pointer[slog.Logger]
+	writers    writers
+	lock       *dirLock
+
+	tableOptions atomic.Pointer[map[string]TableOptions]
+	quota        Quota
+	health       HealthOptions
+	usage        usage
+	diskFull     func(err error)
+	maintenance  *maintenance
+	asyncMutex   sync.RWMutex
+	async        *asyncWriter
+	flushOnQuery atomic.Bool
+	mmap         atomic.Bool
+	maxLine      atomic.Int64
+	fileCache    atomic.Pointer[fileCache]
+	recent       atomic.Pointer[recentCache]
+	dedup        atomic.Pointer[deduper]
+	clock        atomic.Pointer[clockGuard]
+	layout       atomic.Pointer[Layout]
+	currentLinks atomic.Bool
+	tailsChecked atomic.Bool
+	currentFiles map[string]string
+	rollovers    []RolloverFunc
+	mirrors      []*MirrorWriter
+	snapshots    snapshots
+	backup       backup
+	ids          recordIDs
+	seqMutex     sync.Mutex
+	seqs         map[string]uint64
+	seqLoaded    map[string]bool
+	dicts        *dictionaries
 }
 
 func New(path string) *DB {
-	return &DB{Path: path, mutex: &sync.RWMutex{}}
+	return newDB(path, diskStorage{root: path})
+}
+
+// OpenFS returns a read only database that reads the data from fsys.
+func OpenFS(fsys fs.FS) *DB {
+	return newDB("", fsStorage{fsys: fsys})
+}
+
+// NewMemory returns a database that keeps all the data in memory.
+// It is intended for tests.
+func NewMemory() *DB {
+	return newDB("", newMemStorage())
+}
+
+func newDB(path string, s storage) *DB {
+	dicts := &dictionaries{}
+	return &DB{
+		Path:    path,
+		mutex:   &sync.RWMutex{},
+		metrics: &metrics{},
+		storage: archiveStorage{storage: s, dicts: dicts, entries: &archiveEntries{}},
+		dicts:   dicts,
+	}
 }
 
 func (db *DB) Save(table, data string, v ...interface{}) error {
-	return db.save(time.Now(), table, data, v...)
+	return db.save(db.now(table), table, data, v...)
 }
 
 func (db *DB) Insert(t time.Time, table, data string, v ...interface{}) error {
@@ -41,6 +105,10 @@ func (db *DB) Insert(t time.Time, table, data string, v ...interface{}) error {
 type DataPoint struct {
 	Time time.Time
 	Text string
+
+	// Seq is the sequence number of the record in tables
+	// with TableOptions.Sequence.
+	Seq uint64 `json:",omitempty"`
 }
 
 func (d DataPoint) String() string {
@@ -48,9 +116,34 @@ func (d DataPoint) String() string {
 }
 
 type Scanner struct {
-	reader  *reader
-	scanner *bufio.Scanner
-	Error   error
+	reader   *reader
+	scanner  *bufio.Scanner
+	data     DataPoint
+	hooks    []readHook
+	start    time.Time
+	rows     int64
+	closed   bool
+	sample   sampler
+	totals   progressTotals
+	maxLine  int
+	trunc    bool
+	skip     bool
+	json     *JSONFilter
+	filters  []FilterFunc
+	project  *regexp.Regexp
+	fields   map[string]string
+	afterSeq uint64
+
+	// tableHooks are the read hooks of each table of the records.
+	tableHooks map[string][]ReadHook
+
+	// the cursor after the last record returned
+	consumed   int64
+	last       cursor
+	hasLast    bool
+	resumeSkip int
+
+	Error error
 }
 
 func (s *Scanner) Scan() bool {
@@ -60,25 +153,71 @@ func (s *Scanner) Scan() bool {
 LOOP:
 	for {
 		if r.limit > 0 && r.index >= r.limit {
+			// release the files without waiting for Close
+			r.finish()
 			return false
 		}
 
 		if ok := sc.Scan(); !ok {
+			r.unpin()
+			if err := sc.Err(); err != nil {
+				if errors.Is(err, bufio.ErrTooLong) {
+					err = fmt.Errorf("%w in table %s: more than %d bytes", ErrLineTooLong, r.table, s.maxLine)
+				}
+				s.Error = err
+			}
 			return false
 		}
 
-		d := s.Data()
+		if isHeader(sc.Bytes()) {
+			continue LOOP
+		}
+
+		d := s.parse()
+		s.data = d
+
 		// advance to start before sending data
 		if d.Time.Before(r.start) {
 			continue LOOP
 		}
 
+		if s.afterSeq > 0 && d.Seq <= s.afterSeq {
+			continue LOOP
+		}
+
 		if r.filter != "" {
-			if !strings.Contains(sc.Text(), r.filter) {
+			// encrypted lines are filtered by the decrypted text
+			line := sc.Text()
+			if r.db.keys != nil {
+				line = d.Text
+			}
+			if !strings.Contains(line, r.filter) {
+				continue LOOP
+			}
+		}
+
+		if s.json != nil && !s.json.Match(d.Text) {
+			continue LOOP
+		}
+
+		if len(s.filters) > 0 && !s.filterFuncs(d) {
+			continue LOOP
+		}
+
+		if s.project != nil {
+			if s.fields = projectFields(s.project, trimText(d.Text)); s.fields == nil {
 				continue LOOP
 			}
 		}
 
+		if s.skipResumed(d) {
+			continue LOOP
+		}
+
+		if !s.sample.keep() {
+			continue LOOP
+		}
+
 		// advance to Offset before sending data
 		for r.index < r.offset {
 			r.index++
@@ -86,19 +225,42 @@ LOOP:
 		}
 
 		r.index++
+
+		if len(s.hooks) > 0 {
+			s.runReadHooks()
+		}
+		s.advanceCursor(d)
+		r.db.metrics.scanRows.Add(1)
+		s.rows++
 		return true
 	}
 }
 
 func (s *Scanner) Close() {
-	s.reader.Close()
+	s.reader.finish()
+
+	if !s.closed {
+		s.closed = true
+		m := s.reader.db.metrics
+		m.queries.Add(1)
+		m.queryTime.Add(int64(time.Since(s.start)))
+
+		if span := s.reader.span; span != nil {
+			span.End(s.rows, s.reader.bytes.Load(), s.Error)
+		}
+	}
 }
 
 func (s *Scanner) SetFilter(v string) {
 	s.reader.filter = v
 }
 
+// Data returns the current data point.
 func (s *Scanner) Data() DataPoint {
+	return s.data
+}
+
+func (s *Scanner) parse() DataPoint {
 	line := s.scanner.Text()
 
 	err := s.scanner.Err()
@@ -110,31 +272,59 @@ func (s *Scanner) Data() DataPoint {
 	i := strings.Index(line, " ")
 	if i == -1 {
 		s.Error = fmt.Errorf("Invalid line: %s", line)
+		s.reader.db.metrics.parseErrors.Add(1)
+		s.reader.db.log().Warn("timedb: invalid line", "table", s.reader.table, "line", line)
 		return DataPoint{}
 	}
 
-	epoch, err := strconv.ParseInt(line[:i], 10, 64)
+	epoch, seq, err := parseTimeField(line[:i])
 	if err != nil {
 		s.Error = fmt.Errorf("Error parsing time in '%s': %v", line, err)
+		s.reader.db.metrics.parseErrors.Add(1)
+		s.reader.db.log().Warn("timedb: invalid time", "table", s.reader.table, "line", line)
 		return DataPoint{}
 	}
 
-	return DataPoint{Time: time.Unix(int64(epoch), 0), Text: line[i:]}
+	text := line[i:]
+	if s.reader.db.keys != nil && strings.HasPrefix(text, " "+encryptedPrefix) {
+		text, err = s.reader.db.decrypt(epoch, text[1:])
+		if err != nil {
+			s.Error = err
+			s.reader.db.log().Warn("timedb: can't decrypt line", "table", s.reader.table, "error", err)
+			return DataPoint{}
+		}
+		text = " " + text
+	}
+
+	return DataPoint{Time: time.Unix(int64(epoch), 0), Text: text, Seq: seq}
 }
 
 func (db *DB) Query(table string, start, end time.Time, offset, size int) *Scanner {
-	r := db.reader(start, end, table, offset, offset+size)
-	s := bufio.NewScanner(r)
+	return db.QueryContext(context.Background(), table, start, end, offset, size)
+}
+
+// QueryContext is like Query. The context is used to trace the query.
+func (db *DB) QueryContext(ctx context.Context, table string, start, end time.Time, offset, size int) *Scanner {
+	if db.flushOnQuery.Load() {
+		// the errors of the writes are reported by Errors
+		db.Flush()
+	}
 
-	// set large capacity (some lines ar very long)
-	const maxCapacity = 512 * 1024
-	buf := make([]byte, maxCapacity)
-	s.Buffer(buf, maxCapacity)
+	r := db.reader(start, end, table, offset, offset+size)
+	if db.tracer != nil {
+		r.span = db.tracer.StartQuery(ctx, table, start, end)
+	}
 
-	return &Scanner{
-		scanner: s,
+	s := &Scanner{
+		scanner: bufio.NewScanner(r),
 		reader:  r,
+		hooks:   db.getReadHooks(),
+		start:   time.Now(),
 	}
+
+	s.SetMaxLineSize(int(db.maxLine.Load()))
+	s.scanner.Split(s.split)
+	return s
 }
 
 type reader struct {
@@ -147,16 +337,44 @@ type reader struct {
 	index    int
 	filter   string
 	current  time.Time
-	file     *os.File
+	file     io.ReadCloser
+	opened   int
+	span     QuerySpan
+	bytes    atomic.Int64
+	files    atomic.Int64
+	prefetch *prefetcher
 	keepFile bool
+	done     bool
 	buf      []byte
+	pooled   *[]byte
+
+	// returned is the number of bytes read, to find the file of a
+	// line in boundaries.
+	returned   int64
+	boundaries []fileBoundary
+	resume     *cursor
+	resumed    bool
+
+	// gen is the generation of the data that the query sees.
+	gen    uint64
+	pinned bool
 }
 
 // Read reads up to len(p) bytes through one or many files
 func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.read(p)
+	r.returned += int64(n)
+	return n, err
+}
+
+func (r *reader) read(p []byte) (int, error) {
 	r.db.mutex.RLock()
 	defer r.db.mutex.RUnlock()
 
+	if r.done {
+		return 0, io.EOF
+	}
+
 	l := len(p)
 
 	for {
@@ -167,6 +385,14 @@ func (r *reader) Read(p []byte) (int, error) {
 			return l, nil
 		}
 
+		// don't open the next file until the data of the current
+		// one is consumed because the query can end before
+		if !r.keepFile && len(r.buf) > 0 {
+			n := copy(p, r.buf)
+			r.buf = r.buf[n:]
+			return n, nil
+		}
+
 		// advance to the next file in necessary
 		if !r.keepFile {
 			err := r.nextFile()
@@ -182,9 +408,23 @@ func (r *reader) Read(p []byte) (int, error) {
 			}
 		}
 
-		// read the current file and grow the buffer
-		b := make([]byte, len(p))
-		n, err := r.file.Read(b)
+		r.grow(len(p))
+
+		// mapped files are appended without copying them twice
+		if m, ok := r.file.(*mmapFile); ok {
+			b := m.next(len(p))
+			if len(b) == 0 {
+				r.keepFile = false
+			} else {
+				r.keepFile = true
+			}
+			r.bytes.Add(int64(len(b)))
+			r.buf = append(r.buf, b...)
+			continue
+		}
+
+		// read the current file at the end of the buffer
+		n, err := r.file.Read(r.buf[len(r.buf) : len(r.buf)+len(p)])
 		if err == io.EOF {
 			r.keepFile = false
 		} else if err != nil {
@@ -193,11 +433,17 @@ func (r *reader) Read(p []byte) (int, error) {
 			r.keepFile = true
 		}
 
-		r.buf = append(r.buf, b[:n]...)
+		r.bytes.Add(int64(n))
+		r.buf = r.buf[:len(r.buf)+n]
 	}
 }
 
 func (r *reader) nextFile() error {
+	if r.prefetch != nil {
+		r.Close()
+		return r.prefetch.nextFile(r)
+	}
+
 	for {
 		// poner al inicio o avanzar un día
 		if r.current.Before(r.start) {
@@ -211,43 +457,162 @@ func (r *reader) nextFile() error {
 			return io.EOF
 		}
 
-		file, err := r.open(r.current)
+		file, err := r.openDay(r.current)
 		if err != nil {
 			// si este día no hay datos pasar al siguiente
-			if os.IsNotExist(err) {
+			if errors.Is(err, fs.ErrNotExist) {
 				continue
 			}
 			return err
 		}
 
+		r.seekCursor(r.current, file)
+		m, _ := file.(*mergeReader)
+		r.boundaries = append(r.boundaries, fileBoundary{stream: r.returned, day: r.current, offset: fileOffset(file), merge: m})
+
 		r.file = file
+		r.opened = 1
+		if m != nil {
+			r.opened = len(m.files)
+		}
+		r.files.Add(int64(r.opened))
+		r.db.metrics.openFiles.Add(int64(r.opened))
 		return nil
 	}
 }
 
+// finish stops reading and closes the files.
+func (r *reader) finish() {
+	r.unpin()
+	r.done = true
+	r.buf = nil
+	if r.pooled != nil {
+		readBuffers.Put(r.pooled)
+		r.pooled = nil
+	}
+
+	r.Close()
+	if r.prefetch != nil {
+		r.prefetch.close()
+	}
+}
+
 func (r *reader) Close() {
 	if r.file != nil {
 		r.file.Close()
 		r.file = nil
+		r.db.metrics.openFiles.Add(int64(-r.opened))
+		r.opened = 0
 	}
 }
 
-func (r *reader) open(t time.Time) (*os.File, error) {
+// openDay opens the table for the day. If the table is a pattern
+// all the matching tables are opened and merged by time.
+func (r *reader) openDay(t time.Time) (io.ReadCloser, error) {
 	// Close the previous one if exists
 	r.Close()
 
-	path := r.db.getTablePath(t, r.table)
-
-	f, err := os.OpenFile(path, os.O_RDONLY, 0644)
+	f, names, err := r.db.openDay(t, r.table, r.start, r.filter, r.gen)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, err
+		return nil, err
+	}
+
+	if r.span != nil {
+		for _, name := range names {
+			r.span.FileOpened(name)
 		}
-		return nil, fmt.Errorf("timeDB.open: error openning file %s: %v", path, err)
 	}
 	return f, nil
 }
 
+// openDay opens the table for the day and returns the names of the
+// files opened. If the table is a pattern all the matching tables
+// are opened and merged by time. The files that can't contain the
+// filter are skipped.
+func (db *DB) openDay(t time.Time, table string, start time.Time, filter string, gen uint64) (io.ReadCloser, []string, error) {
+	if !isPattern(table) {
+		f, name, err := db.openTable(t, table, start, filter, gen)
+		if err != nil {
+			return nil, nil, err
+		}
+		return f, []string{name}, nil
+	}
+
+	tables, err := db.matchTables(t, table)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(tables) == 0 {
+		return nil, nil, os.ErrNotExist
+	}
+
+	files := make([]io.ReadCloser, 0, len(tables))
+	names := make([]string, 0, len(tables))
+	opened := make([]string, 0, len(tables))
+	for _, table := range tables {
+		f, name, err := db.openTable(t, table, start, filter, gen)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, nil, err
+		}
+		files = append(files, f)
+		names = append(names, name)
+		opened = append(opened, table)
+	}
+
+	m := newMergeReader(files)
+	m.tables = opened
+	return m, names, nil
+}
+
+// openTable opens the table for the day as it was in the generation gen.
+// If start is in the same day the file is moved to the first line after
+// it. If the bloom filter of the day says that it doesn't contain the
+// filter it returns fs.ErrNotExist.
+func (db *DB) openTable(t time.Time, table string, start time.Time, filter string, gen uint64) (fs.File, string, error) {
+	path := db.getTablePath(t, table)
+
+	if f, ok, err := db.openRetired(gen, path); ok {
+		if err != nil {
+			return nil, "", fmt.Errorf("timeDB.open: error openning file %s: %v", path, err)
+		}
+		return f, path, nil
+	}
+
+	if c := db.recent.Load(); c != nil {
+		if f, ok := c.open(t, table, start); ok {
+			return f, path, nil
+		}
+	}
+
+	if filter != "" && db.skipBloom(path, filter) {
+		return nil, "", fs.ErrNotExist
+	}
+
+	f, err := db.openParts(t, path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, "", err
+		}
+		return nil, "", fmt.Errorf("timeDB.open: error openning file %s: %v", path, err)
+	}
+
+	if db.getDir(start) == db.getDir(t) {
+		if err := db.seekStart(f, path, start); err != nil {
+			f.Close()
+			return nil, "", fmt.Errorf("timeDB.open: error seeking file %s: %v", path, err)
+		}
+	}
+
+	return f, path, nil
+}
+
 func (db *DB) reader(start, end time.Time, table string, offset, limit int) *reader {
 	return &reader{
 		db:     db,
@@ -256,51 +621,252 @@ func (db *DB) reader(start, end time.Time, table string, offset, limit int) *rea
 		table:  table,
 		offset: offset,
 		limit:  limit,
+		gen:    db.pin(),
+		pinned: true,
+	}
+}
+
+// unpin releases the data of the generation of the query.
+func (r *reader) unpin() {
+	if r.pinned {
+		r.pinned = false
+		r.db.unpin(r.gen)
 	}
 }
 
-func (db *DB) getDir(t time.Time) string {
-	return filepath.Join(db.Path, t.Format("2006-01-02"))
+// days returns the days that have a directory in the database sorted by date.
+func (db *DB) days() ([]time.Time, error) {
+	return db.storageDays(db.storage)
 }
 
 func (db *DB) getTablePath(t time.Time, table string) string {
-	return filepath.Join(db.getDir(t), table+".log")
+	return path.Join(db.getDir(t), table+".log")
+}
+
+// openAppend opens the table file of the day for appending, creating it if necessary.
+// The caller must hold the lock of the database in exclusive mode.
+func (db *DB) openAppend(t time.Time, table string) (io.WriteCloser, error) {
+	// the records are appended to the last part, which the writer of
+	// the table may have open
+	name := db.getTablePath(t, table)
+	fileName := partName(name, lastPart(localStorage(db.storage), name))
+	db.closeFile(name)
+
+	if err := db.checkArchived(fileName); err != nil {
+		return nil, err
+	}
+
+	// the day could have been compressed
+	if err := db.decompressFile(fileName); err != nil {
+		return nil, fmt.Errorf("timeDB: error openning file %s: %w", fileName, err)
+	}
+	if err := db.repairTail(fileName); err != nil {
+		return nil, fmt.Errorf("timeDB: error openning file %s: %w", fileName, err)
+	}
+
+	f, err := db.storage.Append(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("timeDB: error openning file %s: %w", fileName, err)
+	}
+
+	var size int64
+	if info, err := fs.Stat(localStorage(db.storage), fileName); err == nil {
+		size = info.Size()
+	}
+	if _, err := db.writeHeader(f, size); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("timeDB: error writing file %s: %w", fileName, err)
+	}
+	return f, nil
 }
 
 func (db *DB) save(t time.Time, table, data string, v ...interface{}) error {
+	return db.saveRecord(t, table, data, false, v...)
+}
+
+// saveRecord saves the record. In async mode, if wait is true it returns
+// when the record is written instead of when it is queued.
+func (db *DB) saveRecord(t time.Time, table, data string, wait bool, v ...interface{}) error {
+	t, err := db.checkClock(t, table)
+	if err != nil {
+		db.metrics.writeErrors.Add(1)
+		return err
+	}
+
+	data, stored, ok, err := db.prepare(t, table, data, v...)
+	if err != nil || !ok {
+		return err
+	}
+
+	var written chan error
+	if wait {
+		written = make(chan error, 1)
+	}
+	if queued, err := db.enqueue(batchRecord{time: t, table: table, data: data, stored: stored}, written); queued {
+		if err == nil && wait {
+			err = <-written
+		}
+		return err
+	}
+
+	// the size of the line with the time and the new line
+	if err := db.checkQuota(table, int64(len(stored)+12)); err != nil {
+		db.metrics.writeErrors.Add(1)
+		db.forgetDedup(batchRecord{time: t, table: table, data: data})
+		return err
+	}
+
+	if err := db.write(t, table, stored); err != nil {
+		db.notifyDiskFull(err)
+		db.forgetDedup(batchRecord{time: t, table: table, data: data})
+		return err
+	}
+
+	db.notifyWrite(table, DataPoint{Time: t, Text: data})
+	return nil
+}
+
+// prepare returns the data of a record after the write hooks and how it
+// is stored, encrypted or not. It returns false if a hook dropped it.
+func (db *DB) prepare(t time.Time, table, data string, v ...interface{}) (string, string, bool, error) {
+	if err := validTable(table); err != nil {
+		return "", "", false, err
+	}
+
 	if len(v) > 0 {
 		data = fmt.Sprintf(data, v...)
 	}
 
-	dirName := db.getDir(t)
-	fileName := db.getTablePath(t, table)
+	data, ok := db.runWriteHooks(table, data)
+	if !ok {
+		return "", "", false, nil
+	}
 
-	db.mutex.Lock()
+	if strings.ContainsAny(data, "\r\n") {
+		db.metrics.writeErrors.Add(1)
+		return "", "", false, fmt.Errorf("%w for table %s", ErrNewLine, table)
+	}
 
-	if db.file == nil || db.writePath != fileName {
-		if db.file != nil {
-			db.file.Close()
-			db.file = nil
-		}
+	if d := db.dedup.Load(); d != nil && d.duplicate(t, table, data) {
+		return "", "", false, nil
+	}
 
-		err := os.MkdirAll(dirName, 0777)
+	stored := data
+	if db.keys != nil {
+		var err error
+		stored, err = db.encrypt(t.Unix(), data)
 		if err != nil {
-			return fmt.Errorf("timeDB: error creating dir %s: %v", dirName, err)
+			return "", "", false, err
 		}
+	}
 
-		f, err := os.OpenFile(fileName, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
-		if err != nil {
-			return fmt.Errorf("timeDB.Save: error openning file %s: %v", fileName, err)
+	if max := db.TableOptions(table).MaxLineSize; max > 0 && len(stored) > max {
+		db.metrics.writeErrors.Add(1)
+		return "", "", false, fmt.Errorf("%w for table %s: %d bytes", ErrLineTooLong, table, len(stored))
+	}
+
+	return data, stored, true, nil
+}
+
+func (db *DB) write(t time.Time, table, data string) error {
+	w, unlock := db.lockWriter(table)
+	defer unlock()
+
+	seq, err := db.nextSeq(table)
+	if err != nil {
+		return err
+	}
+
+	line := timeField(t, seq) + " " + data + "\n"
+	if err := db.openWrite(w, t, table, len(line)); err != nil {
+		db.releaseSeq(table, seq)
+		return err
+	}
+
+	n, err := io.WriteString(w.file, line)
+	if err != nil {
+		db.releaseSeq(table, seq)
+		db.metrics.writeErrors.Add(1)
+		return diskFullError(fmt.Errorf("timeDB: error writing data %w", err))
+	}
+
+	db.metrics.fileWrites.Add(1)
+
+	if w.fsync == FsyncAlways {
+		if err := db.syncWriteFile(w); err != nil {
+			db.metrics.writeErrors.Add(1)
+			return diskFullError(fmt.Errorf("timeDB: error syncing data %w", err))
 		}
+	}
 
-		db.file = f
-		db.writePath = fileName
+	w.size += int64(n)
+	if c := db.recent.Load(); c != nil {
+		c.add(table, []byte(line))
 	}
 
-	if _, err := fmt.Fprintf(db.file, "%d %s\n", t.Unix(), data); err != nil {
-		return fmt.Errorf("timeDB: error writing data %v", err)
+	db.metrics.writes.Add(1)
+	db.metrics.bytesWritten.Add(int64(n))
+	db.addUsage(table, w.path, int64(n))
+	return nil
+}
+
+// openWrite opens in the writer the file of the table for the time. If
+// the table has a maximum file size and n more bytes don't fit in it, the
+// records continue in a new part. The caller must hold the lock of the writer.
+func (db *DB) openWrite(w *tableWriter, t time.Time, table string, n int) error {
+	if err := db.openWriteFile(w, t, table, n); err != nil {
+		return err
+	}
+	db.rollover(w, table)
+	return nil
+}
+
+func (db *DB) openWriteFile(w *tableWriter, t time.Time, table string, n int) error {
+	if db.lock != nil && db.lock.mode == LockRead {
+		return ErrReadOnly
+	}
+
+	fileName := db.getTablePath(t, table)
+	if w.file != nil && w.path == fileName {
+		if w.max == 0 || w.size <= db.headerSize() || w.size+int64(n) <= w.max || db.backup.active.Load() {
+			return nil
+		}
+
+		part := w.part + 1
+		db.closeWriter(w)
+		return db.openPart(w, fileName, part, db.TableOptions(table))
 	}
 
-	db.mutex.Unlock()
+	db.closeWriter(w)
+
+	o := db.TableOptions(table)
+
+	part := 0
+	if o.MaxFileSize > 0 {
+		part = lastPart(db.storage, fileName)
+	}
+
+	if err := db.openPart(w, fileName, part, o); err != nil {
+		return err
+	}
+
+	if o.MaxFileSize > 0 && w.size > db.headerSize() && w.size+int64(n) > o.MaxFileSize && !db.backup.active.Load() {
+		db.closeWriter(w)
+		return db.openPart(w, fileName, part+1, o)
+	}
 	return nil
 }
+
+// Close writes the records queued in async mode and closes the files open
+// for writing. The database can still be used, in synchronous mode, and
+// the files are opened again on the next write.
+func (db *DB) Close() error {
+	db.stopAsync()
+	db.closeMirrors()
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.closeFiles(func(string) bool { return true })
+	return db.saveSeqs()
+}
@@ -0,0 +1,124 @@
+package timedb
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Extractor returns the value of a record that is counted by TopK
+// and Distinct. Records with an empty value are ignored.
+type Extractor func(d DataPoint) string
+
+// RegexpExtractor extracts the first group of the expression or the
+// whole match if it has no groups.
+func RegexpExtractor(re *regexp.Regexp) Extractor {
+	return func(d DataPoint) string {
+		m := re.FindStringSubmatch(d.Text)
+		switch len(m) {
+		case 0:
+			return ""
+		case 1:
+			return m[0]
+		default:
+			return m[1]
+		}
+	}
+}
+
+// LabelExtractor extracts a label of the records of a numeric table.
+func LabelExtractor(name string) Extractor {
+	return func(d DataPoint) string {
+		_, labels, err := d.Value()
+		if err != nil {
+			return ""
+		}
+		return labels[name]
+	}
+}
+
+// ValueCount is the number of times that a value appears.
+type ValueCount struct {
+	Value string
+	Count int64
+}
+
+// TopK returns the k most frequent values extracted from the records of
+// the range [start, end) that contain filter. If k is zero all the values
+// are returned. Values with the same count are sorted alphabetically.
+func (db *DB) TopK(table string, start, end time.Time, k int, filter string, extract Extractor) ([]ValueCount, error) {
+	counts, err := db.countValues(table, start, end, filter, extract)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]ValueCount, 0, len(counts))
+	for v, c := range counts {
+		result = append(result, ValueCount{Value: v, Count: c})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Value < result[j].Value
+	})
+
+	if k > 0 && len(result) > k {
+		result = result[:k]
+	}
+	return result, nil
+}
+
+// Distinct returns the distinct values extracted from the records of
+// the range [start, end) that contain filter sorted alphabetically.
+func (db *DB) Distinct(table string, start, end time.Time, filter string, extract Extractor) ([]string, error) {
+	counts, err := db.countValues(table, start, end, filter, extract)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0, len(counts))
+	for v := range counts {
+		result = append(result, v)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func (db *DB) countValues(table string, start, end time.Time, filter string, extract Extractor) (map[string]int64, error) {
+	counts := make(map[string]int64)
+
+	err := db.scanRange(table, start, end, filter, func(d DataPoint) {
+		d.Text = trimText(d.Text)
+		if v := extract(d); v != "" {
+			counts[v]++
+		}
+	})
+
+	return counts, err
+}
+
+// trimText removes the space that separates the time from the text of the records.
+func trimText(text string) string {
+	return strings.TrimPrefix(text, " ")
+}
+
+// scanRange calls fn with the records of the range [start, end) that contain filter.
+func (db *DB) scanRange(table string, start, end time.Time, filter string, fn func(d DataPoint)) error {
+	s := db.Query(table, start, end, 0, 0)
+	defer s.Close()
+
+	s.SetFilter(filter)
+
+	for s.Scan() {
+		d := s.Data()
+		if !d.Time.Before(end) {
+			break
+		}
+		fn(d)
+	}
+
+	return s.Error
+}
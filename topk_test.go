@@ -0,0 +1,55 @@
+package timedb
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestTopK(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i, ip := range []string{"1.1.1.1", "2.2.2.2", "1.1.1.1", "3.3.3.3", "2.2.2.2", "1.1.1.1"} {
+		if err := db.Insert(start.Add(time.Duration(i)*time.Minute), "access", "GET / ip=%s", ip); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	extract := RegexpExtractor(regexp.MustCompile(`ip=(\S+)`))
+
+	top, err := db.TopK("access", start, start.Add(time.Hour), 2, "", extract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(top) != 2 || top[0] != (ValueCount{"1.1.1.1", 3}) || top[1] != (ValueCount{"2.2.2.2", 2}) {
+		t.Fatalf("invalid top %v", top)
+	}
+
+	values, err := db.Distinct("access", start, start.Add(4*time.Minute), "", extract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 3 || values[0] != "1.1.1.1" || values[2] != "3.3.3.3" {
+		t.Fatalf("invalid values %v", values)
+	}
+}
+
+func TestLabelExtractor(t *testing.T) {
+	db := NewMemory()
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for _, host := range []string{"a", "b", "a"} {
+		if err := db.InsertValue(start, "cpu", 1, Labels{"host": host}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	top, err := db.TopK("cpu", start, start.Add(time.Hour), 0, "", LabelExtractor("host"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(top) != 2 || top[0] != (ValueCount{"a", 2}) {
+		t.Fatalf("invalid top %v", top)
+	}
+}
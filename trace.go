@@ -0,0 +1,29 @@
+package timedb
+
+import (
+	"context"
+	"time"
+)
+
+// Tracer receives the events of the queries so they can be traced,
+// for example with OpenTelemetry (see the otel package).
+type Tracer interface {
+	StartQuery(ctx context.Context, table string, start, end time.Time) QuerySpan
+}
+
+// QuerySpan traces a single query.
+type QuerySpan interface {
+	// FileOpened is called for each file opened by the query.
+	FileOpened(name string)
+
+	// End is called when the scanner is closed with the rows returned,
+	// the bytes read from the files and the last error.
+	End(rows, bytes int64, err error)
+}
+
+// SetTracer sets the tracer of the queries.
+func (db *DB) SetTracer(t Tracer) {
+	db.mutex.Lock()
+	db.tracer = t
+	db.mutex.Unlock()
+}
@@ -0,0 +1,52 @@
+package timedb
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type testTracer struct {
+	files []string
+	rows  int64
+	bytes int64
+}
+
+func (t *testTracer) StartQuery(ctx context.Context, table string, start, end time.Time) QuerySpan {
+	return t
+}
+
+func (t *testTracer) FileOpened(name string) {
+	t.files = append(t.files, name)
+}
+
+func (t *testTracer) End(rows, bytes int64, err error) {
+	t.rows = rows
+	t.bytes = bytes
+}
+
+func TestTracer(t *testing.T) {
+	db := NewMemory()
+	tracer := &testTracer{}
+	db.SetTracer(tracer)
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 2; i++ {
+		if err := db.Insert(start.AddDate(0, 0, i), "logs", "v%d", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scanner := db.QueryContext(context.Background(), "logs", start, start.AddDate(0, 0, 1), 0, 0)
+	for scanner.Scan() {
+	}
+	scanner.Close()
+
+	if len(tracer.files) != 2 || tracer.files[1] != "2020-01-02/logs.log" {
+		t.Fatalf("unexpected files %v", tracer.files)
+	}
+
+	if tracer.rows != 2 || tracer.bytes != 28+2*db.headerSize() {
+		t.Fatalf("unexpected rows %d bytes %d", tracer.rows, tracer.bytes)
+	}
+}
@@ -0,0 +1,110 @@
+package timedb
+
+import (
+	"encoding/json"
+	"fmt"
+	"iter"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Codec converts the values of a typed table to the text of the records.
+// The text can't contain new lines.
+type Codec[T any] interface {
+	Encode(v T) (string, error)
+	Decode(text string) (T, error)
+}
+
+// JSONCodec encodes the values as JSON. It is the codec of the types
+// that don't have one registered.
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Encode(v T) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+func (JSONCodec[T]) Decode(text string) (T, error) {
+	var v T
+	err := json.Unmarshal([]byte(text), &v)
+	return v, err
+}
+
+var codecs sync.Map
+
+// RegisterCodec sets the codec of the tables of type T created after it.
+func RegisterCodec[T any](c Codec[T]) {
+	codecs.Store(reflect.TypeFor[T](), c)
+}
+
+// Record is a value of a typed table.
+type Record[T any] struct {
+	Time  time.Time
+	Value T
+}
+
+// Table reads and writes values of type T instead of text.
+type Table[T any] struct {
+	db    *DB
+	name  string
+	codec Codec[T]
+}
+
+// NewTable returns the typed table with the given name. The values are
+// encoded with the codec registered for T or as JSON.
+func NewTable[T any](db *DB, name string) *Table[T] {
+	var codec Codec[T] = JSONCodec[T]{}
+	if c, ok := codecs.Load(reflect.TypeFor[T]()); ok {
+		codec = c.(Codec[T])
+	}
+	return &Table[T]{db: db, name: name, codec: codec}
+}
+
+// Name returns the name of the table.
+func (t *Table[T]) Name() string {
+	return t.name
+}
+
+// Save writes the value at the given time.
+func (t *Table[T]) Save(tm time.Time, v T) error {
+	text, err := t.codec.Encode(v)
+	if err != nil {
+		return fmt.Errorf("timeDB: error encoding the value of %s: %v", t.name, err)
+	}
+	if strings.ContainsAny(text, "\r\n") {
+		return fmt.Errorf("timeDB: the value of %s contains new lines", t.name)
+	}
+	return t.db.save(tm, t.name, text)
+}
+
+// Query returns the values of the range [start, end). The iteration
+// stops after the first error.
+func (t *Table[T]) Query(start, end time.Time) iter.Seq2[Record[T], error] {
+	return func(yield func(Record[T], error) bool) {
+		s := t.db.Query(t.name, start, end, 0, 0)
+		defer s.Close()
+
+		for s.Scan() {
+			d := s.Data()
+			if !d.Time.Before(end) {
+				return
+			}
+
+			v, err := t.codec.Decode(trimText(d.Text))
+			if err != nil {
+				yield(Record[T]{Time: d.Time}, fmt.Errorf("timeDB: error decoding the value of %s: %v", t.name, err))
+				return
+			}
+
+			if !yield(Record[T]{Time: d.Time, Value: v}, nil) {
+				return
+			}
+		}
+
+		if s.Error != nil {
+			yield(Record[T]{}, s.Error)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package timedb
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+type request struct {
+	Path   string
+	Status int
+}
+
+type celsius float64
+
+type celsiusCodec struct{}
+
+func (celsiusCodec) Encode(v celsius) (string, error) {
+	return strconv.FormatFloat(float64(v), 'f', 1, 64) + "C", nil
+}
+
+func (celsiusCodec) Decode(text string) (celsius, error) {
+	v, err := strconv.ParseFloat(text[:len(text)-1], 64)
+	return celsius(v), err
+}
+
+func TestTable(t *testing.T) {
+	db := NewMemory()
+	requests := NewTable[request](db, "requests")
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 3; i++ {
+		if err := requests.Save(start.Add(time.Duration(i)*time.Second), request{Path: "/", Status: 200 + i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []Record[request]
+	for r, err := range requests.Query(start, start.Add(2*time.Second)) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, r)
+	}
+
+	if len(got) != 2 || got[1].Value.Status != 201 || !got[1].Time.Equal(start.Add(time.Second)) {
+		t.Fatalf("unexpected records %v", got)
+	}
+
+	// stop early
+	for range requests.Query(start, start.AddDate(0, 0, 1)) {
+		break
+	}
+
+	// invalid values are returned as errors
+	if err := db.Insert(start.Add(time.Minute), "requests", "x"); err != nil {
+		t.Fatal(err)
+	}
+	var failed bool
+	for _, err := range requests.Query(start, start.AddDate(0, 0, 1)) {
+		failed = err != nil
+	}
+	if !failed {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestTableCodec(t *testing.T) {
+	RegisterCodec[celsius](celsiusCodec{})
+
+	db := NewMemory()
+	temps := NewTable[celsius](db, "temp")
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	if err := temps.Save(start, 21.5); err != nil {
+		t.Fatal(err)
+	}
+
+	s := db.Query("temp", start, start, 0, 0)
+	defer s.Close()
+	if !s.Scan() || trimText(s.Data().Text) != "21.5C" {
+		t.Fatalf("unexpected data %v", s.Data())
+	}
+
+	for r, err := range temps.Query(start, start.Add(time.Hour)) {
+		if err != nil || r.Value != 21.5 {
+			t.Fatalf("unexpected record %v %v", r, err)
+		}
+	}
+}
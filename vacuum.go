@@ -0,0 +1,51 @@
+package timedb
+
+import "time"
+
+// VacuumReport is the result of Vacuum.
+type VacuumReport struct {
+	// Dirs is the number of directories removed.
+	Dirs int
+
+	// Bytes is the size of the directories removed as reported by
+	// the file system. It is zero for the storages that don't have
+	// real directories.
+	Bytes int64
+
+	Duration time.Duration
+}
+
+// Vacuum removes the directories of the days and tables that don't have
+// files, that are left after deleting data.
+func (db *DB) Vacuum() (VacuumReport, error) {
+	start := time.Now()
+
+	unlock, err := db.lockMaintenance()
+	if err != nil {
+		return VacuumReport{}, err
+	}
+	defer unlock()
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	local := localStorage(db.storage)
+
+	dayList, err := db.storageDays(local)
+	if err != nil {
+		return VacuumReport{}, err
+	}
+
+	var r VacuumReport
+	for _, day := range dayList {
+		n, b := removeDayDir(local, db.getDir(day))
+		r.Dirs += n
+		r.Bytes += b
+	}
+
+	r.Duration = time.Since(start)
+	if r.Dirs > 0 {
+		db.log().Info("timedb: vacuum", "dirs", r.Dirs, "bytes", r.Bytes)
+	}
+	return r, nil
+}
@@ -0,0 +1,41 @@
+package timedb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVacuum(t *testing.T) {
+	dir := t.TempDir()
+	db := New(dir)
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	if err := db.Insert(start, "log", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a day and a nested table left empty
+	for _, d := range []string{"2020-01-02", "2020-01-01/prod/web"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := db.Vacuum()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Dirs != 3 {
+		t.Fatalf("expected 3 directories, got %d", r.Dirs)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "2020-01-01", "log.log")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "2020-01-02")); !os.IsNotExist(err) {
+		t.Fatal("the empty day should be removed")
+	}
+}
@@ -0,0 +1,152 @@
+package timedb
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// maxWriteFiles is the number of files open for writing above which the
+// files of the tables that are not being written are closed.
+const maxWriteFiles = 128
+
+// The writes take the lock of the database in shared mode and the lock of
+// the writer of their table, so different tables are appended in parallel.
+// The tasks that replace or delete files take the lock of the database in
+// exclusive mode and can use all the writers without their locks.
+
+// tableWriter is the file open for writing of a table.
+type tableWriter struct {
+	mutex sync.Mutex
+	file  io.WriteCloser
+	path  string
+	part  int
+	size  int64
+	max   int64
+	fsync FsyncPolicy
+}
+
+type writers struct {
+	// mutex protects the map of writers and the current files
+	// of the tables (see rollover).
+	mutex  sync.Mutex
+	tables map[string]*tableWriter
+	active string
+}
+
+// writer returns the writer of the table. The caller must hold the
+// lock of the database.
+func (db *DB) writer(table string) *tableWriter {
+	ws := &db.writers
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+
+	w, ok := ws.tables[table]
+	if !ok {
+		if ws.tables == nil {
+			ws.tables = make(map[string]*tableWriter)
+		}
+		w = &tableWriter{}
+		ws.tables[table] = w
+	}
+	return w
+}
+
+// lockWriter takes the locks to write to the table, counting the time
+// waiting for them. The returned function releases them.
+func (db *DB) lockWriter(table string) (*tableWriter, func()) {
+	db.repairTails()
+
+	start := time.Now()
+	db.mutex.RLock()
+	w := db.writer(table)
+	w.mutex.Lock()
+	db.metrics.lockWait.Add(int64(time.Since(start)))
+
+	return w, func() {
+		w.mutex.Unlock()
+		db.mutex.RUnlock()
+	}
+}
+
+// syncWriteFile syncs the file of the writer. The caller must hold its lock.
+func (db *DB) syncWriteFile(w *tableWriter) error {
+	start := time.Now()
+	err := syncFile(w.file)
+	db.metrics.fsyncs.Add(1)
+	db.metrics.fsyncTime.Add(int64(time.Since(start)))
+	return err
+}
+
+// closeWriter closes the file of the writer. The caller must hold its lock.
+func (db *DB) closeWriter(w *tableWriter) {
+	if w.file == nil {
+		return
+	}
+
+	if w.fsync == FsyncOnClose {
+		if err := db.syncWriteFile(w); err != nil {
+			db.log().Warn("timedb: error syncing file", "file", w.path, "error", err)
+		}
+	}
+	if err := w.file.Close(); err != nil {
+		db.log().Warn("timedb: error closing file", "file", w.path, "error", err)
+	}
+
+	db.writers.mutex.Lock()
+	if db.writers.active == w.path {
+		db.writers.active = ""
+	}
+	db.writers.mutex.Unlock()
+
+	w.file = nil
+	w.path = ""
+	db.metrics.openFiles.Add(-1)
+}
+
+// closeFile closes the data file if it is open for writing. The caller
+// must hold the lock of the database in exclusive mode.
+func (db *DB) closeFile(name string) {
+	db.closeFiles(func(p string) bool { return p == name })
+}
+
+// closeFiles closes the files open for writing that match. The caller
+// must hold the lock of the database in exclusive mode.
+func (db *DB) closeFiles(match func(name string) bool) {
+	for _, w := range db.allWriters() {
+		if w.file != nil && match(w.path) {
+			db.closeWriter(w)
+		}
+	}
+}
+
+// allWriters returns the writers of all the tables.
+func (db *DB) allWriters() []*tableWriter {
+	ws := &db.writers
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+
+	all := make([]*tableWriter, 0, len(ws.tables))
+	for _, w := range ws.tables {
+		all = append(all, w)
+	}
+	return all
+}
+
+// closeIdle closes the files of the tables that are not being written
+// if there are too many open. The caller must hold the lock of w.
+func (db *DB) closeIdle(w *tableWriter) {
+	if db.metrics.openFiles.Load() <= maxWriteFiles {
+		return
+	}
+
+	for _, o := range db.allWriters() {
+		if db.metrics.openFiles.Load() <= maxWriteFiles {
+			return
+		}
+		if o != w && o.mutex.TryLock() {
+			db.closeWriter(o)
+			o.mutex.Unlock()
+		}
+	}
+}
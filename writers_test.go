@@ -0,0 +1,83 @@
+package timedb
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParallelWriters(t *testing.T) {
+	db := New(t.TempDir())
+	if err := db.SetTableOptions("t0", TableOptions{Sequence: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			table := fmt.Sprintf("t%d", w%4)
+			for i := 0; i < 100; i++ {
+				var err error
+				if i%10 == 0 {
+					b := db.NewBatch()
+					b.Insert(start, table, "b%d", i)
+					b.Insert(start, table, "b%d", i)
+					err = b.Commit()
+				} else {
+					err = db.Insert(start, table, "%d", i)
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for i := 0; i < 4; i++ {
+		if n := countRecords(t, db, fmt.Sprintf("t%d", i), start); n != 220 {
+			t.Fatalf("t%d: expected 220 records, got %d", i, n)
+		}
+	}
+
+	if st := db.Stats(); st.OpenFiles != 4 {
+		t.Fatalf("expected 4 open files, got %d", st.OpenFiles)
+	}
+
+	// the sequence numbers don't repeat
+	s := db.Query("t0", start, start, 0, 0)
+	seen := make(map[uint64]bool)
+	for s.Scan() {
+		if seq := s.Data().Seq; seen[seq] || seq == 0 {
+			t.Fatalf("repeated sequence %d", seq)
+		}
+		seen[s.Data().Seq] = true
+	}
+	s.Close()
+
+	db.Close()
+	if st := db.Stats(); st.OpenFiles != 0 || st.ActiveFile != "" {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+func TestCloseIdleWriters(t *testing.T) {
+	db := New(t.TempDir())
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < maxWriteFiles+10; i++ {
+		if err := db.Insert(start, fmt.Sprintf("t%d", i), "x"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := db.Stats().OpenFiles; n > maxWriteFiles {
+		t.Fatalf("%d files open", n)
+	}
+}